@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How many entries the activity log keeps unless retain_activity says
+// otherwise, and shows
+const maxActivityEntries = 500
+
+// Kinds of activity
+const (
+	activitySave    = "save"
+	activityRestore = "restore"
+	activityUndo    = "undo"
+	activityTrigger = "trigger"
+)
+
+// activityEntry is one thing wisa did, for answering why the windows just
+// moved
+type activityEntry struct {
+	At          time.Time
+	Kind        string
+	ProfileName string
+	// Source is what started it, e.g. window, hotkey or display
+	Source string
+	Detail string
+	// Error is empty when it went fine
+	Error string
+}
+
+// Adds an entry to the activity log and drops the oldest ones. Failing to
+// log is only logged, it never fails what was being logged.
+func logActivity(db *sql.DB, kind, profileName, source, detail string, err error) {
+	var errText string
+	if err != nil {
+		errText = err.Error()
+	}
+	_, dbErr := db.Exec(
+		"INSERT INTO activity_log (at, kind, profile_name, source, detail, error) VALUES (?, ?, ?, ?, ?, ?)",
+		time.Now(), kind, profileName, source, detail, errText,
+	)
+	if dbErr != nil {
+		log.Printf("Error writing activity log: %v", dbErr)
+		return
+	}
+
+	if dbErr = pruneActivity(db); dbErr != nil {
+		log.Printf("Error applying retention: %v", dbErr)
+	}
+}
+
+// Gets the newest entries of the activity log, newest first
+func getActivity(db *sql.DB, limit int) ([]activityEntry, error) {
+	rows, err := db.Query(
+		"SELECT at, kind, profile_name, source, detail, error FROM activity_log ORDER BY id DESC LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying activity log: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []activityEntry
+	for rows.Next() {
+		var entry activityEntry
+		if err := rows.Scan(&entry.At, &entry.Kind, &entry.ProfileName, &entry.Source, &entry.Detail, &entry.Error); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return entries, nil
+}
+
+// Counts the outcomes of a restore, e.g. 3 moved, 1 not found
+func summarizeResults(results []restoreResult) string {
+	counts := make(map[restoreOutcome]int)
+	for _, result := range results {
+		counts[result.Outcome]++
+	}
+	var parts []string
+	for _, outcome := range []restoreOutcome{outcomeMoved, outcomeInPlace, outcomeNotFound, outcomeAppNotRunning, outcomePermissionDenied, outcomeFailed} {
+		if counts[outcome] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[outcome], outcome))
+		}
+	}
+	if onScreen := countOnScreen(results); onScreen > 0 {
+		parts = append(parts, fmt.Sprintf("%d brought on screen", onScreen))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Counts the windows that would have landed off screen
+func countOnScreen(results []restoreResult) int {
+	count := 0
+	for _, result := range results {
+		if result.OnScreen {
+			count++
+		}
+	}
+	return count
+}
+
+// Logs a restore with what happened to its windows
+func logRestoreActivity(db *sql.DB, profileName string, opts restoreOptions, count int, results []restoreResult, hookErr, err error) {
+	detail := fmt.Sprintf("%d windows", count)
+	if count > 0 {
+		detail = summarizeResults(results)
+	}
+	if hookErr != nil {
+		detail += "; " + strings.ReplaceAll(hookErr.Error(), "\n", "; ")
+	}
+	if len(opts.Windows) > 0 {
+		detail = "selected windows: " + detail
+	}
+	// Windows that failed are in the detail already
+	var restoreErr *RestoreError
+	if errors.As(err, &restoreErr) {
+		err = nil
+	}
+	logActivity(db, activityRestore, profileName, opts.Source, detail, err)
+}
+
+func describeActivity(entry activityEntry) string {
+	text := fmt.Sprintf("%s  %s '%s'", entry.At.Format("Jan 2 15:04:05"), entry.Kind, entry.ProfileName)
+	if entry.Source != "" {
+		text += " by " + entry.Source
+	}
+	if entry.Detail != "" {
+		text += ": " + entry.Detail
+	}
+	return text
+}
+
+// Shows the recent saves, restores and triggers, newest first
+func showActivityDialog(db *sql.DB, parent fyne.Window) {
+	var entries []activityEntry
+	list := widget.NewList(
+		func() int {
+			return len(entries)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			entry := entries[id]
+			label := item.(*widget.Label)
+			if entry.Error != "" {
+				label.SetText("✗ " + describeActivity(entry) + " — " + entry.Error)
+				label.Importance = widget.DangerImportance
+			} else {
+				label.SetText("✓ " + describeActivity(entry))
+				label.Importance = widget.MediumImportance
+			}
+			label.Refresh()
+		},
+	)
+
+	summary := widget.NewLabel("")
+	refresh := func() {
+		var err error
+		entries, err = getActivity(db, maxActivityEntries)
+		switch {
+		case err != nil:
+			summary.SetText(fmt.Sprintf("Error: %v", err))
+		case len(entries) == 0:
+			summary.SetText("Nothing has been saved or restored yet")
+		default:
+			summary.SetText(fmt.Sprintf("The last %d things wisa did, newest first", len(entries)))
+		}
+		list.Refresh()
+	}
+	refresh()
+
+	content := container.NewBorder(summary, widget.NewButton("Refresh", refresh), nil, nil, list)
+	d := dialog.NewCustom("Activity", "Close", content, parent)
+	d.Resize(fyne.NewSize(680, 460))
+	d.Show()
+}
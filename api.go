@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Port the local API listens on when it was never set
+const defaultAPIPort = 7765
+
+// apiServer answers the local API, for scripts and launchers such as
+// Raycast, Alfred or a Stream Deck. It only listens on localhost and every
+// request needs a token, see tokens.go.
+type apiServer struct {
+	engine *restoreEngine
+	hooks  triggerHooks
+}
+
+// Starts the local API if it's turned on. Failing to listen is logged, e.g.
+// when the daemon already has the port.
+func startAPIServer(engine *restoreEngine, hooks triggerHooks) {
+	if !getBoolSetting(engine.db, settingAPIEnabled, false) {
+		return
+	}
+	port, err := strconv.Atoi(getSetting(engine.db, settingAPIPort, strconv.Itoa(defaultAPIPort)))
+	if err != nil {
+		port = defaultAPIPort
+	}
+
+	server := &apiServer{engine: engine, hooks: hooks}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /profiles", server.require(scopeRead, server.listProfiles))
+	mux.HandleFunc("GET /profiles/{name}", server.require(scopeRead, server.getProfile))
+	mux.HandleFunc("POST /profiles/{name}/restore", server.require(scopeRestore, server.restoreProfile))
+	mux.HandleFunc("POST /profiles/{name}/save", server.require(scopeAdmin, server.saveProfile))
+	mux.HandleFunc("DELETE /profiles/{name}", server.require(scopeAdmin, server.deleteProfile))
+	mux.HandleFunc("POST /capture", server.require(scopeRead, server.capture))
+	mux.HandleFunc("GET /queue", server.require(scopeRead, server.queue))
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		log.Printf("Error starting local API: %v", err)
+		return
+	}
+	log.Printf("Local API listening on %s", listener.Addr())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Printf("Error serving local API: %v", err)
+		}
+	}()
+}
+
+// Rejects requests without a token that covers the scope
+func (s *apiServer) require(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing bearer token"))
+			return
+		}
+		t, err := lookupAPIToken(s.engine.db, token)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if t == nil {
+			writeAPIError(w, http.StatusUnauthorized, errors.New("unknown token"))
+			return
+		}
+		if !t.allows(scope) {
+			writeAPIError(w, http.StatusForbidden, fmt.Errorf("token '%s' can't %s", t.Name, scope))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func writeAPIJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error writing API response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeAPIJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// Finds the profile a request names, in any case, writing a 404 if the user
+// can't see it
+func (s *apiServer) profileName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := r.PathValue("name")
+	profiles, err := getProfiles(s.engine.db)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return "", false
+	}
+	for _, profile := range profiles {
+		if strings.EqualFold(profile, canonicalProfileName(name)) {
+			return profile, true
+		}
+	}
+	writeAPIError(w, http.StatusNotFound, fmt.Errorf("profile %s not found", name))
+	return "", false
+}
+
+// GET /profiles lists the profiles, filtered by the search, app, role,
+// updated_after and updated_before parameters and paged by limit and offset
+func (s *apiServer) listProfiles(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := profileQuery{
+		Search: params.Get("search"),
+		App:    params.Get("app"),
+		Role:   params.Get("role"),
+	}
+	var err error
+	for name, target := range map[string]*time.Time{"updated_after": &query.UpdatedAfter, "updated_before": &query.UpdatedBefore} {
+		if value := params.Get(name); value != "" {
+			if *target, err = parseQueryDate(value); err != nil {
+				writeAPIError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+	for name, target := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+		if value := params.Get(name); value != "" {
+			if *target, err = strconv.Atoi(value); err != nil || *target < 0 {
+				writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid %s %q", name, value))
+				return
+			}
+		}
+	}
+
+	profiles, total, err := queryProfiles(s.engine.db, query)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if profiles == nil {
+		profiles = []profileSummary{}
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{"profiles": profiles, "total": total})
+}
+
+// GET /profiles/{name} gets the windows the profile restores on the
+// connected displays
+func (s *apiServer) getProfile(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.profileName(w, r)
+	if !ok {
+		return
+	}
+	db := s.engine.db
+	states, err := loadWindowStates(db, name, currentArrangement(s.engine.backend))
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	revision, err := getProfileRevision(db, name)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+		"name":     name,
+		"revision": revision,
+		"windows":  states,
+	})
+}
+
+// POST /profiles/{name}/restore queues a restore and waits for it to run
+func (s *apiServer) restoreProfile(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.profileName(w, r)
+	if !ok {
+		return
+	}
+
+	type result struct {
+		count int
+		err   error
+	}
+	done := make(chan result, 1)
+	s.engine.Enqueue(name, "api", restoreOptions{}, func(count int, err error) {
+		if s.hooks.Notify != nil {
+			s.hooks.Notify(name, count, err)
+		}
+		done <- result{count, err}
+	})
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			writeAPIError(w, http.StatusInternalServerError, res.err)
+			return
+		}
+		writeAPIJSON(w, http.StatusOK, map[string]interface{}{"profile": name, "restored": res.count})
+	case <-r.Context().Done():
+		// The restore still runs, the client just stopped waiting
+	}
+}
+
+// POST /profiles/{name}/save captures the open windows into a profile,
+// creating it if needed. A "revision" query parameter makes the save fail
+// with 409 if the profile changed since that revision.
+func (s *apiServer) saveProfile(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	revision := anyRevision
+	if value := r.URL.Query().Get("revision"); value != "" {
+		var err error
+		revision, err = strconv.Atoi(value)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid revision %q", value))
+			return
+		}
+	}
+
+	backend := s.engine.backend
+	states := captureForSave(backend)
+	err := saveWindowStatesAt(s.engine.db, name, currentArrangement(backend), states, revision)
+	if s.hooks.Saved != nil {
+		s.hooks.Saved(name, len(states), err)
+	}
+	var stale *staleRevisionError
+	if errors.As(err, &stale) {
+		writeAPIError(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	current, err := getProfileRevision(s.engine.db, name)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{"profile": name, "saved": len(states), "revision": current})
+}
+
+// DELETE /profiles/{name} moves a profile to Recently Deleted
+func (s *apiServer) deleteProfile(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.profileName(w, r)
+	if !ok {
+		return
+	}
+	if err := deleteProfile(s.engine.db, name); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /capture returns the open windows without saving them
+func (s *apiServer) capture(w http.ResponseWriter, r *http.Request) {
+	backend := s.engine.backend
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{
+		"arrangement": currentArrangement(backend),
+		"captured_at": time.Now(),
+		"windows":     captureStates(backend),
+	})
+}
+
+// GET /queue shows the restore that's running and the ones waiting
+func (s *apiServer) queue(w http.ResponseWriter, r *http.Request) {
+	state := s.engine.QueueState()
+	var running interface{}
+	if state.Running != nil {
+		running = map[string]interface{}{"profile": state.Running.ProfileName, "sources": state.Running.Sources}
+	}
+	pending := []map[string]interface{}{}
+	for _, request := range state.Pending {
+		pending = append(pending, map[string]interface{}{"profile": request.ProfileName, "sources": request.Sources})
+	}
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{"running": running, "pending": pending})
+}
@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WindowBackend captures and restores window positions for one platform's
+// window manager. Each supported OS provides its own implementation through
+// newBackend.
+type WindowBackend interface {
+	// Capture returns the position and size of every visible window
+	Capture() []WindowState
+	// Restore moves and resizes the matching windows back to the saved
+	// states, stopping early when ctx is cancelled
+	Restore(ctx context.Context, states []WindowState) error
+}
+
+// errWindowNotFound is a backend's failure for a saved window it found no
+// open window for
+var errWindowNotFound = errors.New("window not found")
+
+// RestoreFailure records a window that couldn't be moved back into place
+type RestoreFailure struct {
+	State WindowState
+	Err   error
+}
+
+// RestoreError is returned by Restore when some of the windows failed
+type RestoreError struct {
+	Failures []RestoreFailure
+	Total    int
+	// Results has what happened to every window, filled in once the
+	// restore has been checked, see restoreStatesWithResults
+	Results []restoreResult
+}
+
+func (e *RestoreError) Error() string {
+	return fmt.Sprintf("failed to restore %d of %d windows", len(e.Failures), e.Total)
+}
+
+// WindowRaiser is implemented by backends that can bring a window to the
+// front, which is used to rebuild the saved stacking order
+type WindowRaiser interface {
+	Raise(state WindowState) error
+}
+
+// errUnsupportedPlatform is returned by backends on platforms wisa can't drive
+var errUnsupportedPlatform = errors.New("window management is not supported on this platform")
+
+// Highlighter is implemented by backends that can briefly flash the
+// destination rectangles of a profile on screen before restoring it
+type Highlighter interface {
+	Highlight(states []WindowState, duration time.Duration) error
+}
+
+// WindowPicker is implemented by backends that can wait for the user to click
+// on a window and report which one was clicked
+type WindowPicker interface {
+	PickWindow(timeout time.Duration) (WindowState, error)
+}
+
+// errPickTimeout is returned when no window was clicked in time
+var errPickTimeout = errors.New("no window was clicked in time")
+
+// Finds the window under a screen point, preferring windows of preferApp
+// (usually the app that came to the front because of the click) and
+// otherwise the smallest window containing the point
+func windowAtPoint(states []WindowState, x, y float64, preferApp string) (WindowState, bool) {
+	var best WindowState
+	var found bool
+	for _, state := range states {
+		if x < state.X || y < state.Y || x > state.X+state.Width || y > state.Y+state.Height {
+			continue
+		}
+
+		if !found {
+			best, found = state, true
+			continue
+		}
+
+		bestPreferred := best.AppName == preferApp
+		preferred := state.AppName == preferApp
+		if preferred && !bestPreferred {
+			best = state
+		} else if preferred == bestPreferred && state.Width*state.Height < best.Width*best.Height {
+			best = state
+		}
+	}
+	return best, found
+}
+
+// Display is one connected screen, in the same global coordinate space the
+// backend uses for window positions
+type Display struct {
+	ID     string
+	Index  int
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// DisplayLister is implemented by backends that can enumerate displays
+type DisplayLister interface {
+	Displays() ([]Display, error)
+}
+
+// Builds a fingerprint of a display arrangement from the resolution and
+// position of each display, so "docked" and "laptop only" setups differ
+func arrangementFingerprint(displays []Display) string {
+	parts := make([]string, 0, len(displays))
+	for _, display := range displays {
+		parts = append(parts, fmt.Sprintf("%.0fx%.0f@%.0f,%.0f", display.Width, display.Height, display.X, display.Y))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ";")
+}
+
+// Gets the fingerprint of the displays connected right now, or "" if the
+// backend can't list displays
+func currentArrangement(backend WindowBackend) string {
+	lister, ok := backend.(DisplayLister)
+	if !ok {
+		return ""
+	}
+
+	displays, err := lister.Displays()
+	if err != nil {
+		log.Printf("Error listing displays: %v", err)
+		return ""
+	}
+	return arrangementFingerprint(displays)
+}
+
+// Moves states saved on a display that has moved since to where it is now,
+// so windows stay on the same screen
+func placeOnDisplays(states []WindowState, displays []Display) []WindowState {
+	adjusted := make([]WindowState, len(states))
+	copy(adjusted, states)
+	for i, state := range adjusted {
+		if state.DisplayID == "" {
+			continue
+		}
+		for _, display := range displays {
+			if display.ID == state.DisplayID {
+				adjusted[i].X += display.X - state.DisplayX
+				adjusted[i].Y += display.Y - state.DisplayY
+				adjusted[i].DisplayX = display.X
+				adjusted[i].DisplayY = display.Y
+				break
+			}
+		}
+	}
+	return adjusted
+}
+
+// How much of a window's width and height has to be on a display for it to
+// be left where it is, enough to grab it
+const minOnScreen = 40
+
+// Brings windows that would land off every display, say because the monitor
+// they were saved on is gone, onto the display nearest to them, shrinking
+// them to fit if needed. Reports which ones were moved.
+func clampToDisplays(states []WindowState, displays []Display) ([]WindowState, []bool) {
+	clamped := make([]bool, len(states))
+	if len(displays) == 0 {
+		return states, clamped
+	}
+
+	adjusted := make([]WindowState, len(states))
+	copy(adjusted, states)
+	for i, state := range adjusted {
+		if onScreen(state, displays) {
+			continue
+		}
+
+		display := nearestDisplay(state, displays)
+		width := math.Min(state.Width, display.Width)
+		height := math.Min(state.Height, display.Height)
+		adjusted[i].X = math.Max(display.X, math.Min(state.X, display.X+display.Width-width))
+		adjusted[i].Y = math.Max(display.Y, math.Min(state.Y, display.Y+display.Height-height))
+		adjusted[i].Width = width
+		adjusted[i].Height = height
+		clamped[i] = true
+	}
+	return adjusted, clamped
+}
+
+// Checks whether enough of a window is on one of the displays to reach it
+func onScreen(state WindowState, displays []Display) bool {
+	for _, display := range displays {
+		overlapX := math.Min(state.X+state.Width, display.X+display.Width) - math.Max(state.X, display.X)
+		overlapY := math.Min(state.Y+state.Height, display.Y+display.Height) - math.Max(state.Y, display.Y)
+		if overlapX >= math.Min(minOnScreen, state.Width) && overlapY >= math.Min(minOnScreen, state.Height) {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds the display closest to the center of a window
+func nearestDisplay(state WindowState, displays []Display) Display {
+	cx := state.X + state.Width/2
+	cy := state.Y + state.Height/2
+	best := displays[0]
+	bestDistance := math.Inf(1)
+	for _, display := range displays {
+		dx := cx - math.Max(display.X, math.Min(cx, display.X+display.Width))
+		dy := cy - math.Max(display.Y, math.Min(cy, display.Y+display.Height))
+		if distance := dx*dx + dy*dy; distance < bestDistance {
+			best, bestDistance = display, distance
+		}
+	}
+	return best
+}
+
+// Finds the display containing the center of a window, or the first display
+// if the window is entirely off-screen
+func displayFor(state WindowState, displays []Display) (Display, bool) {
+	if len(displays) == 0 {
+		return Display{}, false
+	}
+
+	cx := state.X + state.Width/2
+	cy := state.Y + state.Height/2
+	for _, display := range displays {
+		if cx >= display.X && cx < display.X+display.Width && cy >= display.Y && cy < display.Y+display.Height {
+			return display, true
+		}
+	}
+	return displays[0], true
+}
+
+// Records the display each window is on
+func tagDisplays(backend WindowBackend, states []WindowState) {
+	lister, ok := backend.(DisplayLister)
+	if !ok {
+		return
+	}
+
+	displays, err := lister.Displays()
+	if err != nil {
+		log.Printf("Error listing displays: %v", err)
+		return
+	}
+
+	for i := range states {
+		if display, ok := displayFor(states[i], displays); ok {
+			states[i].DisplayID = display.ID
+			states[i].DisplayX = display.X
+			states[i].DisplayY = display.Y
+			states[i].DisplayWidth = display.Width
+			states[i].DisplayHeight = display.Height
+		}
+	}
+}
+
+// Captures the current windows along with the display each one is on,
+// answering from the live window index when it's up to date. Apps left out
+// by the capture filter are dropped.
+func captureStates(backend WindowBackend) []WindowState {
+	if states, ok := liveWindows.Snapshot(); ok {
+		return filterCapturedApps(states)
+	}
+	return filterCapturedApps(sweepStates(backend))
+}
+
+// Captures the current windows the way captureStates does but always from
+// the backend, for when the index being a few seconds behind matters
+func freshStates(backend WindowBackend) []WindowState {
+	return filterCapturedApps(sweepStates(backend))
+}
+
+// Captures the current windows from the backend
+func sweepStates(backend WindowBackend) []WindowState {
+	states := backend.Capture()
+	tagDisplays(backend, states)
+	indexByApp(states)
+	sortStates(states)
+	assignUIDs(states)
+	return states
+}
+
+// Puts states in a fixed order so capturing the same windows twice stores
+// them the same way, whatever order the window server listed them in
+func sortStates(states []WindowState) {
+	sort.SliceStable(states, func(i, j int) bool {
+		a, b := states[i], states[j]
+		if a.AppName != b.AppName {
+			return a.AppName < b.AppName
+		}
+		if a.WindowTitle != b.WindowTitle {
+			return a.WindowTitle < b.WindowTitle
+		}
+		return a.AppIndex < b.AppIndex
+	})
+}
+
+// Gives states without one a stable ID made from the app, the title and
+// which of the windows with that app and title it is
+func assignUIDs(states []WindowState) {
+	seen := make(map[windowKey]int)
+	for i := range states {
+		key := keyOf(states[i])
+		index := seen[key]
+		seen[key]++
+		if states[i].UID != "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d", key.AppName, key.WindowTitle, index)))
+		states[i].UID = hex.EncodeToString(sum[:8])
+	}
+}
+
+// Moves saved windows along with their display if it has moved in the
+// arrangement since they were captured, then restores them
+func restoreStates(backend WindowBackend, states []WindowState) error {
+	_, err := restoreStatesWithResults(context.Background(), backend, states)
+	return err
+}
+
+// What happened to one window in a restore
+type restoreOutcome string
+
+const (
+	outcomeMoved    restoreOutcome = "moved"
+	outcomeInPlace  restoreOutcome = "already in place"
+	outcomeNotFound restoreOutcome = "not found"
+	outcomeFailed   restoreOutcome = "failed"
+	// The window's app isn't running, so there was nothing to move
+	outcomeAppNotRunning restoreOutcome = "app not running"
+	// The OS didn't let wisa move the window
+	outcomePermissionDenied restoreOutcome = "permission denied"
+)
+
+// restoreResult is the outcome of restoring one saved window state
+type restoreResult struct {
+	State   WindowState
+	Outcome restoreOutcome
+	Err     error
+	// OnScreen is set when the window would have landed off screen and was
+	// brought onto a display instead
+	OnScreen bool
+	// TitleChanged is set when the window was only found under another
+	// title, or wasn't found by its title while its app was running
+	TitleChanged bool
+}
+
+// Whether the window ended up where it was saved
+func (r restoreResult) Restored() bool {
+	return r.Outcome == outcomeMoved || r.Outcome == outcomeInPlace
+}
+
+// Errors the platforms give when wisa isn't allowed to control a window:
+// missing Accessibility or Automation access on macOS, elevated windows on
+// Windows
+var permissionErrors = []string{"-1719", "-1743", "-25211", "assistive access", "not authorized", "access is denied"}
+
+// Checks whether a restore failure was the OS refusing access
+func isPermissionError(err error) bool {
+	text := strings.ToLower(err.Error())
+	for _, permission := range permissionErrors {
+		if strings.Contains(text, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// How far off a window may be and still count as already in place
+const inPlaceTolerance = 2
+
+// Restores the states and reports what happened to each one, in the order
+// they were given
+func restoreStatesWithResults(ctx context.Context, backend WindowBackend, states []WindowState) ([]restoreResult, error) {
+	saved := states
+	clamped := make([]bool, len(states))
+	if lister, ok := backend.(DisplayLister); ok {
+		displays, err := lister.Displays()
+		if err != nil {
+			log.Printf("Error listing displays: %v", err)
+		}
+		states, clamped = clampToDisplays(placeOnDisplays(states, displays), displays)
+	}
+
+	// Which apps are running tells a closed app apart from a missing window
+	var running map[string]bool
+	if launcher, ok := backend.(AppLauncher); ok {
+		var err error
+		if running, err = launcher.RunningApps(); err != nil {
+			log.Printf("Error listing running apps: %v", err)
+		}
+	}
+
+	resolved := resolveTitles(backend, states)
+	// Windows already in place are skipped, so this can't come from the
+	// index, which may not have seen a window the user just dragged
+	before := freshStates(backend)
+	var err error
+	moving := statesToMove(resolved, before)
+	if len(moving) > 0 {
+		err = backend.Restore(ctx, moving)
+	}
+	if len(moving) > 0 || !stackedAsSaved(resolved, before) {
+		raiseInOrder(backend, resolved)
+	}
+	liveWindows.Refresh()
+
+	var failures []RestoreFailure
+	var restoreErr *RestoreError
+	if errors.As(err, &restoreErr) {
+		failures = restoreErr.Failures
+	}
+	results := describeRestore(saved, resolved, before, failures, running)
+	for i := range results {
+		results[i].OnScreen = clamped[i]
+	}
+
+	// Windows that weren't found show in the results but don't fail the
+	// restore, their app is often just not open
+	if restoreErr != nil {
+		kept := restoreErr.Failures[:0]
+		for _, failure := range restoreErr.Failures {
+			if !errors.Is(failure.Err, errWindowNotFound) {
+				kept = append(kept, failure)
+			}
+		}
+		restoreErr.Failures = kept
+		if len(kept) == 0 {
+			restoreErr, err = nil, nil
+		}
+	}
+
+	// Report failures with the saved titles so they can be ignored later
+	if restoreErr != nil {
+		byKey := make(map[windowKey]WindowState)
+		for i := range resolved {
+			byKey[keyOf(resolved[i])] = states[i]
+		}
+		for i, failure := range restoreErr.Failures {
+			if state, ok := byKey[keyOf(failure.State)]; ok {
+				restoreErr.Failures[i].State = state
+			}
+		}
+		restoreErr.Results = results
+	}
+	return results, err
+}
+
+// Leaves out the windows already in place, so a restore after a small drift
+// only moves the windows that drifted. A window is only left out when it's
+// the one open window with its app and title, as the backend might pick
+// another one of several.
+func statesToMove(resolved, before []WindowState) []WindowState {
+	moving := make([]WindowState, 0, len(resolved))
+	for _, state := range resolved {
+		var live []WindowState
+		for _, window := range before {
+			if sameApp(window, state) && window.WindowTitle == state.WindowTitle {
+				live = append(live, window)
+			}
+		}
+		if len(live) == 1 && inPlace(live[0], state) {
+			continue
+		}
+		moving = append(moving, state)
+	}
+	return moving
+}
+
+// Checks whether the open windows are already stacked the way the states
+// were saved, so they needn't be raised again
+func stackedAsSaved(resolved, before []WindowState) bool {
+	ordered := make([]WindowState, 0, len(resolved))
+	for _, state := range resolved {
+		if !state.Minimized {
+			ordered = append(ordered, state)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].ZOrder < ordered[j].ZOrder
+	})
+
+	lastZOrder := -1
+	for _, state := range ordered {
+		var live []WindowState
+		for _, window := range before {
+			if sameApp(window, state) && window.WindowTitle == state.WindowTitle {
+				live = append(live, window)
+			}
+		}
+		if len(live) != 1 || live[0].ZOrder <= lastZOrder {
+			return false
+		}
+		lastZOrder = live[0].ZOrder
+	}
+	return true
+}
+
+// Works out what happened to each window from the windows on screen before
+// the restore, the failures the backend reported and the apps that were
+// running, nil if that isn't known. A window only counts as moved when the
+// backend found it and reported no failure.
+func describeRestore(saved, resolved, before []WindowState, failures []RestoreFailure, running map[string]bool) []restoreResult {
+	failed := make(map[windowKey]error)
+	for _, failure := range failures {
+		failed[keyOf(failure.State)] = failure.Err
+	}
+
+	results := make([]restoreResult, len(resolved))
+	for i, state := range resolved {
+		results[i].State = saved[i]
+
+		var live *WindowState
+		for j := range before {
+			if sameApp(before[j], state) && before[j].WindowTitle == state.WindowTitle {
+				live = &before[j]
+				break
+			}
+		}
+
+		notRunning := live == nil && running != nil && !running[state.AppName]
+		results[i].TitleChanged = state.WindowTitle != saved[i].WindowTitle ||
+			(live == nil && running != nil && running[state.AppName])
+		if err, ok := failed[keyOf(state)]; ok {
+			results[i].Err = err
+			switch {
+			case isPermissionError(err):
+				results[i].Outcome = outcomePermissionDenied
+			case notRunning:
+				results[i].Outcome = outcomeAppNotRunning
+			case live == nil || errors.Is(err, errWindowNotFound):
+				results[i].Outcome = outcomeNotFound
+			default:
+				results[i].Outcome = outcomeFailed
+			}
+			continue
+		}
+		switch {
+		case live != nil && inPlace(*live, state):
+			results[i].Outcome = outcomeInPlace
+		case notRunning:
+			results[i].Outcome = outcomeAppNotRunning
+		default:
+			results[i].Outcome = outcomeMoved
+		}
+	}
+	return results
+}
+
+// Checks whether a window already has the saved position, size and state
+func inPlace(live, target WindowState) bool {
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) <= inPlaceTolerance
+	}
+	return near(live.X, target.X) && near(live.Y, target.Y) &&
+		near(live.Width, target.Width) && near(live.Height, target.Height) &&
+		live.Minimized == target.Minimized && live.FullScreen == target.FullScreen
+}
+
+// Raises the windows back to front so they end up stacked the way they were
+// saved, with the saved frontmost window focused last
+func raiseInOrder(backend WindowBackend, states []WindowState) {
+	raiser, ok := backend.(WindowRaiser)
+	if !ok {
+		return
+	}
+
+	ordered := make([]WindowState, 0, len(states))
+	for _, state := range states {
+		if !state.Minimized {
+			ordered = append(ordered, state)
+		}
+	}
+
+	// States saved before stacking was recorded all have ZOrder 0
+	stacked := false
+	for _, state := range ordered {
+		if state.ZOrder != 0 {
+			stacked = true
+			break
+		}
+	}
+	if !stacked {
+		return
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].ZOrder > ordered[j].ZOrder
+	})
+	for _, state := range ordered {
+		if err := raiser.Raise(state); err != nil {
+			log.Printf("Error raising %s - %s: %v", state.AppName, state.WindowTitle, err)
+		}
+	}
+}
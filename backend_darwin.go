@@ -0,0 +1,481 @@
+//go:build darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// macBackend drives macOS windows through System Events via AppleScript
+type macBackend struct{}
+
+func newBackend() WindowBackend {
+	return macBackend{}
+}
+
+// Gets the current window states natively, falling back to System Events
+func (macBackend) Capture() []WindowState {
+	states, err := captureNative()
+	if err != nil {
+		log.Printf("Native capture failed, falling back to System Events: %v", err)
+		states = captureWithJXA()
+	}
+	tagSpaces(states)
+	return states
+}
+
+// JXA script that lists the windows of visible apps as JSON, so titles with
+// commas, quotes or newlines come through intact
+const captureScript = `
+function run() {
+	var processes = Application('System Events').applicationProcesses.whose({visible: true})();
+	var windows = [];
+
+	processes.forEach(function (proc) {
+		var app = proc.name();
+		var bundle = '';
+		try {
+			bundle = proc.bundleIdentifier() || '';
+		} catch (e) {}
+
+		proc.windows().forEach(function (win) {
+			var position, size;
+			try {
+				position = win.position();
+				size = win.size();
+			} catch (e) {
+				return;
+			}
+
+			var title = '';
+			try {
+				title = win.name() || '';
+			} catch (e) {}
+			var minimized = false;
+			try {
+				minimized = win.attributes.byName('AXMinimized').value();
+			} catch (e) {}
+			var fullscreen = false;
+			try {
+				fullscreen = win.attributes.byName('AXFullScreen').value();
+			} catch (e) {}
+
+			windows.push({
+				app: app,
+				bundle: bundle,
+				title: title,
+				x: position[0],
+				y: position[1],
+				width: size[0],
+				height: size[1],
+				minimized: minimized,
+				fullscreen: fullscreen
+			});
+		});
+	});
+
+	return JSON.stringify(windows);
+}
+`
+
+// Gets the current window states from macOS using a System Events sweep
+func captureWithJXA() []WindowState {
+	output, err := commandOutput("osascript", "-l", "JavaScript", "-e", captureScript)
+	if err != nil {
+		log.Printf("Error getting window states: %v", err)
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			notePermissionError(string(exitErr.Stderr))
+		}
+		return nil
+	}
+
+	var windows []struct {
+		App        string  `json:"app"`
+		Bundle     string  `json:"bundle"`
+		Title      string  `json:"title"`
+		X          float64 `json:"x"`
+		Y          float64 `json:"y"`
+		Width      float64 `json:"width"`
+		Height     float64 `json:"height"`
+		Minimized  bool    `json:"minimized"`
+		FullScreen bool    `json:"fullscreen"`
+	}
+	if err := json.Unmarshal(output, &windows); err != nil {
+		log.Printf("Error reading window states: %v", err)
+		return nil
+	}
+
+	states := make([]WindowState, 0, len(windows))
+	for _, window := range windows {
+		states = append(states, WindowState{
+			AppName:     window.App,
+			BundleID:    window.Bundle,
+			WindowTitle: window.Title,
+			X:           window.X,
+			Y:           window.Y,
+			Width:       window.Width,
+			Height:      window.Height,
+			Minimized:   window.Minimized,
+			FullScreen:  window.FullScreen,
+			ZOrder:      len(states),
+		})
+	}
+	return states
+}
+
+// Runs an AppleScript with arguments for its run handler. Values are never
+// put into the script source so quotes in titles can't break it.
+func runAppleScript(script string, args ...string) error {
+	return runAppleScriptContext(context.Background(), script, args...)
+}
+
+// Like runAppleScript, but osascript is killed when ctx is done
+func runAppleScriptContext(ctx context.Context, script string, args ...string) error {
+	_, err := runAppleScriptOutputContext(ctx, script, args...)
+	return err
+}
+
+// Like runAppleScriptContext, and returns what the run handler returned
+func runAppleScriptOutputContext(ctx context.Context, script string, args ...string) (string, error) {
+	output, err := commandCombinedOutputContext(ctx, "osascript", append([]string{"-e", script}, args...)...)
+	if err != nil {
+		notePermissionError(string(output))
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// AppleScript that activates the app named in argv
+const activateScript = `
+on run argv
+	tell application (item 1 of argv) to activate
+end run
+`
+
+// AppleScript to restore window position and size. Minimized and fullscreen
+// windows don't move, so they are brought back first. A window that should
+// be fullscreen is moved onto its display before entering fullscreen so it
+// ends up on the right one. Returns "not found" when the app or window isn't
+// open.
+//
+// argv: app, title, fullscreen, x, y, width, height, resize, minimized
+const restoreScript = `
+on run argv
+	set appName to item 1 of argv
+	set winTitle to item 2 of argv
+	set wantFullScreen to (item 3 of argv) is "true"
+	set winX to (item 4 of argv) as integer
+	set winY to (item 5 of argv) as integer
+	set winWidth to (item 6 of argv) as integer
+	set winHeight to (item 7 of argv) as integer
+	set wantResize to (item 8 of argv) is "true"
+	set wantMinimized to (item 9 of argv) is "true"
+
+	tell application "System Events"
+		set appList to application processes whose name is appName
+		if (count of appList) is 0 then return "not found"
+		set appProcess to item 1 of appList
+		set windowList to windows of appProcess whose name is winTitle
+		if (count of windowList) is 0 then return "not found"
+		set theWindow to item 1 of windowList
+		set isFullScreen to false
+		try
+			set isFullScreen to value of attribute "AXFullScreen" of theWindow
+		end try
+		if isFullScreen and not wantFullScreen then
+			set value of attribute "AXFullScreen" of theWindow to false
+			delay 1
+		end if
+		if value of attribute "AXMinimized" of theWindow then
+			set value of attribute "AXMinimized" of theWindow to false
+		end if
+		if not isFullScreen then
+			set position of theWindow to {winX, winY}
+		end if
+		if wantFullScreen then
+			if not isFullScreen then
+				set value of attribute "AXFullScreen" of theWindow to true
+			end if
+		else
+			if wantResize then
+				set size of theWindow to {winWidth, winHeight}
+			end if
+			if wantMinimized then
+				set value of attribute "AXMinimized" of theWindow to true
+			end if
+		end if
+		return "moved"
+	end tell
+end run
+`
+
+// Restores window states using AppleScript
+func (macBackend) Restore(ctx context.Context, states []WindowState) error {
+	return restoreEach(ctx, states, func(state WindowState) error {
+		moveToSpace(ctx, state)
+
+		quirk := quirkFor(state.AppName)
+		if quirk.ActivateFirst {
+			if err := runAppleScriptContext(ctx, activateScript, state.AppName); err != nil {
+				log.Printf("Error activating %s: %v", state.AppName, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return errRestoreCancelled
+		case <-time.After(quirk.ExtraDelay):
+		}
+
+		// Apps with fixed-size windows error out when resized
+		outcome, err := runAppleScriptOutputContext(ctx, restoreScript,
+			state.AppName,
+			state.WindowTitle,
+			strconv.FormatBool(state.FullScreen),
+			strconv.Itoa(int(state.X)),
+			strconv.Itoa(int(state.Y)),
+			strconv.Itoa(int(state.Width)),
+			strconv.Itoa(int(state.Height)),
+			strconv.FormatBool(!quirk.IgnoresSize),
+			strconv.FormatBool(state.Minimized),
+		)
+		if err != nil {
+			log.Printf("Error restoring window state for %s - %s: %v", state.AppName, state.WindowTitle, err)
+			return err
+		}
+		if outcome == "not found" {
+			return errWindowNotFound
+		}
+		return nil
+	})
+}
+
+// JXA script that opens a translucent, click-through overlay window for each
+// rectangle and keeps them on screen for the requested number of seconds
+const highlightScript = `
+ObjC.import('Cocoa');
+
+function run(argv) {
+	var rects = JSON.parse(argv[0]);
+	var seconds = parseFloat(argv[1]);
+
+	var app = $.NSApplication.sharedApplication;
+	app.setActivationPolicy($.NSApplicationActivationPolicyAccessory);
+
+	// AppleScript coordinates start top-left, Cocoa ones bottom-left
+	var mainHeight = $.NSScreen.screens.objectAtIndex(0).frame.size.height;
+
+	var overlays = [];
+	rects.forEach(function (r) {
+		var frame = $.NSMakeRect(r.x, mainHeight - r.y - r.h, r.w, r.h);
+		var win = $.NSWindow.alloc.initWithContentRectStyleMaskBackingDefer(
+			frame, $.NSWindowStyleMaskBorderless, $.NSBackingStoreBuffered, false);
+		win.setOpaque(false);
+		win.setBackgroundColor($.NSColor.systemBlueColor.colorWithAlphaComponent(0.3));
+		win.setLevel($.NSStatusWindowLevel);
+		win.setIgnoresMouseEvents(true);
+		win.orderFrontRegardless;
+		overlays.push(win);
+	});
+
+	$.NSRunLoop.currentRunLoop.runUntilDate($.NSDate.dateWithTimeIntervalSinceNow(seconds));
+}
+`
+
+// Flashes the destination rectangles of the states using overlay windows
+func (macBackend) Highlight(states []WindowState, duration time.Duration) error {
+	type rect struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+		W float64 `json:"w"`
+		H float64 `json:"h"`
+	}
+
+	rects := make([]rect, 0, len(states))
+	for _, state := range states {
+		rects = append(rects, rect{X: state.X, Y: state.Y, W: state.Width, H: state.Height})
+	}
+
+	data, err := json.Marshal(rects)
+	if err != nil {
+		return fmt.Errorf("error encoding highlight regions: %v", err)
+	}
+
+	// The overlay stays up for the duration on top of the command timeout
+	cmd, done := newCommand(context.Background(), duration+getCommandTimeout(), "osascript", "-l", "JavaScript", "-e", highlightScript,
+		string(data), strconv.FormatFloat(duration.Seconds(), 'f', 2, 64))
+	if err := done(cmd.Run()); err != nil {
+		return fmt.Errorf("error showing highlight overlay: %v", err)
+	}
+	return nil
+}
+
+// JXA script that waits for a mouse click and reports where it happened and
+// which app is frontmost afterwards, since clicking activates the window's app
+const pickScript = `
+ObjC.import('Cocoa');
+
+function run(argv) {
+	var deadline = Date.now() + parseFloat(argv[0]) * 1000;
+
+	while ($.NSEvent.pressedMouseButtons == 0) {
+		if (Date.now() > deadline) {
+			return JSON.stringify({timeout: true});
+		}
+		delay(0.02);
+	}
+	var location = $.NSEvent.mouseLocation;
+	while ($.NSEvent.pressedMouseButtons != 0) {
+		delay(0.02);
+	}
+	delay(0.2);
+
+	// AppleScript coordinates start top-left, Cocoa ones bottom-left
+	var mainHeight = $.NSScreen.screens.objectAtIndex(0).frame.size.height;
+	var front = Application('System Events').processes.whose({frontmost: true})[0].name();
+
+	return JSON.stringify({x: location.x, y: mainHeight - location.y, app: front});
+}
+`
+
+// Waits for a click and returns the window that was clicked
+func (b macBackend) PickWindow(timeout time.Duration) (WindowState, error) {
+	// The script gives up by itself after the timeout
+	cmd, done := newCommand(context.Background(), timeout+getCommandTimeout(), "osascript", "-l", "JavaScript", "-e", pickScript,
+		strconv.FormatFloat(timeout.Seconds(), 'f', 2, 64))
+	output, err := cmd.Output()
+	err = done(err)
+	if err != nil {
+		return WindowState{}, fmt.Errorf("error waiting for click: %v", err)
+	}
+
+	var click struct {
+		Timeout bool    `json:"timeout"`
+		X       float64 `json:"x"`
+		Y       float64 `json:"y"`
+		App     string  `json:"app"`
+	}
+	if err := json.Unmarshal(output, &click); err != nil {
+		return WindowState{}, fmt.Errorf("error reading click location: %v", err)
+	}
+	if click.Timeout {
+		return WindowState{}, errPickTimeout
+	}
+
+	state, ok := windowAtPoint(b.Capture(), click.X, click.Y, click.App)
+	if !ok {
+		return WindowState{}, fmt.Errorf("no window found at (%.0f, %.0f)", click.X, click.Y)
+	}
+	return state, nil
+}
+
+// Lists the connected displays
+func (macBackend) Displays() ([]Display, error) {
+	return listDisplaysNative()
+}
+
+// AppleScript that raises the window titled item 2 of argv and brings its
+// app, item 1, to the front
+const raiseScript = `
+on run argv
+	tell application "System Events"
+		set appList to application processes whose name is (item 1 of argv)
+		if (count of appList) > 0 then
+			set appProcess to item 1 of appList
+			set windowList to windows of appProcess whose name is (item 2 of argv)
+			if (count of windowList) > 0 then
+				perform action "AXRaise" of item 1 of windowList
+				set frontmost of appProcess to true
+			end if
+		end if
+	end tell
+end run
+`
+
+// Raises a window and activates its app so it ends up in front
+func (macBackend) Raise(state WindowState) error {
+	return runAppleScript(raiseScript, state.AppName, state.WindowTitle)
+}
+
+// Lists the names of the running app processes
+func (macBackend) RunningApps() (map[string]bool, error) {
+	output, err := commandOutput("osascript", "-e",
+		`tell application "System Events" to get name of every application process`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing running apps: %v", err)
+	}
+
+	running := make(map[string]bool)
+	for _, name := range strings.Split(strings.TrimSpace(string(output)), ", ") {
+		running[name] = true
+	}
+	return running, nil
+}
+
+// Starts an app by name with open -a
+func (macBackend) LaunchApp(appName string) error {
+	return runCommand("open", "-a", appName)
+}
+
+// Looks for an app by its bundle ID through Spotlight, or by name in the
+// usual application folders and then Spotlight
+func (macBackend) AppInstalled(appName, bundleID string) (bool, error) {
+	query := fmt.Sprintf("kMDItemFSName == '%s.app'", strings.ReplaceAll(appName, "'", `\'`))
+	if bundleID != "" {
+		query = fmt.Sprintf("kMDItemCFBundleIdentifier == '%s'", strings.ReplaceAll(bundleID, "'", `\'`))
+	} else {
+		home, _ := os.UserHomeDir()
+		folders := []string{
+			"/Applications", "/Applications/Utilities", "/System/Applications",
+			"/System/Applications/Utilities", "/System/Library/CoreServices",
+			filepath.Join(home, "Applications"),
+		}
+		for _, folder := range folders {
+			if _, err := os.Stat(filepath.Join(folder, appName+".app")); err == nil {
+				return true, nil
+			}
+		}
+	}
+
+	output, err := commandOutput("mdfind", query)
+	if err != nil {
+		return false, fmt.Errorf("error searching for %s: %v", appName, err)
+	}
+	return strings.TrimSpace(string(output)) != "", nil
+}
+
+// Hides an app like Cmd-H does
+func (macBackend) HideApp(appName string) error {
+	return runAppleScript(`
+on run argv
+	tell application "System Events" to set visible of application process (item 1 of argv) to false
+end run
+`, appName)
+}
+
+// Asks an app to quit, Finder is hidden instead since it can't really quit
+func (b macBackend) QuitApp(appName string) error {
+	if appName == "Finder" {
+		return b.HideApp(appName)
+	}
+	return runAppleScript(`
+on run argv
+	tell application (item 1 of argv) to quit
+end run
+`, appName)
+}
+
+// Sends window events from Accessibility observers
+func (macBackend) Watch(events chan<- WindowEvent, stop <-chan struct{}) error {
+	return watchNative(events, stop)
+}
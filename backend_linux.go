@@ -0,0 +1,379 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// linuxBackend drives X11 windows by shelling out to wmctrl
+type linuxBackend struct{}
+
+func newBackend() WindowBackend {
+	return linuxBackend{}
+}
+
+// x11Window is one line of `wmctrl -lGx` output
+type x11Window struct {
+	ID    string
+	State WindowState
+}
+
+// Matches: <id> <desktop> <x> <y> <w> <h> <instance.class> <host> <title>
+var wmctrlLine = regexp.MustCompile(`^(0x[0-9a-fA-F]+)\s+(-?\d+)\s+(-?\d+)\s+(-?\d+)\s+(\d+)\s+(\d+)\s+(\S+)\s+(\S+)\s?(.*)$`)
+
+// Lists the managed X11 windows using wmctrl
+func listX11Windows() ([]x11Window, error) {
+	output, err := commandOutput("wmctrl", "-lGx")
+	if err != nil {
+		if _, lookErr := exec.LookPath("wmctrl"); lookErr != nil {
+			return nil, fmt.Errorf("wmctrl is not installed: %v", lookErr)
+		}
+		return nil, fmt.Errorf("error running wmctrl: %v", err)
+	}
+
+	stacking := x11StackingOrder()
+
+	var windows []x11Window
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := wmctrlLine.FindStringSubmatch(line)
+		if parts == nil {
+			continue
+		}
+
+		// Sticky windows on desktop -1 are panels and docks
+		if parts[2] == "-1" {
+			continue
+		}
+
+		x, _ := strconv.ParseFloat(parts[3], 64)
+		y, _ := strconv.ParseFloat(parts[4], 64)
+		width, _ := strconv.ParseFloat(parts[5], 64)
+		height, _ := strconv.ParseFloat(parts[6], 64)
+		desktop, _ := strconv.Atoi(parts[2])
+
+		// WM_CLASS is "instance.Class", the class reads best as an app name
+		appName := parts[7]
+		if i := strings.LastIndex(appName, "."); i >= 0 && i < len(appName)-1 {
+			appName = appName[i+1:]
+		}
+
+		windows = append(windows, x11Window{
+			ID: parts[1],
+			State: WindowState{
+				AppName:     appName,
+				WindowTitle: parts[9],
+				X:           x,
+				Y:           y,
+				Width:       width,
+				Height:      height,
+				Minimized:   hasX11State(parts[1], "_NET_WM_STATE_HIDDEN"),
+				FullScreen:  hasX11State(parts[1], "_NET_WM_STATE_FULLSCREEN"),
+				ZOrder:      stacking[x11WindowID(parts[1])],
+				Space:       desktop + 1,
+			},
+		})
+	}
+
+	return windows, nil
+}
+
+// Parses a hex window id; wmctrl pads them with zeros and xprop doesn't
+func x11WindowID(id string) uint64 {
+	value, _ := strconv.ParseUint(strings.TrimPrefix(id, "0x"), 16, 64)
+	return value
+}
+
+// Maps window ids to their place in the stacking order, 0 being frontmost
+func x11StackingOrder() map[uint64]int {
+	order := make(map[uint64]int)
+	output, err := commandOutput("xprop", "-root", "_NET_CLIENT_LIST_STACKING")
+	if err != nil {
+		return order
+	}
+
+	// The list is bottom to top: "..._STACKING(WINDOW): window id # 0x1, 0x2"
+	_, list, ok := strings.Cut(string(output), "#")
+	if !ok {
+		return order
+	}
+	ids := strings.Split(list, ",")
+	for i, id := range ids {
+		order[x11WindowID(strings.TrimSpace(id))] = len(ids) - 1 - i
+	}
+	return order
+}
+
+// Checks whether a window's _NET_WM_STATE has a flag such as
+// _NET_WM_STATE_HIDDEN (minimized)
+func hasX11State(id, flag string) bool {
+	output, err := commandOutput("xprop", "-id", id, "_NET_WM_STATE")
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(output), flag)
+}
+
+// Gets the current window states from the X11 window manager
+func (linuxBackend) Capture() []WindowState {
+	windows, err := listX11Windows()
+	if err != nil {
+		log.Printf("Error getting window states: %v", err)
+		return nil
+	}
+
+	states := make([]WindowState, 0, len(windows))
+	for _, window := range windows {
+		states = append(states, window.State)
+	}
+	return states
+}
+
+// Restores window states using wmctrl
+func (linuxBackend) Restore(ctx context.Context, states []WindowState) error {
+	windows, err := listX11Windows()
+	if err != nil {
+		return err
+	}
+
+	return restoreEach(ctx, states, func(state WindowState) error {
+		var id string
+		for _, window := range windows {
+			if window.State.AppName == state.AppName && window.State.WindowTitle == state.WindowTitle {
+				id = window.ID
+				break
+			}
+		}
+		if id == "" {
+			return errWindowNotFound
+		}
+
+		// Activating a window also brings it back from being minimized
+		quirk := quirkFor(state.AppName)
+		if quirk.ActivateFirst || (hasX11State(id, "_NET_WM_STATE_HIDDEN") && !state.Minimized) {
+			runCommandContext(ctx, "wmctrl", "-i", "-a", id)
+		}
+		select {
+		case <-ctx.Done():
+			return errRestoreCancelled
+		case <-time.After(quirk.ExtraDelay):
+		}
+
+		// Space is 1-based, wmctrl desktops start at 0
+		if state.Space > 0 {
+			desktop := strconv.Itoa(state.Space - 1)
+			if err := runCommandContext(ctx, "wmctrl", "-i", "-r", id, "-t", desktop); err != nil {
+				log.Printf("Error moving %s - %s to desktop %s: %v", state.AppName, state.WindowTitle, desktop, err)
+			}
+		}
+
+		// Maximized and fullscreen windows ignore move/resize requests
+		runCommandContext(ctx, "wmctrl", "-i", "-r", id, "-b", "remove,maximized_vert,maximized_horz")
+		runCommandContext(ctx, "wmctrl", "-i", "-r", id, "-b", "remove,fullscreen")
+
+		// wmctrl keeps the current size for dimensions of -1
+		width, height := int(state.Width), int(state.Height)
+		if quirk.IgnoresSize {
+			width, height = -1, -1
+		}
+		geometry := fmt.Sprintf("0,%d,%d,%d,%d", int(state.X), int(state.Y), width, height)
+		err := runCommandContext(ctx, "wmctrl", "-i", "-r", id, "-e", geometry)
+		if err == nil && state.FullScreen {
+			err = runCommandContext(ctx, "wmctrl", "-i", "-r", id, "-b", "add,fullscreen")
+		}
+		if err == nil && state.Minimized {
+			err = runCommandContext(ctx, "xdotool", "windowminimize", id)
+		}
+		if err != nil {
+			log.Printf("Error restoring window state for %s - %s: %v", state.AppName, state.WindowTitle, err)
+		}
+		return err
+	})
+}
+
+// Waits for a click using xdotool and returns the window that was clicked
+func (linuxBackend) PickWindow(timeout time.Duration) (WindowState, error) {
+	cmd, done := newCommand(context.Background(), timeout, "xdotool", "selectwindow")
+	output, err := cmd.Output()
+	if err = done(err); err != nil {
+		var timeoutErr *commandTimeoutError
+		if errors.As(err, &timeoutErr) {
+			return WindowState{}, errPickTimeout
+		}
+		return WindowState{}, fmt.Errorf("error waiting for click: %v", err)
+	}
+
+	windows, err := listX11Windows()
+	if err != nil {
+		return WindowState{}, err
+	}
+
+	// xdotool prints a decimal window id, wmctrl uses hex
+	picked, _ := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+	for _, window := range windows {
+		if x11WindowID(window.ID) == picked {
+			return window.State, nil
+		}
+	}
+
+	// The window manager may have reported a frame instead of the client
+	// window, so fall back to what's under the pointer
+	location, err := commandOutput("xdotool", "getmouselocation", "--shell")
+	if err != nil {
+		return WindowState{}, fmt.Errorf("error getting pointer location: %v", err)
+	}
+	var x, y float64
+	for _, line := range strings.Split(string(location), "\n") {
+		if value, ok := strings.CutPrefix(line, "X="); ok {
+			x, _ = strconv.ParseFloat(value, 64)
+		} else if value, ok := strings.CutPrefix(line, "Y="); ok {
+			y, _ = strconv.ParseFloat(value, 64)
+		}
+	}
+
+	states := make([]WindowState, 0, len(windows))
+	for _, window := range windows {
+		states = append(states, window.State)
+	}
+	state, ok := windowAtPoint(states, x, y, "")
+	if !ok {
+		return WindowState{}, fmt.Errorf("no window found at (%.0f, %.0f)", x, y)
+	}
+	return state, nil
+}
+
+// Matches: <index>: +*<name> <w>/<mm>x<h>/<mm>+<x>+<y>  <output>
+var xrandrMonitorLine = regexp.MustCompile(`^\s*(\d+):\s+\S+\s+(\d+)/\d+x(\d+)/\d+\+(-?\d+)\+(-?\d+)\s+(\S+)`)
+
+// Lists the connected monitors using xrandr
+func (linuxBackend) Displays() ([]Display, error) {
+	output, err := commandOutput("xrandr", "--listmonitors")
+	if err != nil {
+		return nil, fmt.Errorf("error running xrandr: %v", err)
+	}
+
+	var displays []Display
+	for _, line := range strings.Split(string(output), "\n") {
+		parts := xrandrMonitorLine.FindStringSubmatch(line)
+		if parts == nil {
+			continue
+		}
+
+		index, _ := strconv.Atoi(parts[1])
+		width, _ := strconv.ParseFloat(parts[2], 64)
+		height, _ := strconv.ParseFloat(parts[3], 64)
+		x, _ := strconv.ParseFloat(parts[4], 64)
+		y, _ := strconv.ParseFloat(parts[5], 64)
+
+		displays = append(displays, Display{
+			ID:     parts[6],
+			Index:  index,
+			X:      x,
+			Y:      y,
+			Width:  width,
+			Height: height,
+		})
+	}
+	return displays, nil
+}
+
+// Activates a window, which raises it to the top
+func (linuxBackend) Raise(state WindowState) error {
+	windows, err := listX11Windows()
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.State.AppName == state.AppName && window.State.WindowTitle == state.WindowTitle {
+			return runCommand("wmctrl", "-i", "-a", window.ID)
+		}
+	}
+	return nil
+}
+
+// Lists the apps that have a window open
+func (linuxBackend) RunningApps() (map[string]bool, error) {
+	windows, err := listX11Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]bool)
+	for _, window := range windows {
+		running[window.State.AppName] = true
+	}
+	return running, nil
+}
+
+// Starts an app from its window class, which usually matches the command
+// name in lower case
+func (linuxBackend) LaunchApp(appName string) error {
+	command, err := exec.LookPath(strings.ToLower(appName))
+	if err != nil {
+		return fmt.Errorf("no command found for %s: %v", appName, err)
+	}
+	// Not killed after the command timeout, the app keeps running
+	return exec.Command(command).Start()
+}
+
+// Looks for the command LaunchApp would start, or a desktop entry named
+// after the app
+func (linuxBackend) AppInstalled(appName, bundleID string) (bool, error) {
+	name := strings.ToLower(appName)
+	if _, err := exec.LookPath(name); err == nil {
+		return true, nil
+	}
+
+	dataDirs := []string{"/usr/local/share", "/usr/share", "/var/lib/flatpak/exports/share", "/var/lib/snapd/desktop"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dataDirs = append(dataDirs, filepath.Join(home, ".local", "share"))
+	}
+	for _, dir := range dataDirs {
+		if _, err := os.Stat(filepath.Join(dir, "applications", name+".desktop")); err == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Minimizes every window of an app since X11 has no notion of hiding apps
+func (linuxBackend) HideApp(appName string) error {
+	windows, err := listX11Windows()
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.State.AppName == appName {
+			if err := runCommand("xdotool", "windowminimize", window.ID); err != nil {
+				return fmt.Errorf("error minimizing window: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Closes every window of an app gracefully
+func (linuxBackend) QuitApp(appName string) error {
+	windows, err := listX11Windows()
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.State.AppName == appName {
+			if err := runCommand("wmctrl", "-i", "-c", window.ID); err != nil {
+				return fmt.Errorf("error closing window: %v", err)
+			}
+		}
+	}
+	return nil
+}
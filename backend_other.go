@@ -0,0 +1,24 @@
+//go:build !darwin && !linux && !windows
+
+package main
+
+import (
+	"context"
+	"log"
+)
+
+// unsupportedBackend is used on platforms without a window backend
+type unsupportedBackend struct{}
+
+func newBackend() WindowBackend {
+	return unsupportedBackend{}
+}
+
+func (unsupportedBackend) Capture() []WindowState {
+	log.Printf("Error getting window states: %v", errUnsupportedPlatform)
+	return nil
+}
+
+func (unsupportedBackend) Restore(ctx context.Context, states []WindowState) error {
+	return errUnsupportedPlatform
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// A 1920x1080 display with a 1280x1024 one to its right
+var testDisplays = []Display{
+	{ID: "main", X: 0, Y: 0, Width: 1920, Height: 1080},
+	{ID: "right", Index: 1, X: 1920, Y: 0, Width: 1280, Height: 1024},
+}
+
+func TestOnScreen(t *testing.T) {
+	tests := []struct {
+		name  string
+		state WindowState
+		want  bool
+	}{
+		{"inside", WindowState{X: 100, Y: 100, Width: 800, Height: 600}, true},
+		{"across both displays", WindowState{X: 1900, Y: 100, Width: 100, Height: 100}, true},
+		{"just enough left of the display", WindowState{X: -760, Y: 100, Width: 800, Height: 600}, true},
+		{"too little left of the display", WindowState{X: -770, Y: 100, Width: 800, Height: 600}, false},
+		{"small window fully inside", WindowState{X: 0, Y: 0, Width: 20, Height: 20}, true},
+		{"small window half off", WindowState{X: -10, Y: 0, Width: 20, Height: 20}, false},
+		{"below every display", WindowState{X: 100, Y: 1200, Width: 800, Height: 600}, false},
+		{"right of every display", WindowState{X: 4000, Y: 100, Width: 800, Height: 600}, false},
+	}
+	for _, test := range tests {
+		if got := onScreen(test.state, testDisplays); got != test.want {
+			t.Errorf("%s: onScreen(%+v) = %v, want %v", test.name, test.state, got, test.want)
+		}
+	}
+}
+
+func TestClampToDisplays(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       WindowState
+		want        WindowState
+		wantClamped bool
+	}{
+		{
+			name:  "on screen is left alone",
+			state: WindowState{AppName: "Code", X: 100, Y: 100, Width: 800, Height: 600},
+			want:  WindowState{AppName: "Code", X: 100, Y: 100, Width: 800, Height: 600},
+		},
+		{
+			name:        "off to the right moves onto the nearest display",
+			state:       WindowState{AppName: "Code", X: 4000, Y: 100, Width: 800, Height: 600},
+			want:        WindowState{AppName: "Code", X: 2400, Y: 100, Width: 800, Height: 600},
+			wantClamped: true,
+		},
+		{
+			name:        "too big for the display is shrunk to fit",
+			state:       WindowState{AppName: "Code", X: 0, Y: 2000, Width: 2000, Height: 1200},
+			want:        WindowState{AppName: "Code", X: 0, Y: 0, Width: 1920, Height: 1080},
+			wantClamped: true,
+		},
+	}
+	for _, test := range tests {
+		states := []WindowState{test.state}
+		got, clamped := clampToDisplays(states, testDisplays)
+		if !reflect.DeepEqual(got, []WindowState{test.want}) || clamped[0] != test.wantClamped {
+			t.Errorf("%s: clampToDisplays = %+v, %v, want %+v, %v", test.name, got[0], clamped[0], test.want, test.wantClamped)
+		}
+		if states[0] != test.state {
+			t.Errorf("%s: clampToDisplays changed its input to %+v", test.name, states[0])
+		}
+	}
+}
+
+func TestClampToDisplaysWithoutDisplays(t *testing.T) {
+	states := []WindowState{{X: 4000, Y: 4000, Width: 800, Height: 600}}
+	got, clamped := clampToDisplays(states, nil)
+	if !reflect.DeepEqual(got, states) || clamped[0] {
+		t.Errorf("clampToDisplays without displays = %+v, %v, want the states unchanged", got, clamped)
+	}
+}
+
+func TestInPlace(t *testing.T) {
+	target := WindowState{X: 100, Y: 100, Width: 800, Height: 600}
+	tests := []struct {
+		name string
+		live WindowState
+		want bool
+	}{
+		{"same", target, true},
+		{"within the tolerance", WindowState{X: 102, Y: 98, Width: 801, Height: 599}, true},
+		{"moved", WindowState{X: 103, Y: 100, Width: 800, Height: 600}, false},
+		{"resized", WindowState{X: 100, Y: 100, Width: 800, Height: 590}, false},
+		{"minimized", WindowState{X: 100, Y: 100, Width: 800, Height: 600, Minimized: true}, false},
+		{"fullscreen", WindowState{X: 100, Y: 100, Width: 800, Height: 600, FullScreen: true}, false},
+	}
+	for _, test := range tests {
+		if got := inPlace(test.live, target); got != test.want {
+			t.Errorf("%s: inPlace = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestStatesToMove(t *testing.T) {
+	editor := WindowState{AppName: "Visual Studio Code", BundleID: "com.microsoft.VSCode", WindowTitle: "main.go", X: 100, Y: 100, Width: 800, Height: 600}
+	browser := WindowState{AppName: "Safari", WindowTitle: "Docs", X: 900, Y: 100, Width: 800, Height: 600}
+	terminal := WindowState{AppName: "Terminal", WindowTitle: "zsh", X: 100, Y: 700, Width: 600, Height: 300}
+	notes := WindowState{AppName: "Notes", WindowTitle: "Notes", X: 0, Y: 0, Width: 400, Height: 400}
+
+	before := []WindowState{
+		// Named differently but the same app, and already in place
+		{AppName: "Code", BundleID: "com.microsoft.VSCode", WindowTitle: "main.go", X: 101, Y: 100, Width: 800, Height: 600},
+		// Drifted
+		{AppName: "Safari", WindowTitle: "Docs", X: 950, Y: 100, Width: 800, Height: 600},
+		// Two windows with the same title, either could be the one moved
+		terminal,
+		{AppName: "Terminal", WindowTitle: "zsh", X: 700, Y: 700, Width: 600, Height: 300},
+	}
+
+	got := statesToMove([]WindowState{editor, browser, terminal, notes}, before)
+	want := []WindowState{browser, terminal, notes}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statesToMove = %+v, want %+v", got, want)
+	}
+}
+
+func TestAssignUIDs(t *testing.T) {
+	states := []WindowState{
+		{AppName: "Terminal", WindowTitle: "zsh"},
+		{AppName: "Terminal", WindowTitle: "zsh"},
+		{AppName: "Terminal", WindowTitle: "vim"},
+		{AppName: "Code", WindowTitle: "main.go", UID: "kept"},
+	}
+	assignUIDs(states)
+
+	if states[3].UID != "kept" {
+		t.Errorf("assignUIDs replaced an existing UID with %q", states[3].UID)
+	}
+	seen := make(map[string]bool)
+	for _, state := range states {
+		if state.UID == "" || seen[state.UID] {
+			t.Errorf("assignUIDs gave %+v an empty or repeated UID", state)
+		}
+		seen[state.UID] = true
+	}
+
+	// The same windows get the same UIDs in every capture, and a window keeps
+	// its UID when the one before it already had one
+	again := []WindowState{
+		{AppName: "Terminal", WindowTitle: "zsh", UID: "other"},
+		{AppName: "Terminal", WindowTitle: "zsh"},
+		{AppName: "Terminal", WindowTitle: "vim"},
+	}
+	assignUIDs(again)
+	if again[1].UID != states[1].UID || again[2].UID != states[2].UID {
+		t.Errorf("assignUIDs isn't stable: got %q and %q, want %q and %q", again[1].UID, again[2].UID, states[1].UID, states[2].UID)
+	}
+}
+
+// fakeBackend has a fixed set of open windows and moves them the way the
+// real backends do, by app and title, failing the ones it doesn't have with
+// errWindowNotFound
+type fakeBackend struct {
+	mu      sync.Mutex
+	windows []WindowState
+	running map[string]bool
+	// broken apps fail to move with errBroken
+	broken map[string]bool
+}
+
+var errBroken = errors.New("window refused to move")
+
+func (b *fakeBackend) Capture() []WindowState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]WindowState(nil), b.windows...)
+}
+
+func (b *fakeBackend) Restore(ctx context.Context, states []WindowState) error {
+	return restoreEach(ctx, states, func(state WindowState) error {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.broken[state.AppName] {
+			return errBroken
+		}
+		for i, window := range b.windows {
+			if window.AppName == state.AppName && window.WindowTitle == state.WindowTitle {
+				b.windows[i].X, b.windows[i].Y = state.X, state.Y
+				b.windows[i].Width, b.windows[i].Height = state.Width, state.Height
+				return nil
+			}
+		}
+		return errWindowNotFound
+	})
+}
+
+func (b *fakeBackend) RunningApps() (map[string]bool, error) {
+	return b.running, nil
+}
+
+func (b *fakeBackend) LaunchApp(appName string) error {
+	return nil
+}
+
+func TestRestoreResults(t *testing.T) {
+	docs := WindowState{AppName: "Safari", WindowTitle: "Docs", X: 100, Y: 100, Width: 800, Height: 600}
+	notes := WindowState{AppName: "Notes", WindowTitle: "Notes", X: 0, Y: 0, Width: 400, Height: 400}
+	shell := WindowState{AppName: "Terminal", WindowTitle: "zsh", X: 900, Y: 100, Width: 600, Height: 400}
+	editor := WindowState{AppName: "Code", WindowTitle: "main.go", X: 0, Y: 500, Width: 800, Height: 500}
+	moved := func(state WindowState) WindowState {
+		state.X += 300
+		return state
+	}
+
+	tests := []struct {
+		name       string
+		backend    *fakeBackend
+		states     []WindowState
+		want       []restoreOutcome
+		wantFailed []WindowState
+	}{
+		{
+			name: "no window matches",
+			backend: &fakeBackend{
+				windows: []WindowState{{AppName: "Safari", WindowTitle: "Other"}},
+				running: map[string]bool{"Safari": true},
+			},
+			states: []WindowState{docs, notes},
+			want:   []restoreOutcome{outcomeNotFound, outcomeAppNotRunning},
+		},
+		{
+			name: "moved, in place and missing",
+			backend: &fakeBackend{
+				windows: []WindowState{moved(docs), shell},
+				running: map[string]bool{"Safari": true, "Terminal": true, "Code": true},
+			},
+			states: []WindowState{docs, shell, editor},
+			want:   []restoreOutcome{outcomeMoved, outcomeInPlace, outcomeNotFound},
+		},
+		{
+			name: "a failure next to a missing window",
+			backend: &fakeBackend{
+				windows: []WindowState{moved(shell)},
+				running: map[string]bool{"Terminal": true, "Code": true},
+				broken:  map[string]bool{"Terminal": true},
+			},
+			states:     []WindowState{shell, editor},
+			want:       []restoreOutcome{outcomeFailed, outcomeNotFound},
+			wantFailed: []WindowState{shell},
+		},
+	}
+	for _, test := range tests {
+		results, err := restoreStatesWithResults(context.Background(), test.backend, test.states)
+
+		var got []restoreOutcome
+		for _, result := range results {
+			got = append(got, result.Outcome)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: outcomes = %q, want %q", test.name, got, test.want)
+		}
+
+		// Missing windows are in the results but don't fail the restore
+		if test.wantFailed == nil {
+			if err != nil {
+				t.Errorf("%s: restoreStatesWithResults returned %v", test.name, err)
+			}
+			continue
+		}
+		var restoreErr *RestoreError
+		if !errors.As(err, &restoreErr) {
+			t.Errorf("%s: restoreStatesWithResults returned %v, want a *RestoreError", test.name, err)
+			continue
+		}
+		var failed []WindowState
+		for _, failure := range restoreErr.Failures {
+			failed = append(failed, failure.State)
+		}
+		if !reflect.DeepEqual(failed, test.wantFailed) {
+			t.Errorf("%s: failures = %+v, want %+v", test.name, failed, test.wantFailed)
+		}
+		if !reflect.DeepEqual(restoreErr.Results, results) {
+			t.Errorf("%s: RestoreError.Results = %+v, want the results", test.name, restoreErr.Results)
+		}
+	}
+}
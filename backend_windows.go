@@ -0,0 +1,432 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+var (
+	user32   = syscall.NewLazyDLL("user32.dll")
+	kernel32 = syscall.NewLazyDLL("kernel32.dll")
+
+	procEnumWindows              = user32.NewProc("EnumWindows")
+	procIsWindowVisible          = user32.NewProc("IsWindowVisible")
+	procIsZoomed                 = user32.NewProc("IsZoomed")
+	procIsIconic                 = user32.NewProc("IsIconic")
+	procGetWindowPlacement       = user32.NewProc("GetWindowPlacement")
+	procGetWindowTextLengthW     = user32.NewProc("GetWindowTextLengthW")
+	procGetWindowTextW           = user32.NewProc("GetWindowTextW")
+	procGetWindowRect            = user32.NewProc("GetWindowRect")
+	procGetWindowThreadProcessId = user32.NewProc("GetWindowThreadProcessId")
+	procSetWindowPos             = user32.NewProc("SetWindowPos")
+	procShowWindow               = user32.NewProc("ShowWindow")
+	procGetAsyncKeyState         = user32.NewProc("GetAsyncKeyState")
+	procGetCursorPos             = user32.NewProc("GetCursorPos")
+	procWindowFromPoint          = user32.NewProc("WindowFromPoint")
+	procGetAncestor              = user32.NewProc("GetAncestor")
+	procSetForegroundWindow      = user32.NewProc("SetForegroundWindow")
+	procEnumDisplayMonitors      = user32.NewProc("EnumDisplayMonitors")
+	procGetMonitorInfoW          = user32.NewProc("GetMonitorInfoW")
+	procPostMessageW             = user32.NewProc("PostMessageW")
+
+	procOpenProcess                = kernel32.NewProc("OpenProcess")
+	procCloseHandle                = kernel32.NewProc("CloseHandle")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+)
+
+const (
+	processQueryLimitedInformation = 0x1000
+
+	swMinimize = 6
+	swRestore  = 9
+
+	swpNoSize     = 0x0001
+	swpNoMove     = 0x0002
+	swpNoZOrder   = 0x0004
+	swpNoActivate = 0x0010
+
+	wmClose = 0x0010
+
+	vkLButton = 0x01
+	gaRoot    = 2
+)
+
+type win32Rect struct {
+	Left, Top, Right, Bottom int32
+}
+
+type win32Point struct {
+	X, Y int32
+}
+
+type win32WindowPlacement struct {
+	Length         uint32
+	Flags          uint32
+	ShowCmd        uint32
+	MinPosition    win32Point
+	MaxPosition    win32Point
+	NormalPosition win32Rect
+}
+
+type win32MonitorInfoEx struct {
+	Size    uint32
+	Monitor win32Rect
+	Work    win32Rect
+	Flags   uint32
+	Device  [32]uint16
+}
+
+// windowsBackend drives top-level windows through the Win32 API
+type windowsBackend struct{}
+
+func newBackend() WindowBackend {
+	return windowsBackend{}
+}
+
+// win32Window pairs a window handle with its captured state
+type win32Window struct {
+	Handle syscall.Handle
+	State  WindowState
+}
+
+// Gets the executable name (without .exe) of the process owning a window
+func windowProcessName(hwnd syscall.Handle) string {
+	var pid uint32
+	procGetWindowThreadProcessId.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&pid)))
+
+	process, _, _ := procOpenProcess.Call(processQueryLimitedInformation, 0, uintptr(pid))
+	if process == 0 {
+		return ""
+	}
+	defer procCloseHandle.Call(process)
+
+	buf := make([]uint16, syscall.MAX_PATH)
+	size := uint32(len(buf))
+	ret, _, _ := procQueryFullProcessImageNameW.Call(process, 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if ret == 0 {
+		return ""
+	}
+
+	name := filepath.Base(syscall.UTF16ToString(buf[:size]))
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Go only has room for about 2000 callbacks and never frees
+// them, so each enumeration's callback is made once and the results are
+// collected in these, one enumeration at a time
+var (
+	enumMu       sync.Mutex
+	enumWindows  []win32Window
+	enumDisplays []Display
+
+	enumWindowsCallback  = syscall.NewCallback(enumWindowProc)
+	enumDisplaysCallback = syscall.NewCallback(enumDisplayProc)
+)
+
+// Called by EnumWindows for each top-level window, collecting the visible,
+// titled ones
+func enumWindowProc(hwnd syscall.Handle, lparam uintptr) uintptr {
+	visible, _, _ := procIsWindowVisible.Call(uintptr(hwnd))
+	if visible == 0 {
+		return 1
+	}
+
+	length, _, _ := procGetWindowTextLengthW.Call(uintptr(hwnd))
+	if length == 0 {
+		return 1
+	}
+	buf := make([]uint16, length+1)
+	procGetWindowTextW.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+
+	var rect win32Rect
+	ret, _, _ := procGetWindowRect.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&rect)))
+	if ret == 0 {
+		return 1
+	}
+
+	// Minimized windows report an off-screen rectangle, their real
+	// position is the one they'll be restored to
+	iconic, _, _ := procIsIconic.Call(uintptr(hwnd))
+	if iconic != 0 {
+		var placement win32WindowPlacement
+		placement.Length = uint32(unsafe.Sizeof(placement))
+		ret, _, _ := procGetWindowPlacement.Call(uintptr(hwnd), uintptr(unsafe.Pointer(&placement)))
+		if ret != 0 {
+			rect = placement.NormalPosition
+		}
+	}
+
+	enumWindows = append(enumWindows, win32Window{
+		Handle: hwnd,
+		State: WindowState{
+			AppName:     windowProcessName(hwnd),
+			WindowTitle: syscall.UTF16ToString(buf),
+			X:           float64(rect.Left),
+			Y:           float64(rect.Top),
+			Width:       float64(rect.Right - rect.Left),
+			Height:      float64(rect.Bottom - rect.Top),
+			Minimized:   iconic != 0,
+			// EnumWindows walks the windows from the top of the z-order
+			ZOrder: len(enumWindows),
+		},
+	})
+	return 1
+}
+
+// Lists the visible, titled top-level windows
+func listWin32Windows() ([]win32Window, error) {
+	enumMu.Lock()
+	defer enumMu.Unlock()
+
+	enumWindows = nil
+	ret, _, err := procEnumWindows.Call(enumWindowsCallback, 0)
+	windows := enumWindows
+	enumWindows = nil
+	if ret == 0 {
+		return nil, fmt.Errorf("error enumerating windows: %v", err)
+	}
+
+	return windows, nil
+}
+
+// Gets the current window states using EnumWindows
+func (windowsBackend) Capture() []WindowState {
+	windows, err := listWin32Windows()
+	if err != nil {
+		log.Printf("Error getting window states: %v", err)
+		return nil
+	}
+
+	states := make([]WindowState, 0, len(windows))
+	for _, window := range windows {
+		states = append(states, window.State)
+	}
+	return states
+}
+
+// Restores window states using SetWindowPos
+func (windowsBackend) Restore(ctx context.Context, states []WindowState) error {
+	windows, err := listWin32Windows()
+	if err != nil {
+		return err
+	}
+
+	return restoreEach(ctx, states, func(state WindowState) error {
+		var hwnd syscall.Handle
+		for _, window := range windows {
+			if window.State.AppName == state.AppName && window.State.WindowTitle == state.WindowTitle {
+				hwnd = window.Handle
+				break
+			}
+		}
+		if hwnd == 0 {
+			return errWindowNotFound
+		}
+
+		quirk := quirkFor(state.AppName)
+		if quirk.ActivateFirst {
+			procSetForegroundWindow.Call(uintptr(hwnd))
+		}
+		select {
+		case <-ctx.Done():
+			return errRestoreCancelled
+		case <-time.After(quirk.ExtraDelay):
+		}
+
+		// Maximized and minimized windows ignore the new position unless
+		// they are restored first
+		zoomed, _, _ := procIsZoomed.Call(uintptr(hwnd))
+		iconic, _, _ := procIsIconic.Call(uintptr(hwnd))
+		if zoomed != 0 || iconic != 0 {
+			procShowWindow.Call(uintptr(hwnd), swRestore)
+		}
+
+		flags := uintptr(swpNoZOrder | swpNoActivate)
+		if quirk.IgnoresSize {
+			flags |= swpNoSize
+		}
+		ret, _, err := procSetWindowPos.Call(uintptr(hwnd), 0,
+			uintptr(int(state.X)), uintptr(int(state.Y)), uintptr(int(state.Width)), uintptr(int(state.Height)),
+			flags)
+		if ret == 0 {
+			log.Printf("Error restoring window state for %s - %s: %v", state.AppName, state.WindowTitle, err)
+			return err
+		}
+		if state.Minimized {
+			procShowWindow.Call(uintptr(hwnd), swMinimize)
+		}
+		return nil
+	})
+}
+
+// Polls the left mouse button until it's clicked and returns the top-level
+// window under the cursor
+func (windowsBackend) PickWindow(timeout time.Duration) (WindowState, error) {
+	deadline := time.Now().Add(timeout)
+
+	// Ignore the click that started picking mode
+	for isMouseDown() {
+		time.Sleep(20 * time.Millisecond)
+	}
+	for !isMouseDown() {
+		if time.Now().After(deadline) {
+			return WindowState{}, errPickTimeout
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	var point win32Point
+	procGetCursorPos.Call(uintptr(unsafe.Pointer(&point)))
+	packed := uintptr(uint32(point.X)) | uintptr(uint32(point.Y))<<32
+	child, _, _ := procWindowFromPoint.Call(packed)
+	root, _, _ := procGetAncestor.Call(child, gaRoot)
+
+	windows, err := listWin32Windows()
+	if err != nil {
+		return WindowState{}, err
+	}
+	for _, window := range windows {
+		if uintptr(window.Handle) == root {
+			return window.State, nil
+		}
+	}
+
+	states := make([]WindowState, 0, len(windows))
+	for _, window := range windows {
+		states = append(states, window.State)
+	}
+	state, ok := windowAtPoint(states, float64(point.X), float64(point.Y), "")
+	if !ok {
+		return WindowState{}, fmt.Errorf("no window found at (%d, %d)", point.X, point.Y)
+	}
+	return state, nil
+}
+
+func isMouseDown() bool {
+	state, _, _ := procGetAsyncKeyState.Call(vkLButton)
+	return state&0x8000 != 0
+}
+
+// Called by EnumDisplayMonitors for each monitor
+func enumDisplayProc(monitor syscall.Handle, hdc syscall.Handle, rect *win32Rect, lparam uintptr) uintptr {
+	var info win32MonitorInfoEx
+	info.Size = uint32(unsafe.Sizeof(info))
+	ret, _, _ := procGetMonitorInfoW.Call(uintptr(monitor), uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 1
+	}
+
+	enumDisplays = append(enumDisplays, Display{
+		ID:     syscall.UTF16ToString(info.Device[:]),
+		Index:  len(enumDisplays),
+		X:      float64(info.Monitor.Left),
+		Y:      float64(info.Monitor.Top),
+		Width:  float64(info.Monitor.Right - info.Monitor.Left),
+		Height: float64(info.Monitor.Bottom - info.Monitor.Top),
+	})
+	return 1
+}
+
+// Lists the connected monitors using EnumDisplayMonitors
+func (windowsBackend) Displays() ([]Display, error) {
+	enumMu.Lock()
+	defer enumMu.Unlock()
+
+	enumDisplays = nil
+	ret, _, err := procEnumDisplayMonitors.Call(0, 0, enumDisplaysCallback, 0)
+	displays := enumDisplays
+	enumDisplays = nil
+	if ret == 0 {
+		return nil, fmt.Errorf("error enumerating displays: %v", err)
+	}
+	return displays, nil
+}
+
+// Moves a window to the top of the z-order and gives it focus
+func (windowsBackend) Raise(state WindowState) error {
+	windows, err := listWin32Windows()
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.State.AppName == state.AppName && window.State.WindowTitle == state.WindowTitle {
+			procSetWindowPos.Call(uintptr(window.Handle), 0, 0, 0, 0, 0, swpNoMove|swpNoSize)
+			procSetForegroundWindow.Call(uintptr(window.Handle))
+			return nil
+		}
+	}
+	return nil
+}
+
+// Lists the apps that have a window open
+func (windowsBackend) RunningApps() (map[string]bool, error) {
+	windows, err := listWin32Windows()
+	if err != nil {
+		return nil, err
+	}
+
+	running := make(map[string]bool)
+	for _, window := range windows {
+		running[window.State.AppName] = true
+	}
+	return running, nil
+}
+
+// Starts an app from its executable name through the shell
+func (windowsBackend) LaunchApp(appName string) error {
+	return runCommand("cmd", "/c", "start", "", appName)
+}
+
+// Looks for the executable on the path or registered under App Paths, which
+// is where start finds it too
+func (windowsBackend) AppInstalled(appName, bundleID string) (bool, error) {
+	executable := appName + ".exe"
+	if _, err := exec.LookPath(executable); err == nil {
+		return true, nil
+	}
+	for _, root := range []string{"HKCU", "HKLM"} {
+		key := root + `\Software\Microsoft\Windows\CurrentVersion\App Paths\` + executable
+		if runCommand("reg", "query", key) == nil {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Minimizes every window of an app
+func (windowsBackend) HideApp(appName string) error {
+	windows, err := listWin32Windows()
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.State.AppName == appName {
+			procShowWindow.Call(uintptr(window.Handle), swMinimize)
+		}
+	}
+	return nil
+}
+
+// Asks every window of an app to close, which quits most apps
+func (windowsBackend) QuitApp(appName string) error {
+	windows, err := listWin32Windows()
+	if err != nil {
+		return err
+	}
+	for _, window := range windows {
+		if window.State.AppName == appName {
+			procPostMessageW.Call(uintptr(window.Handle), wmClose, 0, 0)
+		}
+	}
+	return nil
+}
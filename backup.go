@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tables that stay as they are when a backup is restored
+var localTables = map[string]bool{
+	"schema_version":    true,
+	"restore_journal":   true,
+	"restore_stats":     true,
+	"activity_log":      true,
+	"profile_usage":     true,
+	"title_changes":     true,
+	"display_sightings": true,
+}
+
+// How many automatic backups are kept unless retain_backups says otherwise
+const maxAutoBackups = 20
+
+// Automatic backups go in a folder next to the database
+func backupDir() string {
+	return filepath.Join(filepath.Dir(getDBPath()), ".wisa-backups")
+}
+
+// Writes a consistent copy of the database to a new file
+func backupDatabase(db *sql.DB, path string) error {
+	if _, err := db.Exec("VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("error backing up database: %v", err)
+	}
+	return nil
+}
+
+// Writes a copy of the database to w
+func backupDatabaseTo(db *sql.DB, w io.Writer) error {
+	tmp := filepath.Join(os.TempDir(), fmt.Sprintf("wisa-backup-%d.db", time.Now().UnixNano()))
+	defer os.Remove(tmp)
+
+	if err := backupDatabase(db, tmp); err != nil {
+		return err
+	}
+	file, err := os.Open(tmp)
+	if err != nil {
+		return fmt.Errorf("error reading backup: %v", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("error writing backup: %v", err)
+	}
+	return nil
+}
+
+// Saves a timestamped backup before a destructive operation and drops the
+// oldest ones past the backup retention. Failures are only logged so they never
+// block the operation itself.
+func autoBackup(db *sql.DB, reason string) {
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Printf("Error creating backup folder: %v", err)
+		return
+	}
+
+	name := fmt.Sprintf("wisa-%s-%s.db", time.Now().Format("20060102-150405"), reason)
+	if err := backupDatabase(db, filepath.Join(dir, name)); err != nil {
+		log.Printf("Error making automatic backup: %v", err)
+		return
+	}
+
+	if err := pruneBackups(); err != nil {
+		log.Printf("Error applying retention: %v", err)
+	}
+}
+
+// Gets the column names of a table in an attached database
+func tableColumns(conn *sql.Conn, schema, table string) ([]string, error) {
+	rows, err := conn.QueryContext(context.Background(), fmt.Sprintf("PRAGMA %s.table_info(%s)", schema, table))
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		columns = append(columns, name)
+	}
+	return columns, rows.Err()
+}
+
+// Replaces the contents of the database with a backup file. The backup is
+// copied into the current schema, so backups from older versions work and
+// columns they lack get their defaults.
+func restoreDatabase(db *sql.DB, path string) error {
+	return queueWrite(func() error {
+		return restoreDatabaseLocked(db, path)
+	})
+}
+
+func restoreDatabaseLocked(db *sql.DB, path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("error opening backup: %v", err)
+	}
+
+	autoBackup(db, "restore")
+
+	// ATTACH only applies to one connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening database: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS backup", path); err != nil {
+		return fmt.Errorf("error opening backup: %v", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE backup")
+
+	var hasProfiles int
+	err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM backup.sqlite_master WHERE type = 'table' AND name = 'profiles'").Scan(&hasProfiles)
+	if err != nil || hasProfiles == 0 {
+		return fmt.Errorf("%s is not a wisa database", filepath.Base(path))
+	}
+
+	tables := make(map[string]bool)
+	for _, schema := range []string{"main", "backup"} {
+		rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%%'", schema))
+		if err != nil {
+			return fmt.Errorf("error listing tables: %v", err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning row: %v", err)
+			}
+			// Only tables this version knows are restored, and never the
+			// ones describing this database rather than its contents
+			if localTables[name] {
+				continue
+			}
+			if schema == "main" {
+				tables[name] = false
+			} else if _, ok := tables[name]; ok {
+				tables[name] = true
+			}
+		}
+		rows.Close()
+	}
+
+	// Work out the statements first, the columns the backup and this version
+	// have in common are copied
+	var statements []string
+	for table, inBackup := range tables {
+		statements = append(statements, fmt.Sprintf("DELETE FROM main.%s", table))
+		if !inBackup {
+			continue
+		}
+
+		current, err := tableColumns(conn, "main", table)
+		if err != nil {
+			return err
+		}
+		saved, err := tableColumns(conn, "backup", table)
+		if err != nil {
+			return err
+		}
+		have := make(map[string]bool)
+		for _, column := range saved {
+			have[column] = true
+		}
+		var common []string
+		for _, column := range current {
+			if have[column] {
+				common = append(common, column)
+			}
+		}
+
+		list := strings.Join(common, ", ")
+		statements = append(statements, fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM backup.%s", table, list, list, table))
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error restoring backup: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+
+	loadSettings(db)
+	return loadAppQuirks(db)
+}
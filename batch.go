@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Gets the apps a profile takes in a batch save, as a comma separated list
+// of app names that may use * wildcards
+func getIncludeFilter(db *sql.DB, profileName string) (string, error) {
+	var filter string
+	err := db.QueryRow("SELECT include_filter FROM profiles WHERE name = ?", profileName).Scan(&filter)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading profile: %v", err)
+	}
+	return filter, nil
+}
+
+func setIncludeFilter(db *sql.DB, profileName, filter string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET include_filter = ? WHERE name = ?", strings.TrimSpace(filter), profileName)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+	return nil
+}
+
+// Checks an app name against an include filter, ignoring case
+func matchesInclude(filter, appName string) bool {
+	name := strings.ToLower(appName)
+	for _, pattern := range strings.Split(filter, ",") {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Captures the windows once and saves each profile with the windows its
+// include filter takes, returning how many each one got. Profiles without a
+// filter and other users' profiles are left out, and profiles whose filter
+// takes none of the open windows are returned as skipped rather than saved
+// empty.
+func batchSave(db *sql.DB, backend WindowBackend, profiles []string) (saved map[string]int, skipped []string, err error) {
+	states := captureForSave(backend)
+	arrangement := currentArrangement(backend)
+
+	saved = make(map[string]int)
+	for _, profileName := range profiles {
+		filter, err := getIncludeFilter(db, profileName)
+		if err != nil {
+			return saved, skipped, err
+		}
+		if filter == "" || checkProfileOwner(db, profileName) != nil {
+			continue
+		}
+
+		var included []WindowState
+		for _, state := range states {
+			if matchesInclude(filter, state.AppName) {
+				included = append(included, state)
+			}
+		}
+		// Its apps aren't open, saving would wipe the layout
+		if len(included) == 0 {
+			skipped = append(skipped, profileName)
+			continue
+		}
+		if err := saveWindowStates(db, profileName, arrangement, included); err != nil {
+			return saved, skipped, fmt.Errorf("error saving profile '%s': %v", profileName, err)
+		}
+		saved[profileName] = len(included)
+	}
+	return saved, skipped, nil
+}
+
+// Lets the user set the include filters of their profiles and save the
+// ticked ones from a single capture, which runs in the background
+func showBatchSaveDialog(db *sql.DB, backend WindowBackend, busy *busyIndicator, parent fyne.Window, onSaved func(saved map[string]int, skipped []string)) {
+	profiles, err := getProfiles(db)
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	var names []string
+	var checks []*widget.Check
+	var filters []*widget.Entry
+	form := container.New(layout.NewFormLayout())
+	for _, profileName := range profiles {
+		if checkProfileOwner(db, profileName) != nil {
+			continue
+		}
+		filter, err := getIncludeFilter(db, profileName)
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+
+		check := widget.NewCheck(profileName, nil)
+		check.SetChecked(filter != "")
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder("e.g. Slack, Mail, Microsoft *")
+		entry.SetText(filter)
+
+		names = append(names, profileName)
+		checks = append(checks, check)
+		filters = append(filters, entry)
+		form.Add(check)
+		form.Add(entry)
+	}
+	if len(names) == 0 {
+		dialog.ShowInformation("Batch Save", "There are no profiles to save yet", parent)
+		return
+	}
+
+	scroll := container.NewVScroll(form)
+	scroll.SetMinSize(fyne.NewSize(550, 300))
+	content := container.NewBorder(widget.NewLabel("Each ticked profile gets the windows of the apps in its filter"), nil, nil, nil, scroll)
+
+	dialog.ShowCustomConfirm("Batch Save", "Save", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		var selected []string
+		for i, profileName := range names {
+			if err := setIncludeFilter(db, profileName, filters[i].Text); err != nil {
+				dialog.ShowError(err, parent)
+				return
+			}
+			if checks[i].Checked {
+				selected = append(selected, profileName)
+			}
+		}
+
+		var saved map[string]int
+		var skipped []string
+		var err error
+		busy.Run("Saving profiles...", func() {
+			saved, skipped, err = batchSave(db, backend, selected)
+		}, func() {
+			if err != nil {
+				dialog.ShowError(err, parent)
+			}
+			onSaved(saved, skipped)
+		})
+	}, parent)
+}
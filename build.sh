@@ -3,4 +3,18 @@
 # Build the application using fyne package
 fyne package -os darwin
 
-echo "Application packaged successfully!"
\ No newline at end of file
+# Let wisa:// links open the app
+PLIST="$(ls -d *.app | head -1)/Contents/Info.plist"
+/usr/libexec/PlistBuddy \
+	-c "Add :CFBundleURLTypes array" \
+	-c "Add :CFBundleURLTypes:0 dict" \
+	-c "Add :CFBundleURLTypes:0:CFBundleURLName string io.github.aixoio.wisa" \
+	-c "Add :CFBundleURLTypes:0:CFBundleURLSchemes array" \
+	-c "Add :CFBundleURLTypes:0:CFBundleURLSchemes:0 string wisa" \
+	"$PLIST"
+
+# AppleScript commands, see wisa.sdef
+cp wisa.sdef "$(dirname "$PLIST")/Resources/"
+/usr/libexec/PlistBuddy -c "Add :OSAScriptingDefinition string wisa.sdef" "$PLIST"
+
+echo "Application packaged successfully!"
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Fyne 2.5 widgets lock their own state, so they can be changed from any
+// goroutine, but updates from several goroutines can interleave halfway.
+// Background work hands its UI updates to serialUI, which runs them one at a
+// time and in order on a goroutine of its own. That only serializes them:
+// they don't run on the main thread, Fyne 2.5 has no way to get there, and
+// don't need to, as its widgets and dialogs can be used from any goroutine.
+// The queue has no limit so an update can queue another without waiting.
+var (
+	uiMu      sync.Mutex
+	uiPending []func()
+	uiWake    = make(chan struct{}, 1)
+)
+
+func startUIUpdates() {
+	go func() {
+		for range uiWake {
+			for {
+				uiMu.Lock()
+				if len(uiPending) == 0 {
+					uiMu.Unlock()
+					break
+				}
+				update := uiPending[0]
+				uiPending = uiPending[1:]
+				uiMu.Unlock()
+				update()
+			}
+		}
+	}()
+}
+
+// Queues a UI update from background work to run after the ones before it
+func serialUI(update func()) {
+	uiMu.Lock()
+	uiPending = append(uiPending, update)
+	uiMu.Unlock()
+	select {
+	case uiWake <- struct{}{}:
+	default:
+	}
+}
+
+// busyIndicator runs capture, restore and database work off the event loop,
+// so the window stays responsive during slow sweeps. A spinner shows while
+// it runs, with a progress bar when the work reports its progress, and the
+// controls that would start more work are disabled.
+type busyIndicator struct {
+	activity *widget.Activity
+	progress *widget.ProgressBar
+	// progressBox keeps the progress bar wide enough to read
+	progressBox *fyne.Container
+	status      *widget.Label
+	// Indicator holds the spinner and progress bar, for the status bar
+	Indicator *fyne.Container
+
+	mu       sync.Mutex
+	running  int
+	controls []fyne.Disableable
+}
+
+func newBusyIndicator(status *widget.Label) *busyIndicator {
+	activity := widget.NewActivity()
+	activity.Hide()
+	progress := widget.NewProgressBar()
+	progressBox := container.NewGridWrap(fyne.NewSize(160, progress.MinSize().Height), progress)
+	progressBox.Hide()
+	return &busyIndicator{
+		activity:    activity,
+		progress:    progress,
+		progressBox: progressBox,
+		status:      status,
+		Indicator:   container.NewHBox(activity, progressBox),
+	}
+}
+
+// Shows how much of the running work is done, from any goroutine
+func (b *busyIndicator) Progress(done, total int) {
+	serialUI(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.running == 0 || total == 0 {
+			return
+		}
+		b.progress.Max = float64(total)
+		b.progress.SetValue(float64(done))
+		b.progressBox.Show()
+	})
+}
+
+// Sets the controls disabled while work runs
+func (b *busyIndicator) SetControls(controls ...fyne.Disableable) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.controls = controls
+}
+
+// Reports whether work is running
+func (b *busyIndicator) Running() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.running > 0
+}
+
+// Shows message and runs work in the background, then done after the UI
+// updates queued before it, see serialUI. Done can be nil.
+func (b *busyIndicator) Run(message string, work func(), done func()) {
+	b.mu.Lock()
+	b.running++
+	if b.running == 1 {
+		for _, control := range b.controls {
+			control.Disable()
+		}
+		b.activity.Show()
+		b.activity.Start()
+	}
+	b.mu.Unlock()
+	if message != "" {
+		b.status.SetText(message)
+	}
+
+	go func() {
+		work()
+		serialUI(func() {
+			b.mu.Lock()
+			b.running--
+			if b.running == 0 {
+				b.activity.Stop()
+				b.activity.Hide()
+				b.progressBox.Hide()
+				b.progress.SetValue(0)
+				for _, control := range b.controls {
+					control.Enable()
+				}
+			}
+			b.mu.Unlock()
+			if done != nil {
+				done()
+			}
+		})
+	}()
+}
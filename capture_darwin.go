@@ -0,0 +1,329 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework CoreGraphics -framework ApplicationServices
+#include <ApplicationServices/ApplicationServices.h>
+#include <libproc.h>
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	char *app;
+	char *bundle;
+	char *title;
+	double x, y, width, height;
+	int minimized;
+	int fullscreen;
+} wisa_window;
+
+typedef struct {
+	wisa_window *items;
+	int count;
+	int capacity;
+} wisa_window_list;
+
+static char *wisa_cfstring(CFTypeRef value) {
+	if (value == NULL || CFGetTypeID(value) != CFStringGetTypeID()) {
+		return strdup("");
+	}
+	CFStringRef str = (CFStringRef)value;
+	CFIndex size = CFStringGetMaximumSizeForEncoding(CFStringGetLength(str), kCFStringEncodingUTF8) + 1;
+	char *buf = malloc(size);
+	if (!CFStringGetCString(str, buf, size, kCFStringEncodingUTF8)) {
+		buf[0] = 0;
+	}
+	return buf;
+}
+
+// Gets the bundle identifier of the app a process belongs to from the .app
+// folder its executable lives in, or an empty string for bare executables
+static char *wisa_bundle_id(pid_t pid) {
+	char path[PROC_PIDPATHINFO_MAXSIZE];
+	if (proc_pidpath(pid, path, sizeof(path)) <= 0) {
+		return strdup("");
+	}
+	char *end = strstr(path, ".app/");
+	if (end == NULL) {
+		return strdup("");
+	}
+	end[4] = 0;
+
+	CFURLRef url = CFURLCreateFromFileSystemRepresentation(NULL, (const UInt8 *)path, strlen(path), true);
+	if (url == NULL) {
+		return strdup("");
+	}
+	CFBundleRef bundle = CFBundleCreate(NULL, url);
+	CFRelease(url);
+	if (bundle == NULL) {
+		return strdup("");
+	}
+	char *id = wisa_cfstring(CFBundleGetIdentifier(bundle));
+	CFRelease(bundle);
+	return id;
+}
+
+static void wisa_append(wisa_window_list *list, char *app, char *bundle, char *title, CGRect frame, int minimized, int fullscreen) {
+	if (list->count == list->capacity) {
+		list->capacity = list->capacity ? list->capacity * 2 : 32;
+		list->items = realloc(list->items, list->capacity * sizeof(wisa_window));
+	}
+	wisa_window *w = &list->items[list->count++];
+	w->app = app;
+	w->bundle = bundle;
+	w->title = title;
+	w->x = frame.origin.x;
+	w->y = frame.origin.y;
+	w->width = frame.size.width;
+	w->height = frame.size.height;
+	w->minimized = minimized;
+	w->fullscreen = fullscreen;
+}
+
+static int wisa_dict_int(CFDictionaryRef dict, CFStringRef key) {
+	int value = 0;
+	CFNumberRef number = (CFNumberRef)CFDictionaryGetValue(dict, key);
+	if (number != NULL) {
+		CFNumberGetValue(number, kCFNumberIntType, &value);
+	}
+	return value;
+}
+
+// Reads the windows of one app through the Accessibility API, which reports
+// titles without needing the screen recording permission
+static int wisa_ax_bool(AXUIElementRef element, CFStringRef attribute) {
+	CFTypeRef value = NULL;
+	int result = 0;
+	if (AXUIElementCopyAttributeValue(element, attribute, &value) == kAXErrorSuccess && value != NULL) {
+		if (CFGetTypeID(value) == CFBooleanGetTypeID()) {
+			result = CFBooleanGetValue((CFBooleanRef)value);
+		}
+		CFRelease(value);
+	}
+	return result;
+}
+
+static void wisa_capture_ax(wisa_window_list *list, pid_t pid, CFTypeRef owner) {
+	AXUIElementRef app = AXUIElementCreateApplication(pid);
+
+	// Hidden apps aren't part of the visible layout
+	if (wisa_ax_bool(app, kAXHiddenAttribute)) {
+		CFRelease(app);
+		return;
+	}
+
+	CFArrayRef windows = NULL;
+	if (AXUIElementCopyAttributeValue(app, kAXWindowsAttribute, (CFTypeRef *)&windows) != kAXErrorSuccess || windows == NULL) {
+		CFRelease(app);
+		return;
+	}
+
+	for (CFIndex i = 0; i < CFArrayGetCount(windows); i++) {
+		AXUIElementRef window = (AXUIElementRef)CFArrayGetValueAtIndex(windows, i);
+		CFTypeRef title = NULL, position = NULL, size = NULL;
+		CGRect frame = CGRectZero;
+
+		AXUIElementCopyAttributeValue(window, kAXTitleAttribute, &title);
+		if (AXUIElementCopyAttributeValue(window, kAXPositionAttribute, &position) == kAXErrorSuccess && position != NULL) {
+			AXValueGetValue((AXValueRef)position, kAXValueCGPointType, &frame.origin);
+			CFRelease(position);
+		}
+		if (AXUIElementCopyAttributeValue(window, kAXSizeAttribute, &size) == kAXErrorSuccess && size != NULL) {
+			AXValueGetValue((AXValueRef)size, kAXValueCGSizeType, &frame.size);
+			CFRelease(size);
+		}
+
+		if (frame.size.width > 0 && frame.size.height > 0) {
+			wisa_append(list, wisa_cfstring(owner), wisa_bundle_id(pid), wisa_cfstring(title), frame,
+				wisa_ax_bool(window, kAXMinimizedAttribute), wisa_ax_bool(window, CFSTR("AXFullScreen")));
+		}
+		if (title != NULL) {
+			CFRelease(title);
+		}
+	}
+
+	CFRelease(windows);
+	CFRelease(app);
+}
+
+// Lists on-screen app windows front to back. Returns the number of windows
+// or -1 if the window server couldn't be queried.
+static int wisa_capture_windows(wisa_window **out) {
+	Boolean trusted = AXIsProcessTrusted();
+
+	// With accessibility access every app with windows is asked for them, so
+	// apps whose windows are all minimized are included too
+	CGWindowListOption options = kCGWindowListExcludeDesktopElements;
+	options |= trusted ? kCGWindowListOptionAll : kCGWindowListOptionOnScreenOnly;
+	CFArrayRef info = CGWindowListCopyWindowInfo(options, kCGNullWindowID);
+	if (info == NULL) {
+		return -1;
+	}
+
+	wisa_window_list list = {0};
+	CFIndex count = CFArrayGetCount(info);
+	pid_t *seen = calloc(count + 1, sizeof(pid_t));
+	int seenCount = 0;
+
+	for (CFIndex i = 0; i < count; i++) {
+		CFDictionaryRef dict = (CFDictionaryRef)CFArrayGetValueAtIndex(info, i);
+
+		// Layer 0 holds normal app windows, the rest are menus, docks and overlays
+		if (wisa_dict_int(dict, kCGWindowLayer) != 0) {
+			continue;
+		}
+
+		CFTypeRef owner = CFDictionaryGetValue(dict, kCGWindowOwnerName);
+		pid_t pid = wisa_dict_int(dict, kCGWindowOwnerPID);
+
+		if (trusted) {
+			int known = 0;
+			for (int j = 0; j < seenCount; j++) {
+				if (seen[j] == pid) {
+					known = 1;
+					break;
+				}
+			}
+			if (!known) {
+				seen[seenCount++] = pid;
+				wisa_capture_ax(&list, pid, owner);
+			}
+			continue;
+		}
+
+		// Without accessibility access fall back to the window server's view
+		CGRect frame = CGRectZero;
+		CFDictionaryRef bounds = (CFDictionaryRef)CFDictionaryGetValue(dict, kCGWindowBounds);
+		if (bounds == NULL || !CGRectMakeWithDictionaryRepresentation(bounds, &frame)) {
+			continue;
+		}
+		wisa_append(&list, wisa_cfstring(owner), wisa_bundle_id(pid), wisa_cfstring(CFDictionaryGetValue(dict, kCGWindowName)), frame, 0, 0);
+	}
+
+	free(seen);
+	CFRelease(info);
+	*out = list.items;
+	return list.count;
+}
+
+typedef struct {
+	char *uuid;
+	double x, y, width, height;
+} wisa_display;
+
+// Lists active displays with their UUIDs, which stay stable across reboots
+// and reconnects unlike display IDs
+static int wisa_list_displays(wisa_display **out) {
+	CGDirectDisplayID ids[32];
+	uint32_t count = 0;
+	if (CGGetActiveDisplayList(32, ids, &count) != kCGErrorSuccess) {
+		return -1;
+	}
+
+	wisa_display *displays = calloc(count + 1, sizeof(wisa_display));
+	for (uint32_t i = 0; i < count; i++) {
+		CGRect bounds = CGDisplayBounds(ids[i]);
+		CFUUIDRef uuid = CGDisplayCreateUUIDFromDisplayID(ids[i]);
+		if (uuid != NULL) {
+			CFStringRef str = CFUUIDCreateString(NULL, uuid);
+			displays[i].uuid = wisa_cfstring(str);
+			CFRelease(str);
+			CFRelease(uuid);
+		} else {
+			displays[i].uuid = strdup("");
+		}
+		displays[i].x = bounds.origin.x;
+		displays[i].y = bounds.origin.y;
+		displays[i].width = bounds.size.width;
+		displays[i].height = bounds.size.height;
+	}
+
+	*out = displays;
+	return count;
+}
+
+static void wisa_free_displays(wisa_display *displays, int count) {
+	for (int i = 0; i < count; i++) {
+		free(displays[i].uuid);
+	}
+	free(displays);
+}
+
+static void wisa_free_windows(wisa_window *windows, int count) {
+	for (int i = 0; i < count; i++) {
+		free(windows[i].app);
+		free(windows[i].bundle);
+		free(windows[i].title);
+	}
+	free(windows);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// Gets the current window states using CGWindowListCopyWindowInfo and the
+// Accessibility API, which is much faster than a System Events sweep
+func captureNative() ([]WindowState, error) {
+	var list *C.wisa_window
+	count := int(C.wisa_capture_windows(&list))
+	if count < 0 {
+		return nil, errors.New("error listing windows from the window server")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	defer C.wisa_free_windows(list, C.int(count))
+
+	windows := unsafe.Slice(list, count)
+	states := make([]WindowState, 0, count)
+	for i, window := range windows {
+		states = append(states, WindowState{
+			AppName:     C.GoString(window.app),
+			BundleID:    C.GoString(window.bundle),
+			WindowTitle: C.GoString(window.title),
+			X:           float64(window.x),
+			Y:           float64(window.y),
+			Width:       float64(window.width),
+			Height:      float64(window.height),
+			Minimized:   window.minimized != 0,
+			FullScreen:  window.fullscreen != 0,
+			// Apps are visited front to back and each app lists its
+			// windows front to back
+			ZOrder: i,
+		})
+	}
+	return states, nil
+}
+
+// Lists the connected displays using CoreGraphics
+func listDisplaysNative() ([]Display, error) {
+	var list *C.wisa_display
+	count := int(C.wisa_list_displays(&list))
+	if count < 0 {
+		return nil, errors.New("error listing displays from the window server")
+	}
+	defer C.wisa_free_displays(list, C.int(count))
+
+	displays := make([]Display, 0, count)
+	for i, display := range unsafe.Slice(list, count) {
+		id := C.GoString(display.uuid)
+		if id == "" {
+			id = fmt.Sprintf("display-%d", i)
+		}
+		displays = append(displays, Display{
+			ID:     id,
+			Index:  i,
+			X:      float64(display.x),
+			Y:      float64(display.y),
+			Width:  float64(display.width),
+			Height: float64(display.height),
+		})
+	}
+	return displays, nil
+}
@@ -0,0 +1,20 @@
+//go:build darwin && !cgo
+
+package main
+
+import "errors"
+
+// Native capture needs cgo, builds without it use AppleScript only
+func captureNative() ([]WindowState, error) {
+	return nil, errors.New("native window capture requires cgo")
+}
+
+// Listing displays needs CoreGraphics, which needs cgo
+func listDisplaysNative() ([]Display, error) {
+	return nil, errors.New("listing displays requires cgo")
+}
+
+// Accessibility observers need cgo
+func watchNative(events chan<- WindowEvent, stop <-chan struct{}) error {
+	return errors.New("watching windows requires cgo")
+}
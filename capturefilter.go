@@ -0,0 +1,79 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// The apps left out of every capture, from the capture_ignore and
+// capture_only settings. Both are lists like include filters, see
+// matchesInclude.
+var (
+	captureFilterMu sync.RWMutex
+	captureIgnore   string
+	captureOnly     string
+)
+
+// Reloads the capture filter from the settings
+func loadCaptureFilter(db *sql.DB) {
+	ignore := getSetting(db, settingCaptureIgnore, "")
+	only := getSetting(db, settingCaptureOnly, "")
+
+	captureFilterMu.Lock()
+	captureIgnore, captureOnly = ignore, only
+	captureFilterMu.Unlock()
+}
+
+// Loads the capture filter for a command that doesn't otherwise need the
+// database, opening it read-only so nothing is created, upgraded or repaired.
+// Without a database every app is captured.
+func loadCaptureFilterReadOnly() {
+	dbPath := getDBPath()
+	if _, err := os.Stat(dbPath); err != nil {
+		return
+	}
+	db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro&_busy_timeout=5000")
+	if err != nil {
+		log.Printf("Error opening database: %v", err)
+		return
+	}
+	defer db.Close()
+	loadCaptureFilter(db)
+}
+
+func setCaptureFilter(db *sql.DB, ignore, only string) error {
+	if err := setSetting(db, settingCaptureIgnore, strings.TrimSpace(ignore)); err != nil {
+		return err
+	}
+	if err := setSetting(db, settingCaptureOnly, strings.TrimSpace(only)); err != nil {
+		return err
+	}
+	loadCaptureFilter(db)
+	return nil
+}
+
+// Drops the windows of apps that are never captured, or that aren't in the
+// only-capture list when there is one
+func filterCapturedApps(states []WindowState) []WindowState {
+	captureFilterMu.RLock()
+	ignore, only := captureIgnore, captureOnly
+	captureFilterMu.RUnlock()
+	if ignore == "" && only == "" {
+		return states
+	}
+
+	kept := make([]WindowState, 0, len(states))
+	for _, state := range states {
+		if matchesInclude(ignore, state.AppName) {
+			continue
+		}
+		if only != "" && !matchesInclude(only, state.AppName) {
+			continue
+		}
+		kept = append(kept, state)
+	}
+	return kept
+}
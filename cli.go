@@ -0,0 +1,599 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const cliUsage = `usage: wisa [-db file] [command]
+
+Without a command the window is opened. -db or the WISA_DB_PATH environment
+variable use another database than the usual one.
+
+commands:
+  list [-search text] [-app name] [-role role] [-since date] [-until date]
+       [-limit n] [-offset n]
+                          list profiles with their window count and last save
+  stale [-days n] [-archive]
+                          list profiles with apps that aren't installed or displays
+                          not seen for n days, archiving them with -archive
+  rename-app <old> <new>  rename an app in the windows of every profile, e.g. after
+                          it was replaced by a successor
+  provision <file.yaml>   create profiles, triggers, quirks and settings from a file
+  save <profile>          capture the open windows into a profile, replacing its
+                          layout for the connected displays in one transaction
+  capture [-json]         print the open windows without saving them, as JSON
+                          window states with -json
+  restore <profile>       restore a profile, through the open window or daemon's
+                          restore queue when one is running
+  apply [-preview] <file|->
+                          restore a JSON or YAML layout from a file or stdin
+                          without saving it in a profile
+  batch-save [profile...]  capture once and save every profile with an include
+                          filter, or just the ones named
+  export [-profile name] [-strip] [-o file.json]
+                          write profiles as JSON, all of them unless -profile is given
+  import [-force] <file.json|url>
+                          create the profiles in an export, from a file or an
+                          https:// link, -force replaces ones that exist
+  layout-key <key-file>   print the public key of a signing key, creating it when
+                          the file doesn't exist
+  sign <key-file> <file.json>
+                          sign an export for import by URL, writing file.json.sig
+  backup <file.db>        copy the database to a file
+  restore-backup <file.db>
+                          replace everything with the contents of a backup
+  token create <name> <read|restore|admin>
+                          create a token for the local API
+  token list              list the API tokens
+  token revoke <id>       delete an API token
+  api on [port]           start the local API with the window or daemon, on
+                          localhost port 7765 unless another is given
+  api off                 stop starting the local API
+  url register            make wisa:// links open wisa (Windows and Linux, the
+                          macOS app registers them itself)
+  wisa://restore?profile=<name>, wisa://save?profile=<name>
+                          restore or save a profile from a link
+  watch                   print window changes as they happen until interrupted
+  daemon                  apply profiles from display, schedule and hotkey triggers
+                          without opening the window
+  daemon plist            print the launchd job that runs the daemon at login
+  daemon install          install and start the launchd job (macOS)
+  daemon uninstall        stop and remove the launchd job (macOS)
+`
+
+// Runs a command line subcommand and returns the exit code. Engine is the
+// restore engine of the open window or daemon, nil when running on its own.
+func runCLI(db *sql.DB, engine *restoreEngine, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if isWisaURL(args[0]) && len(args) == 1 {
+		return runLink(db, engine, args[0], stdin, stdout, stderr)
+	}
+
+	switch args[0] {
+	case "provision":
+		if len(args) != 2 {
+			fmt.Fprint(stderr, cliUsage)
+			return 2
+		}
+		file, err := readProvisionFile(args[1])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		if err := provision(db, file); err != nil {
+			fmt.Fprintf(stderr, "error provisioning: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Provisioned %d profiles from %s\n", len(file.Profiles), args[1])
+		return 0
+	case "save":
+		if len(args) != 2 {
+			fmt.Fprint(stderr, cliUsage)
+			return 2
+		}
+		backend := newBackend()
+		states := captureForSave(backend)
+		if err := saveWindowStates(db, args[1], currentArrangement(backend), states); err != nil {
+			fmt.Fprintf(stderr, "error saving: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Saved %d window states to profile '%s'\n", len(states), args[1])
+		return 0
+	case "capture":
+		return runCapture(args[1:], stdout, stderr)
+	case "restore":
+		if len(args) != 2 {
+			fmt.Fprint(stderr, cliUsage)
+			return 2
+		}
+		if engine == nil {
+			engine = newRestoreEngine(db, newBackend())
+		}
+		type result struct {
+			count int
+			err   error
+		}
+		done := make(chan result, 1)
+		engine.Enqueue(args[1], "cli", restoreOptions{}, func(count int, err error) {
+			done <- result{count, err}
+		})
+		res := <-done
+		if res.err != nil {
+			fmt.Fprintf(stderr, "error restoring: %v\n", res.err)
+			var restoreErr *RestoreError
+			if errors.As(res.err, &restoreErr) {
+				printRestoreReport(stderr, restoreErr.Results)
+			}
+			return 1
+		}
+		fmt.Fprintf(stdout, "Restored %d window states from profile '%s'\n", res.count, args[1])
+		if hookErr := engine.LastHookError(args[1]); hookErr != nil {
+			fmt.Fprintln(stdout, hookErr)
+		}
+		printRestoreReport(stdout, engine.LastResults(args[1]))
+		return 0
+	case "layout-key":
+		return runLayoutKey(args[1:], stdout, stderr)
+	case "sign":
+		return runSign(args[1:], stdout, stderr)
+	case "apply":
+		return runApply(db, engine, args[1:], stdin, stdout, stderr)
+	case "url":
+		return runURLCommand(args[1:], stdout, stderr)
+	case "batch-save":
+		profiles := args[1:]
+		if len(profiles) == 0 {
+			var err error
+			profiles, err = getProfiles(db)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+		}
+		saved, skipped, err := batchSave(db, newBackend(), profiles)
+		for profileName, count := range saved {
+			fmt.Fprintf(stdout, "Saved %d window states to profile '%s'\n", count, profileName)
+		}
+		for _, profileName := range skipped {
+			fmt.Fprintf(stdout, "Skipped profile '%s', none of its apps have windows open\n", profileName)
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case "list":
+		return runList(db, args[1:], stdout, stderr)
+	case "stale":
+		return runStale(db, args[1:], stdout, stderr)
+	case "rename-app":
+		if len(args) != 3 {
+			fmt.Fprint(stderr, cliUsage)
+			return 2
+		}
+		changed, err := renameApps(db, map[string]string{args[1]: args[2]})
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "Renamed %s to %s in %s\n", args[1], args[2], plural(int(changed), "window"))
+		return 0
+	case "export":
+		return runExport(db, args[1:], stdout, stderr)
+	case "import":
+		return runImport(db, args[1:], stdout, stderr)
+	case "backup", "restore-backup":
+		if len(args) != 2 {
+			fmt.Fprint(stderr, cliUsage)
+			return 2
+		}
+		var err error
+		if args[0] == "backup" {
+			err = backupDatabase(db, args[1])
+		} else {
+			err = restoreDatabase(db, args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	case "token":
+		return runToken(db, args[1:], stdout, stderr)
+	case "api":
+		return runAPICommand(db, args[1:], stdout, stderr)
+	case "watch":
+		runWatch(stdout)
+		return 0
+	case "daemon":
+		return runDaemonCommand(db, args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, cliUsage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], cliUsage)
+		return 2
+	}
+}
+
+func runStale(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("stale", flag.ContinueOnError)
+	days := flags.Int("days", getStaleAfterDays(db), "days a display must be gone")
+	archive := flags.Bool("archive", false, "archive the stale profiles")
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	check, err := gatherStaleCheck(db, newBackend())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	stale := check.staleProfiles(*days)
+	if len(stale) == 0 {
+		fmt.Fprintln(stdout, "No stale profiles")
+		return 0
+	}
+	for _, profile := range stale {
+		fmt.Fprintln(stdout, profile)
+		if *archive {
+			if err := archiveProfile(db, profile.Name); err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+		}
+	}
+	if *archive {
+		fmt.Fprintf(stdout, "Archived %s\n", plural(len(stale), "profile"))
+	}
+	return 0
+}
+
+func runList(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	search := flags.String("search", "", "part of a profile or app name")
+	app := flags.String("app", "", "only profiles with a window of this app")
+	role := flags.String("role", "", "only profiles with a window of this role")
+	since := flags.String("since", "", "only profiles saved on or after this date (YYYY-MM-DD)")
+	until := flags.String("until", "", "only profiles saved before this date (YYYY-MM-DD)")
+	limit := flags.Int("limit", 0, "most profiles to list, 0 for all")
+	offset := flags.Int("offset", 0, "profiles to skip")
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	query := profileQuery{Search: *search, App: *app, Role: *role, Limit: *limit, Offset: *offset}
+	var err error
+	if *since != "" {
+		if query.UpdatedAfter, err = parseQueryDate(*since); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	if *until != "" {
+		if query.UpdatedBefore, err = parseQueryDate(*until); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	profiles, total, err := queryProfiles(db, query)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	for _, profile := range profiles {
+		updated := "-"
+		if !profile.Updated.IsZero() {
+			updated = profile.Updated.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(stdout, "%s\t%d windows\trevision %d\t%s\n", profile.Name, profile.Windows, profile.Revision, updated)
+	}
+	if len(profiles) < total {
+		fmt.Fprintf(stderr, "Showing %d of %d profiles\n", len(profiles), total)
+	}
+	return 0
+}
+
+// Prints the windows of a restore that weren't simply moved into place, one
+// per line
+func printRestoreReport(w io.Writer, results []restoreResult) {
+	for _, result := range results {
+		switch {
+		case !result.Restored():
+			fmt.Fprintf(w, "%s - %s: %s\n", result.State.AppName, result.State.WindowTitle, describeRestoreResult(result))
+		case result.OnScreen:
+			fmt.Fprintf(w, "%s - %s: brought back on screen\n", result.State.AppName, result.State.WindowTitle)
+		}
+	}
+}
+
+// Restores a layout read from a file, or stdin when the file is -
+func runApply(db *sql.DB, engine *restoreEngine, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	preview := flags.Bool("preview", false, "flash where the windows go before moving them")
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	name := flags.Arg(0)
+	in := stdin
+	if name == "-" {
+		name = "stdin"
+	} else {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+	states, err := readLayout(in)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	if engine == nil {
+		engine = newRestoreEngine(db, newBackend())
+	}
+	count, err := engine.ApplyLayout(name, states, restoreOptions{Preview: *preview, Source: "cli"})
+	if err != nil {
+		fmt.Fprintf(stderr, "error restoring: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Restored %d window states from %s\n", count, name)
+	return 0
+}
+
+// Prints the open windows, as a JSON array of window states with -json or
+// otherwise as tab separated lines: app, title, position and size
+func runCapture(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("capture", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print JSON window states")
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	states := captureStates(newBackend())
+	if *asJSON {
+		if states == nil {
+			states = []WindowState{}
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(states); err != nil {
+			fmt.Fprintf(stderr, "error writing JSON: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	for _, state := range states {
+		fmt.Fprintf(stdout, "%s\t%s\t%.0f,%.0f\t%.0fx%.0f\n", state.AppName, state.WindowTitle, state.X, state.Y, state.Width, state.Height)
+	}
+	return 0
+}
+
+func runImport(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	force := flags.Bool("force", false, "replace profiles that already exist")
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	source := flags.Arg(0)
+	var bundle *exportBundle
+	if isImportURL(source) {
+		var err error
+		if bundle, err = fetchExport(db, source); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	} else {
+		file, err := os.Open(source)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		if bundle, err = readExport(file); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if !*force {
+		existing, err := existingImports(db, bundle)
+		if err != nil {
+			fmt.Fprintf(stderr, "error importing: %v\n", err)
+			return 1
+		}
+		if len(existing) > 0 {
+			fmt.Fprintf(stderr, "error importing: profiles %s already exist, use -force to replace them\n", strings.Join(existing, ", "))
+			return 1
+		}
+	}
+
+	if err := importProfiles(db, bundle); err != nil {
+		fmt.Fprintf(stderr, "error importing: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Imported %d profiles from %s\n", len(bundle.Profiles), source)
+	return 0
+}
+
+func runExport(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	profile := flags.String("profile", "", "profile to export")
+	strip := flags.Bool("strip", false, "leave out display IDs and machine-specific environment actions")
+	output := flags.String("o", "", "file to write instead of stdout")
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var names []string
+	if *profile != "" {
+		names = []string{*profile}
+	}
+	bundle, err := exportProfiles(db, names, exportOptions{StripMachine: *strip})
+	if err != nil {
+		fmt.Fprintf(stderr, "error exporting: %v\n", err)
+		return 1
+	}
+
+	out := stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	if err := writeExport(out, bundle); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runToken(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	switch {
+	case len(args) == 3 && args[0] == "create":
+		token, err := createAPIToken(db, args[1], args[2])
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, token)
+		fmt.Fprintln(stderr, "Store this token now, it can't be shown again")
+		return 0
+	case len(args) == 1 && args[0] == "list":
+		tokens, err := getAPITokens(db)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		for _, t := range tokens {
+			fmt.Fprintf(stdout, "%d\t%s\t%s\t%s\n", t.ID, t.Name, t.Scope, t.Created.Format("2006-01-02"))
+		}
+		return 0
+	case len(args) == 2 && args[0] == "revoke":
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(stderr, "invalid token id %q\n", args[1])
+			return 2
+		}
+		if err := revokeAPIToken(db, id); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+}
+
+func runAPICommand(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	var err error
+	switch {
+	case len(args) >= 1 && len(args) <= 2 && args[0] == "on":
+		if len(args) == 2 {
+			port, convErr := strconv.Atoi(args[1])
+			if convErr != nil || port < 1 || port > 65535 {
+				fmt.Fprintf(stderr, "invalid port %q\n", args[1])
+				return 2
+			}
+			err = setSetting(db, settingAPIPort, strconv.Itoa(port))
+		}
+		if err == nil {
+			err = setBoolSetting(db, settingAPIEnabled, true)
+		}
+		if err == nil {
+			fmt.Fprintln(stdout, "The local API starts the next time the window or daemon is opened")
+		}
+	case len(args) == 1 && args[0] == "off":
+		err = setBoolSetting(db, settingAPIEnabled, false)
+	default:
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func runDaemonCommand(db *sql.DB, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		runDaemon(db)
+		return 0
+	}
+	if len(args) != 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "plist":
+		var plist string
+		plist, err = launchAgentPlist()
+		if err == nil {
+			fmt.Fprint(stdout, plist)
+		}
+	case "install":
+		err = installLaunchAgent()
+		if err == nil {
+			fmt.Fprintln(stdout, "Installed the daemon, it starts at login")
+		}
+	case "uninstall":
+		err = uninstallLaunchAgent()
+		if err == nil {
+			fmt.Fprintln(stdout, "Removed the daemon")
+		}
+	default:
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// Prints window events as tab separated lines: time, kind, app and title
+func runWatch(stdout io.Writer) {
+	events := make(chan WindowEvent, 64)
+	watchWindows(newBackend(), events, nil)
+	for event := range events {
+		fmt.Fprintf(stdout, "%s\t%s\t%s\t%s\n", time.Now().Format("15:04:05.000"), event.Kind, event.AppName, event.WindowTitle)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commands like osascript, wmctrl or yabai are killed when they run longer
+// than the command timeout, so one hung System Events call can't hold up a
+// restore forever. Cancelling a restore kills the commands run with its
+// context too, captures and everything else wisa runs meanwhile carry on.
+
+// How long a command may run when command_timeout isn't set
+const defaultCommandTimeout = 30 * time.Second
+
+var errRestoreCancelled = errors.New("restore cancelled")
+
+// commandTimeoutError is returned for a command that was killed for running
+// too long
+type commandTimeoutError struct {
+	Name    string
+	Timeout time.Duration
+}
+
+func (e *commandTimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %v", e.Name, e.Timeout)
+}
+
+// The command timeout, from the command_timeout setting
+var (
+	commandTimeoutMu      sync.RWMutex
+	currentCommandTimeout = defaultCommandTimeout
+)
+
+// Parses a timeout setting in seconds, empty for the default
+func parseCommandTimeout(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultCommandTimeout, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 1 || seconds > 600 {
+		return 0, fmt.Errorf("invalid command timeout %q, use 1 up to 600 seconds", value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Reloads the command timeout from the settings, using the default if it's
+// invalid
+func loadCommandTimeout(db *sql.DB) {
+	timeout, err := parseCommandTimeout(getSetting(db, settingCommandTimeout, ""))
+	if err != nil {
+		timeout = defaultCommandTimeout
+	}
+
+	commandTimeoutMu.Lock()
+	currentCommandTimeout = timeout
+	commandTimeoutMu.Unlock()
+}
+
+func setCommandTimeout(db *sql.DB, value string) error {
+	timeout, err := parseCommandTimeout(value)
+	if err != nil {
+		return err
+	}
+	if err := setSetting(db, settingCommandTimeout, strconv.Itoa(int(timeout/time.Second))); err != nil {
+		return err
+	}
+	loadCommandTimeout(db)
+	return nil
+}
+
+func getCommandTimeout() time.Duration {
+	commandTimeoutMu.RLock()
+	defer commandTimeoutMu.RUnlock()
+	return currentCommandTimeout
+}
+
+// Cancels the running restore's context, for cancelRestore. Restores run
+// one at a time, so there's only ever one.
+var (
+	restoreCancelMu sync.Mutex
+	restoreCancel   context.CancelFunc
+)
+
+// Makes the context for the restore about to run, cancelled by
+// cancelRestore. Call the returned func once it's done.
+func beginCancellable() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	restoreCancelMu.Lock()
+	restoreCancel = cancel
+	restoreCancelMu.Unlock()
+
+	return ctx, func() {
+		cancel()
+		restoreCancelMu.Lock()
+		restoreCancel = nil
+		restoreCancelMu.Unlock()
+	}
+}
+
+// Cancels the running restore, reporting whether there was one
+func cancelRestore() bool {
+	restoreCancelMu.Lock()
+	defer restoreCancelMu.Unlock()
+	if restoreCancel == nil {
+		return false
+	}
+	restoreCancel()
+	return true
+}
+
+// Makes a command that's killed once timeout passes or parent is done,
+// parent being a restore's context or context.Background(). Pass what running
+// it returned to done, which says why it was killed if it was.
+func newCommand(parent context.Context, timeout time.Duration, name string, args ...string) (cmd *exec.Cmd, done func(error) error) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	cmd = exec.CommandContext(ctx, name, args...)
+	// Don't wait on children that kept the output open
+	cmd.WaitDelay = time.Second
+
+	return cmd, func(err error) error {
+		defer cancel()
+		switch {
+		case err == nil:
+			return nil
+		case parent.Err() != nil:
+			return errRestoreCancelled
+		case ctx.Err() == context.DeadlineExceeded:
+			return &commandTimeoutError{Name: name, Timeout: timeout}
+		}
+		return err
+	}
+}
+
+// Runs a command within the command timeout
+func runCommand(name string, args ...string) error {
+	return runCommandContext(context.Background(), name, args...)
+}
+
+// Runs a command within the command timeout that's killed when ctx is done
+func runCommandContext(ctx context.Context, name string, args ...string) error {
+	cmd, done := newCommand(ctx, getCommandTimeout(), name, args...)
+	return done(cmd.Run())
+}
+
+// Runs a command within the command timeout and returns its output
+func commandOutput(name string, args ...string) ([]byte, error) {
+	cmd, done := newCommand(context.Background(), getCommandTimeout(), name, args...)
+	output, err := cmd.Output()
+	return output, done(err)
+}
+
+// Runs a command within the command timeout and returns its output and
+// errors together
+func commandCombinedOutput(name string, args ...string) ([]byte, error) {
+	return commandCombinedOutputContext(context.Background(), name, args...)
+}
+
+// Like commandCombinedOutput, but the command is killed when ctx is done
+func commandCombinedOutputContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd, done := newCommand(ctx, getCommandTimeout(), name, args...)
+	output, err := cmd.CombinedOutput()
+	return output, done(err)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// How many windows are restored at once when restore_concurrency isn't set
+const defaultRestoreConcurrency = 4
+
+// The most windows restored at once, from the restore_concurrency setting
+var (
+	restoreConcurrencyMu      sync.RWMutex
+	currentRestoreConcurrency = defaultRestoreConcurrency
+)
+
+// Parses a concurrency setting, empty for the default
+func parseRestoreConcurrency(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRestoreConcurrency, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > 32 {
+		return 0, fmt.Errorf("invalid restore concurrency %q, use 1 up to 32", value)
+	}
+	return limit, nil
+}
+
+// Reloads the concurrency from the settings, using the default if it's
+// invalid
+func loadRestoreConcurrency(db *sql.DB) {
+	limit, err := parseRestoreConcurrency(getSetting(db, settingRestoreConcurrency, ""))
+	if err != nil {
+		limit = defaultRestoreConcurrency
+	}
+
+	restoreConcurrencyMu.Lock()
+	currentRestoreConcurrency = limit
+	restoreConcurrencyMu.Unlock()
+}
+
+func setRestoreConcurrency(db *sql.DB, value string) error {
+	limit, err := parseRestoreConcurrency(value)
+	if err != nil {
+		return err
+	}
+	if err := setSetting(db, settingRestoreConcurrency, strconv.Itoa(limit)); err != nil {
+		return err
+	}
+	loadRestoreConcurrency(db)
+	return nil
+}
+
+func getRestoreConcurrency() int {
+	restoreConcurrencyMu.RLock()
+	defer restoreConcurrencyMu.RUnlock()
+	return currentRestoreConcurrency
+}
+
+// How many windows the running restore has moved, for the progress bar
+var (
+	restoreProgressMu sync.Mutex
+	restoreProgress   func(done, total int)
+	restoredWindows   int
+)
+
+// Sends the progress of the restore about to run to report, which can be
+// nil, until the returned func is called
+func beginRestoreProgress(report func(done, total int)) func() {
+	restoreProgressMu.Lock()
+	restoreProgress, restoredWindows = report, 0
+	restoreProgressMu.Unlock()
+
+	return func() {
+		restoreProgressMu.Lock()
+		restoreProgress = nil
+		restoreProgressMu.Unlock()
+	}
+}
+
+// Counts one more of total windows as done
+func windowRestored(total int) {
+	restoreProgressMu.Lock()
+	restoredWindows++
+	report, done := restoreProgress, restoredWindows
+	restoreProgressMu.Unlock()
+	if report != nil {
+		report(done, total)
+	}
+}
+
+// Calls restore for each state, running up to the restore concurrency at
+// once, and collects the failures in the order of the states. The windows
+// of one app are restored one after another so its scripting isn't asked
+// two things at once, and apps that have to be activated first take turns
+// since only one app can be active. Windows not reached before the restore is
+// cancelled fail with errRestoreCancelled.
+func restoreEach(ctx context.Context, states []WindowState, restore func(state WindowState) error) error {
+	const activating = "\x00activate"
+	var groups [][]int
+	groupOf := make(map[string]int)
+	for i, state := range states {
+		key := state.AppName
+		if quirkFor(state.AppName).ActivateFirst {
+			key = activating
+		}
+		group, ok := groupOf[key]
+		if !ok {
+			group = len(groups)
+			groupOf[key] = group
+			groups = append(groups, nil)
+		}
+		groups[group] = append(groups[group], i)
+	}
+
+	errs := make([]error, len(states))
+	slots := make(chan struct{}, getRestoreConcurrency())
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			for _, i := range group {
+				if ctx.Err() != nil {
+					errs[i] = errRestoreCancelled
+				} else {
+					errs[i] = restore(states[i])
+				}
+				windowRestored(len(states))
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failures []RestoreFailure
+	for i, err := range errs {
+		if err != nil {
+			failures = append(failures, RestoreFailure{State: states[i], Err: err})
+		}
+	}
+	if len(failures) > 0 {
+		return &RestoreError{Failures: failures, Total: len(states)}
+	}
+	return nil
+}
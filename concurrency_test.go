@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRestoreEachOrder(t *testing.T) {
+	// Word and Excel both have to be activated first, so they take turns
+	states := []WindowState{
+		{AppName: "Terminal", WindowTitle: "1"},
+		{AppName: "Microsoft Word", WindowTitle: "1"},
+		{AppName: "Safari", WindowTitle: "1"},
+		{AppName: "Terminal", WindowTitle: "2"},
+		{AppName: "Microsoft Excel", WindowTitle: "1"},
+		{AppName: "Safari", WindowTitle: "2"},
+		{AppName: "Terminal", WindowTitle: "3"},
+		{AppName: "Microsoft Word", WindowTitle: "2"},
+	}
+	groupOf := func(state WindowState) string {
+		if quirkFor(state.AppName).ActivateFirst {
+			return "activate"
+		}
+		return state.AppName
+	}
+
+	var mu sync.Mutex
+	running := make(map[string]int)
+	order := make(map[string][]string)
+	overlapped := false
+	err := restoreEach(context.Background(), states, func(state WindowState) error {
+		group := groupOf(state)
+		mu.Lock()
+		running[group]++
+		overlapped = overlapped || running[group] > 1
+		order[group] = append(order[group], state.AppName+" "+state.WindowTitle)
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		running[group]--
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("restoreEach returned %v", err)
+	}
+	if overlapped {
+		t.Error("restoreEach restored two windows of one group at once")
+	}
+
+	want := map[string][]string{
+		"Terminal": {"Terminal 1", "Terminal 2", "Terminal 3"},
+		"Safari":   {"Safari 1", "Safari 2"},
+		"activate": {"Microsoft Word 1", "Microsoft Excel 1", "Microsoft Word 2"},
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("restoreEach restored in the order %q, want %q", order, want)
+	}
+}
+
+func TestRestoreEachFailures(t *testing.T) {
+	states := []WindowState{
+		{AppName: "Slow", WindowTitle: "1"},
+		{AppName: "Fast", WindowTitle: "1"},
+		{AppName: "Fine", WindowTitle: "1"},
+		{AppName: "Fast", WindowTitle: "2"},
+	}
+	failing := errors.New("window not found")
+	err := restoreEach(context.Background(), states, func(state WindowState) error {
+		switch state.AppName {
+		case "Slow":
+			time.Sleep(10 * time.Millisecond)
+			return failing
+		case "Fast":
+			return failing
+		}
+		return nil
+	})
+
+	var restoreErr *RestoreError
+	if !errors.As(err, &restoreErr) {
+		t.Fatalf("restoreEach returned %v, want a *RestoreError", err)
+	}
+	if restoreErr.Total != len(states) {
+		t.Errorf("RestoreError.Total = %d, want %d", restoreErr.Total, len(states))
+	}
+	var got []WindowState
+	for _, failure := range restoreErr.Failures {
+		if failure.Err != failing {
+			t.Errorf("failure of %+v is %v, want %v", failure.State, failure.Err, failing)
+		}
+		got = append(got, failure.State)
+	}
+	want := []WindowState{states[0], states[1], states[3]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("restoreEach failures = %+v, want them in the order of the states %+v", got, want)
+	}
+}
+
+func TestRestoreEachCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	states := []WindowState{{AppName: "Terminal"}, {AppName: "Safari"}}
+	called := false
+	err := restoreEach(ctx, states, func(state WindowState) error {
+		called = true
+		return nil
+	})
+	if called {
+		t.Error("restoreEach restored a window after the restore was cancelled")
+	}
+	var restoreErr *RestoreError
+	if !errors.As(err, &restoreErr) || len(restoreErr.Failures) != len(states) {
+		t.Fatalf("restoreEach returned %v, want every window to fail", err)
+	}
+	for _, failure := range restoreErr.Failures {
+		if failure.Err != errRestoreCancelled {
+			t.Errorf("failure of %+v is %v, want %v", failure.State, failure.Err, errRestoreCancelled)
+		}
+	}
+}
+
+func TestParseRestoreConcurrency(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "", want: defaultRestoreConcurrency},
+		{value: " 8 ", want: 8},
+		{value: "1", want: 1},
+		{value: "32", want: 32},
+		{value: "0", wantErr: true},
+		{value: "33", wantErr: true},
+		{value: "four", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseRestoreConcurrency(test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("parseRestoreConcurrency(%q) = %d, %v, want %d, error %v", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
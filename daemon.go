@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// Label of the launchd job that starts the daemon at login
+const launchAgentLabel = "io.github.aixoio.wisa"
+
+// Runs the automatic triggers without opening the window until interrupted
+func runDaemon(db *sql.DB) {
+	backend := newBackend()
+	engine := newRestoreEngine(db, backend)
+	startWindowIndex(backend, windowIndexInterval)
+	startIPCServer(engine)
+
+	// There's nobody to ask, so triggers apply straight away even when they
+	// are set to ask first
+	hooks := triggerHooks{
+		Notify: func(profileName string, count int, err error) {
+			if err != nil {
+				log.Printf("Error auto-restoring profile '%s': %v", profileName, err)
+				return
+			}
+			log.Printf("Auto-restored %d window states from profile '%s'", count, profileName)
+		},
+		Saved: func(profileName string, count int, err error) {
+			if err != nil {
+				log.Printf("Error saving window states: %v", err)
+				return
+			}
+			log.Printf("Saved %d window states to profile '%s'", count, profileName)
+		},
+	}
+	go watchDisplays(engine, 3*time.Second, hooks)
+	startPruner(db)
+	go watchSchedules(engine, hooks)
+	startHotkeys(engine, hooks)
+	startAPIServer(engine, hooks)
+
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Printf("Stopping daemon")
+		db.Close()
+		os.Exit(0)
+	}()
+
+	log.Printf("Daemon started, watching displays, schedules and hotkeys")
+	// Hotkeys are delivered through the main thread's event loop
+	runHotkeyLoop()
+}
+
+// Where the launchd job is installed for the current user
+func launchAgentPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return filepath.Join(homeDir, "Library", "LaunchAgents", launchAgentLabel+".plist"), nil
+}
+
+// Builds the launchd job that runs this executable as a daemon at login
+func launchAgentPlist() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("error finding the wisa executable: %v", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return "", fmt.Errorf("error finding the wisa executable: %v", err)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	logPath := filepath.Join(homeDir, "Library", "Logs", "wisa.log")
+
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>daemon</string>
+	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ProcessType</key>
+	<string>Interactive</string>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`, launchAgentLabel, html.EscapeString(executable), html.EscapeString(logPath), html.EscapeString(logPath)), nil
+}
+
+// Writes the launchd job and loads it, so the daemon starts now and at
+// every login
+func installLaunchAgent() error {
+	if runtime.GOOS != "darwin" {
+		return errors.New("launchd is only available on macOS")
+	}
+
+	plist, err := launchAgentPlist()
+	if err != nil {
+		return err
+	}
+	path, err := launchAgentPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating LaunchAgents folder: %v", err)
+	}
+
+	// Unload an older copy first so the new one is picked up
+	if _, err := os.Stat(path); err == nil {
+		runCommand("launchctl", "unload", path)
+	}
+	if err := os.WriteFile(path, []byte(plist), 0644); err != nil {
+		return fmt.Errorf("error writing launchd job: %v", err)
+	}
+	if output, err := commandCombinedOutput("launchctl", "load", "-w", path); err != nil {
+		return fmt.Errorf("error loading launchd job: %v: %s", err, output)
+	}
+	return nil
+}
+
+// Stops the daemon and removes its launchd job
+func uninstallLaunchAgent() error {
+	if runtime.GOOS != "darwin" {
+		return errors.New("launchd is only available on macOS")
+	}
+
+	path, err := launchAgentPath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return fmt.Errorf("the daemon isn't installed")
+	}
+	if output, err := commandCombinedOutput("launchctl", "unload", "-w", path); err != nil {
+		log.Printf("Error unloading launchd job: %v: %s", err, output)
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("error removing launchd job: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The database is found, in order, from the -db flag, the WISA_DB_PATH
+// environment variable, the location picked in Preferences and otherwise
+// in the config folder, e.g. ~/Library/Application Support/wisa/wisa.db.
+// Older versions kept it in the home folder, it's moved from there the first
+// time it's opened.
+
+// Set by the -db flag before the subcommand
+var dbPathFlag string
+
+// The environment variable that overrides the database location
+const dbPathEnv = "WISA_DB_PATH"
+
+// Where wisa's own files go, e.g. ~/Library/Application Support/wisa
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the config folder: %v", err)
+	}
+	return filepath.Join(dir, "wisa"), nil
+}
+
+// Where older versions kept the database
+func legacyDBPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Fatalf("Error getting home directory: %v", err)
+	}
+	return filepath.Join(homeDir, "wisa.db")
+}
+
+// The database's location when nothing else picks one. The old location
+// is used while its file couldn't be moved.
+func defaultDBPath() string {
+	dir, err := configDir()
+	if err != nil {
+		log.Printf("%v", err)
+		return legacyDBPath()
+	}
+	path := filepath.Join(dir, "wisa.db")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(legacyDBPath()); err == nil {
+			return legacyDBPath()
+		}
+	}
+	return path
+}
+
+// The file holding the location picked in Preferences, the database can't
+// hold its own
+func dbConfigPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "db_path"), nil
+}
+
+// Gets the location picked in Preferences, empty if none was
+func configuredDBPath() string {
+	path, err := dbConfigPath()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Saves the location picked in Preferences, empty goes back to the default
+func setConfiguredDBPath(dbPath string) error {
+	path, err := dbConfigPath()
+	if err != nil {
+		return err
+	}
+	if dbPath == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error saving database location: %v", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error saving database location: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(dbPath+"\n"), 0o644); err != nil {
+		return fmt.Errorf("error saving database location: %v", err)
+	}
+	return nil
+}
+
+// Says where the database location comes from, for Preferences
+func dbPathSource() string {
+	switch {
+	case dbPathOverride != "":
+		return "opened after the usual database failed"
+	case dbPathFlag != "":
+		return "set with -db"
+	case os.Getenv(dbPathEnv) != "":
+		return "set by " + dbPathEnv
+	case configuredDBPath() != "":
+		return "picked in Preferences"
+	}
+	return "the default"
+}
+
+var moveLegacyOnce sync.Once
+
+// Moves the database, its backups and SQLite's side files from the home
+// folder to the config folder, once and only when the default location is
+// used. If it fails wisa keeps using the old location.
+func moveLegacyDB() {
+	moveLegacyOnce.Do(func() {
+		if dbPathFlag != "" || os.Getenv(dbPathEnv) != "" || configuredDBPath() != "" {
+			return
+		}
+		legacy := legacyDBPath()
+		if _, err := os.Stat(legacy); err != nil {
+			return
+		}
+		dir, err := configDir()
+		if err != nil {
+			return
+		}
+		target := filepath.Join(dir, "wisa.db")
+		if _, err := os.Stat(target); err == nil {
+			return
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Printf("Error moving database: %v", err)
+			return
+		}
+
+		if err := os.Rename(legacy, target); err != nil {
+			log.Printf("Error moving database to %s, using %s: %v", target, legacy, err)
+			return
+		}
+		for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+			if err := os.Rename(legacy+suffix, target+suffix); err != nil && !os.IsNotExist(err) {
+				log.Printf("Error moving database: %v", err)
+			}
+		}
+		oldBackups := filepath.Join(filepath.Dir(legacy), ".wisa-backups")
+		if _, err := os.Stat(oldBackups); err == nil {
+			if err := os.Rename(oldBackups, filepath.Join(dir, ".wisa-backups")); err != nil {
+				log.Printf("Error moving backups: %v", err)
+			}
+		}
+		log.Printf("Moved the database from %s to %s", legacy, target)
+	})
+}
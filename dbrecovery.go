@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Checks that SQLite can read every page of the database
+func checkIntegrity(db *sql.DB) error {
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("error checking database: %v", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("database is damaged: %s", result)
+	}
+	return nil
+}
+
+// Moves a database that can't be opened out of the way, along with its
+// journal files, and returns where it went
+func moveDatabaseAside(path string) (string, error) {
+	damaged := fmt.Sprintf("%s.damaged-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, damaged); err != nil {
+		return "", fmt.Errorf("error moving damaged database: %v", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Rename(path+suffix, damaged+suffix); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error moving %s: %v", path+suffix, err)
+		}
+	}
+	return damaged, nil
+}
+
+// Starts a new, empty database at path
+func createDatabase(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error creating database: %v", err)
+	}
+	if err := migrateDB(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating database: %v", err)
+	}
+	return db, nil
+}
+
+// Replaces the database at path with a backup, keeping the old file next to
+// it
+func replaceWithBackup(path, backup string) error {
+	damaged, err := moveDatabaseAside(path)
+	if err != nil {
+		return err
+	}
+	log.Printf("Moved the database that couldn't be opened to %s", damaged)
+
+	db, err := createDatabase(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return restoreDatabase(db, backup)
+}
+
+// Copies every row that can still be read from the database at path into a
+// new database in its place, keeping the old file next to it. Returns what
+// it saved.
+func salvageDatabase(path string) ([]string, error) {
+	damaged, err := moveDatabaseAside(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Moved the database that couldn't be opened to %s", damaged)
+
+	db, err := createDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// ATTACH only applies to one connection
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS damaged", damaged); err != nil {
+		return nil, fmt.Errorf("error opening damaged database: %v", err)
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE damaged")
+
+	rows, err := conn.QueryContext(ctx, "SELECT name FROM main.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %v", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if !localTables[name] {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+
+	// Each table is copied on its own so one damaged table doesn't lose the
+	// others
+	var saved []string
+	for _, table := range tables {
+		current, err := tableColumns(conn, "main", table)
+		if err != nil {
+			return nil, err
+		}
+		old, err := tableColumns(conn, "damaged", table)
+		if err != nil || len(old) == 0 {
+			saved = append(saved, fmt.Sprintf("%s: couldn't be read", table))
+			continue
+		}
+		have := make(map[string]bool)
+		for _, column := range old {
+			have[column] = true
+		}
+		var common []string
+		for _, column := range current {
+			if have[column] {
+				common = append(common, column)
+			}
+		}
+
+		list := strings.Join(common, ", ")
+		result, err := conn.ExecContext(ctx, fmt.Sprintf("INSERT OR IGNORE INTO main.%s (%s) SELECT %s FROM damaged.%s", table, list, list, table))
+		if err != nil {
+			log.Printf("Error salvaging %s: %v", table, err)
+			saved = append(saved, fmt.Sprintf("%s: couldn't be read", table))
+			continue
+		}
+		n, _ := result.RowsAffected()
+		saved = append(saved, fmt.Sprintf("%s: %d rows", table, n))
+	}
+	return saved, nil
+}
+
+// Shows why the database couldn't be opened and lets the user try again,
+// open another database, restore a backup or salvage what can be read.
+// Calls opened with the database once one opens.
+func showDatabaseError(myApp fyne.App, openErr error, opened func(db *sql.DB)) {
+	window := myApp.NewWindow("Wisa - Database Problem")
+	window.Resize(fyne.NewSize(560, 260))
+
+	message := widget.NewLabel("")
+	message.Wrapping = fyne.TextWrapWord
+	showError := func(err error) {
+		message.SetText(fmt.Sprintf("wisa couldn't open its database at %s:\n\n%v\n\n"+
+			"If another program has it open, close it and try again.", getDBPath(), err))
+	}
+	showError(openErr)
+
+	// Opens the database again and hands it over if that works
+	retry := func() {
+		db, err := initDB()
+		if err != nil {
+			showError(err)
+			return
+		}
+		opened(db)
+		window.Close()
+	}
+
+	tryButton := widget.NewButton("Try Again", retry)
+
+	otherButton := widget.NewButton("Open Another…", func() {
+		open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			dbPathOverride = reader.URI().Path()
+			retry()
+		}, window)
+		open.SetFilter(storage.NewExtensionFileFilter([]string{".db"}))
+		open.Show()
+	})
+
+	backupButton := widget.NewButton("Restore Backup…", func() {
+		open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			if err := replaceWithBackup(getDBPath(), reader.URI().Path()); err != nil {
+				showError(err)
+				return
+			}
+			retry()
+		}, window)
+		open.SetFilter(storage.NewExtensionFileFilter([]string{".db"}))
+		if dir, err := storage.ListerForURI(storage.NewFileURI(backupDir())); err == nil {
+			open.SetLocation(dir)
+		}
+		open.Show()
+	})
+
+	repairButton := widget.NewButton("Repair", func() {
+		confirm := fmt.Sprintf("Copy everything that can still be read into a new database?\nThe current file is kept as %s.damaged-….", filepath.Base(getDBPath()))
+		dialog.ShowConfirm("Repair Database", confirm, func(ok bool) {
+			if !ok {
+				return
+			}
+			saved, err := salvageDatabase(getDBPath())
+			if err != nil {
+				showError(err)
+				return
+			}
+			log.Printf("Salvaged database: %s", strings.Join(saved, ", "))
+			startupRepairs = append([]string{"Copied what could be read into a new database: " + strings.Join(saved, ", ")}, startupRepairs...)
+			retry()
+		}, window)
+	})
+
+	quitButton := widget.NewButton("Quit", func() {
+		myApp.Quit()
+	})
+
+	window.SetContent(container.NewBorder(
+		nil,
+		container.NewHBox(tryButton, otherButton, backupButton, repairButton, layout.NewSpacer(), quitButton),
+		nil, nil,
+		message,
+	))
+	window.Show()
+}
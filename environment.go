@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// environmentAction changes a part of the desktop other than window
+// placement, such as the volume, when a profile is restored
+type environmentAction struct {
+	// Label is shown in the profile's environment editor
+	Label string
+	// Hint describes the value the action expects
+	Hint string
+	// Apply performs the action with the value stored in the profile
+	Apply func(value string) error
+	// Current reads the value in effect right now, for actions that can be
+	// recorded into a profile's environment snapshot. Optional.
+	Current func() (string, error)
+}
+
+// Environment actions available on this platform, keyed by kind. Platform
+// files add theirs with registerEnvironmentAction.
+var environmentActions = map[string]environmentAction{}
+
+func registerEnvironmentAction(kind string, action environmentAction) {
+	environmentActions[kind] = action
+}
+
+// Hint shared by the wallpaper actions of every platform
+const wallpaperHint = "/path/to/image.jpg, or 2=/path/to/image.jpg for display 2 only"
+
+// Splits a wallpaper action value into the display number it applies to
+// (0 meaning every display) and the image path
+func parseWallpaperValue(value string) (int, string) {
+	if prefix, path, ok := strings.Cut(value, "="); ok {
+		if display, err := strconv.Atoi(prefix); err == nil && display > 0 {
+			return display, path
+		}
+	}
+	return 0, value
+}
+
+// ProfileAction is an environment action stored with a profile
+type ProfileAction struct {
+	ID    int
+	Kind  string
+	Value string
+}
+
+// Gets the environment actions of a profile in the order they were added
+func getProfileActions(db *sql.DB, profileName string) ([]ProfileAction, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.kind, a.value FROM profile_actions a
+		JOIN profiles p ON p.id = a.profile_id
+		WHERE p.name = ?
+		ORDER BY a.id`,
+		profileName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying profile actions: %v", err)
+	}
+	defer rows.Close()
+
+	var actions []ProfileAction
+	for rows.Next() {
+		var action ProfileAction
+		if err := rows.Scan(&action.ID, &action.Kind, &action.Value); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		actions = append(actions, action)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return actions, nil
+}
+
+func addProfileAction(db *sql.DB, profileName, kind, value string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(
+		"INSERT INTO profile_actions (profile_id, kind, value) SELECT id, ?, ? FROM profiles WHERE name = ?",
+		kind, value, profileName,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding profile action: %v", err)
+	}
+	return nil
+}
+
+// Records the current value of every action that can be read back, replacing
+// earlier values of the same kinds, and returns how many were recorded
+func snapshotProfileActions(db *sql.DB, profileName string) (int, error) {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return 0, err
+	}
+
+	var recorded int
+	for kind, handler := range environmentActions {
+		if handler.Current == nil {
+			continue
+		}
+
+		value, err := handler.Current()
+		if err != nil {
+			log.Printf("Error reading current %s: %v", kind, err)
+			continue
+		}
+
+		_, err = db.Exec(`
+			DELETE FROM profile_actions
+			WHERE kind = ? AND profile_id = (SELECT id FROM profiles WHERE name = ?)`,
+			kind, profileName,
+		)
+		if err != nil {
+			return recorded, fmt.Errorf("error replacing profile action: %v", err)
+		}
+		if err := addProfileAction(db, profileName, kind, value); err != nil {
+			return recorded, err
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+// Deletes an environment action, as long as it belongs to the profile
+func deleteProfileAction(db *sql.DB, profileName string, id int) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(
+		"DELETE FROM profile_actions WHERE id = ? AND profile_id = (SELECT id FROM profiles WHERE name = ?)",
+		id, profileName,
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting profile action: %v", err)
+	}
+	return nil
+}
+
+// Runs the environment actions of a profile. Failures are logged and don't
+// stop the remaining actions.
+func applyProfileActions(db *sql.DB, profileName string) error {
+	actions, err := getProfileActions(db, profileName)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, action := range actions {
+		handler, ok := environmentActions[action.Kind]
+		if !ok {
+			log.Printf("Skipping environment action %s: not supported on this platform", action.Kind)
+			continue
+		}
+		if err := handler.Apply(action.Value); err != nil {
+			log.Printf("Error applying environment action %s=%s: %v", action.Kind, action.Value, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d environment actions", failed, len(actions))
+	}
+	return nil
+}
+
+func actionLabel(kind string) string {
+	if handler, ok := environmentActions[kind]; ok {
+		return handler.Label
+	}
+	return kind
+}
+
+// Shows and edits the environment actions of a profile
+func showEnvironmentDialog(db *sql.DB, profileName string, parent fyne.Window) {
+	if len(environmentActions) == 0 {
+		dialog.ShowInformation("Environment", "No environment actions are available on this platform", parent)
+		return
+	}
+
+	list := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		actions, err := getProfileActions(db, profileName)
+		if err != nil {
+			list.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(actions) == 0 {
+			list.Add(widget.NewLabel("This profile doesn't change the environment"))
+		}
+		for _, action := range actions {
+			id := action.ID
+			remove := widget.NewButton("Remove", func() {
+				if err := deleteProfileAction(db, profileName, id); err != nil {
+					dialog.ShowError(err, parent)
+				}
+				refresh()
+			})
+			label := widget.NewLabel(fmt.Sprintf("%s: %s", actionLabel(action.Kind), action.Value))
+			list.Add(container.NewBorder(nil, nil, nil, remove, label))
+		}
+	}
+	refresh()
+
+	// Offer the actions by label, sorted for a stable menu
+	kinds := make(map[string]string)
+	labels := make([]string, 0, len(environmentActions))
+	for kind, handler := range environmentActions {
+		kinds[handler.Label] = kind
+		labels = append(labels, handler.Label)
+	}
+	sort.Strings(labels)
+
+	valueEntry := widget.NewEntry()
+	browseButton := widget.NewButton("Browse…", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			// Keep a "display=" prefix the user already typed
+			display, _ := parseWallpaperValue(valueEntry.Text)
+			if display > 0 {
+				valueEntry.SetText(fmt.Sprintf("%d=%s", display, reader.URI().Path()))
+			} else {
+				valueEntry.SetText(reader.URI().Path())
+			}
+		}, parent)
+	})
+	kindSelect := widget.NewSelect(labels, func(label string) {
+		valueEntry.SetPlaceHolder(environmentActions[kinds[label]].Hint)
+	})
+	kindSelect.PlaceHolder = "Choose an action"
+
+	addButton := widget.NewButton("Add", func() {
+		if kindSelect.Selected == "" {
+			return
+		}
+		if err := addProfileAction(db, profileName, kinds[kindSelect.Selected], valueEntry.Text); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		valueEntry.SetText("")
+		refresh()
+	})
+
+	snapshotButton := widget.NewButton("Record Current Environment", func() {
+		if _, err := snapshotProfileActions(db, profileName); err != nil {
+			dialog.ShowError(err, parent)
+		}
+		refresh()
+	})
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(450, 150))
+
+	content := container.NewVBox(
+		scroll,
+		snapshotButton,
+		widget.NewSeparator(),
+		kindSelect,
+		container.NewBorder(nil, nil, nil, container.NewHBox(browseButton, addButton), valueEntry),
+	)
+	dialog.ShowCustom("Environment for '"+profileName+"'", "Close", content, parent)
+}
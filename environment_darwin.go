@@ -0,0 +1,119 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Reads one of the Dock's preferences through System Events
+func dockPreference(name string) (string, error) {
+	script := fmt.Sprintf(`tell application "System Events" to get %s of dock preferences`, name)
+	output, err := commandOutput("osascript", "-e", script)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func init() {
+	registerEnvironmentAction("volume", environmentAction{
+		Label: "Output Volume",
+		Hint:  "0-100",
+		Apply: func(value string) error {
+			volume, err := strconv.Atoi(value)
+			if err != nil || volume < 0 || volume > 100 {
+				return fmt.Errorf("volume must be a number from 0 to 100")
+			}
+			script := fmt.Sprintf("set volume output volume %d", volume)
+			return runCommand("osascript", "-e", script)
+		},
+	})
+
+	// macOS has no API for picking the output device, SwitchAudioSource
+	// (brew install switchaudio-osx) is the usual tool for it
+	registerEnvironmentAction("audio_output", environmentAction{
+		Label: "Audio Output Device",
+		Hint:  "Device name, e.g. MacBook Pro Speakers",
+		Apply: func(value string) error {
+			return runCommand("SwitchAudioSource", "-t", "output", "-s", value)
+		},
+	})
+
+	registerEnvironmentAction("wallpaper", environmentAction{
+		Label: "Wallpaper",
+		Hint:  wallpaperHint,
+		Apply: func(value string) error {
+			// Display 0 means every desktop
+			display, path := parseWallpaperValue(value)
+			return runAppleScript(`
+on run argv
+	set thePicture to POSIX file (item 2 of argv)
+	set displayIndex to (item 1 of argv) as integer
+	tell application "System Events"
+		if displayIndex is 0 then
+			set picture of every desktop to thePicture
+		else
+			set picture of desktop displayIndex to thePicture
+		end if
+	end tell
+end run
+`, strconv.Itoa(display), path)
+		},
+	})
+
+	registerEnvironmentAction("dock_autohide", environmentAction{
+		Label: "Dock Autohide",
+		Hint:  "on or off",
+		Apply: func(value string) error {
+			if value != "on" && value != "off" {
+				return fmt.Errorf("dock autohide must be on or off")
+			}
+			script := fmt.Sprintf(`tell application "System Events" to set autohide of dock preferences to %t`, value == "on")
+			return runCommand("osascript", "-e", script)
+		},
+		Current: func() (string, error) {
+			autohide, err := dockPreference("autohide")
+			if err != nil {
+				return "", err
+			}
+			if autohide == "true" {
+				return "on", nil
+			}
+			return "off", nil
+		},
+	})
+
+	registerEnvironmentAction("dock_position", environmentAction{
+		Label: "Dock Position",
+		Hint:  "left, bottom or right",
+		Apply: func(value string) error {
+			if value != "left" && value != "bottom" && value != "right" {
+				return fmt.Errorf("dock position must be left, bottom or right")
+			}
+			script := fmt.Sprintf(`tell application "System Events" to set screen edge of dock preferences to %s`, value)
+			return runCommand("osascript", "-e", script)
+		},
+		Current: func() (string, error) {
+			return dockPreference("screen edge")
+		},
+	})
+
+	// Focus modes can only be toggled through Shortcuts, so this runs the
+	// user's "wisa Do Not Disturb On/Off" shortcuts
+	registerEnvironmentAction("do_not_disturb", environmentAction{
+		Label: "Do Not Disturb",
+		Hint:  "on or off",
+		Apply: func(value string) error {
+			switch value {
+			case "on":
+				return runCommand("shortcuts", "run", "wisa Do Not Disturb On")
+			case "off":
+				return runCommand("shortcuts", "run", "wisa Do Not Disturb Off")
+			}
+			return fmt.Errorf("do not disturb must be on or off")
+		},
+	})
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerEnvironmentAction("volume", environmentAction{
+		Label: "Output Volume",
+		Hint:  "0-100",
+		Apply: func(value string) error {
+			volume, err := strconv.Atoi(value)
+			if err != nil || volume < 0 || volume > 100 {
+				return fmt.Errorf("volume must be a number from 0 to 100")
+			}
+			return runCommand("pactl", "set-sink-volume", "@DEFAULT_SINK@", fmt.Sprintf("%d%%", volume))
+		},
+	})
+
+	registerEnvironmentAction("audio_output", environmentAction{
+		Label: "Audio Output Device",
+		Hint:  "PulseAudio sink name",
+		Apply: func(value string) error {
+			return runCommand("pactl", "set-default-sink", value)
+		},
+	})
+
+	// GNOME uses one wallpaper for every display, so a display prefix is ignored
+	registerEnvironmentAction("wallpaper", environmentAction{
+		Label: "Wallpaper",
+		Hint:  wallpaperHint,
+		Apply: func(value string) error {
+			_, path := parseWallpaperValue(value)
+			uri := "file://" + path
+			err := runCommand("gsettings", "set", "org.gnome.desktop.background", "picture-uri", uri)
+			if err != nil {
+				return err
+			}
+			return runCommand("gsettings", "set", "org.gnome.desktop.background", "picture-uri-dark", uri)
+		},
+	})
+
+	registerEnvironmentAction("do_not_disturb", environmentAction{
+		Label: "Do Not Disturb",
+		Hint:  "on or off",
+		Apply: func(value string) error {
+			switch value {
+			case "on":
+				return runCommand("gsettings", "set", "org.gnome.desktop.notifications", "show-banners", "false")
+			case "off":
+				return runCommand("gsettings", "set", "org.gnome.desktop.notifications", "show-banners", "true")
+			}
+			return fmt.Errorf("do not disturb must be on or off")
+		},
+		Current: func() (string, error) {
+			output, err := commandOutput("gsettings", "get", "org.gnome.desktop.notifications", "show-banners")
+			if err != nil {
+				return "", err
+			}
+			if strings.TrimSpace(string(output)) == "false" {
+				return "on", nil
+			}
+			return "off", nil
+		},
+	})
+}
@@ -0,0 +1,38 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procSystemParametersInfoW = user32.NewProc("SystemParametersInfoW")
+
+const (
+	spiSetDeskWallpaper = 0x0014
+	spifUpdateIniFile   = 0x01
+	spifSendChange      = 0x02
+)
+
+func init() {
+	// SystemParametersInfo sets one wallpaper for every display
+	registerEnvironmentAction("wallpaper", environmentAction{
+		Label: "Wallpaper",
+		Hint:  wallpaperHint,
+		Apply: func(value string) error {
+			_, path := parseWallpaperValue(value)
+			pathPtr, err := syscall.UTF16PtrFromString(path)
+			if err != nil {
+				return err
+			}
+			ret, _, err := procSystemParametersInfoW.Call(spiSetDeskWallpaper, 0,
+				uintptr(unsafe.Pointer(pathPtr)), spifUpdateIniFile|spifSendChange)
+			if ret == 0 {
+				return fmt.Errorf("error setting wallpaper: %v", err)
+			}
+			return nil
+		},
+	})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// How many restores are kept for estimating how long the next one takes
+const maxRestoreStats = 50
+
+// Guesses used until there are past restores to go by
+const (
+	defaultWindowTime = 300 * time.Millisecond
+	defaultLaunchTime = 5 * time.Second
+)
+
+// Restores estimated to take at least this long are confirmed first in the
+// window
+const slowRestoreThreshold = 10 * time.Second
+
+// restoreEstimate is what a restore is going to do and how long it should
+// take
+type restoreEstimate struct {
+	Windows  int
+	Launches int
+	Hooks    int
+	Actions  int
+	Duration time.Duration
+	// FromHistory is false when nothing has been restored yet to time it by
+	FromHistory bool
+
+	// Available is how many of the windows can be restored now
+	Available int
+	// NotRunning are the apps of the other windows that aren't running and
+	// won't be launched
+	NotRunning []string
+	// OffDisplay is how many windows are on displays that aren't connected
+	OffDisplay int
+}
+
+// Describes the estimate, e.g. 12 windows, 2 app launches, about 14s
+func (e restoreEstimate) String() string {
+	parts := []string{plural(e.Windows, "window")}
+	if e.Launches > 0 {
+		parts = append(parts, plural(e.Launches, "app launch"))
+	}
+	if e.Hooks > 0 {
+		parts = append(parts, plural(e.Hooks, "hook"))
+	}
+	if e.Actions > 0 {
+		parts = append(parts, plural(e.Actions, "environment action"))
+	}
+
+	duration := "under a second"
+	if e.Duration >= time.Second {
+		duration = "about " + e.Duration.Round(time.Second).String()
+	}
+	if !e.FromHistory {
+		duration += " (a guess until wisa has timed a restore)"
+	}
+	return strings.Join(parts, ", ") + ", " + duration
+}
+
+// Says why some windows can't be restored now, e.g. 12 of 20 windows can be
+// restored now
+func (e restoreEstimate) Unavailable() string {
+	lines := []string{fmt.Sprintf("%d of %s can be restored now.", e.Available, plural(e.Windows, "window"))}
+	if len(e.NotRunning) > 0 {
+		lines = append(lines, "Not running: "+strings.Join(e.NotRunning, ", "))
+	}
+	if e.OffDisplay == 1 {
+		lines = append(lines, "1 window is on a display that isn't connected")
+	} else if e.OffDisplay > 1 {
+		lines = append(lines, fmt.Sprintf("%d windows are on displays that aren't connected", e.OffDisplay))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", noun)
+	}
+	if strings.HasSuffix(noun, "h") {
+		return fmt.Sprintf("%d %ses", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// Records how long a restore took and drops the oldest records
+func recordRestoreStats(db *sql.DB, profileName string, windows, launches int, launchTime, moveTime, total time.Duration) error {
+	_, err := db.Exec(
+		"INSERT INTO restore_stats (profile_name, finished_at, windows, launches, launch_ms, move_ms, total_ms) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		profileName, time.Now(), windows, launches, launchTime.Milliseconds(), moveTime.Milliseconds(), total.Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("error recording restore: %v", err)
+	}
+
+	_, err = db.Exec(
+		"DELETE FROM restore_stats WHERE id NOT IN (SELECT id FROM restore_stats ORDER BY id DESC LIMIT ?)",
+		maxRestoreStats,
+	)
+	if err != nil {
+		return fmt.Errorf("error pruning restore stats: %v", err)
+	}
+	return nil
+}
+
+// Gets the average time of count over the recorded restores, those of the
+// profile if it has any. False if nothing was recorded.
+func averageRestoreTime(db *sql.DB, profileName, column, count string) (time.Duration, bool, error) {
+	query := fmt.Sprintf("SELECT COALESCE(SUM(%s), 0), COALESCE(SUM(%s), 0) FROM restore_stats WHERE %s > 0", column, count, count)
+	for _, filter := range []string{" AND profile_name = ?", ""} {
+		var args []interface{}
+		if filter != "" {
+			args = append(args, profileName)
+		}
+		var ms, n int64
+		if err := db.QueryRow(query+filter, args...).Scan(&ms, &n); err != nil {
+			return 0, false, fmt.Errorf("error reading restore stats: %v", err)
+		}
+		if n > 0 {
+			return time.Duration(ms/n) * time.Millisecond, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// Gets the average time a profile's restores spend outside of launching and
+// moving windows, mostly hooks and environment actions
+func averageRestoreOverhead(db *sql.DB, profileName string) (time.Duration, error) {
+	var ms sql.NullFloat64
+	err := db.QueryRow(
+		"SELECT AVG(total_ms - launch_ms - move_ms) FROM restore_stats WHERE profile_name = ?",
+		profileName,
+	).Scan(&ms)
+	if err != nil {
+		return 0, fmt.Errorf("error reading restore stats: %v", err)
+	}
+	if !ms.Valid || ms.Float64 < 0 {
+		return 0, nil
+	}
+	return time.Duration(ms.Float64) * time.Millisecond, nil
+}
+
+// Works out what restoring a profile with these options would do and how
+// long it should take, going by the restores timed before
+func (e *restoreEngine) Estimate(profileName string, opts restoreOptions) (restoreEstimate, error) {
+	states, err := loadWindowStates(e.db, profileName, currentArrangement(e.backend))
+	if err != nil {
+		return restoreEstimate{}, fmt.Errorf("error loading window states: %v", err)
+	}
+	partial := len(opts.Windows) > 0
+	if partial {
+		states = selectWindowStates(states, opts.Windows)
+	}
+	e.mu.Lock()
+	states, err = filterIgnoredStates(e.db, profileName, e.sessionIgnores, states)
+	e.mu.Unlock()
+	if err != nil {
+		return restoreEstimate{}, fmt.Errorf("error loading ignored windows: %v", err)
+	}
+
+	estimate := restoreEstimate{Windows: len(states)}
+	launch, err := getLaunchMissing(e.db, profileName)
+	if err != nil {
+		return restoreEstimate{}, err
+	}
+	if launcher, ok := e.backend.(AppLauncher); ok && launch {
+		missing, err := missingApps(launcher, states)
+		if err != nil {
+			return restoreEstimate{}, err
+		}
+		estimate.Launches = len(missing)
+	}
+	scale, err := getScaleToDisplay(e.db, profileName)
+	if err != nil {
+		return restoreEstimate{}, err
+	}
+	estimate.Available, estimate.NotRunning, estimate.OffDisplay = availableStates(e.backend, states, launch, scale)
+	if !partial {
+		hooks, err := getProfileHooks(e.db, profileName, "")
+		if err != nil {
+			return restoreEstimate{}, err
+		}
+		actions, err := getProfileActions(e.db, profileName)
+		if err != nil {
+			return restoreEstimate{}, err
+		}
+		estimate.Hooks = len(hooks)
+		estimate.Actions = len(actions)
+	}
+
+	perWindow, timed, err := averageRestoreTime(e.db, profileName, "move_ms", "windows")
+	if err != nil {
+		return restoreEstimate{}, err
+	}
+	if !timed {
+		perWindow = defaultWindowTime
+	}
+	estimate.FromHistory = timed
+	perLaunch, launchesTimed, err := averageRestoreTime(e.db, profileName, "launch_ms", "launches")
+	if err != nil {
+		return restoreEstimate{}, err
+	}
+	if !launchesTimed {
+		perLaunch = defaultLaunchTime
+	}
+	estimate.Duration = time.Duration(estimate.Windows)*perWindow + time.Duration(estimate.Launches)*perLaunch
+	if !partial {
+		overhead, err := averageRestoreOverhead(e.db, profileName)
+		if err != nil {
+			return restoreEstimate{}, err
+		}
+		estimate.Duration += overhead
+	}
+	return estimate, nil
+}
+
+// Counts the windows that can be restored now. The others belong to apps
+// that aren't running and won't be launched, or to displays that aren't
+// connected and won't be scaled onto another one.
+func availableStates(backend WindowBackend, states []WindowState, launch, scale bool) (available int, notRunning []string, offDisplay int) {
+	var running map[string]bool
+	if launcher, ok := backend.(AppLauncher); ok && !launch {
+		var err error
+		if running, err = launcher.RunningApps(); err != nil {
+			log.Printf("Error listing running apps: %v", err)
+		}
+	}
+	connected := make(map[string]bool)
+	if !scale {
+		for _, display := range connectedDisplays(backend) {
+			connected[display.ID] = true
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, state := range states {
+		ok := true
+		if running != nil && !running[state.AppName] {
+			ok = false
+			if !seen[state.AppName] {
+				seen[state.AppName] = true
+				notRunning = append(notRunning, state.AppName)
+			}
+		}
+		if len(connected) > 0 && state.DisplayID != "" && !connected[state.DisplayID] {
+			ok = false
+			offDisplay++
+		}
+		if ok {
+			available++
+		}
+	}
+	sort.Strings(notRunning)
+	return available, notRunning, offDisplay
+}
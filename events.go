@@ -0,0 +1,103 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// Kinds of window events
+const (
+	windowCreated   = "created"
+	windowMoved     = "moved"
+	windowResized   = "resized"
+	windowDestroyed = "destroyed"
+	windowRetitled  = "retitled"
+	windowMinimized = "minimized"
+)
+
+// WindowEvent reports a change to one window
+type WindowEvent struct {
+	Kind        string
+	AppName     string
+	WindowTitle string
+}
+
+// WindowWatcher is implemented by backends the window manager tells about
+// window changes, so they don't have to be polled for. Watch sends events
+// until stop is closed and fails right away if watching isn't possible.
+type WindowWatcher interface {
+	Watch(events chan<- WindowEvent, stop <-chan struct{}) error
+}
+
+// How often windows are compared when the backend can't watch them
+const windowPollInterval = time.Second
+
+// Sends the window events of the backend, comparing captures when it can't
+// watch windows itself
+func watchWindows(backend WindowBackend, events chan<- WindowEvent, stop <-chan struct{}) {
+	if watcher, ok := backend.(WindowWatcher); ok {
+		err := watcher.Watch(events, stop)
+		if err == nil {
+			return
+		}
+		log.Printf("Watching windows failed, comparing captures instead: %v", err)
+	}
+	go pollWindowEvents(backend, windowPollInterval, events, stop)
+}
+
+// Captures the windows every interval and sends what changed between
+// captures
+func pollWindowEvents(backend WindowBackend, interval time.Duration, events chan<- WindowEvent, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := make(map[string]WindowState)
+	for _, state := range sweepStates(backend) {
+		last[state.UID] = state
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		current := make(map[string]WindowState)
+		var changes []WindowEvent
+		for _, state := range sweepStates(backend) {
+			current[state.UID] = state
+			event := WindowEvent{AppName: state.AppName, WindowTitle: state.WindowTitle}
+			before, ok := last[state.UID]
+			switch {
+			case !ok:
+				event.Kind = windowCreated
+			case before.X != state.X || before.Y != state.Y:
+				event.Kind = windowMoved
+			case before.Width != state.Width || before.Height != state.Height:
+				event.Kind = windowResized
+			case state.Minimized && !before.Minimized:
+				event.Kind = windowMinimized
+			case before.Minimized && !state.Minimized:
+				event.Kind = windowMoved
+			default:
+				continue
+			}
+			changes = append(changes, event)
+		}
+		for uid, state := range last {
+			if _, ok := current[uid]; !ok {
+				changes = append(changes, WindowEvent{Kind: windowDestroyed, AppName: state.AppName, WindowTitle: state.WindowTitle})
+			}
+		}
+		last = current
+
+		for _, event := range changes {
+			select {
+			case events <- event:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// windowKey identifies a window by app and title
+type windowKey struct {
+	AppName     string
+	WindowTitle string
+}
+
+func keyOf(state WindowState) windowKey {
+	return windowKey{AppName: state.AppName, WindowTitle: state.WindowTitle}
+}
+
+// Adds a window to the exclude list. A zero profileID excludes the window
+// from every profile.
+func addWindowExclude(db *sql.DB, profileID int, key windowKey) error {
+	var profile interface{}
+	if profileID != 0 {
+		profile = profileID
+	}
+
+	_, err := db.Exec(
+		"INSERT INTO window_excludes (profile_id, app_name, window_title) VALUES (?, ?, ?)",
+		profile, key.AppName, key.WindowTitle,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding window exclude: %v", err)
+	}
+	return nil
+}
+
+// Gets the windows excluded from restoring a profile, including global excludes
+func getWindowExcludes(db *sql.DB, profileName string) (map[windowKey]bool, error) {
+	rows, err := db.Query(`
+		SELECT app_name, window_title FROM window_excludes
+		WHERE profile_id IS NULL
+		   OR profile_id = (SELECT id FROM profiles WHERE name = ?)`,
+		profileName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying window excludes: %v", err)
+	}
+	defer rows.Close()
+
+	excludes := make(map[windowKey]bool)
+	for rows.Next() {
+		var key windowKey
+		if err := rows.Scan(&key.AppName, &key.WindowTitle); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		excludes[key] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return excludes, nil
+}
+
+// Drops states that are ignored for this session or excluded for the profile
+func filterIgnoredStates(db *sql.DB, profileName string, session map[windowKey]bool, states []WindowState) ([]WindowState, error) {
+	excludes, err := getWindowExcludes(db, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []WindowState
+	for _, state := range states {
+		key := keyOf(state)
+		if session[key] || excludes[key] {
+			continue
+		}
+		kept = append(kept, state)
+	}
+	return kept, nil
+}
+
+// Options offered for each failed window in the failure report
+const (
+	ignoreNever   = "Keep retrying"
+	ignoreSession = "Ignore for this session"
+	ignoreProfile = "Ignore for this profile"
+	ignoreAlways  = "Always ignore"
+)
+
+// Whether a restore went badly enough to show its report
+func needsRestoreReport(results []restoreResult) bool {
+	for _, result := range results {
+		if !result.Restored() {
+			return true
+		}
+	}
+	return false
+}
+
+// Shows what happened to each window of a restore and lets the user stop
+// retrying the ones that weren't restored
+func showRestoreReport(engine *restoreEngine, profileName string, results []restoreResult, parent fyne.Window) {
+	db := engine.db
+
+	restored := 0
+	choices := make([]*widget.Select, len(results))
+	rows := container.NewVBox()
+	for i, result := range results {
+		label := widget.NewLabel(fmt.Sprintf("%s - %s\n%s", result.State.AppName, result.State.WindowTitle, describeRestoreResult(result)))
+		label.Wrapping = fyne.TextWrapWord
+		if result.Restored() {
+			restored++
+			rows.Add(label)
+			continue
+		}
+		choices[i] = widget.NewSelect([]string{ignoreNever, ignoreSession, ignoreProfile, ignoreAlways}, nil)
+		choices[i].SetSelected(ignoreNever)
+		rows.Add(container.NewBorder(nil, nil, nil, choices[i], label))
+	}
+
+	scroll := container.NewVScroll(rows)
+	scroll.SetMinSize(fyne.NewSize(560, 300))
+
+	title := fmt.Sprintf("Restored %d of %d windows", restored, len(results))
+	dialog.ShowCustomConfirm(title, "Apply", "Close", scroll, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		var profileID int
+		err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("error finding profile: %v", err), parent)
+			return
+		}
+
+		for i, result := range results {
+			if choices[i] == nil {
+				continue
+			}
+			key := keyOf(result.State)
+			switch choices[i].Selected {
+			case ignoreSession:
+				engine.ignoreForSession(key)
+			case ignoreProfile:
+				err = addWindowExclude(db, profileID, key)
+			case ignoreAlways:
+				err = addWindowExclude(db, 0, key)
+			}
+			if err != nil {
+				dialog.ShowError(err, parent)
+				return
+			}
+		}
+	}, parent)
+}
+
+// Shows the captured windows as a checklist before saving them into a
+// profile and calls onSave with the ones left checked. Windows excluded
+// from the profile start unchecked.
+func showSaveChecklist(db *sql.DB, profileName string, states []WindowState, parent fyne.Window, onSave func(states []WindowState)) {
+	excludes, err := getWindowExcludes(db, profileName)
+	if err != nil {
+		log.Printf("Error loading window excludes: %v", err)
+	}
+
+	checks := make([]*widget.Check, len(states))
+	list := container.NewVBox()
+	for i, state := range states {
+		label := fmt.Sprintf("%s - %s (%.0f, %.0f %.0f x %.0f)",
+			state.AppName, state.WindowTitle, state.X, state.Y, state.Width, state.Height)
+		checks[i] = widget.NewCheck(label, nil)
+		checks[i].SetChecked(!excludes[keyOf(state)])
+		list.Add(checks[i])
+	}
+
+	setAll := func(checked bool) {
+		for _, check := range checks {
+			check.SetChecked(checked)
+		}
+	}
+	buttons := container.NewHBox(
+		widget.NewButton("Select All", func() { setAll(true) }),
+		widget.NewButton("Select None", func() { setAll(false) }),
+	)
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 300))
+
+	dialog.ShowCustomConfirm("Save Windows to '"+profileName+"'", "Save", "Cancel", container.NewBorder(buttons, nil, nil, nil, scroll), func(ok bool) {
+		if !ok {
+			return
+		}
+
+		var picked []WindowState
+		for i, state := range states {
+			if checks[i].Checked {
+				picked = append(picked, state)
+			}
+		}
+		if len(picked) == 0 {
+			dialog.ShowInformation("Save Windows", "No windows were selected, nothing was saved", parent)
+			return
+		}
+		onSave(picked)
+	}, parent)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Version of the export format, bumped when it changes incompatibly
+const exportVersion = 1
+
+// Environment actions whose values only make sense on the machine they were
+// recorded on, like file paths and device names
+var machineSpecificActions = map[string]bool{
+	"audio_output": true,
+	"wallpaper":    true,
+}
+
+// exportBundle is a set of profiles with everything needed to set them up
+// on another machine. It holds nothing that changes between exports of the
+// same profiles, so exports kept in git only diff when the profiles do.
+type exportBundle struct {
+	Version  int             `json:"version"`
+	Profiles []exportProfile `json:"profiles"`
+}
+
+type exportProfile struct {
+	Name           string          `json:"name"`
+	LaunchMissing  bool            `json:"launch_missing,omitempty"`
+	OtherApps      string          `json:"other_apps,omitempty"`
+	ScaleToDisplay bool            `json:"scale_to_display,omitempty"`
+	IncludeFilter  string          `json:"include_filter,omitempty"`
+	Layouts        []exportLayout  `json:"layouts"`
+	Actions        []exportAction  `json:"actions,omitempty"`
+	Triggers       []exportTrigger `json:"triggers,omitempty"`
+}
+
+// exportLayout is the layout variant saved for one display arrangement
+type exportLayout struct {
+	Arrangement string        `json:"arrangement,omitempty"`
+	Windows     []WindowState `json:"windows"`
+}
+
+type exportAction struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// exportTrigger covers every kind of trigger: display arrangements,
+// schedules and hotkeys
+type exportTrigger struct {
+	Kind       string `json:"kind"`
+	Spec       string `json:"spec"`
+	Enabled    bool   `json:"enabled"`
+	QuietStart string `json:"quiet_start,omitempty"`
+	QuietEnd   string `json:"quiet_end,omitempty"`
+}
+
+// exportOptions controls what goes into an export
+type exportOptions struct {
+	// StripMachine leaves out display IDs and actions tied to this machine
+	StripMachine bool
+}
+
+// Gets every trigger that applies a profile, of any kind
+func getProfileTriggers(db *sql.DB, profileName string) ([]Trigger, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.kind, t.spec, p.name, t.enabled, t.quiet_start, t.quiet_end FROM triggers t
+		JOIN profiles p ON p.id = t.profile_id
+		WHERE p.name = ?
+		ORDER BY t.id`,
+		profileName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying triggers: %v", err)
+	}
+	defer rows.Close()
+
+	var triggers []Trigger
+	for rows.Next() {
+		var trigger Trigger
+		err := rows.Scan(&trigger.ID, &trigger.Kind, &trigger.Spec, &trigger.ProfileName, &trigger.Enabled,
+			&trigger.QuietStart, &trigger.QuietEnd)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		triggers = append(triggers, trigger)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return triggers, nil
+}
+
+// Collects the named profiles, or all of them when names is empty, into a
+// bundle that can be written out as JSON
+func exportProfiles(db *sql.DB, names []string, opts exportOptions) (*exportBundle, error) {
+	if len(names) == 0 {
+		var err error
+		names, err = getProfiles(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bundle := &exportBundle{Version: exportVersion}
+	for _, name := range names {
+		profile := exportProfile{Name: name}
+
+		var err error
+		profile.LaunchMissing, err = getLaunchMissing(db, name)
+		if err != nil {
+			return nil, err
+		}
+		profile.OtherApps, err = getOtherAppsMode(db, name)
+		if err != nil {
+			return nil, err
+		}
+		profile.ScaleToDisplay, err = getScaleToDisplay(db, name)
+		if err != nil {
+			return nil, err
+		}
+		profile.IncludeFilter, err = getIncludeFilter(db, name)
+		if err != nil {
+			return nil, err
+		}
+
+		variants, err := getProfileVariants(db, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, variant := range variants {
+			states, err := loadWindowStates(db, name, variant)
+			if err != nil {
+				return nil, err
+			}
+			if opts.StripMachine {
+				for i := range states {
+					states[i].DisplayID = ""
+					states[i].DisplayX = 0
+					states[i].DisplayY = 0
+					states[i].DisplayWidth = 0
+					states[i].DisplayHeight = 0
+				}
+			}
+			profile.Layouts = append(profile.Layouts, exportLayout{Arrangement: variant, Windows: states})
+		}
+
+		actions, err := getProfileActions(db, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, action := range actions {
+			if opts.StripMachine && machineSpecificActions[action.Kind] {
+				continue
+			}
+			profile.Actions = append(profile.Actions, exportAction{Kind: action.Kind, Value: action.Value})
+		}
+
+		triggers, err := getProfileTriggers(db, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, trigger := range triggers {
+			profile.Triggers = append(profile.Triggers, exportTrigger{
+				Kind:       trigger.Kind,
+				Spec:       trigger.Spec,
+				Enabled:    trigger.Enabled,
+				QuietStart: trigger.QuietStart,
+				QuietEnd:   trigger.QuietEnd,
+			})
+		}
+
+		bundle.Profiles = append(bundle.Profiles, profile)
+	}
+
+	return bundle, nil
+}
+
+// Creates or replaces the profiles in a bundle along with their environment
+// actions and triggers. Triggers with the same kind and spec as an imported
+// one are replaced too. The whole bundle is imported or nothing is.
+func importProfiles(db *sql.DB, bundle *exportBundle) error {
+	return queueWrite(func() error {
+		return importProfilesLocked(db, bundle)
+	})
+}
+
+// Gets the profiles in a bundle that importing it would replace
+func existingImports(db *sql.DB, bundle *exportBundle) ([]string, error) {
+	var existing []string
+	for _, profile := range bundle.Profiles {
+		var name string
+		err := db.QueryRow("SELECT name FROM profiles WHERE name = ? AND deleted_at IS NULL", canonicalProfileName(profile.Name)).Scan(&name)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error finding profile: %v", err)
+		}
+		existing = append(existing, name)
+	}
+	return existing, nil
+}
+
+func importProfilesLocked(db *sql.DB, bundle *exportBundle) error {
+	if bundle.Version > exportVersion {
+		return fmt.Errorf("export version %d is newer than this version of wisa supports", bundle.Version)
+	}
+
+	// Every name is checked before anything changes
+	names := make([]string, len(bundle.Profiles))
+	for i, profile := range bundle.Profiles {
+		name, err := cleanProfileName(profile.Name)
+		if err != nil {
+			return fmt.Errorf("error importing profile: %v", err)
+		}
+		if err := checkProfileOwner(db, name); err != nil {
+			return err
+		}
+		names[i] = name
+	}
+
+	autoBackup(db, "import")
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	// Does nothing once committed
+	defer tx.Rollback()
+
+	for i, profile := range bundle.Profiles {
+		profile.Name = names[i]
+		if err := importProfileTx(tx, profile); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Creates or replaces one profile of a bundle as part of its import
+func importProfileTx(tx *sql.Tx, profile exportProfile) error {
+	if err := moveDeletedProfileAside(tx, profile.Name); err != nil {
+		return err
+	}
+
+	var profileID int
+	err := tx.QueryRow("SELECT id FROM profiles WHERE name = ?", profile.Name).Scan(&profileID)
+	if err == sql.ErrNoRows {
+		result, err := tx.Exec("INSERT INTO profiles (name, owner) VALUES (?, ?)", profile.Name, currentUsername())
+		if err != nil {
+			return fmt.Errorf("error creating profile: %v", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting new profile ID: %v", err)
+		}
+		profileID = int(id)
+	} else if err != nil {
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	// Imported layouts replace all the saved ones
+	if err := bumpRevision(tx, profile.Name, profileID, anyRevision); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM window_states WHERE profile_id = ?", profileID); err != nil {
+		return fmt.Errorf("error clearing window states: %v", err)
+	}
+	for _, layout := range profile.Layouts {
+		if err := insertWindowStates(tx, profileID, layout.Arrangement, layout.Windows); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		"UPDATE profiles SET launch_missing = ?, other_apps = ?, scale_to_display = ?, include_filter = ? WHERE id = ?",
+		profile.LaunchMissing, profile.OtherApps, profile.ScaleToDisplay, strings.TrimSpace(profile.IncludeFilter), profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM profile_actions WHERE profile_id = ?", profileID); err != nil {
+		return fmt.Errorf("error clearing profile actions: %v", err)
+	}
+	for _, action := range profile.Actions {
+		_, err := tx.Exec("INSERT INTO profile_actions (profile_id, kind, value) VALUES (?, ?, ?)", profileID, action.Kind, action.Value)
+		if err != nil {
+			return fmt.Errorf("error adding profile action: %v", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM triggers WHERE profile_id = ?", profileID); err != nil {
+		return fmt.Errorf("error clearing triggers: %v", err)
+	}
+	for _, trigger := range profile.Triggers {
+		_, err := tx.Exec(
+			"DELETE FROM triggers WHERE kind = ? AND spec = ? AND profile_id IN ("+ownProfileIDs+")",
+			trigger.Kind, trigger.Spec, currentUsername(),
+		)
+		if err != nil {
+			return fmt.Errorf("error replacing trigger: %v", err)
+		}
+		_, err = tx.Exec(
+			"INSERT INTO triggers (kind, spec, profile_id, enabled, quiet_start, quiet_end) VALUES (?, ?, ?, ?, ?, ?)",
+			trigger.Kind, trigger.Spec, profileID, trigger.Enabled, trigger.QuietStart, trigger.QuietEnd,
+		)
+		if err != nil {
+			return fmt.Errorf("error saving trigger: %v", err)
+		}
+	}
+	return nil
+}
+
+// Writes a bundle as indented JSON, which diffs nicely in dotfiles
+func writeExport(w io.Writer, bundle *exportBundle) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(bundle); err != nil {
+		return fmt.Errorf("error writing export: %v", err)
+	}
+	return nil
+}
+
+func readExport(r io.Reader) (*exportBundle, error) {
+	var bundle exportBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, fmt.Errorf("error reading export: %v", err)
+	}
+	return &bundle, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// snapGrid is what saved positions and sizes are rounded to, either a step
+// in pixels or a fraction of the window's display. The zero value is off.
+type snapGrid struct {
+	Pixels float64
+	// Divisions splits each display into this many columns and rows
+	Divisions int
+}
+
+func (g snapGrid) off() bool {
+	return g.Pixels <= 0 && g.Divisions <= 0
+}
+
+func (g snapGrid) String() string {
+	switch {
+	case g.Divisions > 0:
+		return fmt.Sprintf("1/%d", g.Divisions)
+	case g.Pixels > 0:
+		return strconv.FormatFloat(g.Pixels, 'f', -1, 64)
+	}
+	return ""
+}
+
+// Parses a grid setting: empty or 0 for off, pixels such as 8, or a fraction
+// of the display such as 1/12
+func parseSnapGrid(value string) (snapGrid, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return snapGrid{}, nil
+	}
+	if fraction, ok := strings.CutPrefix(value, "1/"); ok {
+		divisions, err := strconv.Atoi(strings.TrimSpace(fraction))
+		if err != nil || divisions < 1 || divisions > 100 {
+			return snapGrid{}, fmt.Errorf("invalid grid %q, use 1/1 up to 1/100", value)
+		}
+		return snapGrid{Divisions: divisions}, nil
+	}
+	pixels, err := strconv.ParseFloat(strings.TrimSuffix(value, "px"), 64)
+	if err != nil || pixels < 0 || pixels > 1000 {
+		return snapGrid{}, fmt.Errorf("invalid grid %q, use pixels such as 8 or a fraction such as 1/12", value)
+	}
+	return snapGrid{Pixels: pixels}, nil
+}
+
+// The grid captured windows are snapped to when saved, from the snap_grid
+// setting
+var (
+	snapGridMu      sync.RWMutex
+	currentSnapGrid snapGrid
+)
+
+// Reloads the grid from the settings, leaving snapping off if it's invalid
+func loadSnapGrid(db *sql.DB) {
+	grid, err := parseSnapGrid(getSetting(db, settingSnapGrid, ""))
+	if err != nil {
+		log.Printf("Error reading snap grid: %v", err)
+	}
+
+	snapGridMu.Lock()
+	currentSnapGrid = grid
+	snapGridMu.Unlock()
+}
+
+func setSnapGrid(db *sql.DB, value string) error {
+	grid, err := parseSnapGrid(value)
+	if err != nil {
+		return err
+	}
+	if err := setSetting(db, settingSnapGrid, grid.String()); err != nil {
+		return err
+	}
+	loadSnapGrid(db)
+	return nil
+}
+
+func getSnapGrid() snapGrid {
+	snapGridMu.RLock()
+	defer snapGridMu.RUnlock()
+	return currentSnapGrid
+}
+
+// Rounds value to the nearest step counted from origin
+func snapTo(value, origin, step float64) float64 {
+	return origin + math.Round((value-origin)/step)*step
+}
+
+// Rounds the windows' edges to the grid, counted from the corner of the
+// display each one is on. Windows never shrink below one step, and
+// fullscreen windows are left alone as the display sets their size.
+func snapStates(grid snapGrid, displays []Display, states []WindowState) []WindowState {
+	if grid.off() {
+		return states
+	}
+
+	snapped := make([]WindowState, len(states))
+	copy(snapped, states)
+	for i, state := range snapped {
+		if state.FullScreen {
+			continue
+		}
+
+		var originX, originY float64
+		stepX, stepY := grid.Pixels, grid.Pixels
+		if display, ok := displayFor(state, displays); ok {
+			originX, originY = display.X, display.Y
+			if grid.Divisions > 0 {
+				stepX = display.Width / float64(grid.Divisions)
+				stepY = display.Height / float64(grid.Divisions)
+			}
+		}
+		if stepX <= 0 || stepY <= 0 {
+			// Fractions of a display need the displays
+			continue
+		}
+
+		left := snapTo(state.X, originX, stepX)
+		top := snapTo(state.Y, originY, stepY)
+		right := math.Max(snapTo(state.X+state.Width, originX, stepX), left+stepX)
+		bottom := math.Max(snapTo(state.Y+state.Height, originY, stepY), top+stepY)
+		snapped[i].X = math.Round(left)
+		snapped[i].Y = math.Round(top)
+		snapped[i].Width = math.Round(right) - snapped[i].X
+		snapped[i].Height = math.Round(bottom) - snapped[i].Y
+	}
+	return snapped
+}
+
+// Captures the open windows for saving into a profile, snapped to the grid
+// when one is set
+func captureForSave(backend WindowBackend) []WindowState {
+	// Saved layouts are meant to be exactly what's on screen now, which the
+	// index may be a few seconds behind on
+	states := freshStates(backend)
+	grid := getSnapGrid()
+	if grid.off() {
+		return states
+	}
+
+	var displays []Display
+	if lister, ok := backend.(DisplayLister); ok {
+		var err error
+		if displays, err = lister.Displays(); err != nil {
+			log.Printf("Error listing displays: %v", err)
+		}
+	}
+	return snapStates(grid, displays, states)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How many captures are kept in each profile's history unless retain_history
+// says otherwise
+const maxSnapshots = 50
+
+// profileSnapshot is one capture in a profile's history
+type profileSnapshot struct {
+	ID          int64
+	Version     int
+	Arrangement string
+	Created     time.Time
+	States      []WindowState
+}
+
+// Adds a capture to the history of a profile as its next version and drops
+// the oldest ones past the history retention
+func recordSnapshot(tx *sql.Tx, profileID int, arrangement string, states []WindowState) error {
+	data, err := json.Marshal(states)
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot: %v", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO profile_snapshots (profile_id, version, arrangement, created_at, states)
+		SELECT ?, COALESCE(MAX(version), 0) + 1, ?, ?, ? FROM profile_snapshots WHERE profile_id = ?`,
+		profileID, arrangement, time.Now(), string(data), profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %v", err)
+	}
+
+	keep := getRetention(settingRetainHistory).MaxEntries
+	if keep == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`
+		DELETE FROM profile_snapshots WHERE profile_id = ? AND id NOT IN (
+			SELECT id FROM profile_snapshots WHERE profile_id = ? ORDER BY version DESC LIMIT ?
+		)`,
+		profileID, profileID, keep,
+	)
+	if err != nil {
+		return fmt.Errorf("error pruning snapshots: %v", err)
+	}
+	return nil
+}
+
+// Gets the history of a profile, newest first
+func getSnapshots(db *sql.DB, profileName string) ([]profileSnapshot, error) {
+	rows, err := db.Query(`
+		SELECT s.id, s.version, s.arrangement, s.created_at, s.states FROM profile_snapshots s
+		JOIN profiles p ON p.id = s.profile_id
+		WHERE p.name = ?
+		ORDER BY s.version DESC`,
+		profileName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying snapshots: %v", err)
+	}
+	defer rows.Close()
+
+	var snapshots []profileSnapshot
+	for rows.Next() {
+		var snapshot profileSnapshot
+		var states string
+		if err := rows.Scan(&snapshot.ID, &snapshot.Version, &snapshot.Arrangement, &snapshot.Created, &states); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if err := json.Unmarshal([]byte(states), &snapshot.States); err != nil {
+			return nil, fmt.Errorf("error reading snapshot: %v", err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return snapshots, nil
+}
+
+// Makes an earlier capture the profile's layout again. The rollback is
+// saved like any other capture, so it can be rolled back too.
+func rollBackSnapshot(db *sql.DB, profileName string, snapshot profileSnapshot) error {
+	return saveWindowStates(db, profileName, snapshot.Arrangement, snapshot.States)
+}
+
+// Lists the captures of a profile and lets the user look at them or roll
+// back to one
+func showHistoryDialog(db *sql.DB, profileName string, parent fyne.Window, onRolledBack func()) {
+	snapshots, err := getSnapshots(db, profileName)
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+	if len(snapshots) == 0 {
+		dialog.ShowInformation("History", fmt.Sprintf("'%s' has no saved history yet", profileName), parent)
+		return
+	}
+
+	list := container.NewVBox()
+	for _, snapshot := range snapshots {
+		snapshot := snapshot
+		label := widget.NewLabel(fmt.Sprintf("Version %d — %s, %d windows",
+			snapshot.Version, snapshot.Created.Format("2006-01-02 15:04"), len(snapshot.States)))
+		view := widget.NewButton("View", func() {
+			var lines []string
+			for _, state := range snapshot.States {
+				lines = append(lines, fmt.Sprintf("%s - %s (%.0f, %.0f) %.0f x %.0f",
+					state.AppName, state.WindowTitle, state.X, state.Y, state.Width, state.Height))
+			}
+			text := widget.NewLabel(strings.Join(lines, "\n"))
+			scroll := container.NewVScroll(text)
+			scroll.SetMinSize(fyne.NewSize(500, 250))
+			dialog.ShowCustom(fmt.Sprintf("Version %d", snapshot.Version), "Close", scroll, parent)
+		})
+		rollBack := widget.NewButton("Roll Back", func() {
+			dialog.ShowConfirm("Roll Back",
+				fmt.Sprintf("Replace the layout of '%s' with version %d?", profileName, snapshot.Version),
+				func(ok bool) {
+					if !ok {
+						return
+					}
+					if err := rollBackSnapshot(db, profileName, snapshot); err != nil {
+						dialog.ShowError(err, parent)
+						return
+					}
+					onRolledBack()
+				}, parent)
+		})
+		list.Add(container.NewBorder(nil, nil, nil, container.NewHBox(view, rollBack), label))
+	}
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 250))
+	dialog.ShowCustom(fmt.Sprintf("History of '%s'", profileName), "Close", scroll, parent)
+}
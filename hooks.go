@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// When a hook command runs during a restore
+const (
+	hookBefore = "before"
+	hookAfter  = "after"
+)
+
+// How long a hook may run when it doesn't set its own timeout
+const defaultHookTimeout = 30 * time.Second
+
+// How much of a hook's output is kept in the database
+const maxHookOutput = 4096
+
+// profileHook is a shell command a profile runs before or after restoring,
+// e.g. starting yabai or opening a project in an editor
+type profileHook struct {
+	ID      int
+	Stage   string
+	Command string
+	Timeout time.Duration
+	// The outcome of the last run, LastRun is zero if it never ran
+	LastRun    time.Time
+	LastStatus string
+	LastOutput string
+}
+
+// Gets the hooks of a profile for a stage, or for both stages if stage is
+// empty, in the order they were added
+func getProfileHooks(db *sql.DB, profileName, stage string) ([]profileHook, error) {
+	rows, err := db.Query(`
+		SELECT h.id, h.stage, h.command, h.timeout_seconds, h.last_run_at, h.last_status, h.last_output
+		FROM profile_hooks h
+		JOIN profiles p ON p.id = h.profile_id
+		WHERE p.name = ? AND (? = '' OR h.stage = ?)
+		ORDER BY h.id`,
+		profileName, stage, stage,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying profile hooks: %v", err)
+	}
+	defer rows.Close()
+
+	var hooks []profileHook
+	for rows.Next() {
+		var hook profileHook
+		var timeout int
+		var lastRun sql.NullTime
+		if err := rows.Scan(&hook.ID, &hook.Stage, &hook.Command, &timeout, &lastRun, &hook.LastStatus, &hook.LastOutput); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		hook.Timeout = time.Duration(timeout) * time.Second
+		hook.LastRun = lastRun.Time
+		hooks = append(hooks, hook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return hooks, nil
+}
+
+func addProfileHook(db *sql.DB, profileName, stage, command string, timeout time.Duration) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	if stage != hookBefore && stage != hookAfter {
+		return fmt.Errorf("unknown hook stage %q, use %s or %s", stage, hookBefore, hookAfter)
+	}
+	if strings.TrimSpace(command) == "" {
+		return errors.New("hook command can't be empty")
+	}
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	result, err := db.Exec(
+		"INSERT INTO profile_hooks (profile_id, stage, command, timeout_seconds) SELECT id, ?, ?, ? FROM profiles WHERE name = ?",
+		stage, command, int(timeout/time.Second), profileName,
+	)
+	if err != nil {
+		return fmt.Errorf("error adding profile hook: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("profile %s not found", profileName)
+	}
+	return nil
+}
+
+func deleteProfileHook(db *sql.DB, profileName string, id int) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec(
+		"DELETE FROM profile_hooks WHERE id = ? AND profile_id = (SELECT id FROM profiles WHERE name = ?)",
+		id, profileName,
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting profile hook: %v", err)
+	}
+	return nil
+}
+
+// Whether the current user may run a profile's hooks. Hooks are shell
+// commands, so those of a profile shared by another user are never run: they
+// would run as whoever restores it.
+func hooksRunnable(db *sql.DB, profileName string) bool {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		log.Printf("Skipping hooks of '%s': %v", profileName, err)
+		return false
+	}
+	return true
+}
+
+// hookPolicy is what a profile's restores do when its hooks fail. By default
+// failures are only logged and reported.
+type hookPolicy struct {
+	// BeforeAborts stops the restore before moving anything when a before
+	// hook fails
+	BeforeAborts bool
+	// AfterFatal fails the restore when an after hook fails
+	AfterFatal bool
+}
+
+func getHookPolicy(db *sql.DB, profileName string) (hookPolicy, error) {
+	var policy hookPolicy
+	err := db.QueryRow("SELECT before_hooks_abort, after_hooks_fatal FROM profiles WHERE name = ?", profileName).Scan(&policy.BeforeAborts, &policy.AfterFatal)
+	if err == sql.ErrNoRows {
+		return hookPolicy{}, nil
+	}
+	if err != nil {
+		return hookPolicy{}, fmt.Errorf("error reading profile: %v", err)
+	}
+	return policy, nil
+}
+
+func setHookPolicy(db *sql.DB, profileName string, policy hookPolicy) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET before_hooks_abort = ?, after_hooks_fatal = ? WHERE name = ?", policy.BeforeAborts, policy.AfterFatal, profileName)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+	return nil
+}
+
+// hookContext is what hooks are told about the restore they run around
+type hookContext struct {
+	Displays int
+	// Result is how the restore went for after hooks: ok, partial or
+	// failed, or test when run from the Hooks dialog
+	Result  string
+	Windows []hookWindow
+}
+
+// hookWindow is one window of the restore in the file hooks get, with its
+// outcome once it was restored
+type hookWindow struct {
+	AppName     string  `json:"app_name"`
+	WindowTitle string  `json:"window_title"`
+	X           float64 `json:"x"`
+	Y           float64 `json:"y"`
+	Width       float64 `json:"width"`
+	Height      float64 `json:"height"`
+	Result      string  `json:"result,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Builds the context for before hooks, with the windows about to be restored
+func beforeHookContext(backend WindowBackend, states []WindowState) hookContext {
+	hc := hookContext{Displays: len(connectedDisplays(backend))}
+	for _, state := range states {
+		hc.Windows = append(hc.Windows, hookWindow{
+			AppName: state.AppName, WindowTitle: state.WindowTitle,
+			X: state.X, Y: state.Y, Width: state.Width, Height: state.Height,
+		})
+	}
+	return hc
+}
+
+// Builds the context for after hooks from what happened to each window
+func afterHookContext(backend WindowBackend, results []restoreResult, err error) hookContext {
+	hc := hookContext{Displays: len(connectedDisplays(backend)), Result: "ok"}
+	restored := 0
+	for _, result := range results {
+		window := hookWindow{
+			AppName: result.State.AppName, WindowTitle: result.State.WindowTitle,
+			X: result.State.X, Y: result.State.Y, Width: result.State.Width, Height: result.State.Height,
+			Result: string(result.Outcome),
+		}
+		if result.Err != nil {
+			window.Error = result.Err.Error()
+		}
+		if result.Restored() {
+			restored++
+		}
+		hc.Windows = append(hc.Windows, window)
+	}
+	if err != nil {
+		hc.Result = "failed"
+		if restored > 0 {
+			hc.Result = "partial"
+		}
+	}
+	return hc
+}
+
+// Writes the windows of a hook context to a temporary JSON file for the
+// hooks to read, the caller removes it
+func writeHookWindows(hc hookContext) (string, error) {
+	file, err := os.CreateTemp("", "wisa-hook-*.json")
+	if err != nil {
+		return "", fmt.Errorf("error creating hook windows file: %v", err)
+	}
+	defer file.Close()
+
+	windows := hc.Windows
+	if windows == nil {
+		windows = []hookWindow{}
+	}
+	if err := json.NewEncoder(file).Encode(windows); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("error writing hook windows file: %v", err)
+	}
+	return file.Name(), nil
+}
+
+// Runs the hooks of a profile for a stage one after another. Failures are
+// logged and don't stop the remaining hooks or the restore. Another user's
+// hooks are skipped.
+func runProfileHooks(db *sql.DB, profileName, stage string, hc hookContext) error {
+	if !hooksRunnable(db, profileName) {
+		return nil
+	}
+	hooks, err := getProfileHooks(db, profileName, stage)
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	env := []string{
+		"WISA_PROFILE=" + profileName,
+		"WISA_HOOK_STAGE=" + stage,
+		"WISA_DISPLAY_COUNT=" + strconv.Itoa(hc.Displays),
+		"WISA_RESULT=" + hc.Result,
+	}
+	windowsFile, err := writeHookWindows(hc)
+	if err != nil {
+		log.Printf("Error preparing hooks for '%s': %v", profileName, err)
+	} else {
+		defer os.Remove(windowsFile)
+		env = append(env, "WISA_WINDOWS_FILE="+windowsFile)
+	}
+
+	var failed int
+	for _, hook := range hooks {
+		if err := runProfileHook(db, profileName, hook, env); err != nil {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d %s-restore hooks failed", failed, len(hooks), stage)
+	}
+	return nil
+}
+
+// Runs one hook with env added to wisa's environment, logs its output and
+// records how it went
+func runProfileHook(db *sql.DB, profileName string, hook profileHook, env []string) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := hookCommand(ctx, hook.Command)
+	cmd.Env = append(os.Environ(), env...)
+	var output cappedBuffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait forever for children that keep the output open
+	cmd.WaitDelay = time.Second
+
+	log.Printf("Running %s-restore hook for '%s': %s", hook.Stage, profileName, hook.Command)
+	err := cmd.Run()
+	status := "ok"
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("timed out after %v", timeout)
+		status = err.Error()
+	case err != nil:
+		status = err.Error()
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(output.String(), "\n"), "\n") {
+		if line != "" {
+			log.Printf("Hook output: %s", line)
+		}
+	}
+	if err != nil {
+		log.Printf("Error running %s-restore hook for '%s': %v", hook.Stage, profileName, err)
+	}
+
+	_, dbErr := db.Exec(
+		"UPDATE profile_hooks SET last_run_at = ?, last_status = ?, last_output = ? WHERE id = ?",
+		time.Now(), status, output.String(), hook.ID,
+	)
+	if dbErr != nil {
+		log.Printf("Error recording hook result: %v", dbErr)
+	}
+	return err
+}
+
+// Runs a hook command through the platform's shell
+func hookCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+// cappedBuffer keeps the first maxHookOutput bytes written to it and drops
+// the rest, so a chatty hook can't fill the database
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := maxHookOutput - b.buf.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	if b.truncated {
+		return b.buf.String() + "\n[output truncated]"
+	}
+	return b.buf.String()
+}
+
+// Describes how a hook's last run went
+func describeHookRun(hook profileHook) string {
+	if hook.LastRun.IsZero() {
+		return "never run"
+	}
+	return fmt.Sprintf("%s at %s", hook.LastStatus, hook.LastRun.Format("Jan 2 15:04"))
+}
+
+// Shows and edits the commands a profile runs before and after restoring
+func showHooksDialog(db *sql.DB, backend WindowBackend, profileName string, parent fyne.Window) {
+	list := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		hooks, err := getProfileHooks(db, profileName, "")
+		if err != nil {
+			list.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(hooks) == 0 {
+			list.Add(widget.NewLabel("This profile doesn't run any commands"))
+		}
+		for _, hook := range hooks {
+			output := widget.NewButton("Output", func() {
+				text := hook.LastOutput
+				if text == "" {
+					text = "(no output)"
+				}
+				entry := widget.NewMultiLineEntry()
+				entry.SetText(text)
+				entry.Disable()
+				scroll := container.NewVScroll(entry)
+				scroll.SetMinSize(fyne.NewSize(500, 250))
+				dialog.ShowCustom("Last Output: "+describeHookRun(hook), "Close", scroll, parent)
+			})
+			remove := widget.NewButton("Remove", func() {
+				if err := deleteProfileHook(db, profileName, hook.ID); err != nil {
+					dialog.ShowError(err, parent)
+				}
+				refresh()
+			})
+			label := widget.NewLabel(fmt.Sprintf("%s: %s (%s)", hook.Stage, hook.Command, describeHookRun(hook)))
+			label.Truncation = fyne.TextTruncateEllipsis
+			list.Add(container.NewBorder(nil, nil, nil, container.NewHBox(output, remove), label))
+		}
+	}
+	refresh()
+
+	stageSelect := widget.NewSelect([]string{hookBefore, hookAfter}, nil)
+	stageSelect.SetSelected(hookBefore)
+	commandEntry := widget.NewEntry()
+	commandEntry.SetPlaceHolder("e.g. code ~/Projects/site")
+	timeoutEntry := widget.NewEntry()
+	timeoutEntry.SetPlaceHolder(strconv.Itoa(int(defaultHookTimeout / time.Second)))
+
+	addButton := widget.NewButton("Add", func() {
+		var timeout time.Duration
+		if timeoutEntry.Text != "" {
+			seconds, err := strconv.Atoi(timeoutEntry.Text)
+			if err != nil || seconds <= 0 {
+				dialog.ShowError(fmt.Errorf("timeout must be a number of seconds"), parent)
+				return
+			}
+			timeout = time.Duration(seconds) * time.Second
+		}
+		if err := addProfileHook(db, profileName, stageSelect.Selected, commandEntry.Text, timeout); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		commandEntry.SetText("")
+		timeoutEntry.SetText("")
+		refresh()
+	})
+
+	runButton := widget.NewButton("Run Now", func() {
+		go func() {
+			states, err := loadWindowStates(db, profileName, currentArrangement(backend))
+			if err != nil {
+				log.Printf("Error loading window states: %v", err)
+			}
+			hc := beforeHookContext(backend, states)
+			runProfileHooks(db, profileName, hookBefore, hc)
+			hc.Result = "test"
+			runProfileHooks(db, profileName, hookAfter, hc)
+			refresh()
+		}()
+	})
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 150))
+
+	form := container.New(
+		layout.NewFormLayout(),
+		widget.NewLabel("When:"), stageSelect,
+		widget.NewLabel("Command:"), commandEntry,
+		widget.NewLabel("Timeout (s):"), timeoutEntry,
+	)
+	// What a failing hook does to the restore, saved as soon as it's ticked
+	policy, err := getHookPolicy(db, profileName)
+	if err != nil {
+		log.Printf("Error reading profile settings: %v", err)
+	}
+	var beforeCheck, afterCheck *widget.Check
+	savePolicy := func(bool) {
+		policy := hookPolicy{BeforeAborts: beforeCheck.Checked, AfterFatal: afterCheck.Checked}
+		if err := setHookPolicy(db, profileName, policy); err != nil {
+			dialog.ShowError(err, parent)
+		}
+	}
+	beforeCheck = widget.NewCheck("Stop the restore when a before hook fails", nil)
+	beforeCheck.SetChecked(policy.BeforeAborts)
+	beforeCheck.OnChanged = savePolicy
+	afterCheck = widget.NewCheck("Report the restore as failed when an after hook fails", nil)
+	afterCheck.SetChecked(policy.AfterFatal)
+	afterCheck.OnChanged = savePolicy
+
+	content := container.NewVBox(
+		scroll,
+		widget.NewLabel("Commands run in the shell with WISA_PROFILE, WISA_DISPLAY_COUNT, WISA_RESULT\nand WISA_WINDOWS_FILE set, see the README."),
+		beforeCheck,
+		afterCheck,
+		widget.NewSeparator(),
+		form,
+		container.NewHBox(addButton, layout.NewSpacer(), runButton),
+	)
+	dialog.ShowCustom("Hooks for '"+profileName+"'", "Close", content, parent)
+}
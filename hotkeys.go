@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Kinds of hotkey triggers, the spec is the key combination
+const (
+	// triggerHotkey restores the profile when the keys are pressed
+	triggerHotkey = "hotkey"
+	// triggerSaveHotkey saves the current windows into the profile
+	triggerSaveHotkey = "hotkey_save"
+)
+
+// errHotkeysUnsupported is returned where system-wide hotkeys can't be
+// registered
+var errHotkeysUnsupported = errors.New("global hotkeys are not supported on this platform")
+
+// hotkey is a key combination like ctrl+alt+cmd+1
+type hotkey struct {
+	Ctrl  bool
+	Alt   bool
+	Shift bool
+	Cmd   bool
+	Key   string
+}
+
+// Keys other than letters and digits that can be used in hotkeys
+var hotkeyNamedKeys = map[string]bool{
+	"space": true, "left": true, "right": true, "up": true, "down": true,
+	"f1": true, "f2": true, "f3": true, "f4": true, "f5": true, "f6": true,
+	"f7": true, "f8": true, "f9": true, "f10": true, "f11": true, "f12": true,
+}
+
+// Parses a key combination such as "ctrl+alt+cmd+1". Option, super and win
+// are accepted for alt and cmd.
+func parseHotkey(spec string) (hotkey, error) {
+	var key hotkey
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(spec)), "+")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if i == len(parts)-1 {
+			if (len(part) == 1 && (part[0] >= 'a' && part[0] <= 'z' || part[0] >= '0' && part[0] <= '9')) || hotkeyNamedKeys[part] {
+				key.Key = part
+				break
+			}
+			return hotkey{}, fmt.Errorf("unknown key %q in hotkey %q", part, spec)
+		}
+		switch part {
+		case "ctrl", "control":
+			key.Ctrl = true
+		case "alt", "option", "opt":
+			key.Alt = true
+		case "shift":
+			key.Shift = true
+		case "cmd", "command", "super", "win":
+			key.Cmd = true
+		default:
+			return hotkey{}, fmt.Errorf("unknown modifier %q in hotkey %q", part, spec)
+		}
+	}
+	if !key.Ctrl && !key.Alt && !key.Cmd {
+		return hotkey{}, fmt.Errorf("hotkey %q needs ctrl, alt or cmd so it doesn't take over typing", spec)
+	}
+	return key, nil
+}
+
+// Formats the hotkey the way it's stored
+func (key hotkey) String() string {
+	var parts []string
+	if key.Ctrl {
+		parts = append(parts, "ctrl")
+	}
+	if key.Alt {
+		parts = append(parts, "alt")
+	}
+	if key.Shift {
+		parts = append(parts, "shift")
+	}
+	if key.Cmd {
+		parts = append(parts, "cmd")
+	}
+	return strings.Join(append(parts, key.Key), "+")
+}
+
+// Receives the IDs of registered hotkeys when they are pressed
+var hotkeyPressed = make(chan int, 16)
+
+// hotkeyManager keeps the system-wide hotkeys in line with the hotkey
+// triggers and runs them when pressed
+type hotkeyManager struct {
+	engine *restoreEngine
+	hooks  triggerHooks
+
+	mu         sync.Mutex
+	registered map[int]Trigger
+}
+
+// Registers the hotkey triggers and starts handling presses
+func startHotkeys(engine *restoreEngine, hooks triggerHooks) *hotkeyManager {
+	manager := &hotkeyManager{
+		engine:     engine,
+		hooks:      hooks,
+		registered: make(map[int]Trigger),
+	}
+	if err := manager.Reload(); err != nil {
+		log.Printf("Error registering hotkeys: %v", err)
+	}
+	go manager.run()
+	return manager
+}
+
+// Registers the enabled hotkey triggers again, after they were changed.
+// Returns the first hotkey that couldn't be registered.
+func (m *hotkeyManager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id := range m.registered {
+		unregisterHotkey(id)
+	}
+	m.registered = make(map[int]Trigger)
+
+	var triggers []Trigger
+	for _, kind := range []string{triggerHotkey, triggerSaveHotkey} {
+		found, err := getTriggers(m.engine.db, kind)
+		if err != nil {
+			return err
+		}
+		triggers = append(triggers, found...)
+	}
+
+	var firstErr error
+	for _, trigger := range triggers {
+		if !trigger.Enabled {
+			continue
+		}
+		key, err := parseHotkey(trigger.Spec)
+		if err == nil {
+			err = registerHotkey(trigger.ID, key)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error registering %s: %v", trigger.Spec, err)
+			}
+			continue
+		}
+		m.registered[trigger.ID] = trigger
+	}
+	return firstErr
+}
+
+func (m *hotkeyManager) run() {
+	for id := range hotkeyPressed {
+		m.mu.Lock()
+		trigger, ok := m.registered[id]
+		m.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		profileName := trigger.ProfileName
+		if trigger.Kind == triggerSaveHotkey {
+			backend := m.engine.backend
+			states := captureForSave(backend)
+			err := saveWindowStates(m.engine.db, profileName, currentArrangement(backend), states)
+			if m.hooks.Saved != nil {
+				m.hooks.Saved(profileName, len(states), err)
+			}
+			continue
+		}
+		m.engine.Enqueue(profileName, trigger.Kind, restoreOptions{}, func(count int, err error) {
+			m.hooks.Notify(profileName, count, err)
+		})
+	}
+}
+
+// Assigns a hotkey to restoring or saving a profile, replacing whatever the
+// same keys did before
+func saveHotkeyTrigger(db *sql.DB, kind, spec, profileName string) error {
+	key, err := parseHotkey(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	var profileID int
+	err = db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	_, err = db.Exec(
+		"DELETE FROM triggers WHERE kind IN (?, ?) AND spec = ? AND profile_id IN ("+ownProfileIDs+")",
+		triggerHotkey, triggerSaveHotkey, key.String(), currentUsername(),
+	)
+	if err != nil {
+		return fmt.Errorf("error replacing trigger: %v", err)
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO triggers (kind, spec, profile_id, enabled) VALUES (?, ?, ?, 1)",
+		kind, key.String(), profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving trigger: %v", err)
+	}
+	return nil
+}
+
+// Labels for the hotkey kinds in the dialog
+var hotkeyKindLabels = map[string]string{
+	triggerHotkey:     "Restore",
+	triggerSaveHotkey: "Save",
+}
+
+// Shows the hotkeys and lets the user add, turn off and remove them
+func showHotkeysDialog(db *sql.DB, manager *hotkeyManager, parent fyne.Window) {
+	profiles, err := getProfiles(db)
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	reload := func() {
+		if err := manager.Reload(); err != nil {
+			dialog.ShowError(err, parent)
+		}
+	}
+
+	list := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		var triggers []Trigger
+		for _, kind := range []string{triggerHotkey, triggerSaveHotkey} {
+			found, err := getTriggers(db, kind)
+			if err != nil {
+				list.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+				return
+			}
+			triggers = append(triggers, found...)
+		}
+		if len(triggers) == 0 {
+			list.Add(widget.NewLabel("No hotkeys yet"))
+		}
+		for _, trigger := range triggers {
+			trigger := trigger
+			label := widget.NewLabel(fmt.Sprintf("%s → %s '%s'", trigger.Spec, hotkeyKindLabels[trigger.Kind], trigger.ProfileName))
+			enabled := widget.NewCheck("", func(checked bool) {
+				if err := setTriggerEnabled(db, trigger.ID, checked); err != nil {
+					dialog.ShowError(err, parent)
+					return
+				}
+				reload()
+			})
+			enabled.SetChecked(trigger.Enabled)
+			remove := widget.NewButton("Remove", func() {
+				if err := deleteTrigger(db, trigger.ID); err != nil {
+					dialog.ShowError(err, parent)
+				}
+				reload()
+				refresh()
+			})
+			list.Add(container.NewBorder(nil, nil, enabled, remove, label))
+		}
+	}
+	refresh()
+
+	keysEntry := widget.NewEntry()
+	keysEntry.SetPlaceHolder("ctrl+alt+cmd+1")
+	kindSelect := widget.NewSelect([]string{hotkeyKindLabels[triggerHotkey], hotkeyKindLabels[triggerSaveHotkey]}, nil)
+	kindSelect.SetSelected(hotkeyKindLabels[triggerHotkey])
+	profileSelect := widget.NewSelect(profiles, nil)
+	profileSelect.PlaceHolder = "Choose a profile"
+	addButton := widget.NewButton("Add", func() {
+		if profileSelect.Selected == "" {
+			return
+		}
+		kind := triggerHotkey
+		if kindSelect.Selected == hotkeyKindLabels[triggerSaveHotkey] {
+			kind = triggerSaveHotkey
+		}
+		if err := saveHotkeyTrigger(db, kind, keysEntry.Text, profileSelect.Selected); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		keysEntry.SetText("")
+		reload()
+		refresh()
+	})
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 180))
+
+	content := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Keys:"), nil, keysEntry),
+		container.NewBorder(nil, nil, kindSelect, addButton, profileSelect),
+		widget.NewSeparator(),
+		scroll,
+	)
+	dialog.ShowCustom("Hotkeys", "Close", content, parent)
+}
@@ -0,0 +1,197 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include <Carbon/Carbon.h>
+#include <dispatch/dispatch.h>
+#include <pthread.h>
+#include <unistd.h>
+
+// Pressed hotkey IDs are written to a pipe that Go reads from, Carbon calls
+// the handler on the main thread
+static int wisa_hotkey_pipe[2] = {-1, -1};
+
+static OSStatus wisa_hotkey_event(EventHandlerCallRef next, EventRef event, void *data) {
+	EventHotKeyID hotKeyID;
+	if (GetEventParameter(event, kEventParamDirectObject, typeEventHotKeyID, NULL, sizeof(hotKeyID), NULL, &hotKeyID) == noErr) {
+		int id = (int)hotKeyID.id;
+		write(wisa_hotkey_pipe[1], &id, sizeof(id));
+	}
+	return noErr;
+}
+
+typedef struct {
+	int id;
+	UInt32 keyCode;
+	UInt32 modifiers;
+	EventHotKeyRef ref;
+	int result;
+} wisa_hotkey_request;
+
+static void wisa_do_install(void *ctx) {
+	wisa_hotkey_request *request = ctx;
+	EventTypeSpec spec = {kEventClassKeyboard, kEventHotKeyPressed};
+	request->result = InstallApplicationEventHandler(&wisa_hotkey_event, 1, &spec, NULL, NULL) == noErr ? 0 : -1;
+}
+
+static void wisa_do_register(void *ctx) {
+	wisa_hotkey_request *request = ctx;
+	EventHotKeyID hotKeyID = {'wisa', (UInt32)request->id};
+	request->result = RegisterEventHotKey(request->keyCode, request->modifiers, hotKeyID,
+		GetApplicationEventTarget(), 0, &request->ref) == noErr ? 0 : -1;
+}
+
+static void wisa_do_unregister(void *ctx) {
+	wisa_hotkey_request *request = ctx;
+	UnregisterEventHotKey(request->ref);
+}
+
+// Carbon event calls belong on the main thread
+static void wisa_on_main(wisa_hotkey_request *request, dispatch_function_t fn) {
+	if (pthread_main_np()) {
+		fn(request);
+	} else {
+		dispatch_sync_f(dispatch_get_main_queue(), request, fn);
+	}
+}
+
+// Installs the hotkey handler and returns the pipe to read presses from, or
+// -1 on failure
+static int wisa_hotkeys_init(void) {
+	if (pipe(wisa_hotkey_pipe) != 0) {
+		return -1;
+	}
+	wisa_hotkey_request request = {0};
+	wisa_on_main(&request, wisa_do_install);
+	return request.result == 0 ? wisa_hotkey_pipe[0] : -1;
+}
+
+static EventHotKeyRef wisa_register_hotkey(int id, UInt32 keyCode, UInt32 modifiers) {
+	wisa_hotkey_request request = {id, keyCode, modifiers, NULL, 0};
+	wisa_on_main(&request, wisa_do_register);
+	return request.result == 0 ? request.ref : NULL;
+}
+
+static void wisa_unregister_hotkey(EventHotKeyRef ref) {
+	wisa_hotkey_request request = {0};
+	request.ref = ref;
+	wisa_on_main(&request, wisa_do_unregister);
+}
+
+// Dispatches Carbon events and the main queue when there is no window
+static void wisa_run_event_loop(void) {
+	RunApplicationEventLoop();
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// Carbon virtual key codes of the keys parseHotkey accepts
+var macKeyCodes = map[string]C.UInt32{
+	"a": 0x00, "s": 0x01, "d": 0x02, "f": 0x03, "h": 0x04, "g": 0x05, "z": 0x06,
+	"x": 0x07, "c": 0x08, "v": 0x09, "b": 0x0B, "q": 0x0C, "w": 0x0D, "e": 0x0E,
+	"r": 0x0F, "y": 0x10, "t": 0x11, "o": 0x1F, "u": 0x20, "i": 0x22, "p": 0x23,
+	"l": 0x25, "j": 0x26, "k": 0x28, "n": 0x2D, "m": 0x2E,
+	"1": 0x12, "2": 0x13, "3": 0x14, "4": 0x15, "6": 0x16, "5": 0x17, "9": 0x19,
+	"7": 0x1A, "8": 0x1C, "0": 0x1D,
+	"space": 0x31, "left": 0x7B, "right": 0x7C, "down": 0x7D, "up": 0x7E,
+	"f1": 0x7A, "f2": 0x78, "f3": 0x63, "f4": 0x76, "f5": 0x60, "f6": 0x61,
+	"f7": 0x62, "f8": 0x64, "f9": 0x65, "f10": 0x6D, "f11": 0x67, "f12": 0x6F,
+}
+
+var (
+	hotkeyInitOnce sync.Once
+	hotkeyInitErr  error
+
+	hotkeyMu   sync.Mutex
+	hotkeyRefs = make(map[int]C.EventHotKeyRef)
+)
+
+// Installs the Carbon handler and forwards presses from its pipe
+func initHotkeys() {
+	fd := int(C.wisa_hotkeys_init())
+	if fd < 0 {
+		hotkeyInitErr = errors.New("error installing the hotkey handler")
+		return
+	}
+
+	go func() {
+		pipe := os.NewFile(uintptr(fd), "hotkeys")
+		var id int32
+		for {
+			if err := binary.Read(pipe, binary.NativeEndian, &id); err != nil {
+				if err != io.EOF {
+					log.Printf("Error reading hotkeys: %v", err)
+				}
+				return
+			}
+			select {
+			case hotkeyPressed <- int(id):
+			default:
+			}
+		}
+	}()
+}
+
+// Registers a system-wide hotkey with Carbon, presses are sent on
+// hotkeyPressed
+func registerHotkey(id int, key hotkey) error {
+	hotkeyInitOnce.Do(initHotkeys)
+	if hotkeyInitErr != nil {
+		return hotkeyInitErr
+	}
+
+	code, ok := macKeyCodes[key.Key]
+	if !ok {
+		return errors.New("unknown key " + key.Key)
+	}
+	var mods C.UInt32
+	if key.Ctrl {
+		mods |= C.controlKey
+	}
+	if key.Alt {
+		mods |= C.optionKey
+	}
+	if key.Shift {
+		mods |= C.shiftKey
+	}
+	if key.Cmd {
+		mods |= C.cmdKey
+	}
+
+	ref := C.wisa_register_hotkey(C.int(id), code, mods)
+	if ref == nil {
+		return errors.New("the keys may already be taken")
+	}
+	hotkeyMu.Lock()
+	hotkeyRefs[id] = ref
+	hotkeyMu.Unlock()
+	return nil
+}
+
+func unregisterHotkey(id int) {
+	hotkeyMu.Lock()
+	ref, ok := hotkeyRefs[id]
+	delete(hotkeyRefs, id)
+	hotkeyMu.Unlock()
+	if ok {
+		C.wisa_unregister_hotkey(ref)
+	}
+}
+
+// Runs the event loop that delivers hotkeys when the window isn't open.
+// Must be called from the main goroutine and never returns.
+func runHotkeyLoop() {
+	C.wisa_run_event_loop()
+	select {}
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !(darwin && cgo)
+
+package main
+
+// Hotkeys need Carbon on macOS and aren't implemented for X11 yet
+func registerHotkey(id int, key hotkey) error {
+	return errHotkeysUnsupported
+}
+
+func unregisterHotkey(id int) {}
+
+// Nothing needs an event loop without hotkeys, so this just waits
+func runHotkeyLoop() {
+	select {}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestParseHotkey(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    hotkey
+		wantErr bool
+	}{
+		{spec: "ctrl+alt+cmd+1", want: hotkey{Ctrl: true, Alt: true, Cmd: true, Key: "1"}},
+		{spec: " Ctrl + Shift + A ", want: hotkey{Ctrl: true, Shift: true, Key: "a"}},
+		{spec: "option+command+space", want: hotkey{Alt: true, Cmd: true, Key: "space"}},
+		{spec: "control+opt+left", want: hotkey{Ctrl: true, Alt: true, Key: "left"}},
+		{spec: "super+f12", want: hotkey{Cmd: true, Key: "f12"}},
+		{spec: "win+z", want: hotkey{Cmd: true, Key: "z"}},
+		{spec: "shift+a", wantErr: true},
+		{spec: "a", wantErr: true},
+		{spec: "", wantErr: true},
+		{spec: "ctrl+", wantErr: true},
+		{spec: "ctrl+f13", wantErr: true},
+		{spec: "ctrl+ab", wantErr: true},
+		{spec: "hyper+a", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseHotkey(test.spec)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseHotkey(%q) = %+v, want an error", test.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseHotkey(%q) returned %v", test.spec, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseHotkey(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestHotkeyStringRoundTrips(t *testing.T) {
+	for _, spec := range []string{"ctrl+alt+shift+cmd+1", "alt+space", "cmd+f1"} {
+		key, err := parseHotkey(spec)
+		if err != nil {
+			t.Fatalf("parseHotkey(%q) returned %v", spec, err)
+		}
+		if got := key.String(); got != spec {
+			t.Errorf("parseHotkey(%q).String() = %q", spec, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"unsafe"
+)
+
+var (
+	procRegisterHotKey     = user32.NewProc("RegisterHotKey")
+	procUnregisterHotKey   = user32.NewProc("UnregisterHotKey")
+	procGetMessageW        = user32.NewProc("GetMessageW")
+	procPeekMessageW       = user32.NewProc("PeekMessageW")
+	procPostThreadMessageW = user32.NewProc("PostThreadMessageW")
+	procGetCurrentThreadId = kernel32.NewProc("GetCurrentThreadId")
+)
+
+const (
+	modAlt      = 0x0001
+	modControl  = 0x0002
+	modShift    = 0x0004
+	modWin      = 0x0008
+	modNoRepeat = 0x4000
+
+	wmHotkey = 0x0312
+	// wmApp wakes the hotkey thread to pick up requests
+	wmApp = 0x8000
+)
+
+type winMsg struct {
+	Hwnd    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      struct{ X, Y int32 }
+}
+
+// hotkeyRequest asks the hotkey thread to register or unregister a hotkey,
+// which has to happen on the thread that receives its messages
+type hotkeyRequest struct {
+	id       int
+	key      hotkey
+	register bool
+	done     chan error
+}
+
+var (
+	hotkeyThreadOnce sync.Once
+	hotkeyThreadID   uintptr
+	hotkeyRequests   = make(chan hotkeyRequest, 16)
+)
+
+// Starts the thread that owns the hotkeys and waits for its message queue
+func startHotkeyThread() {
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		hotkeyThreadID, _, _ = procGetCurrentThreadId.Call()
+
+		// Windows creates the message queue on the first peek
+		var msg winMsg
+		procPeekMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0, 0)
+		close(ready)
+
+		for {
+			ret, _, _ := procGetMessageW.Call(uintptr(unsafe.Pointer(&msg)), 0, 0, 0)
+			if int32(ret) <= 0 {
+				return
+			}
+			switch msg.Message {
+			case wmHotkey:
+				select {
+				case hotkeyPressed <- int(msg.WParam):
+				default:
+				}
+			case wmApp:
+				for pending := true; pending; {
+					select {
+					case request := <-hotkeyRequests:
+						request.done <- handleHotkeyRequest(request)
+					default:
+						pending = false
+					}
+				}
+			}
+		}
+	}()
+	<-ready
+}
+
+func handleHotkeyRequest(request hotkeyRequest) error {
+	if !request.register {
+		procUnregisterHotKey.Call(0, uintptr(request.id))
+		return nil
+	}
+
+	mods := uintptr(modNoRepeat)
+	if request.key.Ctrl {
+		mods |= modControl
+	}
+	if request.key.Alt {
+		mods |= modAlt
+	}
+	if request.key.Shift {
+		mods |= modShift
+	}
+	if request.key.Cmd {
+		mods |= modWin
+	}
+	ret, _, err := procRegisterHotKey.Call(0, uintptr(request.id), mods, virtualKey(request.key.Key))
+	if ret == 0 {
+		return fmt.Errorf("the keys may already be taken: %v", err)
+	}
+	return nil
+}
+
+// Gets the virtual key code of a key name accepted by parseHotkey
+func virtualKey(name string) uintptr {
+	switch name {
+	case "space":
+		return 0x20
+	case "left":
+		return 0x25
+	case "up":
+		return 0x26
+	case "right":
+		return 0x27
+	case "down":
+		return 0x28
+	}
+	if len(name) > 1 && name[0] == 'f' {
+		n, _ := strconv.Atoi(name[1:])
+		return uintptr(0x70 + n - 1)
+	}
+	// Letter and digit keys use their uppercase ASCII code
+	c := name[0]
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	return uintptr(c)
+}
+
+func sendHotkeyRequest(request hotkeyRequest) error {
+	hotkeyThreadOnce.Do(startHotkeyThread)
+	request.done = make(chan error, 1)
+	hotkeyRequests <- request
+	procPostThreadMessageW.Call(hotkeyThreadID, wmApp, 0, 0)
+	return <-request.done
+}
+
+// Registers a system-wide hotkey, presses are sent on hotkeyPressed
+func registerHotkey(id int, key hotkey) error {
+	return sendHotkeyRequest(hotkeyRequest{id: id, key: key, register: true})
+}
+
+func unregisterHotkey(id int) {
+	sendHotkeyRequest(hotkeyRequest{id: id})
+}
+
+// Hotkeys have their own thread here, so this just waits
+func runHotkeyLoop() {
+	select {}
+}
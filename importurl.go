@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Exports can be published on a web server and imported from their URL.
+// The import_hosts setting limits the hosts they're imported from, and with
+// import_keys set only exports signed by one of the keys are imported, the
+// signature being at the export's URL with .sig added.
+
+// Larger downloads aren't exports
+const maxImportSize = 10 << 20
+
+func isImportURL(arg string) bool {
+	lower := strings.ToLower(arg)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// Checks that a URL may be imported from: over https, or http to this
+// machine, and from one of the allowed hosts when they're set
+func checkImportURL(db *sql.DB, link *url.URL) error {
+	host := link.Hostname()
+	switch {
+	case link.Scheme == "https":
+	case link.Scheme == "http" && isLoopbackHost(host):
+	default:
+		return fmt.Errorf("layouts can only be imported over https, not from %s", link.Redacted())
+	}
+	if hosts := getSetting(db, settingImportHosts, ""); hosts != "" && !matchesInclude(hosts, host) {
+		return fmt.Errorf("%s isn't one of the hosts layouts can be imported from", host)
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Downloads a file to import, checking every redirect against the allowed
+// hosts too
+func downloadImport(db *sql.DB, link *url.URL) ([]byte, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("too many redirects")
+			}
+			return checkImportURL(db, req.URL)
+		},
+	}
+	response, err := client.Get(link.String())
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", link.Redacted(), err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading %s: %s", link.Redacted(), response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxImportSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", link.Redacted(), err)
+	}
+	if len(data) > maxImportSize {
+		return nil, fmt.Errorf("%s is too large to be a layout", link.Redacted())
+	}
+	return data, nil
+}
+
+// Downloads an export from a URL, verifying its signature when signing keys
+// are set
+func fetchExport(db *sql.DB, rawURL string) (*exportBundle, error) {
+	link, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	if err := checkImportURL(db, link); err != nil {
+		return nil, err
+	}
+
+	data, err := downloadImport(db, link)
+	if err != nil {
+		return nil, err
+	}
+
+	if keys := getSetting(db, settingImportKeys, ""); keys != "" {
+		signatureLink := *link
+		signatureLink.Path += ".sig"
+		signatureLink.RawPath = ""
+		signature, err := downloadImport(db, &signatureLink)
+		if err != nil {
+			return nil, fmt.Errorf("error getting the layout's signature: %v", err)
+		}
+		if err := verifyExport(keys, data, signature); err != nil {
+			return nil, err
+		}
+	}
+	return readExport(bytes.NewReader(data))
+}
+
+// Parses a comma separated list of base64 public keys
+func parseImportKeys(keys string) ([]ed25519.PublicKey, error) {
+	var parsed []ed25519.PublicKey
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil || len(decoded) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid signing key %q", key)
+		}
+		parsed = append(parsed, ed25519.PublicKey(decoded))
+	}
+	return parsed, nil
+}
+
+// Checks that signature, in base64, is one of the keys' signature of data
+func verifyExport(keys string, data, signature []byte) error {
+	publicKeys, err := parseImportKeys(keys)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("error reading the layout's signature: %v", err)
+	}
+	for _, key := range publicKeys {
+		if ed25519.Verify(key, data, decoded) {
+			return nil
+		}
+	}
+	return errors.New("the layout isn't signed by a trusted key")
+}
+
+func setImportPolicy(db *sql.DB, hosts, keys string) error {
+	if _, err := parseImportKeys(keys); err != nil {
+		return err
+	}
+	if err := setSetting(db, settingImportHosts, strings.TrimSpace(hosts)); err != nil {
+		return err
+	}
+	return setSetting(db, settingImportKeys, strings.TrimSpace(keys))
+}
+
+// Reads a signing key written by createSigningKey
+func readSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %v", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s isn't a signing key", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// Writes a new private signing key to path, which must not exist yet
+func createSigningKey(path string) (ed25519.PrivateKey, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error creating signing key: %v", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error writing signing key: %v", err)
+	}
+	defer file.Close()
+	if _, err := fmt.Fprintln(file, base64.StdEncoding.EncodeToString(private.Seed())); err != nil {
+		return nil, fmt.Errorf("error writing signing key: %v", err)
+	}
+	return private, nil
+}
+
+// Signs an export file, writing the signature next to it with .sig added
+func signExport(key ed25519.PrivateKey, path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading export: %v", err)
+	}
+	if _, err := readExport(bytes.NewReader(data)); err != nil {
+		return "", err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	signaturePath := path + ".sig"
+	if err := os.WriteFile(signaturePath, []byte(signature+"\n"), 0644); err != nil {
+		return "", fmt.Errorf("error writing signature: %v", err)
+	}
+	return signaturePath, nil
+}
+
+// Runs layout-key, creating the key file when it doesn't exist, and prints
+// the public key to add to import_keys
+func runLayoutKey(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+	var key ed25519.PrivateKey
+	var err error
+	if _, statErr := os.Stat(args[0]); os.IsNotExist(statErr) {
+		key, err = createSigningKey(args[0])
+	} else {
+		key, err = readSigningKey(args[0])
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	return 0
+}
+
+func runSign(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+	key, err := readSigningKey(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	signaturePath, err := signExport(key, args[1])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Wrote the signature to %s, publish it next to the export\n", signaturePath)
+	return 0
+}
+
+// Asks for the URL of an export to import, along with the hosts and keys
+// imports are limited to, then calls onImport with the link
+func showImportURLDialog(db *sql.DB, parent fyne.Window, onImport func(link string)) {
+	urlEntry := widget.NewEntry()
+	urlEntry.SetPlaceHolder("https://example.com/layouts/team.json")
+	urlEntry.Validator = func(text string) error {
+		if !isImportURL(strings.TrimSpace(text)) {
+			return errors.New("enter an https:// link")
+		}
+		return nil
+	}
+	hostsEntry := widget.NewEntry()
+	hostsEntry.SetPlaceHolder("Any host, e.g. layouts.example.com, *.example.com")
+	hostsEntry.SetText(getSetting(db, settingImportHosts, ""))
+	keysEntry := widget.NewEntry()
+	keysEntry.SetPlaceHolder("Not needed, or public keys from wisa layout-key")
+	keysEntry.SetText(getSetting(db, settingImportKeys, ""))
+	keysEntry.Validator = func(text string) error {
+		_, err := parseImportKeys(text)
+		return err
+	}
+
+	form := container.New(
+		layout.NewFormLayout(),
+		widget.NewLabel("Link:"), urlEntry,
+		widget.NewLabel("Only from hosts:"), hostsEntry,
+		widget.NewLabel("Signed by:"), keysEntry,
+	)
+	note := widget.NewLabel("Profiles in the export replace profiles with the same name. With signing keys set, the export's signature is read from its link with .sig added.")
+	note.Wrapping = fyne.TextWrapWord
+	content := container.NewVBox(form, note)
+
+	d := dialog.NewCustomConfirm("Import From URL", "Import", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := urlEntry.Validate(); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		if err := setImportPolicy(db, hostsEntry.Text, keysEntry.Text); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		onImport(strings.TrimSpace(urlEntry.Text))
+	}, parent)
+	d.Resize(fyne.NewSize(560, 260))
+	d.Show()
+}
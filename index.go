@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// How often the live window index captures the windows again
+const windowIndexInterval = 5 * time.Second
+
+// How long the index waits for a burst of window events to end, so
+// dragging a window doesn't capture on every step
+const windowIndexSettle = 300 * time.Millisecond
+
+// windowIndex keeps the latest capture of the windows on screen up to date
+// in the background, so saving and restoring don't have to wait for a full
+// sweep of every app
+type windowIndex struct {
+	backend  WindowBackend
+	interval time.Duration
+	refresh  chan struct{}
+	// watching is set when the backend reports window changes, which
+	// replaces capturing every interval
+	watching bool
+
+	mu      sync.Mutex
+	states  []WindowState
+	updated time.Time
+}
+
+// The index captureStates answers from, nil until startWindowIndex runs
+var liveWindows *windowIndex
+
+// Starts keeping the index of the backend's windows and makes captureStates
+// use it
+func startWindowIndex(backend WindowBackend, interval time.Duration) *windowIndex {
+	index := &windowIndex{
+		backend:  backend,
+		interval: interval,
+		refresh:  make(chan struct{}, 1),
+	}
+	if watcher, ok := backend.(WindowWatcher); ok {
+		events := make(chan WindowEvent, 64)
+		if err := watcher.Watch(events, nil); err != nil {
+			log.Printf("Watching windows failed, the window index will poll instead: %v", err)
+		} else {
+			index.watching = true
+			go func() {
+				for range events {
+					index.changed()
+				}
+			}()
+		}
+	}
+	liveWindows = index
+	go index.run()
+	return index
+}
+
+func (i *windowIndex) run() {
+	if i.watching {
+		for {
+			// A failed capture is tried again after the interval, there may
+			// be no window event to prompt it
+			if i.update() {
+				<-i.refresh
+			} else {
+				select {
+				case <-i.refresh:
+				case <-time.After(i.interval):
+				}
+			}
+			time.Sleep(windowIndexSettle)
+		}
+	}
+
+	ticker := time.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		i.update()
+		select {
+		case <-ticker.C:
+		case <-i.refresh:
+		}
+	}
+}
+
+// Captures the windows into the index, reporting whether it worked. A
+// capture that found no windows at all is taken as failed and the previous
+// one is kept until a capture works again.
+func (i *windowIndex) update() bool {
+	states := sweepStates(i.backend)
+	if len(states) == 0 {
+		return false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.states = states
+	i.updated = time.Now()
+	return true
+}
+
+// Returns a copy of the indexed windows, or false when the index is stale
+// and the caller should capture the windows itself
+func (i *windowIndex) Snapshot() ([]WindowState, bool) {
+	if i == nil {
+		return nil, false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.updated.IsZero() || (!i.watching && time.Since(i.updated) > 2*i.interval) {
+		return nil, false
+	}
+	states := make([]WindowState, len(i.states))
+	copy(states, i.states)
+	return states, true
+}
+
+// Marks the index stale and has it capture again right away, used after
+// wisa moves windows itself
+func (i *windowIndex) Refresh() {
+	if i == nil {
+		return
+	}
+
+	i.mu.Lock()
+	i.updated = time.Time{}
+	i.mu.Unlock()
+	i.changed()
+}
+
+// Has the index capture again soon
+func (i *windowIndex) changed() {
+	select {
+	case i.refresh <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Insights are worked out from the restores on this computer and never leave
+// it, profile_usage and title_changes aren't even part of backups.
+
+// Profiles not restored or saved for this long count as unused
+const unusedAfter = 30 * 24 * time.Hour
+
+// Profiles need this many restores before their failures are worth pointing
+// out, and then failing this share of them
+const (
+	minRestoresForFailures = 3
+	failingRestoreRate     = 0.25
+)
+
+// How many apps the title changes list shows
+const maxTitleChangeApps = 10
+
+// Counts a restore of a profile for the insights, with the apps whose
+// windows changed title. Failing to record is only logged.
+func recordUsage(db *sql.DB, profileName string, results []restoreResult, err error) {
+	// Results are only this restore's when it got as far as moving windows
+	var restoreErr *RestoreError
+	moved := err == nil || errors.As(err, &restoreErr)
+
+	failed := err != nil
+	if moved {
+		for _, result := range results {
+			if !result.Restored() {
+				failed = true
+			}
+		}
+	}
+
+	now := time.Now()
+	_, dbErr := db.Exec(`
+		INSERT INTO profile_usage (profile_name, restores, failed_restores, last_restored_at) VALUES (?, 1, ?, ?)
+		ON CONFLICT (profile_name) DO UPDATE SET
+			restores = restores + 1,
+			failed_restores = failed_restores + excluded.failed_restores,
+			last_restored_at = excluded.last_restored_at`,
+		profileName, failed, now,
+	)
+	if dbErr != nil {
+		log.Printf("Error recording profile usage: %v", dbErr)
+	}
+	if !moved {
+		return
+	}
+
+	changed := make(map[string]bool)
+	for _, result := range results {
+		if result.TitleChanged {
+			changed[result.State.AppName] = true
+		}
+	}
+	for appName := range changed {
+		_, dbErr := db.Exec(`
+			INSERT INTO title_changes (app_name, changes, last_changed_at) VALUES (?, 1, ?)
+			ON CONFLICT (app_name) DO UPDATE SET
+				changes = changes + 1,
+				last_changed_at = excluded.last_changed_at`,
+			appName, now,
+		)
+		if dbErr != nil {
+			log.Printf("Error recording title change: %v", dbErr)
+		}
+	}
+}
+
+// unusedProfile is a profile that hasn't been restored or saved in a while
+type unusedProfile struct {
+	Name string
+	// LastUsed is the last restore or save, zero if neither is known
+	LastUsed time.Time
+}
+
+// failingProfile is a profile whose restores often leave windows behind
+type failingProfile struct {
+	Name     string
+	Restores int
+	Failed   int
+}
+
+// titleChangeApp is an app whose windows were often found under another title
+type titleChangeApp struct {
+	AppName string
+	Changes int
+}
+
+type insights struct {
+	Unused       []unusedProfile
+	Failing      []failingProfile
+	TitleChanges []titleChangeApp
+}
+
+// Works out the insights for the profiles the current user can see
+func getInsights(db *sql.DB) (*insights, error) {
+	rows, err := db.Query(`
+		SELECT p.name, p.updated_at, u.last_restored_at, COALESCE(u.restores, 0), COALESCE(u.failed_restores, 0)
+		FROM profiles p LEFT JOIN profile_usage u ON u.profile_name = p.name
+		WHERE p.deleted_at IS NULL AND p.archived_at IS NULL AND (p.owner = '' OR p.owner = ? OR p.shared = 1)
+		ORDER BY p.name`,
+		currentUsername(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying profile usage: %v", err)
+	}
+	defer rows.Close()
+
+	var result insights
+	cutoff := time.Now().Add(-unusedAfter)
+	for rows.Next() {
+		var name string
+		var updated, restored sql.NullTime
+		var restores, failed int
+		if err := rows.Scan(&name, &updated, &restored, &restores, &failed); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+
+		lastUsed := updated.Time
+		if restored.Time.After(lastUsed) {
+			lastUsed = restored.Time
+		}
+		if lastUsed.Before(cutoff) {
+			result.Unused = append(result.Unused, unusedProfile{Name: name, LastUsed: lastUsed})
+		}
+		if restores >= minRestoresForFailures && float64(failed) >= failingRestoreRate*float64(restores) {
+			result.Failing = append(result.Failing, failingProfile{Name: name, Restores: restores, Failed: failed})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	appRows, err := db.Query("SELECT app_name, changes FROM title_changes ORDER BY changes DESC, app_name LIMIT ?", maxTitleChangeApps)
+	if err != nil {
+		return nil, fmt.Errorf("error querying title changes: %v", err)
+	}
+	defer appRows.Close()
+	for appRows.Next() {
+		var app titleChangeApp
+		if err := appRows.Scan(&app.AppName, &app.Changes); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		result.TitleChanges = append(result.TitleChanges, app)
+	}
+	if err = appRows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+	return &result, nil
+}
+
+// Says how long ago t was in days, e.g. 45 days ago
+func daysAgo(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	days := int(time.Since(t) / (24 * time.Hour))
+	return plural(days, "day") + " ago"
+}
+
+func describeInsights(result *insights) string {
+	var b strings.Builder
+
+	b.WriteString("Unused profiles\n")
+	if len(result.Unused) == 0 {
+		b.WriteString("  Every profile was restored or saved in the last 30 days\n")
+	}
+	for _, profile := range result.Unused {
+		fmt.Fprintf(&b, "  %s: last used %s\n", profile.Name, daysAgo(profile.LastUsed))
+	}
+	if len(result.Unused) > 0 {
+		b.WriteString("  Delete the ones you no longer need to keep the list short\n")
+	}
+
+	b.WriteString("\nProfiles that often don't fully restore\n")
+	if len(result.Failing) == 0 {
+		b.WriteString("  None\n")
+	}
+	for _, profile := range result.Failing {
+		fmt.Fprintf(&b, "  %s: %d of %d restores left windows behind\n", profile.Name, profile.Failed, profile.Restores)
+	}
+	if len(result.Failing) > 0 {
+		b.WriteString("  Restore them to see which windows fail, then save them again or ignore those windows\n")
+	}
+
+	b.WriteString("\nApps whose window titles change\n")
+	if len(result.TitleChanges) == 0 {
+		b.WriteString("  None\n")
+	}
+	for _, app := range result.TitleChanges {
+		fmt.Fprintf(&b, "  %s: %s with a changed or missing title\n", app.AppName, plural(app.Changes, "restore"))
+	}
+	if len(result.TitleChanges) > 0 {
+		b.WriteString("  Title Matching… can match their windows by app, a pattern or their index instead\n")
+	}
+	return b.String()
+}
+
+// Shows the insights, worked out when opened
+func showInsightsDialog(db *sql.DB, parent fyne.Window) {
+	text := widget.NewLabel("")
+	refresh := func() {
+		result, err := getInsights(db)
+		if err != nil {
+			text.SetText(fmt.Sprintf("Error: %v", err))
+			return
+		}
+		text.SetText(describeInsights(result))
+	}
+	refresh()
+
+	note := widget.NewLabel("Worked out from the restores on this computer, nothing is sent anywhere")
+	note.Importance = widget.LowImportance
+	content := container.NewBorder(note, widget.NewButton("Refresh", refresh), nil, nil, container.NewVScroll(text))
+	d := dialog.NewCustom("Insights", "Close", content, parent)
+	d.Resize(fyne.NewSize(620, 460))
+	d.Show()
+}
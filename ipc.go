@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Commands that always run in their own process rather than in the running
+// window or daemon
+var localCommands = map[string]bool{
+	"watch": true, "daemon": true, "help": true, "-h": true, "--help": true,
+}
+
+// ipcRequest is a command line sent to the running window or daemon
+type ipcRequest struct {
+	Args []string `json:"args"`
+	// Stdin is the command's input, for commands that read it
+	Stdin string `json:"stdin,omitempty"`
+	// DBPath is the database the command is meant for, it's refused when
+	// the running wisa has another one open
+	DBPath string `json:"db_path,omitempty"`
+}
+
+// ipcMessage is a piece of a command's output, the last one has its exit
+// code
+type ipcMessage struct {
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	Exit   *int   `json:"exit,omitempty"`
+	// OtherDB is the answer to a command meant for another database, which
+	// then runs in its own process
+	OtherDB bool `json:"other_db,omitempty"`
+}
+
+// Where the running window or daemon listens for commands, e.g.
+// ~/Library/Application Support/wisa/wisa.sock
+func socketPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error finding the config folder: %v", err)
+	}
+	return filepath.Join(dir, "wisa", "wisa.sock"), nil
+}
+
+// Listens for commands from the CLI, so they run here instead of opening the
+// database a second time. Does nothing if another wisa is already listening.
+func startIPCServer(engine *restoreEngine) {
+	path, err := socketPath()
+	if err != nil {
+		log.Printf("Error starting command socket: %v", err)
+		return
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		log.Printf("Another wisa is already listening on %s", path)
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Printf("Error starting command socket: %v", err)
+		return
+	}
+	// Left behind by a wisa that didn't quit cleanly
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		log.Printf("Error starting command socket: %v", err)
+		return
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		log.Printf("Error securing command socket: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				log.Printf("Error accepting command: %v", err)
+				return
+			}
+			go serveIPC(engine, conn)
+		}
+	}()
+}
+
+// ipcWriter sends what a command writes to one of its streams
+type ipcWriter struct {
+	mu      *sync.Mutex
+	encoder *json.Encoder
+	stderr  bool
+}
+
+func (w ipcWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	message := ipcMessage{Stdout: string(p)}
+	if w.stderr {
+		message = ipcMessage{Stderr: string(p)}
+	}
+	if err := w.encoder.Encode(message); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Runs one command from the CLI and sends back its output and exit code
+func serveIPC(engine *restoreEngine, conn net.Conn) {
+	defer conn.Close()
+
+	var request ipcRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&request); err != nil {
+		// Other instances connect without a command to see if one is running
+		if err != io.EOF {
+			log.Printf("Error reading command: %v", err)
+		}
+		return
+	}
+	if len(request.Args) == 0 || localCommands[request.Args[0]] {
+		return
+	}
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(conn)
+	if request.DBPath != "" && !sameFile(request.DBPath, getDBPath()) {
+		if err := encoder.Encode(ipcMessage{OtherDB: true}); err != nil {
+			log.Printf("Error answering command: %v", err)
+		}
+		return
+	}
+	stdout := ipcWriter{mu: &mu, encoder: encoder}
+	stderr := ipcWriter{mu: &mu, encoder: encoder, stderr: true}
+	code := runCLI(engine.db, engine, request.Args, strings.NewReader(request.Stdin), stdout, stderr)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := encoder.Encode(ipcMessage{Exit: &code}); err != nil {
+		log.Printf("Error answering command: %v", err)
+	}
+}
+
+// Runs a command in the wisa that's already running, if there is one.
+// Returns false when the command has to run in this process.
+func forwardCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) (int, bool) {
+	if len(args) == 0 || localCommands[args[0]] {
+		return 0, false
+	}
+	path, err := socketPath()
+	if err != nil {
+		return 0, false
+	}
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return 0, false
+	}
+	defer conn.Close()
+
+	request := ipcRequest{Args: absoluteFileArgs(args), DBPath: getDBPath()}
+	if path, err := filepath.Abs(request.DBPath); err == nil {
+		request.DBPath = path
+	}
+	if readsStdin(args) {
+		input, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "error reading stdin: %v\n", err)
+			return 1, true
+		}
+		request.Stdin = string(input)
+	}
+	if err := json.NewEncoder(conn).Encode(request); err != nil {
+		fmt.Fprintf(stderr, "error sending command to wisa: %v\n", err)
+		return 1, true
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(conn))
+	for {
+		var message ipcMessage
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errors.New("wisa closed the connection")
+			}
+			fmt.Fprintf(stderr, "error running command in wisa: %v\n", err)
+			return 1, true
+		}
+		if message.OtherDB {
+			return 0, false
+		}
+		io.WriteString(stdout, message.Stdout)
+		io.WriteString(stderr, message.Stderr)
+		if message.Exit != nil {
+			return *message.Exit, true
+		}
+	}
+}
+
+// Whether a command reads its input from stdin, which has to be sent along
+// to the running wisa
+func readsStdin(args []string) bool {
+	return args[0] == "apply" && args[len(args)-1] == "-"
+}
+
+// Makes the file arguments of a command absolute, since the running wisa
+// has its own working directory
+func absoluteFileArgs(args []string) []string {
+	args = append([]string(nil), args...)
+	absolute := func(i int) {
+		if i < len(args) && args[i] != "" {
+			if path, err := filepath.Abs(args[i]); err == nil {
+				args[i] = path
+			}
+		}
+	}
+
+	switch args[0] {
+	case "provision", "backup", "restore-backup", "layout-key":
+		absolute(1)
+	case "import":
+		if last := len(args) - 1; last > 0 && !isImportURL(args[last]) {
+			absolute(last)
+		}
+	case "sign":
+		absolute(1)
+		absolute(2)
+	case "apply":
+		if last := len(args) - 1; last > 0 && args[last] != "-" {
+			absolute(last)
+		}
+	case "export":
+		for i := 1; i < len(args); i++ {
+			switch {
+			case args[i] == "-o" || args[i] == "--o":
+				absolute(i + 1)
+			case strings.HasPrefix(args[i], "-o=") || strings.HasPrefix(args[i], "--o="):
+				flag, value, _ := strings.Cut(args[i], "=")
+				if path, err := filepath.Abs(value); err == nil {
+					args[i] = flag + "=" + path
+				}
+			}
+		}
+	}
+	return args
+}
+
+// Whether two paths are the same file, comparing the paths when either
+// doesn't exist yet
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(infoA, infoB)
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
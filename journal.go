@@ -0,0 +1,182 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+)
+
+// How many finished restores are kept in the journal unless retain_journal
+// says otherwise
+const maxJournalEntries = 20
+
+// errNothingToUndo is returned when no restore has been journaled
+var errNothingToUndo = errors.New("there is no restore to undo")
+
+// restoreJournal records what a restore is about to do before it moves
+// anything, so a restore that was cut short can be finished or undone the
+// next time wisa starts
+type restoreJournal struct {
+	ID          int64
+	ProfileName string
+	Started     time.Time
+	// Targets are the states being restored
+	Targets []WindowState
+	// Before holds the whole layout from before the restore
+	Before []WindowState
+}
+
+// Records a restore that is about to start and returns its journal ID
+func beginJournal(db *sql.DB, profileName string, targets, before []WindowState) (int64, error) {
+	targetData, err := json.Marshal(targets)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding journal: %v", err)
+	}
+	beforeData, err := json.Marshal(before)
+	if err != nil {
+		return 0, fmt.Errorf("error encoding journal: %v", err)
+	}
+
+	result, err := db.Exec("INSERT INTO restore_journal (profile_name, started_at, targets, before) VALUES (?, ?, ?, ?)",
+		profileName, time.Now(), string(targetData), string(beforeData))
+	if err != nil {
+		return 0, fmt.Errorf("error writing journal: %v", err)
+	}
+	return result.LastInsertId()
+}
+
+// Marks a journaled restore as done and drops the oldest finished ones
+func finishJournal(db *sql.DB, id int64) error {
+	_, err := db.Exec("UPDATE restore_journal SET finished_at = ? WHERE id = ?", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("error updating journal: %v", err)
+	}
+
+	return pruneJournal(db)
+}
+
+// Gets the restores that started but never finished, newest first
+func getUnfinishedJournals(db *sql.DB) ([]restoreJournal, error) {
+	return queryJournals(db, "WHERE finished_at IS NULL ORDER BY id DESC")
+}
+
+// Gets the most recent restore, or nil if there hasn't been one
+func getLastJournal(db *sql.DB) (*restoreJournal, error) {
+	journals, err := queryJournals(db, "ORDER BY id DESC LIMIT 1")
+	if err != nil || len(journals) == 0 {
+		return nil, err
+	}
+	return &journals[0], nil
+}
+
+func queryJournals(db *sql.DB, clause string) ([]restoreJournal, error) {
+	rows, err := db.Query("SELECT id, profile_name, started_at, targets, before FROM restore_journal " + clause)
+	if err != nil {
+		return nil, fmt.Errorf("error querying journal: %v", err)
+	}
+	defer rows.Close()
+
+	var journals []restoreJournal
+	for rows.Next() {
+		var journal restoreJournal
+		var targets, before string
+		if err := rows.Scan(&journal.ID, &journal.ProfileName, &journal.Started, &targets, &before); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if err := json.Unmarshal([]byte(targets), &journal.Targets); err != nil {
+			return nil, fmt.Errorf("error reading journal: %v", err)
+		}
+		if err := json.Unmarshal([]byte(before), &journal.Before); err != nil {
+			return nil, fmt.Errorf("error reading journal: %v", err)
+		}
+		journals = append(journals, journal)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return journals, nil
+}
+
+// Finishes an interrupted restore by moving the windows to its targets
+func (e *restoreEngine) ResumeJournal(journal restoreJournal) error {
+	return e.replayJournal(journal, journal.Targets)
+}
+
+// Undoes an interrupted restore by moving the windows back to where they
+// were before it started
+func (e *restoreEngine) RollBackJournal(journal restoreJournal) error {
+	return e.replayJournal(journal, journal.Before)
+}
+
+// Puts the windows back where they were before the most recent restore and
+// returns the name of the profile it restored. Each restore can be undone
+// once.
+func (e *restoreEngine) UndoLastRestore() (string, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	journal, err := getLastJournal(e.db)
+	if err != nil {
+		return "", err
+	}
+	if journal == nil {
+		return "", errNothingToUndo
+	}
+
+	err = restoreStates(e.backend, journal.Before)
+	if _, deleteErr := e.db.Exec("DELETE FROM restore_journal WHERE id = ?", journal.ID); deleteErr != nil {
+		log.Printf("Error updating journal: %v", deleteErr)
+	}
+	logActivity(e.db, activityUndo, journal.ProfileName, "", fmt.Sprintf("%d windows put back", len(journal.Before)), err)
+	return journal.ProfileName, err
+}
+
+func (e *restoreEngine) replayJournal(journal restoreJournal, states []WindowState) error {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	err := restoreStates(e.backend, states)
+	if finishErr := finishJournal(e.db, journal.ID); finishErr != nil {
+		log.Printf("Error updating journal: %v", finishErr)
+	}
+	return err
+}
+
+// Asks what to do about each restore that was cut short last time
+func showInterruptedRestores(engine *restoreEngine, parent fyne.Window, status func(string)) {
+	journals, err := getUnfinishedJournals(engine.db)
+	if err != nil {
+		log.Printf("Error reading journal: %v", err)
+		return
+	}
+
+	for _, journal := range journals {
+		journal := journal
+		message := fmt.Sprintf("Restoring '%s' was interrupted at %s.\nFinish moving the windows, or put them back where they were?",
+			journal.ProfileName, journal.Started.Format("2006-01-02 15:04"))
+		confirm := dialog.NewConfirm("Interrupted Restore", message, func(resume bool) {
+			var err error
+			if resume {
+				err = engine.ResumeJournal(journal)
+			} else {
+				err = engine.RollBackJournal(journal)
+			}
+			if err != nil {
+				status(fmt.Sprintf("Error recovering restore of '%s': %v", journal.ProfileName, err))
+				return
+			}
+			status(fmt.Sprintf("Recovered interrupted restore of '%s'", journal.ProfileName))
+		}, parent)
+		confirm.SetConfirmText("Finish")
+		confirm.SetDismissText("Roll Back")
+		confirm.Show()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// AppLauncher is implemented by backends that can start apps which are in a
+// profile but not running
+type AppLauncher interface {
+	RunningApps() (map[string]bool, error)
+	LaunchApp(appName string) error
+}
+
+// How long to wait for a launched app to open its windows
+const launchTimeout = 15 * time.Second
+
+// Gets whether restoring a profile should launch the apps that aren't running
+func getLaunchMissing(db *sql.DB, profileName string) (bool, error) {
+	var launch bool
+	err := db.QueryRow("SELECT launch_missing FROM profiles WHERE name = ?", profileName).Scan(&launch)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading profile: %v", err)
+	}
+	return launch, nil
+}
+
+func setLaunchMissing(db *sql.DB, profileName string, launch bool) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET launch_missing = ? WHERE name = ?", launch, profileName)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+	return nil
+}
+
+// Gets the apps of the states that aren't running, each once
+func missingApps(launcher AppLauncher, states []WindowState) ([]string, error) {
+	running, err := launcher.RunningApps()
+	if err != nil {
+		return nil, fmt.Errorf("error listing running apps: %v", err)
+	}
+
+	var missing []string
+	seen := make(map[string]bool)
+	for _, state := range states {
+		if running[state.AppName] || seen[state.AppName] {
+			continue
+		}
+		seen[state.AppName] = true
+		missing = append(missing, state.AppName)
+	}
+	return missing, nil
+}
+
+// Launches the apps of the states that aren't running and waits until they
+// have opened a window or the timeout passes. Returns how many it launched.
+func launchMissingApps(ctx context.Context, backend WindowBackend, states []WindowState, timeout time.Duration) int {
+	launcher, ok := backend.(AppLauncher)
+	if !ok {
+		return 0
+	}
+
+	missing, err := missingApps(launcher, states)
+	if err != nil {
+		log.Printf("Error launching missing apps: %v", err)
+		return 0
+	}
+
+	waiting := make(map[string]bool)
+	for _, appName := range missing {
+		if err := launcher.LaunchApp(appName); err != nil {
+			log.Printf("Error launching %s: %v", appName, err)
+			continue
+		}
+		waiting[appName] = true
+	}
+	launched := len(waiting)
+
+	if len(waiting) > 0 {
+		defer liveWindows.Refresh()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for len(waiting) > 0 && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(500 * time.Millisecond)
+		for _, state := range backend.Capture() {
+			delete(waiting, state.AppName)
+		}
+	}
+	for appName := range waiting {
+		log.Printf("Timed out waiting for %s to open a window", appName)
+	}
+	return launched
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Reads a layout that isn't saved in a profile, in JSON or YAML: either a
+// list of window states such as `wisa capture -json` prints, or an object
+// with them under "windows" like a layout in an export
+func readLayout(r io.Reader) ([]WindowState, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading layout: %v", err)
+	}
+
+	// YAML is converted to JSON first, like provisioning files
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing layout: %v", err)
+	}
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error converting layout: %v", err)
+	}
+
+	var states []WindowState
+	if _, ok := raw.([]interface{}); ok {
+		err = json.Unmarshal(converted, &states)
+	} else {
+		var layout struct {
+			Windows []WindowState `json:"windows"`
+		}
+		err = json.Unmarshal(converted, &layout)
+		states = layout.Windows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading layout: %v", err)
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("the layout has no windows")
+	}
+	for _, state := range states {
+		if state.AppName == "" {
+			return nil, fmt.Errorf("the layout has a window without an app_name")
+		}
+		if state.Width <= 0 || state.Height <= 0 {
+			return nil, fmt.Errorf("the layout's %s window needs a width and height", state.AppName)
+		}
+	}
+	return states, nil
+}
+
+// Restores a layout that isn't saved in a profile. Only the windows are
+// moved, and the restore is journaled and logged under name so it can be
+// undone like any other.
+func (e *restoreEngine) ApplyLayout(name string, states []WindowState, opts restoreOptions) (int, error) {
+	results, err := e.applyLayout(name, states, opts)
+	logRestoreActivity(e.db, name, opts, len(states), results, nil, err)
+	return len(states), err
+}
+
+func (e *restoreEngine) applyLayout(name string, states []WindowState, opts restoreOptions) ([]restoreResult, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+
+	if opts.Preview {
+		if highlighter, ok := e.backend.(Highlighter); ok {
+			if err := highlighter.Highlight(states, time.Second); err != nil {
+				log.Printf("Error previewing window states: %v", err)
+			}
+		}
+	}
+
+	if getBoolSetting(e.db, settingRestoreDND, false) {
+		defer quietNotifications(e.db, "")()
+	}
+
+	journalID, journalErr := beginJournal(e.db, name, states, captureStates(e.backend))
+	if journalErr != nil {
+		log.Printf("Error writing journal: %v", journalErr)
+	}
+
+	results, err := restoreStatesWithResults(context.Background(), e.backend, states)
+	if journalID != 0 {
+		if journalErr := finishJournal(e.db, journalID); journalErr != nil {
+			log.Printf("Error updating journal: %v", journalErr)
+		}
+	}
+	return results, err
+}
@@ -2,73 +2,136 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // WindowState represents the position and size of a window
 type WindowState struct {
-	AppName     string
-	WindowTitle string
-	X           float64
-	Y           float64
-	Width       float64
-	Height      float64
+	// ID is the database row of a saved state, zero for live captures
+	ID int64 `json:"-"`
+	// UID identifies the window across captures, see assignUIDs
+	UID         string `json:"uid,omitempty"`
+	AppName     string `json:"app_name"`
+	WindowTitle string `json:"window_title"`
+	// BundleID identifies the app on macOS, where process names can be
+	// localized or shared with helpers. Empty elsewhere.
+	BundleID string  `json:"bundle_id,omitempty"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	// Display the window was on when captured and that display's origin
+	// at the time, so the window can follow the display if it moved
+	DisplayID string  `json:"display_id,omitempty"`
+	DisplayX  float64 `json:"display_x,omitempty"`
+	DisplayY  float64 `json:"display_y,omitempty"`
+	// The display's size at the time, for profiles that scale with their
+	// display, see scaleToDisplays
+	DisplayWidth  float64 `json:"display_width,omitempty"`
+	DisplayHeight float64 `json:"display_height,omitempty"`
+	// Role is freeform purpose metadata such as "editor" or "reference"
+	Role string `json:"role,omitempty"`
+	// Minimized windows are moved into place and then minimized again
+	Minimized bool `json:"minimized,omitempty"`
+	// FullScreen windows are moved onto their display and made fullscreen
+	FullScreen bool `json:"fullscreen,omitempty"`
+	// ZOrder is the window's place in the stacking order, 0 being frontmost
+	ZOrder int `json:"z_order,omitempty"`
+	// Space is the 1-based Space or virtual desktop the window is on, 0 when
+	// it isn't known
+	Space int `json:"space,omitempty"`
+	// TitleMatch is how the title is matched on restore, see matching.go
+	TitleMatch string `json:"title_match,omitempty"`
+	// TitlePattern is used by the loose matching strategies instead of the
+	// saved title when set
+	TitlePattern string `json:"title_pattern,omitempty"`
+	// AppIndex is the window's position among its app's windows
+	AppIndex int `json:"app_index,omitempty"`
 }
 
 // Database operations
+
+// Set when the user opens another database after the usual one failed to
+// open, used until wisa quits
+var dbPathOverride string
+
+// Where the database is, see dbpath.go
 func getDBPath() string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalf("Error getting home directory: %v", err)
+	switch {
+	case dbPathOverride != "":
+		return dbPathOverride
+	case dbPathFlag != "":
+		return dbPathFlag
+	case os.Getenv(dbPathEnv) != "":
+		return os.Getenv(dbPathEnv)
+	}
+	if path := configuredDBPath(); path != "" {
+		return path
 	}
-	return filepath.Join(homeDir, "wisa.db")
+	return defaultDBPath()
 }
 
-func initDB() *sql.DB {
+// What was repaired in the database when it was opened, shown once the
+// window is up
+var startupRepairs []string
+
+// Opens the database and brings it up to date. Errors are returned so the
+// window can offer a way out instead of exiting.
+func initDB() (*sql.DB, error) {
+	moveLegacyDB()
 	dbPath := getDBPath()
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatalf("Error opening database: %v", err)
-	}
-
-	// Create tables if they don't exist yet
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS profiles (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE
-	);
-	CREATE TABLE IF NOT EXISTS window_states (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		profile_id INTEGER NOT NULL,
-		app_name TEXT NOT NULL,
-		window_title TEXT NOT NULL,
-		x REAL NOT NULL,
-		y REAL NOT NULL,
-		width REAL NOT NULL,
-		height REAL NOT NULL,
-		FOREIGN KEY (profile_id) REFERENCES profiles(id)
-	);
-	`
-	_, err = db.Exec(createTableSQL)
-	if err != nil {
-		log.Fatalf("Error creating tables: %v", err)
-	}
-
-	return db
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating database folder: %v", err)
+	}
+	// Other wisa processes wait for each other's writes instead of failing,
+	// and transactions take the write lock as soon as they begin
+	db, err := sql.Open("sqlite3", dbPath+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %v", err)
+	}
+
+	// A damaged file often opens fine and fails later, find out now
+	if err := checkIntegrity(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateDB(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error updating database: %v", err)
+	}
+	repairs, err := repairDatabase(db)
+	if err != nil {
+		log.Printf("Error repairing database: %v", err)
+	}
+	startupRepairs = append(startupRepairs, repairs...)
+	if err := purgeExpiredProfiles(db); err != nil {
+		log.Printf("Error emptying the trash: %v", err)
+	}
+
+	// Load the per-app restore workarounds
+	if err := loadAppQuirks(db); err != nil {
+		log.Printf("Error loading app quirks: %v", err)
+	}
+	loadSettings(db)
+
+	return db, nil
 }
 
 // Profile structure to hold both id and name
@@ -77,16 +140,61 @@ type Profile struct {
 	Name string
 }
 
-func saveWindowStates(db *sql.DB, profileName string, states []WindowState) error {
+// Returned instead of saving a profile with no windows, which is almost
+// always a capture that failed rather than a layout anyone wants
+var errNothingToSave = errors.New("no windows were captured, nothing was saved")
+
+// Saves the window states of a profile for one display arrangement, leaving
+// the layout variants for other arrangements alone
+func saveWindowStates(db *sql.DB, profileName, arrangement string, states []WindowState) error {
+	return saveWindowStatesAt(db, profileName, arrangement, states, anyRevision)
+}
+
+// Saves like saveWindowStates, but only if the profile is still at revision,
+// failing with a staleRevisionError if it was changed since
+func saveWindowStatesAt(db *sql.DB, profileName, arrangement string, states []WindowState, revision int) error {
+	if len(states) == 0 {
+		logActivity(db, activitySave, profileName, "", "0 windows", errNothingToSave)
+		return errNothingToSave
+	}
+	err := queueWrite(func() error {
+		return saveWindowStatesLocked(db, profileName, arrangement, states, revision)
+	})
+	logActivity(db, activitySave, profileName, "", fmt.Sprintf("%d windows", len(states)), err)
+	return err
+}
+
+func saveWindowStatesLocked(db *sql.DB, profileName, arrangement string, states []WindowState, revision int) error {
+	profileName, err := cleanProfileName(profileName)
+	if err != nil {
+		return err
+	}
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	// Everything below happens in one transaction so a failure part way
+	// leaves the profile as it was
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	// Does nothing once committed
+	defer tx.Rollback()
+
+	if err := moveDeletedProfileAside(tx, profileName); err != nil {
+		return err
+	}
+
 	// First, ensure the profile exists
 	var profileID int
 
 	// Try to get existing profile ID
-	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	err = tx.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			// Profile doesn't exist, create it
-			result, err := db.Exec("INSERT INTO profiles (name) VALUES (?)", profileName)
+			result, err := tx.Exec("INSERT INTO profiles (name, owner) VALUES (?, ?)", profileName, currentUsername())
 			if err != nil {
 				return fmt.Errorf("error creating profile: %v", err)
 			}
@@ -102,41 +210,211 @@ func saveWindowStates(db *sql.DB, profileName string, states []WindowState) erro
 		}
 	}
 
-	// Delete any existing window states for this profile
-	_, err = db.Exec("DELETE FROM window_states WHERE profile_id = ?", profileID)
+	if err := bumpRevision(tx, profileName, profileID, revision); err != nil {
+		return err
+	}
+
+	// Keep the roles and title matching of windows that are being captured
+	// again
+	kept := make(map[windowKey]WindowState)
+	rows, err := tx.Query("SELECT app_name, window_title, role, title_match, title_pattern FROM window_states WHERE profile_id = ? AND (role != '' OR title_match != '')", profileID)
+	if err != nil {
+		return fmt.Errorf("error reading existing roles: %v", err)
+	}
+	for rows.Next() {
+		var state WindowState
+		if err := rows.Scan(&state.AppName, &state.WindowTitle, &state.Role, &state.TitleMatch, &state.TitlePattern); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		kept[keyOf(state)] = state
+	}
+	rows.Close()
+	for i := range states {
+		old, ok := kept[keyOf(states[i])]
+		if !ok {
+			continue
+		}
+		if states[i].Role == "" {
+			states[i].Role = old.Role
+		}
+		if states[i].TitleMatch == matchExact {
+			states[i].TitleMatch = old.TitleMatch
+			states[i].TitlePattern = old.TitlePattern
+		}
+	}
+
+	// Delete any existing window states for this profile and arrangement
+	_, err = tx.Exec("DELETE FROM window_states WHERE profile_id = ? AND arrangement = ?", profileID, arrangement)
 	if err != nil {
 		return fmt.Errorf("error clearing existing window states: %v", err)
 	}
 
 	// Insert the new window states
-	stmt, err := db.Prepare("INSERT INTO window_states (profile_id, app_name, window_title, x, y, width, height) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err := insertWindowStates(tx, profileID, arrangement, states); err != nil {
+		return err
+	}
+
+	// Keep this capture in the profile's history
+	if err := recordSnapshot(tx, profileID, arrangement, states); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Appends window states to the layout variant of an existing profile without
+// touching its other states
+func addWindowStates(db *sql.DB, profileName, arrangement string, states []WindowState) error {
+	return queueWrite(func() error {
+		return addWindowStatesLocked(db, profileName, arrangement, states)
+	})
+}
+
+func addWindowStatesLocked(db *sql.DB, profileName, arrangement string, states []WindowState) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	var profileID int
+	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
 	if err != nil {
-		return fmt.Errorf("error preparing statement: %v", err)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
 	}
-	defer stmt.Close()
 
-	for _, state := range states {
-		_, err = stmt.Exec(
-			profileID,
-			state.AppName,
-			state.WindowTitle,
-			state.X,
-			state.Y,
-			state.Width,
-			state.Height,
-		)
+	// A profile shown from another arrangement's variant gets its own copy of
+	// it first, so the added windows join the ones that were shown
+	variant, err := resolveVariant(db, profileID, arrangement)
+	if err != nil {
+		return err
+	}
+	if variant != arrangement {
+		shown, err := loadWindowStates(db, profileName, arrangement)
 		if err != nil {
-			return fmt.Errorf("error inserting window state: %v", err)
+			return err
+		}
+		states = append(shown, states...)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := bumpRevision(tx, profileName, profileID, anyRevision); err != nil {
+		return err
+	}
+	if err := insertWindowStates(tx, profileID, arrangement, states); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Columns written for each window state, in the order insertWindowStates
+// passes them
+var windowStateColumns = []string{
+	"profile_id", "app_name", "window_title", "x", "y", "width", "height", "display_id", "display_x", "display_y",
+	"role", "arrangement", "minimized", "fullscreen", "z_order", "space", "title_match", "title_pattern",
+	"app_index", "bundle_id", "uid", "display_width", "display_height",
+}
+
+// The fewest variables a statement may have in any SQLite build, inserts
+// are batched to stay under it
+const maxSQLVariables = 999
+
+// Inserts window states for a profile's layout variant in batches of
+// multi-row statements
+func insertWindowStates(tx *sql.Tx, profileID int, arrangement string, states []WindowState) error {
+	batchSize := maxSQLVariables / len(windowStateColumns)
+	row := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(windowStateColumns)), ", ") + ")"
+
+	// Full batches share one statement, the rest gets its own
+	var stmt *sql.Stmt
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+	prepared := 0
+
+	for len(states) > 0 {
+		batch := states
+		if len(batch) > batchSize {
+			batch = batch[:batchSize]
+		}
+		states = states[len(batch):]
+
+		if prepared != len(batch) {
+			if stmt != nil {
+				stmt.Close()
+			}
+			var err error
+			stmt, err = tx.Prepare("INSERT INTO window_states (" + strings.Join(windowStateColumns, ", ") + ") VALUES " +
+				strings.TrimSuffix(strings.Repeat(row+", ", len(batch)), ", "))
+			if err != nil {
+				stmt = nil
+				return fmt.Errorf("error preparing statement: %v", err)
+			}
+			prepared = len(batch)
+		}
+
+		args := make([]interface{}, 0, len(batch)*len(windowStateColumns))
+		for _, state := range batch {
+			args = append(args,
+				profileID,
+				state.AppName,
+				state.WindowTitle,
+				state.X,
+				state.Y,
+				state.Width,
+				state.Height,
+				state.DisplayID,
+				state.DisplayX,
+				state.DisplayY,
+				state.Role,
+				arrangement,
+				state.Minimized,
+				state.FullScreen,
+				state.ZOrder,
+				state.Space,
+				state.TitleMatch,
+				state.TitlePattern,
+				state.AppIndex,
+				state.BundleID,
+				state.UID,
+				state.DisplayWidth,
+				state.DisplayHeight,
+			)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return fmt.Errorf("error inserting window states: %v", err)
 		}
 	}
 
 	return nil
 }
 
-func loadWindowStates(db *sql.DB, profileName string) ([]WindowState, error) {
+// Loads the layout variant of a profile that best fits a display arrangement:
+// the exact match, then the variant saved before arrangements were tracked,
+// then the most recently saved one. Profiles in Recently Deleted and other
+// users' private ones aren't found.
+func loadWindowStates(db *sql.DB, profileName, arrangement string) ([]WindowState, error) {
 	// First get the profile ID
 	var profileID int
-	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	err := db.QueryRow(
+		"SELECT id FROM profiles WHERE name = ? AND deleted_at IS NULL AND (owner = '' OR owner = ? OR shared = 1)",
+		profileName, currentUsername(),
+	).Scan(&profileID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("profile %s not found", profileName)
@@ -144,9 +422,14 @@ func loadWindowStates(db *sql.DB, profileName string) ([]WindowState, error) {
 		return nil, fmt.Errorf("error finding profile: %v", err)
 	}
 
+	variant, err := resolveVariant(db, profileID, arrangement)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := db.Query(
-		"SELECT app_name, window_title, x, y, width, height FROM window_states WHERE profile_id = ?",
-		profileID,
+		"SELECT id, app_name, window_title, x, y, width, height, display_id, display_x, display_y, role, minimized, fullscreen, z_order, space, title_match, title_pattern, app_index, bundle_id, uid, display_width, display_height FROM window_states WHERE profile_id = ? AND arrangement = ? ORDER BY id",
+		profileID, variant,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error querying window states: %v", err)
@@ -157,12 +440,28 @@ func loadWindowStates(db *sql.DB, profileName string) ([]WindowState, error) {
 	for rows.Next() {
 		var state WindowState
 		err := rows.Scan(
+			&state.ID,
 			&state.AppName,
 			&state.WindowTitle,
 			&state.X,
 			&state.Y,
 			&state.Width,
 			&state.Height,
+			&state.DisplayID,
+			&state.DisplayX,
+			&state.DisplayY,
+			&state.Role,
+			&state.Minimized,
+			&state.FullScreen,
+			&state.ZOrder,
+			&state.Space,
+			&state.TitleMatch,
+			&state.TitlePattern,
+			&state.AppIndex,
+			&state.BundleID,
+			&state.UID,
+			&state.DisplayWidth,
+			&state.DisplayHeight,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning row: %v", err)
@@ -174,11 +473,203 @@ func loadWindowStates(db *sql.DB, profileName string) ([]WindowState, error) {
 		return nil, fmt.Errorf("error iterating rows: %v", err)
 	}
 
+	// States saved before IDs were tracked get them on the fly
+	assignUIDs(states)
+
 	return states, nil
 }
 
+// Picks which stored layout variant of a profile to use for an arrangement
+func resolveVariant(db *sql.DB, profileID int, arrangement string) (string, error) {
+	var variant string
+	err := db.QueryRow(`
+		SELECT arrangement FROM window_states WHERE profile_id = ?
+		GROUP BY arrangement
+		ORDER BY arrangement = ? DESC, arrangement = '' DESC, MAX(id) DESC
+		LIMIT 1`,
+		profileID, arrangement,
+	).Scan(&variant)
+	if err == sql.ErrNoRows {
+		return arrangement, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error finding layout variant: %v", err)
+	}
+	return variant, nil
+}
+
+// Gets the display arrangements a profile has layout variants for
+func getProfileVariants(db *sql.DB, profileName string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ws.arrangement FROM window_states ws
+		JOIN profiles p ON p.id = ws.profile_id
+		WHERE p.name = ? AND p.deleted_at IS NULL AND (p.owner = '' OR p.owner = ? OR p.shared = 1)
+		ORDER BY ws.arrangement`,
+		profileName, currentUsername(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying layout variants: %v", err)
+	}
+	defer rows.Close()
+
+	var variants []string
+	for rows.Next() {
+		var variant string
+		if err := rows.Scan(&variant); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		variants = append(variants, variant)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return variants, nil
+}
+
+// Sets the role metadata of a saved window state
+func setWindowRole(db *sql.DB, profileName string, stateID int64, role string) error {
+	return queueWrite(func() error {
+		return setWindowRoleLocked(db, profileName, stateID, role)
+	})
+}
+
+func setWindowRoleLocked(db *sql.DB, profileName string, stateID int64, role string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	var profileID int
+	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := bumpRevision(tx, profileName, profileID, anyRevision); err != nil {
+		return err
+	}
+	result, err := tx.Exec("UPDATE window_states SET role = ? WHERE id = ? AND profile_id = ?", role, stateID, profileID)
+	if err != nil {
+		return fmt.Errorf("error updating window role: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("window state %d not found in profile %s", stateID, profileName)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Changes the position and size of a saved window state
+func updateWindowState(db *sql.DB, profileName string, state WindowState) error {
+	return queueWrite(func() error {
+		return updateWindowStateLocked(db, profileName, state)
+	})
+}
+
+func updateWindowStateLocked(db *sql.DB, profileName string, state WindowState) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	var profileID int
+	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := bumpRevision(tx, profileName, profileID, anyRevision); err != nil {
+		return err
+	}
+	result, err := tx.Exec(
+		"UPDATE window_states SET x = ?, y = ?, width = ?, height = ? WHERE id = ? AND profile_id = ?",
+		state.X, state.Y, state.Width, state.Height, state.ID, profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating window state: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("window state %d not found in profile %s", state.ID, profileName)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Deletes single window states from a profile, leaving the rest of it as
+// it is
+func removeWindowStates(db *sql.DB, profileName string, ids []int64) error {
+	return queueWrite(func() error {
+		return removeWindowStatesLocked(db, profileName, ids)
+	})
+}
+
+func removeWindowStatesLocked(db *sql.DB, profileName string, ids []int64) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	var profileID int
+	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := bumpRevision(tx, profileName, profileID, anyRevision); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		result, err := tx.Exec("DELETE FROM window_states WHERE id = ? AND profile_id = ?", id, profileID)
+		if err != nil {
+			return fmt.Errorf("error removing window state: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("window state %d not found in profile %s", id, profileName)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Gets the profiles the current user can see: their own, shared ones and
+// ones without an owner
 func getProfiles(db *sql.DB) ([]string, error) {
-	rows, err := db.Query("SELECT name FROM profiles ORDER BY name")
+	rows, err := db.Query(
+		"SELECT name FROM profiles WHERE deleted_at IS NULL AND archived_at IS NULL AND (owner = '' OR owner = ? OR shared = 1) ORDER BY name",
+		currentUsername(),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("error querying profiles: %v", err)
 	}
@@ -201,7 +692,20 @@ func getProfiles(db *sql.DB) ([]string, error) {
 	return profiles, nil
 }
 
-func deleteProfile(db *sql.DB, profileName string) error {
+// Deletes a profile and everything that belongs to it for good
+func purgeProfile(db *sql.DB, profileName string) error {
+	return queueWrite(func() error {
+		return purgeProfileLocked(db, profileName)
+	})
+}
+
+func purgeProfileLocked(db *sql.DB, profileName string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	autoBackup(db, "purge")
+
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %v", err)
@@ -224,6 +728,42 @@ func deleteProfile(db *sql.DB, profileName string) error {
 		return fmt.Errorf("error deleting window states: %v", err)
 	}
 
+	_, err = tx.Exec("DELETE FROM profile_actions WHERE profile_id = ?", profileID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting profile actions: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM profile_hooks WHERE profile_id = ?", profileID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting profile hooks: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM triggers WHERE profile_id = ?", profileID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting triggers: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM window_excludes WHERE profile_id = ?", profileID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting window excludes: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM profile_snapshots WHERE profile_id = ?", profileID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting snapshots: %v", err)
+	}
+
+	_, err = tx.Exec("DELETE FROM profile_usage WHERE profile_name = ?", profileName)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting profile usage: %v", err)
+	}
+
 	_, err = tx.Exec("DELETE FROM profiles WHERE id = ?", profileID)
 	if err != nil {
 		tx.Rollback()
@@ -238,159 +778,152 @@ func deleteProfile(db *sql.DB, profileName string) error {
 	return nil
 }
 
-// Gets the current window states from macOS using AppleScript
-func getCurrentWindowStates() []WindowState {
-	// Initialize an empty slice to store window states
-	var states []WindowState
-
-	// AppleScript to get information about all visible windows
-	script := `
-tell application "System Events"
-	set appList to application processes whose visible is true
-	set windowData to ""
-	
-	repeat with appProcess in appList
-		set appName to name of appProcess as string
-		set windowList to windows of appProcess
-		
-		repeat with theWindow in windowList
-			set winTitle to ""
-			try
-				set winTitle to name of theWindow as string
-			end try
-			
-			set winPos to position of theWindow
-			set winSize to size of theWindow
-			
-			set windowData to windowData & appName & "," & winTitle & "," & (item 1 of winPos as string) & "," & (item 2 of winPos as string) & "," & (item 1 of winSize as string) & "," & (item 2 of winSize as string) & "\n"
-		end repeat
-	end repeat
-	
-	return windowData
-end tell
-`
-
-	// Execute the AppleScript
-	cmd := exec.Command("osascript", "-e", script)
-	output, err := cmd.Output()
-	if err != nil {
-		log.Printf("Error getting window states: %v", err)
-		return states
-	}
-
-	// Parse the output
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if line == "" {
-			continue
+func main() {
+	// Windows and Linux open wisa:// links by passing them as the argument,
+	// which runCLI handles
+	args := os.Args[1:]
+
+	// -db picks another database for this run
+	if len(args) >= 2 && (args[0] == "-db" || args[0] == "--db") {
+		dbPathFlag, args = args[1], args[2:]
+		if abs, err := filepath.Abs(dbPathFlag); err == nil {
+			dbPathFlag = abs
 		}
+	}
 
-		parts := strings.Split(line, ",")
-		if len(parts) < 6 {
-			continue
+	// Subcommands run in the window or daemon if one is open, so only one
+	// process has the database open. One run on another database with -db
+	// runs here, as does one whose WISA_DB_PATH isn't the database the
+	// window has open, which it refuses.
+	if len(args) > 0 && dbPathFlag == "" {
+		if code, ok := forwardCLI(args, os.Stdin, os.Stdout, os.Stderr); ok {
+			os.Exit(code)
 		}
+	}
 
-		// Parse position and size
-		x, _ := strconv.ParseFloat(parts[2], 64)
-		y, _ := strconv.ParseFloat(parts[3], 64)
-		width, _ := strconv.ParseFloat(parts[4], 64)
-		height, _ := strconv.ParseFloat(parts[5], 64)
-
-		states = append(states, WindowState{
-			AppName:     parts[0],
-			WindowTitle: parts[1],
-			X:           x,
-			Y:           y,
-			Width:       width,
-			Height:      height,
-		})
+	// capture only reads the open windows and the capture filter, so it
+	// leaves the database as it is
+	if len(args) > 0 && args[0] == "capture" {
+		loadCaptureFilterReadOnly()
+		os.Exit(runCapture(args[1:], os.Stdout, os.Stderr))
 	}
 
-	return states
-}
+	// Initialize the database
+	db, err := initDB()
 
-// Restores window states using AppleScript
-func restoreWindowStates(states []WindowState) {
-	for _, state := range states {
-		// AppleScript to restore window position and size
-		script := fmt.Sprintf(`
-tell application "System Events"
-	set appList to application processes whose name is "%s"
-	if (count of appList) > 0 then
-		set appProcess to item 1 of appList
-		set windowList to windows of appProcess whose name is "%s"
-		if (count of windowList) > 0 then
-			set theWindow to item 1 of windowList
-			set position of theWindow to {%d, %d}
-			set size of theWindow to {%d, %d}
-		end if
-	end if
-end tell
-`, state.AppName, state.WindowTitle, int(state.X), int(state.Y), int(state.Width), int(state.Height))
-
-		// Execute the AppleScript
-		cmd := exec.Command("osascript", "-e", script)
-		err := cmd.Run()
+	// Subcommands run without opening the window
+	if len(args) > 0 {
 		if err != nil {
-			log.Printf("Error restoring window state for %s - %s: %v", state.AppName, state.WindowTitle, err)
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
 		}
+		code := runCLI(db, nil, args, os.Stdin, os.Stdout, os.Stderr)
+		db.Close()
+		os.Exit(code)
 	}
-}
-
-func main() {
-	// Initialize the database
-	db := initDB()
-	defer db.Close()
 
 	// Initialize the Fyne app
 	myApp := app.New()
+	if err != nil {
+		// The window opens once a database does
+		log.Printf("Error opening database: %v", err)
+		showDatabaseError(myApp, err, func(opened *sql.DB) {
+			db = opened
+			showMainWindow(myApp, db)
+		})
+	} else {
+		showMainWindow(myApp, db)
+	}
+	myApp.Run()
+	if db != nil {
+		db.Close()
+	}
+}
+
+// Opens the main window on an open database
+func showMainWindow(myApp fyne.App, db *sql.DB) {
+	// Pick the window backend for this platform
+	backend := newBackend()
+
+	// Shared by the restore button and the automatic triggers
+	engine := newRestoreEngine(db, backend)
+	startWindowIndex(backend, windowIndexInterval)
+	startIPCServer(engine)
+
 	myWindow := myApp.NewWindow("Wisa - Window State Manager")
 	myWindow.Resize(fyne.NewSize(600, 500))
+	// Shared by tray mode and the permission indicator
+	tray := newTrayMenu(myApp, myWindow, db)
 
-	// Create profile selection dropdown with option to create new profiles
+	// Create profile selection dropdown, new profiles are made with the
+	// New Profile button
 	profiles, err := getProfiles(db)
 	if err != nil {
 		log.Printf("Error getting profiles: %v", err)
 		profiles = []string{}
 	}
 
-	// Add "Create New Profile..." option
-	profileOptions := append([]string{"Create New Profile..."}, profiles...)
-
+	// Empty while no profile is selected
 	var selectedProfile string
-	profileSelect := widget.NewSelect(profileOptions, nil)
-	profileSelect.SetSelected("Create New Profile...")
-
-	// Track if we're in "create new" mode
-	var isCreatingNew bool = true
-
-	// Create input field for new profile name with fixed width
-	profileNameEntry := widget.NewEntry()
-	profileNameEntry.SetPlaceHolder("New Profile Name")
+	// Revision of the selected profile when it was opened, saves fail if
+	// it changed since
+	var selectedRevision int
+	profileSelect := widget.NewSelect(profiles, nil)
+	profileSelect.PlaceHolder = "Select a profile"
 
 	// Status label
 	statusLabel := widget.NewLabel("")
 
+	// Runs slow work off the event loop with a spinner next to the status
+	startUIUpdates()
+	busy := newBusyIndicator(statusLabel)
+	engine.SetProgress(busy.Progress)
+
+	// Stops a restore that's taking too long, shown while one runs
+	var cancelRestoreButton *widget.Button
+	cancelRestoreButton = widget.NewButton("Cancel", func() {
+		if engine.Cancel() {
+			cancelRestoreButton.Disable()
+			statusLabel.SetText("Cancelling restore...")
+		}
+	})
+	cancelRestoreButton.Hide()
+
 	// Window states display
-	statesTextArea := widget.NewMultiLineEntry()
-	statesTextArea.Disable()
-	statesTextArea.SetText("Select a profile to see saved window states")
-	statesTextArea.Wrapping = fyne.TextWrapWord
+	statesView := newStatesTable(db)
+	statesView.Displays = func() []Display {
+		lister, ok := backend.(DisplayLister)
+		if !ok {
+			return nil
+		}
+		displays, err := lister.Displays()
+		if err != nil {
+			log.Printf("Error listing displays: %v", err)
+		}
+		return displays
+	}
+	statesView.ShowMessage("Select a profile to see saved window states")
+
+	// Narrows the profile list down by part of a profile or app name
+	profileFilter := widget.NewEntry()
+	profileFilter.SetPlaceHolder("Filter by profile or app name")
 
 	// Function to refresh the profile list
 	refreshProfiles := func() {
-		newProfiles, err := getProfiles(db)
+		summaries, _, err := queryProfiles(db, profileQuery{Search: strings.TrimSpace(profileFilter.Text)})
 		if err != nil {
 			log.Printf("Error getting profiles: %v", err)
 			return
 		}
+		var newProfiles []string
+		for _, summary := range summaries {
+			newProfiles = append(newProfiles, summary.Name)
+		}
 
-		// Always add "Create New Profile..." option at the top
-		profileOptions := append([]string{"Create New Profile..."}, newProfiles...)
-		profileSelect.Options = profileOptions
+		profileSelect.Options = newProfiles
 
 		// Try to keep the previous selection if it exists
-		if selectedProfile != "" && selectedProfile != "Create New Profile..." {
+		if selectedProfile != "" {
 			// Check if the previously selected profile still exists
 			var found bool
 			for _, profile := range newProfiles {
@@ -402,204 +935,1244 @@ func main() {
 			}
 
 			if !found {
-				// Previously selected profile no longer exists
-				profileSelect.SetSelected("Create New Profile...")
-				isCreatingNew = true
-				profileNameEntry.Enable()
-				profileNameEntry.SetText("")
+				// Previously selected profile no longer exists or is
+				// filtered out
+				profileSelect.ClearSelected()
 			}
-		} else {
-			// Default to "Create New Profile..." if no selection or was already on create new
-			profileSelect.SetSelected("Create New Profile...")
-			isCreatingNew = true
-			profileNameEntry.Enable()
 		}
 
 		profileSelect.Refresh()
 	}
 
-	// Function to display window states
+	profileFilter.OnChanged = func(string) {
+		refreshProfiles()
+	}
+
+	// Function to display window states of the selected profile
 	displayWindowStates := func(states []WindowState) {
-		if len(states) == 0 {
-			statesTextArea.SetText("No window states found for this profile")
+		statesView.Show(selectedProfile, states)
+		// Keep showing how the profile's last restore went
+		statesView.ShowResults(engine.LastResults(selectedProfile))
+	}
+
+	// Per-profile toggle for opening apps that aren't running on restore
+	launchCheck := widget.NewCheck("Launch missing apps", func(checked bool) {
+		if selectedProfile == "" {
 			return
 		}
+		if err := setLaunchMissing(db, selectedProfile, checked); err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error saving profile setting: %v", err))
+		}
+	})
+	launchCheck.Disable()
 
-		text := fmt.Sprintf("Profile has %d window states:\n\n", len(states))
-		for i, state := range states {
-			text += fmt.Sprintf("%d. %s - %s\n   Position: (%.0f, %.0f) Size: %.0f x %.0f\n\n",
-				i+1, state.AppName, state.WindowTitle,
-				state.X, state.Y, state.Width, state.Height)
+	// Per-profile toggle for restoring windows as fractions of their display
+	scaleCheck := widget.NewCheck("Scale to display", func(checked bool) {
+		if selectedProfile == "" {
+			return
+		}
+		if err := setScaleToDisplay(db, selectedProfile, checked); err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error saving profile setting: %v", err))
+		}
+	})
+	scaleCheck.Disable()
+
+	// Per-profile toggle for letting other users of the database see it
+	sharedCheck := widget.NewCheck("Shared", func(checked bool) {
+		if selectedProfile == "" {
+			return
+		}
+		if err := setProfileShared(db, selectedProfile, checked); err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error saving profile setting: %v", err))
 		}
-		statesTextArea.SetText(text)
+	})
+	sharedCheck.Disable()
+
+	// Per-profile choice of what to do with apps that aren't in the profile
+	var otherAppsOptions []string
+	for _, option := range otherAppsLabels {
+		otherAppsOptions = append(otherAppsOptions, option.label)
 	}
+	otherAppsSelect := widget.NewSelect(otherAppsOptions, func(selected string) {
+		if selectedProfile == "" {
+			return
+		}
+		for _, option := range otherAppsLabels {
+			if option.label != selected {
+				continue
+			}
+			if err := setOtherAppsMode(db, selectedProfile, option.mode); err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error saving profile setting: %v", err))
+			}
+		}
+	})
+	otherAppsSelect.SetSelected(otherAppsLabels[0].label)
+	otherAppsSelect.Disable()
 
 	// Update the profile selection handler
 	profileSelect.OnChanged = func(selected string) {
+		selectedProfile = selected
+
 		if selected == "" {
-			statesTextArea.SetText("Select a profile to see saved window states")
+			selectedRevision = 0
+			launchCheck.SetChecked(false)
+			launchCheck.Disable()
+			scaleCheck.SetChecked(false)
+			scaleCheck.Disable()
+			sharedCheck.SetChecked(false)
+			sharedCheck.Disable()
+			otherAppsSelect.SetSelected(otherAppsLabels[0].label)
+			otherAppsSelect.Disable()
+			statesView.ShowMessage("Select a profile to see saved window states")
 			return
 		}
 
-		selectedProfile = selected
+		revision, err := getProfileRevision(db, selected)
+		if err != nil {
+			log.Printf("Error reading profile revision: %v", err)
+		}
+		selectedRevision = revision
 
-		if selected == "Create New Profile..." {
-			isCreatingNew = true
-			profileNameEntry.Enable()
-			profileNameEntry.SetText("")
-			statesTextArea.SetText("Enter a name for your new profile")
-			return
+		launch, err := getLaunchMissing(db, selected)
+		if err != nil {
+			log.Printf("Error reading profile settings: %v", err)
+		}
+		launchCheck.SetChecked(launch)
+		launchCheck.Enable()
+
+		scale, err := getScaleToDisplay(db, selected)
+		if err != nil {
+			log.Printf("Error reading profile settings: %v", err)
 		}
+		scaleCheck.SetChecked(scale)
+		scaleCheck.Enable()
 
-		// Not creating a new profile, so disable profile name entry
-		isCreatingNew = false
-		profileNameEntry.Disable()
-		profileNameEntry.SetText(selected)
+		shared, err := getProfileShared(db, selected)
+		if err != nil {
+			log.Printf("Error reading profile settings: %v", err)
+		}
+		sharedCheck.SetChecked(shared)
+		if checkProfileOwner(db, selected) == nil {
+			sharedCheck.Enable()
+		} else {
+			sharedCheck.Disable()
+		}
+
+		mode, err := getOtherAppsMode(db, selected)
+		if err != nil {
+			log.Printf("Error reading profile settings: %v", err)
+		}
+		for _, option := range otherAppsLabels {
+			if option.mode == mode {
+				otherAppsSelect.SetSelected(option.label)
+			}
+		}
+		otherAppsSelect.Enable()
 
-		states, err := loadWindowStates(db, selected)
+		states, err := loadWindowStates(db, selected, currentArrangement(backend))
 		if err != nil {
-			statesTextArea.SetText(fmt.Sprintf("Error: %v", err))
+			statesView.ShowMessage(fmt.Sprintf("Error: %v", err))
 			return
 		}
 
 		displayWindowStates(states)
+
+		// Mention the layouts saved for other display arrangements
+		variants, err := getProfileVariants(db, selected)
+		if err != nil {
+			log.Printf("Error getting layout variants: %v", err)
+		} else if len(variants) > 1 {
+			text := fmt.Sprintf("Layouts saved for %d display arrangements:", len(variants))
+			for _, variant := range variants {
+				if variant == "" {
+					variant = "(any)"
+				}
+				text += "\n   " + variant
+			}
+			statesView.AppendSummary(text)
+		}
 	}
 
+	// Preview toggle for flashing target regions before a restore
+	previewCheck := widget.NewCheck("Preview positions before restoring", nil)
+
 	// Create buttons
-	saveButton := widget.NewButton("Save Current Window States", func() {
-		var profileName string
+	// Remembers the revision of a profile after changing it from here
+	noteRevision := func(profileName string) {
+		revision, err := getProfileRevision(db, profileName)
+		if err != nil {
+			log.Printf("Error reading profile revision: %v", err)
+			return
+		}
+		selectedRevision = revision
+	}
+
+	statesView.OnEdited = func(state WindowState, err error) {
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error updating window state: %v", err))
+			return
+		}
+		noteRevision(selectedProfile)
+		statusLabel.SetText(fmt.Sprintf("Moved %s - %s to (%.0f, %.0f) %.0f x %.0f",
+			state.AppName, state.WindowTitle, state.X, state.Y, state.Width, state.Height))
+	}
 
-		if isCreatingNew {
-			// Using the text from the entry for a new profile
-			profileName = profileNameEntry.Text
-			if profileName == "" {
-				statusLabel.SetText("Please enter a profile name")
+	// Takes one window out of the selected profile after asking
+	statesView.OnRemove = func(state WindowState) {
+		profileName := selectedProfile
+		message := fmt.Sprintf("Remove %s - %s from profile '%s'?", state.AppName, state.WindowTitle, profileName)
+		dialog.ShowConfirm("Remove Window", message, func(ok bool) {
+			if !ok {
 				return
 			}
-		} else {
-			// Using the selected existing profile
-			profileName = selectedProfile
-			// Double check it's not the "Create New" option
-			if profileName == "Create New Profile..." {
-				statusLabel.SetText("Please select a valid profile or create a new one")
-				return
+			var saved []WindowState
+			var err, loadErr error
+			busy.Run("Removing window...", func() {
+				err = removeWindowStates(db, profileName, []int64{state.ID})
+				if err == nil {
+					saved, loadErr = loadWindowStates(db, profileName, currentArrangement(backend))
+				}
+			}, func() {
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error removing window: %v", err))
+					return
+				}
+				statusLabel.SetText(fmt.Sprintf("Removed %s - %s from profile '%s'", state.AppName, state.WindowTitle, profileName))
+				noteRevision(profileName)
+				if loadErr != nil {
+					statesView.ShowMessage(fmt.Sprintf("Error: %v", loadErr))
+					return
+				}
+				displayWindowStates(saved)
+			})
+		}, myWindow)
+	}
+
+	// Saves states into a profile unless it changed since it was opened, in
+	// which case the user picks whether to overwrite or merge
+	var saveProfile func(profileName string, states []WindowState, revision int)
+	var savedProfile func(profileName, arrangement string, states, saved []WindowState, err, loadErr error)
+	saveProfile = func(profileName string, states []WindowState, revision int) {
+		var arrangement string
+		var err error
+		var saved []WindowState
+		var loadErr error
+		busy.Run("Saving window states...", func() {
+			arrangement = currentArrangement(backend)
+			err = saveWindowStatesAt(db, profileName, arrangement, states, revision)
+			if err == nil {
+				saved, loadErr = loadWindowStates(db, profileName, arrangement)
 			}
-		}
+		}, func() {
+			savedProfile(profileName, arrangement, states, saved, err, loadErr)
+		})
+	}
 
-		statusLabel.SetText("Saving window states...")
-		states := getCurrentWindowStates()
-		err := saveWindowStates(db, profileName, states)
+	// Shows how saving a profile went
+	savedProfile = func(profileName, arrangement string, states, saved []WindowState, err, loadErr error) {
+		var stale *staleRevisionError
+		if errors.As(err, &stale) {
+			statusLabel.SetText(err.Error())
+			showStaleRevisionDialog(stale, myWindow, func() {
+				saveProfile(profileName, states, anyRevision)
+			}, func() {
+				saved, err := loadWindowStates(db, profileName, arrangement)
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error loading window states: %v", err))
+					return
+				}
+				saveProfile(profileName, mergeStates(saved, states), stale.Current)
+			})
+			return
+		}
 		if err != nil {
 			statusLabel.SetText(fmt.Sprintf("Error saving window states: %v", err))
 			return
 		}
+		noteRevision(profileName)
 
 		statusLabel.SetText(fmt.Sprintf("Saved %d window states to profile '%s'", len(states), profileName))
 
-		if isCreatingNew {
-			profileNameEntry.SetText("")
-		}
-
 		refreshProfiles()
 
 		// Auto-select the newly created/updated profile in the dropdown
-		// We need to find it in the updated options list which now includes the "Create New" option
 		for _, option := range profileSelect.Options {
-			if option == profileName {
-				profileSelect.SetSelected(profileName)
+			if strings.EqualFold(option, canonicalProfileName(profileName)) {
+				profileSelect.SetSelected(option)
 				break
 			}
 		}
 
-		displayWindowStates(states)
+		// Show the saved rows so they can be edited
+		if loadErr != nil {
+			statesView.ShowMessage(fmt.Sprintf("Error: %v", loadErr))
+			return
+		}
+		displayWindowStates(saved)
+	}
+
+	saveButton := widget.NewButton("Save Current Window States", func() {
+		if selectedProfile == "" {
+			statusLabel.SetText("Please select a profile, or use New Profile… to create one")
+			return
+		}
+
+		profileName, revision := selectedProfile, selectedRevision
+		var captured []WindowState
+		busy.Run("Capturing open windows...", func() {
+			captured = captureForSave(backend)
+		}, func() {
+			statusLabel.SetText("")
+			showSaveChecklist(db, profileName, captured, myWindow, func(states []WindowState) {
+				saveProfile(profileName, states, revision)
+			})
+		})
+	})
+
+	// Says so in the status bar when a new profile's name is already used
+	profileTaken := func(profileName string) bool {
+		existing, err := getProfiles(db)
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error getting profiles: %v", err))
+			return true
+		}
+		for _, profile := range existing {
+			if strings.EqualFold(profile, profileName) {
+				statusLabel.SetText(fmt.Sprintf("Profile '%s' already exists", profile))
+				return true
+			}
+		}
+		archived, err := getArchivedProfiles(db)
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error getting profiles: %v", err))
+			return true
+		}
+		for _, profile := range archived {
+			if strings.EqualFold(profile, profileName) {
+				statusLabel.SetText(fmt.Sprintf("Profile '%s' is archived, unarchive it from Stale Profiles…", profile))
+				return true
+			}
+		}
+		return false
+	}
+
+	// Saves the open windows into a profile with a new name
+	newProfileButton := widget.NewButton("New Profile…", func() {
+		nameEntry := widget.NewEntry()
+		nameEntry.SetPlaceHolder("e.g. Work")
+		nameEntry.Validator = func(text string) error {
+			return validateProfileName(canonicalProfileName(text))
+		}
+		items := []*widget.FormItem{widget.NewFormItem("Name", nameEntry)}
+		dialog.ShowForm("New Profile", "Create", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			profileName := canonicalProfileName(nameEntry.Text)
+			if profileTaken(profileName) {
+				return
+			}
+
+			var captured []WindowState
+			busy.Run("Capturing open windows...", func() {
+				captured = captureForSave(backend)
+			}, func() {
+				statusLabel.SetText("")
+				showSaveChecklist(db, profileName, captured, myWindow, func(states []WindowState) {
+					saveProfile(profileName, states, anyRevision)
+				})
+			})
+		}, myWindow)
+	})
+
+	// Creates a profile that tiles open windows by a built-in template
+	templateButton := widget.NewButton("New From Template…", func() {
+		var current []WindowState
+		var displays []Display
+		busy.Run("Capturing open windows...", func() {
+			current = captureStates(backend)
+			displays = statesView.Displays()
+		}, func() {
+			statusLabel.SetText("")
+			showTemplateDialog(current, displays, myWindow, func(profileName string, states []WindowState) {
+				if profileTaken(profileName) {
+					return
+				}
+				saveProfile(profileName, states, anyRevision)
+			})
+		})
 	})
 
+	// Restores the selected profile, or some of its windows
+	var runRestore func(profileName string, opts restoreOptions, message string)
+	restoreSelected := func(windows []int64) {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile")
+			return
+		}
+
+		opts := restoreOptions{Preview: previewCheck.Checked, Source: "window", Windows: windows}
+
+		// Says up front how long it should take, and asks first when that's
+		// a while
+		var estimate restoreEstimate
+		var estimateErr error
+		busy.Run("Estimating restore...", func() {
+			estimate, estimateErr = engine.Estimate(profileName, opts)
+		}, func() {
+			message := "Restoring window states..."
+			if estimateErr != nil {
+				log.Printf("Error estimating restore: %v", estimateErr)
+			} else {
+				message = fmt.Sprintf("Restoring window states: %s...", estimate)
+			}
+			partial := estimateErr == nil && estimate.Available < estimate.Windows
+			if estimateErr != nil || (estimate.Duration < slowRestoreThreshold && !partial) {
+				runRestore(profileName, opts, message)
+				return
+			}
+			statusLabel.SetText("")
+
+			// Says which windows will be left behind rather than restoring
+			// only some of them without a word
+			if partial {
+				confirm := dialog.NewConfirm("Restore Profile", estimate.Unavailable()+"\n\nRestore what's available now?", func(ok bool) {
+					if ok {
+						runRestore(profileName, opts, message)
+					}
+				}, myWindow)
+				confirm.SetConfirmText("Restore Anyway")
+				if estimate.Available > 0 {
+					confirm.SetConfirmText(fmt.Sprintf("Restore %s", plural(estimate.Available, "Window")))
+				}
+				confirm.SetDismissText("Don't Restore")
+				confirm.Show()
+				return
+			}
+			confirm := fmt.Sprintf("Restoring '%s' means %s.\nRestore now?", profileName, estimate)
+			dialog.ShowConfirm("Restore Profile", confirm, func(ok bool) {
+				if ok {
+					runRestore(profileName, opts, message)
+				}
+			}, myWindow)
+		})
+	}
+
+	runRestore = func(profileName string, opts restoreOptions, message string) {
+		var count int
+		var err error
+		cancelRestoreButton.Enable()
+		cancelRestoreButton.Show()
+		busy.Run(message, func() {
+			count, err = engine.Apply(profileName, opts)
+		}, func() {
+			cancelRestoreButton.Hide()
+			if profileName == selectedProfile {
+				statesView.ShowResults(engine.LastResults(profileName))
+			}
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error restoring window states: %v", err))
+
+				var restoreErr *RestoreError
+				if errors.As(err, &restoreErr) {
+					showRestoreReport(engine, profileName, restoreErr.Results, myWindow)
+				}
+				return
+			}
+			results := engine.LastResults(profileName)
+			if needsRestoreReport(results) {
+				showRestoreReport(engine, profileName, results, myWindow)
+			}
+			message := fmt.Sprintf("Restored %d window states from profile '%s'", count, profileName)
+			if onScreen := countOnScreen(results); onScreen > 0 {
+				message += fmt.Sprintf(", %d brought back on screen", onScreen)
+			}
+			if hookErr := engine.LastHookError(profileName); hookErr != nil {
+				message += fmt.Sprintf(" (%s)", strings.ReplaceAll(hookErr.Error(), "\n", "; "))
+			}
+			statusLabel.SetText(message)
+
+			// Start a timer to clear the status message after 3 seconds
+			go func() {
+				time.Sleep(3 * time.Second)
+				serialUI(func() {
+					statusLabel.SetText("")
+				})
+			}()
+		})
+	}
+
 	loadButton := widget.NewButton("Load Selected Profile", func() {
+		restoreSelected(nil)
+	})
+
+	// Moves only the windows checked in the table
+	restoreRowsButton := widget.NewButton("Restore Selected", func() {
+		windows := statesView.Selected()
+		if len(windows) == 0 {
+			statusLabel.SetText("Check the windows to restore in the table first")
+			return
+		}
+		restoreSelected(windows)
+	})
+
+	undoButton := widget.NewButton("Undo Last Restore", func() {
+		var profileName string
+		var err error
+		busy.Run("Undoing last restore...", func() {
+			profileName, err = engine.UndoLastRestore()
+		}, func() {
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error undoing restore: %v", err))
+				return
+			}
+			statusLabel.SetText(fmt.Sprintf("Undid restore of profile '%s'", profileName))
+		})
+	})
+
+	deleteButton := widget.NewButton("Delete Selected Profile", func() {
 		profileName := profileSelect.Selected
 		if profileName == "" {
 			statusLabel.SetText("Please select a profile")
 			return
 		}
 
-		// Check if we're in "create new" mode - can't load a profile that doesn't exist yet
-		if profileName == "Create New Profile..." {
-			statusLabel.SetText("Please select an existing profile to load")
+		var err error
+		busy.Run("Deleting profile...", func() {
+			err = deleteProfile(db, profileName)
+		}, func() {
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error deleting profile: %v", err))
+				return
+			}
+
+			statusLabel.SetText(fmt.Sprintf("Moved profile '%s' to Recently Deleted", profileName))
+			statesView.ShowMessage("Select a profile to see saved window states")
+			refreshProfiles()
+		})
+	})
+
+	trashItem := fyne.NewMenuItem("Recently Deleted…", func() {
+		showTrashDialog(db, myWindow, refreshProfiles)
+	})
+
+	// Adds windows to a profile and shows its updated window states
+	addWindows := func(profileName string, states []WindowState) {
+		var saved []WindowState
+		var err, loadErr error
+		busy.Run("Adding windows...", func() {
+			arrangement := currentArrangement(backend)
+			err = addWindowStates(db, profileName, arrangement, states)
+			if err == nil {
+				saved, loadErr = loadWindowStates(db, profileName, arrangement)
+			}
+		}, func() {
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error adding windows: %v", err))
+				return
+			}
+
+			if len(states) == 1 {
+				statusLabel.SetText(fmt.Sprintf("Added %s - %s to profile '%s'", states[0].AppName, states[0].WindowTitle, profileName))
+			} else {
+				statusLabel.SetText(fmt.Sprintf("Added %d windows to profile '%s'", len(states), profileName))
+			}
+			noteRevision(profileName)
+			if loadErr != nil {
+				statesView.ShowMessage(fmt.Sprintf("Error: %v", loadErr))
+				return
+			}
+			displayWindowStates(saved)
+		})
+	}
+
+	// Lets the user cherry-pick captured windows to add to a profile,
+	// optionally narrowed down to one app
+	showAddWindows := func(profileName string, current []WindowState) {
+		const allApps = "All apps"
+		picked := make([]bool, len(current))
+		checks := container.NewVBox()
+		showApp := func(app string) {
+			checks.RemoveAll()
+			frontmost := -1
+			for i, state := range current {
+				if app != allApps && state.AppName != app {
+					continue
+				}
+				if frontmost == -1 || state.ZOrder < current[frontmost].ZOrder {
+					frontmost = i
+				}
+			}
+			// Picking an app ticks its frontmost window
+			if app != allApps && frontmost != -1 {
+				picked[frontmost] = true
+			}
+			for i, state := range current {
+				if app != allApps && state.AppName != app {
+					continue
+				}
+				label := fmt.Sprintf("%s - %s (%.0f, %.0f %.0f x %.0f)",
+					state.AppName, state.WindowTitle, state.X, state.Y, state.Width, state.Height)
+				check := widget.NewCheck(label, func(checked bool) {
+					picked[i] = checked
+				})
+				check.SetChecked(picked[i])
+				checks.Add(check)
+			}
+		}
+		showApp(allApps)
+
+		apps := []string{allApps}
+		seen := make(map[string]bool)
+		for _, state := range current {
+			if !seen[state.AppName] {
+				seen[state.AppName] = true
+				apps = append(apps, state.AppName)
+			}
+		}
+		sort.Strings(apps[1:])
+		appSelect := widget.NewSelect(apps, showApp)
+		appSelect.SetSelected(allApps)
+
+		scroll := container.NewVScroll(checks)
+		scroll.SetMinSize(fyne.NewSize(500, 300))
+		content := container.NewBorder(
+			container.NewBorder(nil, nil, widget.NewLabel("App:"), nil, appSelect),
+			nil, nil, nil,
+			scroll,
+		)
+
+		dialog.ShowCustomConfirm("Add Windows to '"+profileName+"'", "Add", "Cancel", content, func(ok bool) {
+			if !ok {
+				return
+			}
+
+			var selected []WindowState
+			for i, state := range current {
+				if picked[i] {
+					selected = append(selected, state)
+				}
+			}
+			if len(selected) == 0 {
+				statusLabel.SetText("No windows selected")
+				return
+			}
+			addWindows(profileName, selected)
+		}, myWindow)
+	}
+
+	addWindowButton := widget.NewButton("Add Window…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to add windows to")
+			return
+		}
+
+		// Capture the live windows so the user can cherry-pick from them
+		var current []WindowState
+		busy.Run("Capturing open windows...", func() {
+			current = captureForSave(backend)
+		}, func() {
+			statusLabel.SetText("")
+			if len(current) == 0 {
+				statusLabel.SetText("No open windows found")
+				return
+			}
+			showAddWindows(profileName, current)
+		})
+	})
+
+	pickWindowButton := widget.NewButton("Pick Window…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to add windows to")
+			return
+		}
+
+		picker, ok := backend.(WindowPicker)
+		if !ok {
+			statusLabel.SetText("Picking windows is not supported on this platform")
+			return
+		}
+
+		var state WindowState
+		var err error
+		busy.Run("Click on any window to pick it...", func() {
+			state, err = picker.PickWindow(15 * time.Second)
+			if err == nil {
+				picked := []WindowState{state}
+				tagDisplays(backend, picked)
+				state = picked[0]
+			}
+		}, func() {
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error picking window: %v", err))
+				return
+			}
+
+			statusLabel.SetText("")
+			message := fmt.Sprintf("Add %s - %s\nPosition: (%.0f, %.0f) Size: %.0f x %.0f\nto profile '%s'?",
+				state.AppName, state.WindowTitle, state.X, state.Y, state.Width, state.Height, profileName)
+			dialog.ShowConfirm("Add Picked Window", message, func(ok bool) {
+				if ok {
+					addWindows(profileName, []WindowState{state})
+				}
+			}, myWindow)
+		})
+	})
+
+	schedulesItem := fyne.NewMenuItem("Schedules…", func() {
+		showSchedulesDialog(db, myWindow)
+	})
+
+	// Recent saves, restores and triggers of every profile
+	activityItem := fyne.NewMenuItem("Activity…", func() {
+		showActivityDialog(db, myWindow)
+	})
+
+	// Walks through permissions, profiles and options, by itself the first
+	// time wisa opens
+	runSetup := func() {
+		showSetupWizard(db, myWindow, func(choices setupChoices) {
+			if choices.CloseToTray {
+				setupTrayMode(tray)
+			}
+			if !choices.SaveDefault || profileTaken(defaultProfileName) {
+				return
+			}
+			var captured []WindowState
+			busy.Run("Capturing open windows...", func() {
+				captured = captureForSave(backend)
+			}, func() {
+				saveProfile(defaultProfileName, captured, anyRevision)
+			})
+		})
+	}
+	setupItem := fyne.NewMenuItem("Setup…", runSetup)
+
+	insightsItem := fyne.NewMenuItem("Insights…", func() {
+		showInsightsDialog(db, myWindow)
+	})
+
+	renamesItem := fyne.NewMenuItem("App Renames…", func() {
+		var renames []appRename
+		var err error
+		busy.Run("Looking for missing apps...", func() {
+			renames, err = findAppRenames(db, backend)
+		}, func() {
+			statusLabel.SetText("")
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error: %v", err))
+				return
+			}
+			showAppRenamesDialog(db, renames, myWindow, func(windows int64) {
+				refreshProfiles()
+				statusLabel.SetText(fmt.Sprintf("Renamed apps in %s", plural(int(windows), "window")))
+			})
+		})
+	})
+
+	staleItem := fyne.NewMenuItem("Stale Profiles…", func() {
+		var check *staleCheck
+		var err error
+		busy.Run("Looking for stale profiles...", func() {
+			check, err = gatherStaleCheck(db, backend)
+		}, func() {
+			statusLabel.SetText("")
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error: %v", err))
+				return
+			}
+			showStaleProfilesDialog(db, check, myWindow, refreshProfiles)
+		})
+	})
+
+	historyItem := fyne.NewMenuItem("History…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to see its history")
+			return
+		}
+
+		showHistoryDialog(db, profileName, myWindow, func() {
+			states, err := loadWindowStates(db, profileName, currentArrangement(backend))
+			if err != nil {
+				statesView.ShowMessage(fmt.Sprintf("Error: %v", err))
+				return
+			}
+			displayWindowStates(states)
+			statusLabel.SetText(fmt.Sprintf("Rolled back profile '%s'", profileName))
+			noteRevision(profileName)
+		})
+	})
+
+	rolesItem := fyne.NewMenuItem("Edit Roles…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to edit")
 			return
 		}
 
-		statusLabel.SetText("Loading window states...")
-		states, err := loadWindowStates(db, profileName)
+		states, err := loadWindowStates(db, profileName, currentArrangement(backend))
 		if err != nil {
 			statusLabel.SetText(fmt.Sprintf("Error loading window states: %v", err))
 			return
 		}
-
 		if len(states) == 0 {
 			statusLabel.SetText(fmt.Sprintf("No window states found for profile '%s'", profileName))
 			return
 		}
 
-		statusLabel.SetText("Restoring window states...")
-		restoreWindowStates(states)
-		statusLabel.SetText(fmt.Sprintf("Restored %d window states from profile '%s'", len(states), profileName))
+		entries := make([]*widget.Entry, len(states))
+		form := container.New(layout.NewFormLayout())
+		for i, state := range states {
+			entries[i] = widget.NewEntry()
+			entries[i].SetPlaceHolder("e.g. editor, reference, comm")
+			entries[i].SetText(state.Role)
+			form.Add(widget.NewLabel(fmt.Sprintf("%s - %s", state.AppName, state.WindowTitle)))
+			form.Add(entries[i])
+		}
 
-		// Start a timer to clear the status message after 3 seconds
-		go func() {
-			time.Sleep(3 * time.Second)
-			statusLabel.SetText("")
-		}()
+		scroll := container.NewVScroll(form)
+		scroll.SetMinSize(fyne.NewSize(550, 300))
+
+		dialog.ShowCustomConfirm("Window Roles for '"+profileName+"'", "Save", "Cancel", scroll, func(ok bool) {
+			if !ok {
+				return
+			}
+
+			for i, state := range states {
+				if entries[i].Text == state.Role {
+					continue
+				}
+				if err := setWindowRole(db, profileName, state.ID, entries[i].Text); err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error saving roles: %v", err))
+					return
+				}
+			}
+
+			updated, err := loadWindowStates(db, profileName, currentArrangement(backend))
+			if err != nil {
+				statesView.ShowMessage(fmt.Sprintf("Error: %v", err))
+				return
+			}
+			displayWindowStates(updated)
+			statusLabel.SetText(fmt.Sprintf("Saved window roles for profile '%s'", profileName))
+			noteRevision(profileName)
+		}, myWindow)
 	})
 
-	deleteButton := widget.NewButton("Delete Selected Profile", func() {
+	matchingItem := fyne.NewMenuItem("Title Matching…", func() {
 		profileName := profileSelect.Selected
 		if profileName == "" {
-			statusLabel.SetText("Please select a profile")
+			statusLabel.SetText("Please select a profile to edit")
 			return
 		}
 
-		// Check if we're in "create new" mode - can't delete a profile that doesn't exist yet
-		if profileName == "Create New Profile..." {
-			statusLabel.SetText("Please select an existing profile to delete")
+		states, err := loadWindowStates(db, profileName, currentArrangement(backend))
+		if err != nil {
+			statusLabel.SetText(fmt.Sprintf("Error loading window states: %v", err))
+			return
+		}
+		if len(states) == 0 {
+			statusLabel.SetText(fmt.Sprintf("No window states found for profile '%s'", profileName))
 			return
 		}
 
-		err := deleteProfile(db, profileName)
+		showMatchingDialog(db, profileName, states, myWindow, func() {
+			statusLabel.SetText(fmt.Sprintf("Saved title matching for profile '%s'", profileName))
+			noteRevision(profileName)
+		})
+	})
+
+	batchSaveItem := fyne.NewMenuItem("Batch Save…", func() {
+		showBatchSaveDialog(db, backend, busy, myWindow, func(saved map[string]int, skipped []string) {
+			total := 0
+			for _, count := range saved {
+				total += count
+			}
+			status := fmt.Sprintf("Saved %d window states across %d profiles", total, len(saved))
+			if len(skipped) > 0 {
+				status += fmt.Sprintf(", skipped %s with none of their apps open", strings.Join(skipped, ", "))
+			}
+			statusLabel.SetText(status)
+			refreshProfiles()
+		})
+	})
+
+	exportItem := fyne.NewMenuItem("Export…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to export")
+			return
+		}
+
+		stripCheck := widget.NewCheck("Leave out settings tied to this machine", nil)
+		dialog.ShowCustomConfirm("Export '"+profileName+"'", "Export…", "Cancel", stripCheck, func(ok bool) {
+			if !ok {
+				return
+			}
+			bundle, err := exportProfiles(db, []string{profileName}, exportOptions{StripMachine: stripCheck.Checked})
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error exporting profile: %v", err))
+				return
+			}
+
+			save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+				if err != nil || writer == nil {
+					return
+				}
+				defer writer.Close()
+				if err := writeExport(writer, bundle); err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error exporting profile: %v", err))
+					return
+				}
+				statusLabel.SetText(fmt.Sprintf("Exported profile '%s' to %s", profileName, writer.URI().Name()))
+			}, myWindow)
+			save.SetFileName(profileName + ".json")
+			save.Show()
+		}, myWindow)
+	})
+
+	// Imports a bundle, asking first when it would replace existing profiles
+	importBundle := func(bundle *exportBundle, source string) {
+		runImport := func() {
+			var err error
+			busy.Run("Importing profiles...", func() {
+				err = importProfiles(db, bundle)
+			}, func() {
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error importing profiles: %v", err))
+					return
+				}
+				refreshProfiles()
+				statusLabel.SetText(fmt.Sprintf("Imported %d profiles from %s", len(bundle.Profiles), source))
+			})
+		}
+
+		existing, err := existingImports(db, bundle)
 		if err != nil {
-			statusLabel.SetText(fmt.Sprintf("Error deleting profile: %v", err))
+			statusLabel.SetText(fmt.Sprintf("Error importing profiles: %v", err))
+			return
+		}
+		if len(existing) == 0 {
+			runImport()
 			return
 		}
+		message := fmt.Sprintf("Importing %s replaces these profiles and their saved windows:\n\n%s\n\nReplace them?", source, strings.Join(existing, "\n"))
+		dialog.ShowConfirm("Replace Profiles", message, func(ok bool) {
+			if ok {
+				runImport()
+			}
+		}, myWindow)
+	}
 
-		statusLabel.SetText(fmt.Sprintf("Deleted profile '%s'", profileName))
-		statesTextArea.SetText("Select a profile to see saved window states")
-		refreshProfiles()
+	importItem := fyne.NewMenuItem("Import…", func() {
+		open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			bundle, err := readExport(reader)
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error importing profiles: %v", err))
+				return
+			}
+			importBundle(bundle, reader.URI().Name())
+		}, myWindow)
+		open.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+		open.Show()
+	})
+
+	importURLItem := fyne.NewMenuItem("Import From URL…", func() {
+		showImportURLDialog(db, myWindow, func(link string) {
+			var bundle *exportBundle
+			var err error
+			busy.Run("Downloading profiles...", func() {
+				bundle, err = fetchExport(db, link)
+			}, func() {
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error importing profiles: %v", err))
+					return
+				}
+				importBundle(bundle, link)
+			})
+		})
+	})
+
+	backupItem := fyne.NewMenuItem("Backup…", func() {
+		save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil || writer == nil {
+				return
+			}
+			defer writer.Close()
+			if err := backupDatabaseTo(db, writer); err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error backing up: %v", err))
+				return
+			}
+			statusLabel.SetText(fmt.Sprintf("Backed up all profiles to %s", writer.URI().Name()))
+		}, myWindow)
+		save.SetFileName(fmt.Sprintf("wisa-%s.db", time.Now().Format("2006-01-02")))
+		save.Show()
+	})
+
+	restoreBackupItem := fyne.NewMenuItem("Restore Backup…", func() {
+		open := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+
+			// SQLite needs a file path, so the backup is copied out first
+			tmp, err := os.CreateTemp("", "wisa-restore-*.db")
+			if err != nil {
+				statusLabel.SetText(fmt.Sprintf("Error reading backup: %v", err))
+				return
+			}
+			_, err = io.Copy(tmp, reader)
+			tmp.Close()
+			if err != nil {
+				os.Remove(tmp.Name())
+				statusLabel.SetText(fmt.Sprintf("Error reading backup: %v", err))
+				return
+			}
+
+			name := reader.URI().Name()
+			message := fmt.Sprintf("Replace all profiles, triggers and settings with the ones in %s?\nA backup of the current ones is saved first.", name)
+			dialog.ShowConfirm("Restore Backup", message, func(ok bool) {
+				if !ok {
+					os.Remove(tmp.Name())
+					return
+				}
+				var err error
+				busy.Run("Restoring backup...", func() {
+					err = restoreDatabase(db, tmp.Name())
+					os.Remove(tmp.Name())
+				}, func() {
+					if err != nil {
+						statusLabel.SetText(fmt.Sprintf("Error restoring backup: %v", err))
+						return
+					}
+					refreshProfiles()
+					statusLabel.SetText(fmt.Sprintf("Restored backup %s", name))
+				})
+			}, myWindow)
+		}, myWindow)
+		open.SetFilter(storage.NewExtensionFileFilter([]string{".db"}))
+		open.Show()
+	})
+
+	environmentItem := fyne.NewMenuItem("Environment…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to edit")
+			return
+		}
+		showEnvironmentDialog(db, profileName, myWindow)
+	})
+
+	hooksItem := fyne.NewMenuItem("Hooks…", func() {
+		profileName := profileSelect.Selected
+		if profileName == "" {
+			statusLabel.SetText("Please select a profile to edit")
+			return
+		}
+		showHooksDialog(db, backend, profileName, myWindow)
+	})
+
+	autoRestoreItem := fyne.NewMenuItem("Auto-Restore…", func() {
+		showDisplayTriggersDialog(db, backend, myWindow)
 	})
 
 	// Create layout with a clearer design for the combo profile selector
 	topContent := container.NewVBox(
 		widget.NewLabel("Wisa - Window State Manager"),
-		widget.NewLabel("Select or Create Profile:"),
-		profileSelect,
-		// Profile name entry only shows when creating a new profile
-		container.New(
-			layout.NewFormLayout(),
-			widget.NewLabel("Profile Name:"),
-			profileNameEntry,
-		),
+		widget.NewLabel("Profile:"),
+		profileFilter,
+		container.NewBorder(nil, nil, nil, container.NewHBox(newProfileButton, templateButton), profileSelect),
 		container.NewHBox(
 			saveButton,
 			loadButton,
+			restoreRowsButton,
+			undoButton,
+			addWindowButton,
+			pickWindowButton,
 			deleteButton,
 		),
+		container.NewHBox(
+			previewCheck,
+			launchCheck,
+			scaleCheck,
+			sharedCheck,
+			otherAppsSelect,
+		),
+	)
+
+	// Shows whether wisa has the OS permissions it needs
+	// The setup wizard covers the permissions the first time
+	firstRun := needsSetup(db, profiles)
+	permissions := newPermissionIndicator(myWindow, tray)
+	permissions.Start(!firstRun)
+
+	busy.SetControls(
+		saveButton,
+		newProfileButton,
+		templateButton,
+		loadButton,
+		restoreRowsButton,
+		undoButton,
+		addWindowButton,
+		pickWindowButton,
+		deleteButton,
 	)
 
 	content := container.NewBorder(
 		topContent,
-		statusLabel,
+		container.NewBorder(nil, nil, busy.Indicator, container.NewHBox(cancelRestoreButton, permissions.button), statusLabel),
 		nil,
 		nil,
-		container.NewVScroll(statesTextArea),
+		statesView.Content(),
 	)
 
+	// Apply the assigned profile whenever the display arrangement changes
+	// or a schedule comes due
+	hooks := triggerHooks{
+		// These are called from the watchers' goroutines
+		Confirm: func(message string, apply func()) {
+			serialUI(func() {
+				myApp.SendNotification(fyne.NewNotification("Wisa", message))
+				myWindow.RequestFocus()
+				confirm := dialog.NewConfirm("Auto-Restore", message, func(ok bool) {
+					if ok {
+						apply()
+					}
+				}, myWindow)
+				confirm.SetConfirmText("Apply")
+				confirm.SetDismissText("Dismiss")
+				confirm.Show()
+			})
+		},
+		Notify: func(profileName string, count int, err error) {
+			serialUI(func() {
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error auto-restoring profile '%s': %v", profileName, err))
+					return
+				}
+				statusLabel.SetText(fmt.Sprintf("Auto-restored %d window states from profile '%s'", count, profileName))
+			})
+		},
+		Saved: func(profileName string, count int, err error) {
+			serialUI(func() {
+				if err != nil {
+					statusLabel.SetText(fmt.Sprintf("Error saving window states: %v", err))
+					return
+				}
+				statusLabel.SetText(fmt.Sprintf("Saved %d window states to profile '%s'", count, profileName))
+			})
+		},
+	}
+	go watchDisplays(engine, 3*time.Second, hooks)
+	startPruner(db)
+	go watchSchedules(engine, hooks)
+	hotkeys := startHotkeys(engine, hooks)
+	startAPIServer(engine, hooks)
+
+	// AppleScript and Shortcuts can restore, save and list profiles
+	listenForScripts(engine, hooks)
+
+	// Restores or saves the profile named by a wisa:// link opened while the
+	// window is up
+	listenForURLs(func(raw string) {
+		command, err := urlCommand(raw)
+		if err != nil {
+			statusLabel.SetText(err.Error())
+			return
+		}
+		profileName := command[1]
+		run := func() {
+			if command[0] == "save" {
+				states := captureForSave(backend)
+				hooks.Saved(profileName, len(states), saveWindowStates(db, profileName, currentArrangement(backend), states))
+				return
+			}
+			engine.Enqueue(profileName, "url", restoreOptions{}, func(count int, err error) {
+				hooks.Notify(profileName, count, err)
+			})
+		}
+		if reason := linkNeedsConsent(db, command); reason != "" {
+			myWindow.Show()
+			dialog.ShowConfirm("Open Link", reason+" Go ahead?", func(ok bool) {
+				if ok {
+					run()
+				}
+			}, myWindow)
+			return
+		}
+		run()
+	})
+
 	myWindow.SetContent(content)
-	myWindow.ShowAndRun()
+	showInterruptedRestores(engine, myWindow, statusLabel.SetText)
+	if len(startupRepairs) > 0 {
+		dialog.ShowInformation("Database Repaired",
+			"wisa fixed some problems in its database, a backup was made first:\n\n"+strings.Join(startupRepairs, "\n"), myWindow)
+	}
+	setupTrayMode(tray)
+	applyTheme(myApp, db)
+
+	// The menu items that start more work can't be disabled while it runs
+	// like the buttons, so they say so instead
+	whenIdle := func(item *fyne.MenuItem) *fyne.MenuItem {
+		action := item.Action
+		item.Action = func() {
+			if busy.Running() {
+				statusLabel.SetText("Please wait for the current work to finish")
+				return
+			}
+			action()
+		}
+		return item
+	}
+
+	// Preferences… is in the File menu, or the app menu on macOS
+	preferences := fyne.NewMenuItem("Preferences…", func() {
+		showPreferencesDialog(db, myApp, myWindow, hotkeys, tray)
+	})
+	myWindow.SetMainMenu(fyne.NewMainMenu(
+		fyne.NewMenu("File",
+			whenIdle(batchSaveItem),
+			fyne.NewMenuItemSeparator(),
+			whenIdle(importItem),
+			whenIdle(importURLItem),
+			exportItem,
+			fyne.NewMenuItemSeparator(),
+			backupItem,
+			whenIdle(restoreBackupItem),
+			trashItem,
+			fyne.NewMenuItemSeparator(),
+			preferences,
+		),
+		fyne.NewMenu("Profile",
+			historyItem,
+			rolesItem,
+			matchingItem,
+			environmentItem,
+			hooksItem,
+			schedulesItem,
+		),
+		fyne.NewMenu("Tools",
+			autoRestoreItem,
+			renamesItem,
+			staleItem,
+			activityItem,
+			insightsItem,
+			setupItem,
+		),
+	))
+	if firstRun {
+		runSetup()
+	}
+	myWindow.Show()
 }
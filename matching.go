@@ -0,0 +1,335 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How a saved window title is matched against the open windows
+const (
+	matchExact    = ""
+	matchPrefix   = "prefix"
+	matchContains = "contains"
+	matchRegex    = "regex"
+	// matchIndex takes the app's window at the same position it had when
+	// the profile was saved, whatever its title
+	matchIndex = "index"
+)
+
+// Labels for the matching strategies in the UI, in display order
+var matchLabels = []struct{ match, label string }{
+	{matchExact, "Exact title"},
+	{matchPrefix, "Title starts with"},
+	{matchContains, "Title contains"},
+	{matchRegex, "Title matches regex"},
+	{matchIndex, "Any window of app, by index"},
+}
+
+// The strategy for windows matched by exact title, from the
+// default_title_match setting, so titles that change can be matched loosely
+// everywhere without setting it on each window
+var (
+	defaultMatchMu      sync.RWMutex
+	currentDefaultMatch = matchExact
+)
+
+// Checks a default strategy is known. Regex isn't one, a saved title is
+// rarely a useful pattern.
+func validDefaultMatch(match string) error {
+	for _, label := range matchLabels {
+		if label.match == match && match != matchRegex {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid title matching %q, use prefix, contains, index or empty for exact", match)
+}
+
+// Reloads the default strategy from the settings, exact if it's invalid
+func loadDefaultMatch(db *sql.DB) {
+	match := getSetting(db, settingDefaultTitleMatch, matchExact)
+	if validDefaultMatch(match) != nil {
+		match = matchExact
+	}
+
+	defaultMatchMu.Lock()
+	currentDefaultMatch = match
+	defaultMatchMu.Unlock()
+}
+
+func setDefaultMatch(db *sql.DB, match string) error {
+	if err := validDefaultMatch(match); err != nil {
+		return err
+	}
+	if err := setSetting(db, settingDefaultTitleMatch, match); err != nil {
+		return err
+	}
+	loadDefaultMatch(db)
+	return nil
+}
+
+// The strategy a state is matched by, its own or else the default
+func effectiveMatch(state WindowState) string {
+	if state.TitleMatch != matchExact {
+		return state.TitleMatch
+	}
+	defaultMatchMu.RLock()
+	defer defaultMatchMu.RUnlock()
+	return currentDefaultMatch
+}
+
+// The pattern a state's title is matched with, its own or else the saved
+// title
+func titlePattern(state WindowState) string {
+	if state.TitlePattern != "" {
+		return state.TitlePattern
+	}
+	return state.WindowTitle
+}
+
+// Compiles the title pattern of a state for regex matching, once rather than
+// for every window it's compared with. Nil when it isn't a valid regex.
+func compileTitlePattern(state WindowState) *regexp.Regexp {
+	re, err := regexp.Compile(titlePattern(state))
+	if err != nil {
+		log.Printf("Invalid title pattern %q: %v", titlePattern(state), err)
+		return nil
+	}
+	return re
+}
+
+// Checks a window title against a saved state using a single strategy. re is
+// the state's compiled pattern for regex matching, see compileTitlePattern.
+func titleMatches(state WindowState, match string, title string, appIndex int, re *regexp.Regexp) bool {
+	pattern := titlePattern(state)
+
+	switch match {
+	case matchPrefix:
+		return strings.HasPrefix(title, pattern)
+	case matchContains:
+		return strings.Contains(title, pattern)
+	case matchRegex:
+		return re != nil && re.MatchString(title)
+	case matchIndex:
+		return appIndex == state.AppIndex
+	default:
+		return title == state.WindowTitle
+	}
+}
+
+// The strategies tried for a state, from strictest to loosest. An exact
+// title always wins, and any loose strategy falls back to the window index.
+func matchChain(match string) []string {
+	switch match {
+	case matchExact:
+		return []string{matchExact}
+	case matchIndex:
+		return []string{matchExact, matchIndex}
+	default:
+		return []string{matchExact, match, matchIndex}
+	}
+}
+
+// Checks whether two states belong to the same app, by bundle ID when both
+// have one since process names are ambiguous
+func sameApp(a, b WindowState) bool {
+	if a.BundleID != "" && b.BundleID != "" {
+		return a.BundleID == b.BundleID
+	}
+	return a.AppName == b.AppName
+}
+
+// Numbers the windows of each app in the order they were captured
+func indexByApp(states []WindowState) {
+	counts := make(map[string]int)
+	for i := range states {
+		states[i].AppIndex = counts[states[i].AppName]
+		counts[states[i].AppName]++
+	}
+}
+
+// Replaces the saved app names and titles with those of the open windows
+// they match, so the backends can find them by exact name and title. Each
+// open window is only used once.
+func resolveTitles(backend WindowBackend, states []WindowState) []WindowState {
+	resolved := make([]WindowState, len(states))
+	copy(resolved, states)
+
+	needed := false
+	for _, state := range states {
+		if effectiveMatch(state) != matchExact || state.BundleID != "" {
+			needed = true
+			break
+		}
+	}
+	if !needed {
+		return resolved
+	}
+
+	current := captureStates(backend)
+
+	used := make([]bool, len(current))
+	for i, state := range resolved {
+		match := effectiveMatch(state)
+		if match == matchExact && state.BundleID == "" {
+			continue
+		}
+		var re *regexp.Regexp
+		if match == matchRegex {
+			re = compileTitlePattern(state)
+		}
+		found := false
+		for _, match := range matchChain(match) {
+			for j, window := range current {
+				if used[j] || !sameApp(window, state) {
+					continue
+				}
+				if titleMatches(state, match, window.WindowTitle, window.AppIndex, re) {
+					used[j] = true
+					resolved[i].AppName = window.AppName
+					resolved[i].WindowTitle = window.WindowTitle
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+	}
+	return resolved
+}
+
+// Checks a strategy is known and, for regex, that its pattern compiles
+func validTitleMatch(match, pattern string) error {
+	known := false
+	for _, label := range matchLabels {
+		known = known || label.match == match
+	}
+	if !known {
+		return fmt.Errorf("invalid title matching %q", match)
+	}
+	if match == matchRegex {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid regex %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Sets how the title of a saved window state is matched
+func setWindowMatch(db *sql.DB, profileName string, stateID int64, match, pattern string) error {
+	if err := validTitleMatch(match, pattern); err != nil {
+		return err
+	}
+	return queueWrite(func() error {
+		return setWindowMatchLocked(db, profileName, stateID, match, pattern)
+	})
+}
+
+func setWindowMatchLocked(db *sql.DB, profileName string, stateID int64, match, pattern string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	var profileID int
+	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := bumpRevision(tx, profileName, profileID, anyRevision); err != nil {
+		return err
+	}
+	result, err := tx.Exec(
+		"UPDATE window_states SET title_match = ?, title_pattern = ? WHERE id = ? AND profile_id = ?",
+		match, pattern, stateID, profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error updating title matching: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("window state %d not found in profile %s", stateID, profileName)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %v", err)
+	}
+	return nil
+}
+
+// Lets the user pick how the title of each window in a profile is matched
+func showMatchingDialog(db *sql.DB, profileName string, states []WindowState, parent fyne.Window, onSaved func()) {
+	var labels []string
+	for _, option := range matchLabels {
+		labels = append(labels, option.label)
+	}
+
+	selects := make([]*widget.Select, len(states))
+	patterns := make([]*widget.Entry, len(states))
+	form := container.New(layout.NewFormLayout())
+	for i, state := range states {
+		selects[i] = widget.NewSelect(labels, nil)
+		for _, option := range matchLabels {
+			if option.match == state.TitleMatch {
+				selects[i].SetSelected(option.label)
+			}
+		}
+		patterns[i] = widget.NewEntry()
+		patterns[i].SetPlaceHolder("Pattern, defaults to the saved title")
+		patterns[i].SetText(state.TitlePattern)
+
+		form.Add(widget.NewLabel(fmt.Sprintf("%s - %s", state.AppName, state.WindowTitle)))
+		form.Add(container.NewGridWithColumns(2, selects[i], patterns[i]))
+	}
+
+	scroll := container.NewVScroll(form)
+	scroll.SetMinSize(fyne.NewSize(700, 300))
+
+	dialog.ShowCustomConfirm("Title Matching for '"+profileName+"'", "Save", "Cancel", scroll, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		for i, state := range states {
+			match := state.TitleMatch
+			for _, option := range matchLabels {
+				if option.label == selects[i].Selected {
+					match = option.match
+				}
+			}
+
+			pattern := patterns[i].Text
+			if err := validTitleMatch(match, pattern); err != nil {
+				dialog.ShowError(fmt.Errorf("%s - %s: %v", state.AppName, state.WindowTitle, err), parent)
+				return
+			}
+
+			if match == state.TitleMatch && pattern == state.TitlePattern {
+				continue
+			}
+			if err := setWindowMatch(db, profileName, state.ID, match, pattern); err != nil {
+				dialog.ShowError(err, parent)
+				return
+			}
+		}
+		onSaved()
+	}, parent)
+}
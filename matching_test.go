@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchChain(t *testing.T) {
+	tests := []struct {
+		match string
+		want  []string
+	}{
+		{matchExact, []string{matchExact}},
+		{matchIndex, []string{matchExact, matchIndex}},
+		{matchPrefix, []string{matchExact, matchPrefix, matchIndex}},
+		{matchContains, []string{matchExact, matchContains, matchIndex}},
+		{matchRegex, []string{matchExact, matchRegex, matchIndex}},
+	}
+	for _, test := range tests {
+		if got := matchChain(test.match); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("matchChain(%q) = %q, want %q", test.match, got, test.want)
+		}
+	}
+}
+
+func TestTitleMatches(t *testing.T) {
+	saved := WindowState{AppName: "Safari", WindowTitle: "Docs - Wiki", AppIndex: 1}
+	withPattern := WindowState{AppName: "Code", WindowTitle: "main.go - wisa", TitlePattern: `^\w+\.go - wisa$`}
+	tests := []struct {
+		name     string
+		state    WindowState
+		match    string
+		title    string
+		appIndex int
+		want     bool
+	}{
+		{"exact", saved, matchExact, "Docs - Wiki", 0, true},
+		{"exact is case sensitive", saved, matchExact, "docs - wiki", 0, false},
+		{"exact ignores the pattern", withPattern, matchExact, "main.go - wisa", 0, true},
+		{"prefix", saved, matchPrefix, "Docs - Wiki (2 new)", 0, true},
+		{"prefix elsewhere", saved, matchPrefix, "Re: Docs - Wiki", 0, false},
+		{"contains", saved, matchContains, "Re: Docs - Wiki (2 new)", 0, true},
+		{"contains missing", saved, matchContains, "Docs", 0, false},
+		{"regex uses the pattern", withPattern, matchRegex, "backend.go - wisa", 0, true},
+		{"regex no match", withPattern, matchRegex, "README.md - wisa", 0, false},
+		{"invalid regex", WindowState{TitlePattern: "("}, matchRegex, "(", 0, false},
+		{"index", saved, matchIndex, "Anything", 1, true},
+		{"other index", saved, matchIndex, "Docs - Wiki", 0, false},
+	}
+	for _, test := range tests {
+		re := compileTitlePattern(test.state)
+		if got := titleMatches(test.state, test.match, test.title, test.appIndex, re); got != test.want {
+			t.Errorf("%s: titleMatches(%q, %q) = %v, want %v", test.name, test.match, test.title, got, test.want)
+		}
+	}
+}
+
+func TestValidTitleMatch(t *testing.T) {
+	tests := []struct {
+		match   string
+		pattern string
+		valid   bool
+	}{
+		{matchExact, "", true},
+		{matchPrefix, "Docs", true},
+		{matchRegex, `^\w+\.go$`, true},
+		{matchRegex, "", true},
+		{matchRegex, "(", false},
+		{"fuzzy", "", false},
+	}
+	for _, test := range tests {
+		if err := validTitleMatch(test.match, test.pattern); (err == nil) != test.valid {
+			t.Errorf("validTitleMatch(%q, %q) = %v, want valid %v", test.match, test.pattern, err, test.valid)
+		}
+	}
+}
+
+func TestSameApp(t *testing.T) {
+	tests := []struct {
+		a, b WindowState
+		want bool
+	}{
+		{WindowState{AppName: "Code"}, WindowState{AppName: "Code"}, true},
+		{WindowState{AppName: "Code"}, WindowState{AppName: "Safari"}, false},
+		{WindowState{AppName: "Code", BundleID: "com.microsoft.VSCode"}, WindowState{AppName: "Visual Studio Code", BundleID: "com.microsoft.VSCode"}, true},
+		{WindowState{AppName: "Code", BundleID: "com.microsoft.VSCode"}, WindowState{AppName: "Code", BundleID: "com.example.Code"}, false},
+		{WindowState{AppName: "Code", BundleID: "com.microsoft.VSCode"}, WindowState{AppName: "Code"}, true},
+	}
+	for _, test := range tests {
+		if got := sameApp(test.a, test.b); got != test.want {
+			t.Errorf("sameApp(%+v, %+v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
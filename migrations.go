@@ -0,0 +1,462 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// migration is one step in the evolution of the schema. Migrations run in
+// order, each in its own transaction, and are recorded in schema_version so
+// they run once per database.
+type migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *sql.Tx) error
+}
+
+// Migrations in the order they are applied. Add new ones at the end with
+// the next version, never change one that has shipped.
+var migrations = []migration{
+	{1, "create tables", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS profiles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE
+		);
+		CREATE TABLE IF NOT EXISTS window_states (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id INTEGER NOT NULL,
+			app_name TEXT NOT NULL,
+			window_title TEXT NOT NULL,
+			x REAL NOT NULL,
+			y REAL NOT NULL,
+			width REAL NOT NULL,
+			height REAL NOT NULL,
+			FOREIGN KEY (profile_id) REFERENCES profiles(id)
+		);
+		CREATE TABLE IF NOT EXISTS app_quirks (
+			app_name TEXT PRIMARY KEY,
+			activate_first INTEGER NOT NULL DEFAULT 0,
+			extra_delay_ms INTEGER NOT NULL DEFAULT 0,
+			ignores_size INTEGER NOT NULL DEFAULT 0
+		);
+		CREATE TABLE IF NOT EXISTS triggers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			spec TEXT NOT NULL,
+			profile_id INTEGER NOT NULL,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			FOREIGN KEY (profile_id) REFERENCES profiles(id)
+		);
+		CREATE TABLE IF NOT EXISTS profile_actions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			value TEXT NOT NULL,
+			FOREIGN KEY (profile_id) REFERENCES profiles(id)
+		);
+		CREATE TABLE IF NOT EXISTS settings (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			scope TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS window_excludes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id INTEGER,
+			app_name TEXT NOT NULL,
+			window_title TEXT NOT NULL,
+			FOREIGN KEY (profile_id) REFERENCES profiles(id)
+		);
+		`)
+		return err
+	}},
+	// Databases from before migrations may have any of these already
+	{2, "add columns from before versioned migrations", func(tx *sql.Tx) error {
+		columns := []struct{ table, column, definition string }{
+			{"window_states", "display_id", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "display_x", "REAL NOT NULL DEFAULT 0"},
+			{"window_states", "display_y", "REAL NOT NULL DEFAULT 0"},
+			{"window_states", "role", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "arrangement", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "minimized", "INTEGER NOT NULL DEFAULT 0"},
+			{"window_states", "fullscreen", "INTEGER NOT NULL DEFAULT 0"},
+			{"window_states", "z_order", "INTEGER NOT NULL DEFAULT 0"},
+			{"window_states", "space", "INTEGER NOT NULL DEFAULT 0"},
+			{"window_states", "bundle_id", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "title_match", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "title_pattern", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "app_index", "INTEGER NOT NULL DEFAULT 0"},
+			{"triggers", "quiet_start", "TEXT NOT NULL DEFAULT ''"},
+			{"triggers", "quiet_end", "TEXT NOT NULL DEFAULT ''"},
+			{"window_states", "uid", "TEXT NOT NULL DEFAULT ''"},
+			{"profiles", "owner", "TEXT NOT NULL DEFAULT ''"},
+			{"profiles", "shared", "INTEGER NOT NULL DEFAULT 0"},
+			{"profiles", "include_filter", "TEXT NOT NULL DEFAULT ''"},
+			{"profiles", "launch_missing", "INTEGER NOT NULL DEFAULT 0"},
+			{"profiles", "other_apps", "TEXT NOT NULL DEFAULT ''"},
+		}
+		for _, c := range columns {
+			if err := addColumnIfMissing(tx, c.table, c.column, c.definition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{3, "add deleted_at to profiles", func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "profiles", "deleted_at", "TIMESTAMP")
+	}},
+	{4, "create restore_journal", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS restore_journal (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_name TEXT NOT NULL,
+			started_at TIMESTAMP NOT NULL,
+			finished_at TIMESTAMP,
+			targets TEXT NOT NULL,
+			before TEXT NOT NULL
+		);
+		`)
+		return err
+	}},
+	{5, "create profile_snapshots", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS profile_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id INTEGER NOT NULL,
+			version INTEGER NOT NULL,
+			arrangement TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL,
+			states TEXT NOT NULL,
+			FOREIGN KEY (profile_id) REFERENCES profiles(id)
+		);
+		`)
+		return err
+	}},
+	{6, "add revision to profiles", func(tx *sql.Tx) error {
+		return addColumnIfMissing(tx, "profiles", "revision", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{7, "add updated_at to profiles and index window_states", func(tx *sql.Tx) error {
+		if err := addColumnIfMissing(tx, "profiles", "updated_at", "TIMESTAMP"); err != nil {
+			return err
+		}
+		// The history knows when profiles saved since it was added changed
+		_, err := tx.Exec(`
+		UPDATE profiles SET updated_at = (SELECT MAX(created_at) FROM profile_snapshots WHERE profile_id = profiles.id);
+		CREATE INDEX IF NOT EXISTS window_states_profile ON window_states (profile_id, arrangement);
+		CREATE INDEX IF NOT EXISTS window_states_app ON window_states (app_name COLLATE NOCASE);
+		`)
+		return err
+	}},
+	{8, "make profile names unique ignoring case", func(tx *sql.Tx) error {
+		if err := canonicalizeProfileNames(tx); err != nil {
+			return err
+		}
+
+		// The collation can only be changed by rebuilding the table, the
+		// other tables keep pointing at it by id
+		var definition string
+		if err := tx.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'profiles'").Scan(&definition); err != nil {
+			return err
+		}
+		const nameColumn = "name TEXT NOT NULL UNIQUE"
+		if !strings.Contains(definition, nameColumn) || !strings.HasPrefix(definition, "CREATE TABLE profiles") {
+			return fmt.Errorf("unexpected profiles table: %s", definition)
+		}
+		definition = strings.Replace(definition, nameColumn, nameColumn+" COLLATE NOCASE", 1)
+		definition = strings.Replace(definition, "CREATE TABLE profiles", "CREATE TABLE profiles_new", 1)
+		_, err := tx.Exec(definition + `;
+		INSERT INTO profiles_new SELECT * FROM profiles;
+		DROP TABLE profiles;
+		ALTER TABLE profiles_new RENAME TO profiles;
+		`)
+		return err
+	}},
+	{9, "create profile_hooks", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS profile_hooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_id INTEGER NOT NULL,
+			stage TEXT NOT NULL,
+			command TEXT NOT NULL,
+			timeout_seconds INTEGER NOT NULL,
+			last_run_at TIMESTAMP,
+			last_status TEXT NOT NULL DEFAULT '',
+			last_output TEXT NOT NULL DEFAULT '',
+			FOREIGN KEY (profile_id) REFERENCES profiles(id)
+		);
+		`)
+		return err
+	}},
+	{10, "create restore_stats", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS restore_stats (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			profile_name TEXT NOT NULL,
+			finished_at TIMESTAMP NOT NULL,
+			windows INTEGER NOT NULL,
+			launches INTEGER NOT NULL,
+			launch_ms INTEGER NOT NULL,
+			move_ms INTEGER NOT NULL,
+			total_ms INTEGER NOT NULL
+		);
+		`)
+		return err
+	}},
+	{11, "create activity_log", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS activity_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			at TIMESTAMP NOT NULL,
+			kind TEXT NOT NULL,
+			profile_name TEXT NOT NULL,
+			source TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT ''
+		);
+		`)
+		return err
+	}},
+	{12, "add display sizes and scale_to_display", func(tx *sql.Tx) error {
+		columns := []struct{ table, column, definition string }{
+			{"window_states", "display_width", "REAL NOT NULL DEFAULT 0"},
+			{"window_states", "display_height", "REAL NOT NULL DEFAULT 0"},
+			{"profiles", "scale_to_display", "INTEGER NOT NULL DEFAULT 0"},
+		}
+		for _, c := range columns {
+			if err := addColumnIfMissing(tx, c.table, c.column, c.definition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{13, "add hook failure policies to profiles", func(tx *sql.Tx) error {
+		if err := addColumnIfMissing(tx, "profiles", "before_hooks_abort", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+			return err
+		}
+		return addColumnIfMissing(tx, "profiles", "after_hooks_fatal", "INTEGER NOT NULL DEFAULT 0")
+	}},
+	{14, "create profile_usage and title_changes", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS profile_usage (
+			profile_name TEXT PRIMARY KEY,
+			restores INTEGER NOT NULL DEFAULT 0,
+			failed_restores INTEGER NOT NULL DEFAULT 0,
+			last_restored_at TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS title_changes (
+			app_name TEXT PRIMARY KEY,
+			changes INTEGER NOT NULL DEFAULT 0,
+			last_changed_at TIMESTAMP NOT NULL
+		);
+		`)
+		if err != nil {
+			return err
+		}
+		// Start from the restores still in the activity log
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO profile_usage (profile_name, restores, failed_restores, last_restored_at)
+		SELECT profile_name, COUNT(*), SUM(error != ''), MAX(at) FROM activity_log
+		WHERE kind = 'restore' GROUP BY profile_name
+		`)
+		return err
+	}},
+	{15, "add archived_at to profiles and create display_sightings", func(tx *sql.Tx) error {
+		if err := addColumnIfMissing(tx, "profiles", "archived_at", "TIMESTAMP"); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS display_sightings (
+			display_id TEXT PRIMARY KEY,
+			last_seen_at TIMESTAMP NOT NULL
+		);
+		`)
+		if err != nil {
+			return err
+		}
+		// Displays already in profiles count as seen now, so they only go
+		// stale once they've been away for a while from here on
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO display_sightings (display_id, last_seen_at)
+		SELECT DISTINCT display_id, ? FROM window_states WHERE display_id != ''
+		`, time.Now())
+		return err
+	}},
+}
+
+// Stores every profile name in its canonical form, numbering the ones that
+// would then clash like "Work (2)"
+func canonicalizeProfileNames(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, name FROM profiles ORDER BY id")
+	if err != nil {
+		return err
+	}
+	type profile struct {
+		id   int
+		name string
+	}
+	var profiles []profile
+	for rows.Next() {
+		var p profile
+		if err := rows.Scan(&p.id, &p.name); err != nil {
+			rows.Close()
+			return err
+		}
+		profiles = append(profiles, p)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	// Names that are already canonical and unique stay as they are
+	taken := make(map[string]bool)
+	kept := make(map[int]bool)
+	for _, p := range profiles {
+		if p.name == canonicalProfileName(p.name) && !taken[strings.ToLower(p.name)] {
+			taken[strings.ToLower(p.name)] = true
+			kept[p.id] = true
+		}
+	}
+
+	var renamed []profile
+	for _, p := range profiles {
+		if kept[p.id] {
+			continue
+		}
+		name := canonicalProfileName(p.name)
+		for i := 2; taken[strings.ToLower(name)]; i++ {
+			name = fmt.Sprintf("%s (%d)", canonicalProfileName(p.name), i)
+		}
+		taken[strings.ToLower(name)] = true
+		log.Printf("Renaming profile '%s' to '%s'", p.name, name)
+		renamed = append(renamed, profile{p.id, name})
+	}
+
+	// Move the renamed profiles out of the way first so they can swap names
+	for _, p := range renamed {
+		if _, err := tx.Exec("UPDATE profiles SET name = ? WHERE id = ?", fmt.Sprintf("\x00renaming %d", p.id), p.id); err != nil {
+			return err
+		}
+	}
+	for _, p := range renamed {
+		if _, err := tx.Exec("UPDATE profiles SET name = ? WHERE id = ?", p.name, p.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Gets the newest migration applied to the database, 0 for a new one
+func schemaVersion(db *sql.DB) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return 0, fmt.Errorf("error creating schema_version: %v", err)
+	}
+
+	var version int
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error reading schema version: %v", err)
+	}
+	return version, nil
+}
+
+// Applies the migrations the database doesn't have yet
+func migrateDB(db *sql.DB) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].Version
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than this version of wisa supports (%d)", version, latest)
+	}
+	if version == latest {
+		return nil
+	}
+
+	// Keep a copy of databases that already have profiles in case a
+	// migration goes wrong
+	var tables int
+	db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'profiles'").Scan(&tables)
+	if tables > 0 {
+		autoBackup(db, fmt.Sprintf("migrate-v%d", version))
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %v", err)
+		}
+		if err := m.Apply(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d (%s): %v", m.Version, m.Description, err)
+		}
+		_, err = tx.Exec("INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Description, time.Now())
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error recording migration %d: %v", m.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %d: %v", m.Version, err)
+		}
+		log.Printf("Applied database migration %d: %s", m.Version, m.Description)
+	}
+	return nil
+}
+
+// Adds a column to an existing table unless it's already there
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("error reading columns of %s: %v", table, err)
+	}
+
+	found := false
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		if name == column {
+			found = true
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("error iterating rows: %v", err)
+	}
+	if found {
+		return nil
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("error adding column %s.%s: %v", table, column, err)
+	}
+	return nil
+}
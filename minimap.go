@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"image/color"
+	"math"
+	"sort"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Colors the windows of different apps are drawn in, picked by app name
+var mapWindowColors = []color.NRGBA{
+	{R: 0x42, G: 0x85, B: 0xf4, A: 0x99},
+	{R: 0xea, G: 0x43, B: 0x35, A: 0x99},
+	{R: 0xfb, G: 0xbc, B: 0x05, A: 0x99},
+	{R: 0x34, G: 0xa8, B: 0x53, A: 0x99},
+	{R: 0xab, G: 0x47, B: 0xbc, A: 0x99},
+	{R: 0x00, G: 0xac, B: 0xc1, A: 0x99},
+	{R: 0xff, G: 0x70, B: 0x43, A: 0x99},
+	{R: 0x9e, G: 0x9d, B: 0x24, A: 0x99},
+}
+
+// Space kept around the drawing
+const mapPadding = 8
+
+// Size of the corner that resizes a window on the map instead of moving it
+const mapHandleSize = 8
+
+// Smallest width or height a window can be resized to on the map
+const mapMinWindowSize = 50
+
+func mapWindowColor(appName string) color.NRGBA {
+	hash := fnv.New32a()
+	hash.Write([]byte(appName))
+	return mapWindowColors[hash.Sum32()%uint32(len(mapWindowColors))]
+}
+
+// layoutMap draws a profile's windows as colored rectangles on a scaled down
+// picture of the connected displays, showing where a restore would put them.
+// Saved windows can be dragged to move them and resized from their bottom
+// right corner.
+type layoutMap struct {
+	widget.BaseWidget
+	displays []Display
+	windows  []*mapWindow
+
+	// OnMoved is called with the saved state of a window after it was
+	// dragged or resized, nil leaves the map read only
+	OnMoved func(state WindowState)
+}
+
+func newLayoutMap() *layoutMap {
+	m := &layoutMap{}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+// Shows where the states land on the displays, which may be empty when the
+// backend can't list them
+func (m *layoutMap) SetWindows(displays []Display, states []WindowState) {
+	placed := placeOnDisplays(states, displays)
+	windows := make([]*mapWindow, len(placed))
+	for i := range placed {
+		windows[i] = newMapWindow(m, placed[i])
+		// Remember how far the display moved the window, to save the
+		// edited position where it was saved
+		windows[i].shiftX = placed[i].X - states[i].X
+		windows[i].shiftY = placed[i].Y - states[i].Y
+	}
+	// Drawn back to front so the frontmost window ends up on top
+	sort.SliceStable(windows, func(i, j int) bool {
+		return windows[i].state.ZOrder > windows[j].state.ZOrder
+	})
+	m.displays = displays
+	m.windows = windows
+	m.Refresh()
+}
+
+// The area of the screen covered by the displays and windows
+func (m *layoutMap) bounds() (minX, minY, maxX, maxY float64) {
+	minX, minY = math.Inf(1), math.Inf(1)
+	maxX, maxY = math.Inf(-1), math.Inf(-1)
+	extend := func(x, y, width, height float64) {
+		minX, minY = math.Min(minX, x), math.Min(minY, y)
+		maxX, maxY = math.Max(maxX, x+width), math.Max(maxY, y+height)
+	}
+	for _, display := range m.displays {
+		extend(display.X, display.Y, display.Width, display.Height)
+	}
+	for _, window := range m.windows {
+		extend(window.state.X, window.state.Y, window.state.Width, window.state.Height)
+	}
+	return minX, minY, maxX, maxY
+}
+
+// mapTransform maps screen coordinates onto the map
+type mapTransform struct {
+	scale      float64
+	minX, minY float64
+	offset     fyne.Position
+}
+
+func (t mapTransform) place(x, y float64) fyne.Position {
+	return t.offset.Add(fyne.NewPos(float32((x-t.minX)*t.scale), float32((y-t.minY)*t.scale)))
+}
+
+// Gets the transform that fits the screen area into size, its scale is 0
+// when there's nothing to draw
+func (m *layoutMap) transform(size fyne.Size) mapTransform {
+	minX, minY, maxX, maxY := m.bounds()
+	if maxX <= minX || maxY <= minY {
+		return mapTransform{}
+	}
+	width := float64(size.Width) - 2*mapPadding
+	height := float64(size.Height) - 2*mapPadding
+	scale := math.Min(width/(maxX-minX), height/(maxY-minY))
+	if scale <= 0 {
+		return mapTransform{}
+	}
+	// Centered in the free space
+	offset := fyne.NewPos(
+		float32((float64(size.Width)-(maxX-minX)*scale)/2),
+		float32((float64(size.Height)-(maxY-minY)*scale)/2),
+	)
+	return mapTransform{scale: scale, minX: minX, minY: minY, offset: offset}
+}
+
+func (m *layoutMap) MinSize() fyne.Size {
+	return fyne.NewSize(200, 120)
+}
+
+func (m *layoutMap) CreateRenderer() fyne.WidgetRenderer {
+	r := &layoutMapRenderer{m: m}
+	r.rebuild()
+	return r
+}
+
+type layoutMapRenderer struct {
+	m        *layoutMap
+	displays []*canvas.Rectangle
+	labels   []*canvas.Text
+	empty    *canvas.Text
+	objects  []fyne.CanvasObject
+}
+
+func (r *layoutMapRenderer) rebuild() {
+	r.displays = nil
+	r.labels = nil
+	r.objects = nil
+	for _, display := range r.m.displays {
+		rect := canvas.NewRectangle(theme.InputBackgroundColor())
+		rect.StrokeColor = theme.ForegroundColor()
+		rect.StrokeWidth = 1
+		label := canvas.NewText(fmt.Sprintf("Display %d", display.Index+1), theme.DisabledColor())
+		label.TextSize = theme.CaptionTextSize()
+		r.displays = append(r.displays, rect)
+		r.labels = append(r.labels, label)
+		r.objects = append(r.objects, rect, label)
+	}
+	for _, window := range r.m.windows {
+		r.objects = append(r.objects, window)
+	}
+	r.empty = canvas.NewText("No windows to show", theme.DisabledColor())
+	r.empty.Alignment = fyne.TextAlignCenter
+	r.empty.Hidden = len(r.m.windows) > 0
+	r.objects = append(r.objects, r.empty)
+}
+
+func (r *layoutMapRenderer) Layout(size fyne.Size) {
+	r.empty.Resize(size)
+	r.empty.Move(fyne.NewPos(0, size.Height/2-r.empty.MinSize().Height/2))
+
+	transform := r.m.transform(size)
+	place := func(object fyne.CanvasObject, x, y, width, height float64) {
+		object.Move(transform.place(x, y))
+		object.Resize(fyne.NewSize(float32(width*transform.scale), float32(height*transform.scale)))
+	}
+	for i, display := range r.m.displays {
+		place(r.displays[i], display.X, display.Y, display.Width, display.Height)
+		r.labels[i].Move(r.displays[i].Position().Add(fyne.NewPos(4, 2)))
+	}
+	for _, window := range r.m.windows {
+		place(window, window.state.X, window.state.Y, window.state.Width, window.state.Height)
+	}
+}
+
+func (r *layoutMapRenderer) MinSize() fyne.Size {
+	return r.m.MinSize()
+}
+
+func (r *layoutMapRenderer) Refresh() {
+	r.rebuild()
+	r.Layout(r.m.Size())
+	canvas.Refresh(r.m)
+}
+
+func (r *layoutMapRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *layoutMapRenderer) Destroy() {}
+
+// mapWindow is one window drawn on the layout map
+type mapWindow struct {
+	widget.BaseWidget
+	m *layoutMap
+	// Where the window lands on the connected displays
+	state WindowState
+	// How far that is from where it was saved
+	shiftX, shiftY float64
+
+	// Set while the window is dragged, scale is fixed for the whole drag
+	dragging  bool
+	resizing  bool
+	dragScale float64
+}
+
+func newMapWindow(m *layoutMap, state WindowState) *mapWindow {
+	w := &mapWindow{m: m, state: state}
+	w.ExtendBaseWidget(w)
+	return w
+}
+
+// Live captures aren't in the database, so only saved windows can be edited
+func (w *mapWindow) editable() bool {
+	return w.state.ID != 0 && w.m.OnMoved != nil
+}
+
+func (w *mapWindow) Dragged(event *fyne.DragEvent) {
+	if !w.dragging {
+		scale := w.m.transform(w.m.Size())
+		if !w.editable() || scale.scale <= 0 {
+			return
+		}
+		w.dragging = true
+		w.dragScale = scale.scale
+		start := event.Position.Subtract(event.Dragged)
+		size := w.Size()
+		w.resizing = start.X >= size.Width-mapHandleSize && start.Y >= size.Height-mapHandleSize
+	}
+
+	dx := float64(event.Dragged.DX) / w.dragScale
+	dy := float64(event.Dragged.DY) / w.dragScale
+	if w.resizing {
+		w.state.Width = math.Max(mapMinWindowSize, w.state.Width+dx)
+		w.state.Height = math.Max(mapMinWindowSize, w.state.Height+dy)
+		w.Resize(fyne.NewSize(float32(w.state.Width*w.dragScale), float32(w.state.Height*w.dragScale)))
+		return
+	}
+	w.state.X += dx
+	w.state.Y += dy
+	w.Move(w.Position().Add(event.Dragged))
+}
+
+func (w *mapWindow) DragEnd() {
+	if !w.dragging {
+		return
+	}
+	w.dragging = false
+
+	w.state.X = math.Round(w.state.X)
+	w.state.Y = math.Round(w.state.Y)
+	w.state.Width = math.Round(w.state.Width)
+	w.state.Height = math.Round(w.state.Height)
+	saved := w.state
+	saved.X -= w.shiftX
+	saved.Y -= w.shiftY
+	saved.DisplayX -= w.shiftX
+	saved.DisplayY -= w.shiftY
+
+	// The drawing may need to grow to fit where the window went
+	w.m.Refresh()
+	w.m.OnMoved(saved)
+}
+
+func (w *mapWindow) CreateRenderer() fyne.WidgetRenderer {
+	fill := mapWindowColor(w.state.AppName)
+	rect := canvas.NewRectangle(fill)
+	fill.A = 0xff
+	rect.StrokeColor = fill
+	rect.StrokeWidth = 1
+	label := canvas.NewText(w.state.AppName, theme.ForegroundColor())
+	label.TextSize = theme.CaptionTextSize()
+	handle := canvas.NewRectangle(fill)
+	handle.Hidden = !w.editable()
+	return &mapWindowRenderer{w: w, rect: rect, label: label, handle: handle}
+}
+
+type mapWindowRenderer struct {
+	w      *mapWindow
+	rect   *canvas.Rectangle
+	label  *canvas.Text
+	handle *canvas.Rectangle
+}
+
+func (r *mapWindowRenderer) Layout(size fyne.Size) {
+	r.rect.Resize(size)
+	r.handle.Resize(fyne.NewSize(mapHandleSize, mapHandleSize))
+	r.handle.Move(fyne.NewPos(size.Width-mapHandleSize, size.Height-mapHandleSize))
+	r.label.Move(fyne.NewPos(3, 1))
+	// Names that don't fit are left out rather than spill over
+	r.label.Hidden = r.label.MinSize().Width > size.Width-6 || r.label.MinSize().Height > size.Height-2
+}
+
+func (r *mapWindowRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(1, 1)
+}
+
+func (r *mapWindowRenderer) Refresh() {
+	r.label.Text = r.w.state.AppName
+	r.Layout(r.w.Size())
+	canvas.Refresh(r.w)
+}
+
+func (r *mapWindowRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.rect, r.label, r.handle}
+}
+
+func (r *mapWindowRenderer) Destroy() {}
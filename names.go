@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Gets the form a profile name is stored in: trimmed, with runs of spaces
+// collapsed. Names are unique ignoring case, see migration 8.
+func canonicalProfileName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Checks that a profile name in its canonical form can be stored, shown in
+// the profile list and used as a file name when exporting
+func validateProfileName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("profile name can't be empty")
+	case name == "." || name == "..":
+		return fmt.Errorf("'%s' can't be used as a profile name", name)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("profile name '%s' can't contain / or \\", name)
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return fmt.Errorf("profile name %q can't contain control characters", name)
+	}
+	return nil
+}
+
+// Gets the canonical form of a profile name for saving it, or why it can't
+// be used
+func cleanProfileName(name string) (string, error) {
+	name = canonicalProfileName(name)
+	return name, validateProfileName(name)
+}
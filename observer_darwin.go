@@ -0,0 +1,341 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework CoreGraphics -framework ApplicationServices
+#include <ApplicationServices/ApplicationServices.h>
+#include <stdlib.h>
+#include <errno.h>
+#include <signal.h>
+#include <string.h>
+#include <unistd.h>
+
+enum {
+	WISA_CREATED = 1,
+	WISA_MOVED,
+	WISA_RESIZED,
+	WISA_DESTROYED,
+	WISA_RETITLED,
+	WISA_MINIMIZED,
+	WISA_DEMINIMIZED
+};
+
+typedef struct {
+	int kind;
+	char *app;
+	char *title;
+} wisa_event;
+
+typedef struct {
+	pid_t pid;
+	char *app;
+	AXObserverRef observer;
+} wisa_observed;
+
+// Events waiting to be picked up by Go, dropped past the limit if nobody
+// picks them up
+static wisa_event *wisa_events;
+static int wisa_event_count, wisa_event_capacity;
+static const int wisa_event_limit = 4096;
+
+static wisa_observed *wisa_apps;
+static int wisa_app_count, wisa_app_capacity;
+
+static char *wisa_observer_string(CFTypeRef value) {
+	if (value == NULL || CFGetTypeID(value) != CFStringGetTypeID()) {
+		return strdup("");
+	}
+	CFStringRef str = (CFStringRef)value;
+	CFIndex size = CFStringGetMaximumSizeForEncoding(CFStringGetLength(str), kCFStringEncodingUTF8) + 1;
+	char *buf = malloc(size);
+	if (!CFStringGetCString(str, buf, size, kCFStringEncodingUTF8)) {
+		buf[0] = 0;
+	}
+	return buf;
+}
+
+static const char *wisa_app_name(pid_t pid) {
+	for (int i = 0; i < wisa_app_count; i++) {
+		if (wisa_apps[i].pid == pid) {
+			return wisa_apps[i].app;
+		}
+	}
+	return "";
+}
+
+static void wisa_observer_callback(AXObserverRef observer, AXUIElementRef element, CFStringRef notification, void *refcon) {
+	int kind;
+	if (CFEqual(notification, kAXWindowCreatedNotification)) {
+		kind = WISA_CREATED;
+		// Destroyed notifications are only sent for elements that asked
+		AXObserverAddNotification(observer, element, kAXUIElementDestroyedNotification, refcon);
+	} else if (CFEqual(notification, kAXWindowMovedNotification)) {
+		kind = WISA_MOVED;
+	} else if (CFEqual(notification, kAXWindowResizedNotification)) {
+		kind = WISA_RESIZED;
+	} else if (CFEqual(notification, kAXUIElementDestroyedNotification)) {
+		kind = WISA_DESTROYED;
+	} else if (CFEqual(notification, kAXTitleChangedNotification)) {
+		// Sent for every element of the app with a title, only windows count
+		CFTypeRef role = NULL;
+		AXUIElementCopyAttributeValue(element, kAXRoleAttribute, &role);
+		int window = role != NULL && CFGetTypeID(role) == CFStringGetTypeID() && CFEqual(role, kAXWindowRole);
+		if (role != NULL) {
+			CFRelease(role);
+		}
+		if (!window) {
+			return;
+		}
+		kind = WISA_RETITLED;
+	} else if (CFEqual(notification, kAXWindowMiniaturizedNotification)) {
+		kind = WISA_MINIMIZED;
+	} else if (CFEqual(notification, kAXWindowDeminiaturizedNotification)) {
+		kind = WISA_DEMINIMIZED;
+	} else {
+		return;
+	}
+
+	if (wisa_event_count == wisa_event_limit) {
+		return;
+	}
+	if (wisa_event_count == wisa_event_capacity) {
+		wisa_event_capacity = wisa_event_capacity ? wisa_event_capacity * 2 : 64;
+		wisa_events = realloc(wisa_events, wisa_event_capacity * sizeof(wisa_event));
+	}
+
+	// Destroyed windows can't be asked for their title anymore
+	CFTypeRef title = NULL;
+	if (kind != WISA_DESTROYED) {
+		AXUIElementCopyAttributeValue(element, kAXTitleAttribute, &title);
+	}
+	wisa_event *event = &wisa_events[wisa_event_count++];
+	event->kind = kind;
+	event->app = strdup(wisa_app_name((pid_t)(intptr_t)refcon));
+	event->title = wisa_observer_string(title);
+	if (title != NULL) {
+		CFRelease(title);
+	}
+}
+
+// Stops observing the app at index i and forgets it
+static void wisa_forget_app(int i) {
+	if (wisa_apps[i].observer != NULL) {
+		CFRunLoopRemoveSource(CFRunLoopGetCurrent(), AXObserverGetRunLoopSource(wisa_apps[i].observer), kCFRunLoopDefaultMode);
+		CFRelease(wisa_apps[i].observer);
+	}
+	free(wisa_apps[i].app);
+	wisa_apps[i] = wisa_apps[--wisa_app_count];
+}
+
+// Forgets the apps that have quit, so their observers don't pile up and a
+// new app given the same pid gets observed
+static void wisa_forget_quit_apps(void) {
+	for (int i = wisa_app_count - 1; i >= 0; i--) {
+		if (kill(wisa_apps[i].pid, 0) == -1 && errno == ESRCH) {
+			wisa_forget_app(i);
+		}
+	}
+}
+
+// Adds observers for the windows of one app to the current thread's run loop
+static void wisa_observe_app(pid_t pid, CFTypeRef owner) {
+	char *name = wisa_observer_string(owner);
+	for (int i = 0; i < wisa_app_count; i++) {
+		if (wisa_apps[i].pid != pid) {
+			continue;
+		}
+		// The same pid under another name is a new app that reused it
+		if (strcmp(wisa_apps[i].app, name) == 0) {
+			free(name);
+			return;
+		}
+		wisa_forget_app(i);
+		break;
+	}
+	if (wisa_app_count == wisa_app_capacity) {
+		wisa_app_capacity = wisa_app_capacity ? wisa_app_capacity * 2 : 32;
+		wisa_apps = realloc(wisa_apps, wisa_app_capacity * sizeof(wisa_observed));
+	}
+	wisa_observed *observed = &wisa_apps[wisa_app_count++];
+	observed->pid = pid;
+	observed->app = name;
+	observed->observer = NULL;
+
+	// Apps that can't be observed are remembered so they aren't tried again
+	AXObserverRef observer = NULL;
+	if (AXObserverCreate(pid, wisa_observer_callback, &observer) != kAXErrorSuccess) {
+		return;
+	}
+	observed->observer = observer;
+
+	void *refcon = (void *)(intptr_t)pid;
+	AXUIElementRef app = AXUIElementCreateApplication(pid);
+	AXObserverAddNotification(observer, app, kAXWindowCreatedNotification, refcon);
+	AXObserverAddNotification(observer, app, kAXWindowMovedNotification, refcon);
+	AXObserverAddNotification(observer, app, kAXWindowResizedNotification, refcon);
+	AXObserverAddNotification(observer, app, kAXTitleChangedNotification, refcon);
+	AXObserverAddNotification(observer, app, kAXWindowMiniaturizedNotification, refcon);
+	AXObserverAddNotification(observer, app, kAXWindowDeminiaturizedNotification, refcon);
+
+	CFArrayRef windows = NULL;
+	if (AXUIElementCopyAttributeValue(app, kAXWindowsAttribute, (CFTypeRef *)&windows) == kAXErrorSuccess && windows != NULL) {
+		for (CFIndex i = 0; i < CFArrayGetCount(windows); i++) {
+			AXUIElementRef window = (AXUIElementRef)CFArrayGetValueAtIndex(windows, i);
+			AXObserverAddNotification(observer, window, kAXUIElementDestroyedNotification, refcon);
+		}
+		CFRelease(windows);
+	}
+	CFRelease(app);
+
+	CFRunLoopAddSource(CFRunLoopGetCurrent(), AXObserverGetRunLoopSource(observer), kCFRunLoopDefaultMode);
+}
+
+// Starts observing the apps with windows that aren't observed yet
+static void wisa_observe_new_apps(void) {
+	wisa_forget_quit_apps();
+
+	CFArrayRef info = CGWindowListCopyWindowInfo(kCGWindowListOptionAll | kCGWindowListExcludeDesktopElements, kCGNullWindowID);
+	if (info == NULL) {
+		return;
+	}
+	for (CFIndex i = 0; i < CFArrayGetCount(info); i++) {
+		CFDictionaryRef dict = (CFDictionaryRef)CFArrayGetValueAtIndex(info, i);
+		int layer = 0, pid = 0;
+		CFNumberRef number = (CFNumberRef)CFDictionaryGetValue(dict, kCGWindowLayer);
+		if (number != NULL) {
+			CFNumberGetValue(number, kCFNumberIntType, &layer);
+		}
+		number = (CFNumberRef)CFDictionaryGetValue(dict, kCGWindowOwnerPID);
+		if (number != NULL) {
+			CFNumberGetValue(number, kCFNumberIntType, &pid);
+		}
+		if (layer == 0 && pid != 0) {
+			wisa_observe_app(pid, CFDictionaryGetValue(dict, kCGWindowOwnerName));
+		}
+	}
+	CFRelease(info);
+}
+
+// Runs the observers for up to seconds, sleeping instead when there are none
+// since the run loop returns right away without sources
+static void wisa_run_observers(double seconds) {
+	if (CFRunLoopRunInMode(kCFRunLoopDefaultMode, seconds, false) == kCFRunLoopRunFinished) {
+		usleep((useconds_t)(seconds * 1000000));
+	}
+}
+
+static int wisa_take_events(wisa_event **out) {
+	int count = wisa_event_count;
+	*out = wisa_events;
+	wisa_events = NULL;
+	wisa_event_count = wisa_event_capacity = 0;
+	return count;
+}
+
+static void wisa_free_events(wisa_event *events, int count) {
+	for (int i = 0; i < count; i++) {
+		free(events[i].app);
+		free(events[i].title);
+	}
+	free(events);
+}
+
+static void wisa_stop_observing(void) {
+	while (wisa_app_count > 0) {
+		wisa_forget_app(wisa_app_count - 1);
+	}
+	free(wisa_apps);
+	wisa_apps = NULL;
+	wisa_app_count = wisa_app_capacity = 0;
+
+	wisa_event *events;
+	int count = wisa_take_events(&events);
+	wisa_free_events(events, count);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+var eventKinds = map[C.int]string{
+	C.WISA_CREATED:   windowCreated,
+	C.WISA_MOVED:     windowMoved,
+	C.WISA_RESIZED:   windowResized,
+	C.WISA_DESTROYED: windowDestroyed,
+	C.WISA_RETITLED:  windowRetitled,
+	C.WISA_MINIMIZED: windowMinimized,
+	// Brought back from the Dock, reported like any other move
+	C.WISA_DEMINIMIZED: windowMoved,
+}
+
+// The observers live in C globals, so only one watch can run at a time
+var (
+	watchMu  sync.Mutex
+	watching bool
+)
+
+// Watches windows with Accessibility observers on a thread of their own,
+// since observers deliver their notifications through a run loop
+func watchNative(events chan<- WindowEvent, stop <-chan struct{}) error {
+	if C.AXIsProcessTrusted() == 0 {
+		return errors.New("watching windows needs accessibility access")
+	}
+
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if watching {
+		return errors.New("windows are already being watched")
+	}
+	watching = true
+
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		defer func() {
+			C.wisa_stop_observing()
+			watchMu.Lock()
+			watching = false
+			watchMu.Unlock()
+		}()
+
+		for {
+			// New apps are picked up each time around
+			C.wisa_observe_new_apps()
+			C.wisa_run_observers(1)
+
+			var list *C.wisa_event
+			count := int(C.wisa_take_events(&list))
+			var batch []WindowEvent
+			for _, event := range unsafe.Slice(list, count) {
+				batch = append(batch, WindowEvent{
+					Kind:        eventKinds[event.kind],
+					AppName:     C.GoString(event.app),
+					WindowTitle: C.GoString(event.title),
+				})
+			}
+			if count > 0 {
+				C.wisa_free_events(list, C.int(count))
+			}
+
+			for _, event := range batch {
+				select {
+				case events <- event:
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	return nil
+}
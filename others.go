@@ -0,0 +1,87 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// What happens to apps that aren't in a profile when it's restored
+const (
+	otherAppsLeave = ""
+	otherAppsHide  = "hide"
+	otherAppsQuit  = "quit"
+)
+
+// Labels for the other-apps modes in the UI, in display order
+var otherAppsLabels = []struct{ mode, label string }{
+	{otherAppsLeave, "Leave other apps"},
+	{otherAppsHide, "Hide other apps"},
+	{otherAppsQuit, "Quit other apps"},
+}
+
+// AppHider is implemented by backends that can hide or quit whole apps
+type AppHider interface {
+	HideApp(appName string) error
+	QuitApp(appName string) error
+}
+
+func getOtherAppsMode(db *sql.DB, profileName string) (string, error) {
+	var mode string
+	err := db.QueryRow("SELECT other_apps FROM profiles WHERE name = ?", profileName).Scan(&mode)
+	if err == sql.ErrNoRows {
+		return otherAppsLeave, nil
+	}
+	if err != nil {
+		return otherAppsLeave, fmt.Errorf("error reading profile: %v", err)
+	}
+	return mode, nil
+}
+
+func setOtherAppsMode(db *sql.DB, profileName, mode string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET other_apps = ? WHERE name = ?", mode, profileName)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+	return nil
+}
+
+// Hides or quits the apps with windows on screen that have none in states.
+// wisa itself is always left alone.
+func clearOtherApps(backend WindowBackend, states []WindowState, mode string) {
+	hider, ok := backend.(AppHider)
+	if !ok || mode == otherAppsLeave {
+		return
+	}
+
+	keep := make(map[string]bool)
+	for _, state := range states {
+		keep[state.AppName] = true
+	}
+	self := strings.TrimSuffix(filepath.Base(os.Args[0]), filepath.Ext(os.Args[0]))
+	keep[self] = true
+
+	done := make(map[string]bool)
+	for _, state := range captureStates(backend) {
+		if keep[state.AppName] || done[state.AppName] || state.Minimized {
+			continue
+		}
+		done[state.AppName] = true
+
+		var err error
+		if mode == otherAppsQuit {
+			err = hider.QuitApp(state.AppName)
+		} else {
+			err = hider.HideApp(state.AppName)
+		}
+		if err != nil {
+			log.Printf("Error clearing %s: %v", state.AppName, err)
+		}
+	}
+}
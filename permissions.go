@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How often the permissions are checked again while the window is open
+const permissionCheckInterval = 10 * time.Second
+
+type permissionState int
+
+const (
+	permissionUnknown permissionState = iota
+	permissionGranted
+	permissionDenied
+)
+
+// permissionStatus is whether wisa has one of the OS permissions it needs
+type permissionStatus struct {
+	Name  string
+	State permissionState
+	// What goes wrong without it
+	Why string
+	// How to grant it, and the settings page to do it in
+	Fix         string
+	SettingsURL string
+}
+
+// Short form for the status bar and tray, e.g. Accessibility ✓
+func (p permissionStatus) Label() string {
+	switch p.State {
+	case permissionGranted:
+		return p.Name + " ✓"
+	case permissionDenied:
+		return p.Name + " ✗"
+	}
+	return p.Name + " ?"
+}
+
+func describePermissions(statuses []permissionStatus) string {
+	labels := make([]string, len(statuses))
+	for i, status := range statuses {
+		labels[i] = status.Label()
+	}
+	return strings.Join(labels, " / ")
+}
+
+// Opens the settings page where a permission is granted
+func openPermissionSettings(status permissionStatus) {
+	if status.SettingsURL == "" {
+		return
+	}
+	link, err := url.Parse(status.SettingsURL)
+	if err != nil {
+		log.Printf("Error opening settings: %v", err)
+		return
+	}
+	if err := fyne.CurrentApp().OpenURL(link); err != nil {
+		log.Printf("Error opening settings: %v", err)
+	}
+}
+
+// Called with a permission macOS refused a script, set by the window
+var (
+	permissionRefusedMu sync.Mutex
+	onPermissionRefused func(permissionStatus)
+)
+
+// Lets the window know a script was refused a permission, from any goroutine
+func permissionRefused(status permissionStatus) {
+	permissionRefusedMu.Lock()
+	refused := onPermissionRefused
+	permissionRefusedMu.Unlock()
+	if refused != nil {
+		refused(status)
+	}
+}
+
+// permissionIndicator shows the permission state in the status bar and the
+// tray menu and checks it again every permissionCheckInterval
+type permissionIndicator struct {
+	button   *widget.Button
+	parent   fyne.Window
+	tray     *trayMenu
+	statuses []permissionStatus
+	// Permissions the guide was shown for, it's shown once per permission
+	guided map[string]bool
+}
+
+func newPermissionIndicator(parent fyne.Window, tray *trayMenu) *permissionIndicator {
+	p := &permissionIndicator{parent: parent, tray: tray, guided: make(map[string]bool)}
+	p.button = widget.NewButton("", p.showDetails)
+	p.button.Hide()
+	return p
+}
+
+// Checks the permissions now and then periodically, and guides the user
+// through granting one that a script was refused, or that's missing at start
+// when guide is set. Platforms without permissions to grant never show the
+// indicator.
+func (p *permissionIndicator) Start(guide bool) {
+	p.update(checkPermissions())
+	for _, status := range p.statuses {
+		if guide && status.State == permissionDenied {
+			p.showGuide(status)
+			break
+		}
+	}
+
+	permissionRefusedMu.Lock()
+	onPermissionRefused = func(status permissionStatus) {
+		serialUI(func() {
+			p.showGuide(status)
+		})
+	}
+	permissionRefusedMu.Unlock()
+
+	go func() {
+		for range time.Tick(permissionCheckInterval) {
+			statuses := checkPermissions()
+			serialUI(func() {
+				p.update(statuses)
+			})
+		}
+	}()
+}
+
+func (p *permissionIndicator) update(statuses []permissionStatus) {
+	changed := len(statuses) != len(p.statuses)
+	for i := 0; !changed && i < len(statuses); i++ {
+		changed = statuses[i].State != p.statuses[i].State
+	}
+	if !changed {
+		return
+	}
+	p.statuses = statuses
+	if len(statuses) == 0 {
+		p.button.Hide()
+		return
+	}
+
+	p.button.SetText(describePermissions(statuses))
+	p.button.Importance = widget.LowImportance
+	for _, status := range statuses {
+		if status.State != permissionGranted {
+			p.button.Importance = widget.WarningImportance
+		}
+	}
+	p.button.Show()
+	p.button.Refresh()
+	p.updateTray()
+}
+
+// Lists the permissions in the tray menu while one is missing, each opens
+// its settings page
+func (p *permissionIndicator) updateTray() {
+	missing := false
+	for _, status := range p.statuses {
+		missing = missing || status.State != permissionGranted
+	}
+	if !missing {
+		p.tray.SetPermissions(nil)
+		return
+	}
+
+	var items []*fyne.MenuItem
+	for _, status := range p.statuses {
+		items = append(items, fyne.NewMenuItem(status.Label(), func() {
+			openPermissionSettings(status)
+		}))
+	}
+	p.tray.SetPermissions(items)
+}
+
+// Walks through granting a missing permission, instead of leaving the user
+// wondering why no windows were found
+func (p *permissionIndicator) showGuide(status permissionStatus) {
+	if p.guided[status.Name] {
+		return
+	}
+	p.guided[status.Name] = true
+
+	intro := widget.NewLabel(fmt.Sprintf("wisa needs the %s permission. %s", status.Name, status.Why))
+	intro.Wrapping = fyne.TextWrapWord
+	steps := container.NewVBox(intro)
+	if status.SettingsURL != "" {
+		steps.Add(container.NewBorder(nil, nil, widget.NewLabel("1."), nil, widget.NewButton("Open Settings", func() {
+			openPermissionSettings(status)
+		})))
+	}
+	fix := widget.NewLabel("2. " + status.Fix)
+	fix.Wrapping = fyne.TextWrapWord
+	steps.Add(fix)
+
+	result := widget.NewLabel("")
+	result.Wrapping = fyne.TextWrapWord
+	var d *dialog.CustomDialog
+	check := widget.NewButton("3. Check Again", func() {
+		statuses := checkPermissions()
+		p.update(statuses)
+		for _, current := range statuses {
+			if current.Name != status.Name {
+				continue
+			}
+			if current.State == permissionGranted {
+				d.Hide()
+				return
+			}
+		}
+		result.SetText(fmt.Sprintf("%s isn't granted yet. If you just turned it on, restart wisa.", status.Name))
+	})
+	steps.Add(check)
+	steps.Add(result)
+
+	d = dialog.NewCustom("Permission Needed", "Later", steps, p.parent)
+	d.Resize(fyne.NewSize(480, 300))
+	d.Show()
+}
+
+// Explains each permission and how to grant the missing ones
+func (p *permissionIndicator) showDetails() {
+	rows := container.NewVBox()
+	for _, status := range p.statuses {
+		text := status.Label()
+		switch status.State {
+		case permissionGranted:
+			text += ", granted"
+		case permissionDenied:
+			text += ", not granted. " + status.Fix
+		default:
+			text += ", not known yet. " + status.Fix
+		}
+		label := widget.NewLabel(text)
+		label.Wrapping = fyne.TextWrapWord
+		row := container.NewBorder(nil, nil, nil, nil, label)
+		if status.State != permissionGranted && status.SettingsURL != "" {
+			row = container.NewBorder(nil, nil, nil, widget.NewButton("Open Settings", func() {
+				openPermissionSettings(status)
+			}), label)
+		}
+		rows.Add(row)
+	}
+	rows.Add(widget.NewLabel(fmt.Sprintf("Checked again every %v.", permissionCheckInterval)))
+
+	content := container.NewVScroll(rows)
+	content.SetMinSize(fyne.NewSize(460, 180))
+	dialog.ShowCustom("Permissions", "Close", content, p.parent)
+}
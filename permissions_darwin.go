@@ -0,0 +1,54 @@
+//go:build darwin
+
+package main
+
+import (
+	"log"
+	"strings"
+)
+
+// Accessibility lets wisa read and move other apps' windows, Automation lets
+// it script System Events for the fallbacks and environment actions
+func darwinPermissions(accessibility, automation permissionState) []permissionStatus {
+	return []permissionStatus{
+		{
+			Name:        "Accessibility",
+			State:       accessibility,
+			Why:         "Without it wisa can't read or move other apps' windows, so saves come out empty and restores move nothing.",
+			Fix:         "Turn on wisa in System Settings > Privacy & Security > Accessibility, then restart it.",
+			SettingsURL: "x-apple.systempreferences:com.apple.preference.security?Privacy_Accessibility",
+		},
+		{
+			Name:        "Automation",
+			State:       automation,
+			Why:         "Without it the scripts wisa runs through System Events fail, and with them capturing windows, moving them and environment actions.",
+			Fix:         "Allow wisa to control System Events in System Settings > Privacy & Security > Automation. macOS asks the first time wisa uses it.",
+			SettingsURL: "x-apple.systempreferences:com.apple.preference.security?Privacy_Automation",
+		},
+	}
+}
+
+// The errors osascript prints when macOS refuses a permission, by the
+// permission's name
+var refusedPermissions = map[string]string{
+	// Not authorized to send Apple events
+	"(-1743)": "Automation",
+	// Not allowed assistive access
+	"(-25211)": "Accessibility",
+}
+
+// Looks for a refused permission in what osascript printed, and when there
+// is one logs how to grant it and lets the window guide the user through it
+func notePermissionError(output string) {
+	for code, name := range refusedPermissions {
+		if !strings.Contains(output, code) {
+			continue
+		}
+		for _, status := range darwinPermissions(permissionDenied, permissionDenied) {
+			if status.Name == name {
+				log.Printf("%s permission is missing: %s", name, status.Fix)
+				permissionRefused(status)
+			}
+		}
+	}
+}
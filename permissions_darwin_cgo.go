@@ -0,0 +1,51 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework ApplicationServices -framework CoreServices
+#include <ApplicationServices/ApplicationServices.h>
+#include <string.h>
+
+static int wisa_accessibility_trusted(void) {
+	return AXIsProcessTrusted();
+}
+
+// 1 if wisa may control System Events, 0 if it was refused and -1 if the
+// user hasn't been asked yet or System Events isn't running. Never prompts.
+static int wisa_automation_allowed(void) {
+	const char *bundle = "com.apple.systemevents";
+	AEAddressDesc target;
+	if (AECreateDesc(typeApplicationBundleID, bundle, strlen(bundle), &target) != noErr) {
+		return -1;
+	}
+	OSStatus status = AEDeterminePermissionToAutomateTarget(&target, typeWildCard, typeWildCard, false);
+	AEDisposeDesc(&target);
+	switch (status) {
+	case noErr:
+		return 1;
+	case errAEEventNotPermitted:
+		return 0;
+	default:
+		return -1;
+	}
+}
+*/
+import "C"
+
+func checkPermissions() []permissionStatus {
+	accessibility := permissionDenied
+	if C.wisa_accessibility_trusted() != 0 {
+		accessibility = permissionGranted
+	}
+
+	automation := permissionUnknown
+	switch C.wisa_automation_allowed() {
+	case 1:
+		automation = permissionGranted
+	case 0:
+		automation = permissionDenied
+	}
+
+	return darwinPermissions(accessibility, automation)
+}
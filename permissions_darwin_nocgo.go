@@ -0,0 +1,26 @@
+//go:build darwin && !cgo
+
+package main
+
+import (
+	"strings"
+)
+
+// Without cgo both are read through System Events, which reports whether
+// GUI scripting is allowed and refuses with -1743 without Automation access
+func checkPermissions() []permissionStatus {
+	output, err := commandCombinedOutput("osascript", "-e", `tell application "System Events" to get UI elements enabled`)
+	if err != nil {
+		automation := permissionUnknown
+		if strings.Contains(string(output), "-1743") {
+			automation = permissionDenied
+		}
+		return darwinPermissions(permissionUnknown, automation)
+	}
+
+	accessibility := permissionDenied
+	if strings.TrimSpace(string(output)) == "true" {
+		accessibility = permissionGranted
+	}
+	return darwinPermissions(accessibility, permissionGranted)
+}
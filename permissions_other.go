@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package main
+
+// Window managers on Linux and Windows don't ask for permissions
+func checkPermissions() []permissionStatus {
+	return nil
+}
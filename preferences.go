@@ -0,0 +1,245 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Themes by their theme setting, in display order
+var themeLabels = []struct{ value, label string }{
+	{"", "Follow the system"},
+	{"light", "Light"},
+	{"dark", "Dark"},
+}
+
+// variantTheme is the default theme always in one variant, light or dark
+type variantTheme struct {
+	fyne.Theme
+	variant fyne.ThemeVariant
+}
+
+func (t variantTheme) Color(name fyne.ThemeColorName, _ fyne.ThemeVariant) color.Color {
+	return t.Theme.Color(name, t.variant)
+}
+
+// Applies the theme setting to the app
+func applyTheme(myApp fyne.App, db *sql.DB) {
+	switch getSetting(db, settingTheme, "") {
+	case "light":
+		myApp.Settings().SetTheme(variantTheme{theme.DefaultTheme(), theme.VariantLight})
+	case "dark":
+		myApp.Settings().SetTheme(variantTheme{theme.DefaultTheme(), theme.VariantDark})
+	default:
+		myApp.Settings().SetTheme(theme.DefaultTheme())
+	}
+}
+
+// Edits the options that apply to every profile in one place, each applied
+// as soon as it's saved, and opens the dialogs for the global tables
+func showPreferencesDialog(db *sql.DB, myApp fyne.App, parent fyne.Window, hotkeys *hotkeyManager, tray *trayMenu) {
+	// The database can't hold its own location, it's kept in a file next
+	// to the default one
+	currentDBPath := getDBPath()
+	dbPathEntry := widget.NewEntry()
+	dbPathEntry.SetText(currentDBPath)
+	dbPathEntry.Validator = func(text string) error {
+		if text = strings.TrimSpace(text); text != "" && !filepath.IsAbs(text) {
+			return fmt.Errorf("enter the full path of the database file")
+		}
+		return nil
+	}
+	dbPathNote := widget.NewLabel(fmt.Sprintf("Currently %s. Empty uses the default, a new location gets a copy of this database and is used from the next start.", dbPathSource()))
+	dbPathNote.Wrapping = fyne.TextWrapWord
+	dbPathNote.Importance = widget.LowImportance
+
+	captureFilterMu.RLock()
+	ignore, only := captureIgnore, captureOnly
+	captureFilterMu.RUnlock()
+	ignoreEntry := widget.NewEntry()
+	ignoreEntry.SetPlaceHolder("e.g. Finder, *Helper, System Settings")
+	ignoreEntry.SetText(ignore)
+	onlyEntry := widget.NewEntry()
+	onlyEntry.SetPlaceHolder("Every app")
+	onlyEntry.SetText(only)
+	gridEntry := widget.NewEntry()
+	gridEntry.SetPlaceHolder("Off, e.g. 8 or 1/12")
+	gridEntry.SetText(getSnapGrid().String())
+	gridEntry.Validator = func(text string) error {
+		_, err := parseSnapGrid(text)
+		return err
+	}
+
+	concurrencyEntry := widget.NewEntry()
+	concurrencyEntry.SetText(strconv.Itoa(getRestoreConcurrency()))
+	concurrencyEntry.Validator = func(text string) error {
+		_, err := parseRestoreConcurrency(text)
+		return err
+	}
+	// Keep notification banners from stealing focus mid-restore. It can only
+	// be put back as it was where wisa can tell whether it's on.
+	dndCheck := widget.NewCheck("Do Not Disturb while restoring", nil)
+	dndCheck.SetChecked(getBoolSetting(db, settingRestoreDND, false))
+	if dnd, ok := environmentActions["do_not_disturb"]; !ok || dnd.Current == nil {
+		dndCheck.Disable()
+	}
+	timeoutEntry := widget.NewEntry()
+	timeoutEntry.SetText(strconv.Itoa(int(getCommandTimeout().Seconds())))
+	timeoutEntry.Validator = func(text string) error {
+		_, err := parseCommandTimeout(text)
+		return err
+	}
+
+	var matchOptions []string
+	matchValues := make(map[string]string)
+	for _, label := range matchLabels {
+		if label.match == matchRegex {
+			continue
+		}
+		matchOptions = append(matchOptions, label.label)
+		matchValues[label.label] = label.match
+	}
+	matchSelect := widget.NewSelect(matchOptions, nil)
+	matchSelect.SetSelectedIndex(0)
+	defaultMatch := getSetting(db, settingDefaultTitleMatch, matchExact)
+	for _, option := range matchOptions {
+		if matchValues[option] == defaultMatch {
+			matchSelect.SetSelected(option)
+		}
+	}
+
+	var themeOptions []string
+	themeValues := make(map[string]string)
+	for _, label := range themeLabels {
+		themeOptions = append(themeOptions, label.label)
+		themeValues[label.label] = label.value
+	}
+	themeSelect := widget.NewSelect(themeOptions, nil)
+	themeSelect.SetSelectedIndex(0)
+	current := getSetting(db, settingTheme, "")
+	for i, label := range themeLabels {
+		if label.value == current {
+			themeSelect.SetSelectedIndex(i)
+		}
+	}
+
+	closeToTray := widget.NewCheck("Keep running in the tray when the window is closed", nil)
+	closeToTray.SetChecked(getBoolSetting(db, settingCloseToTray, false))
+	if _, ok := myApp.(desktop.App); !ok {
+		closeToTray.Disable()
+	}
+
+	linkSaves := widget.NewCheck("Let wisa:// links save profiles without asking", nil)
+	linkSaves.SetChecked(getBoolSetting(db, settingLinkSaves, false))
+	linkHooks := widget.NewCheck("Let wisa:// links restore profiles with hooks without asking", nil)
+	linkHooks.SetChecked(getBoolSetting(db, settingLinkHooks, false))
+
+	form := widget.NewForm(
+		widget.NewFormItem("Database", container.NewVBox(dbPathEntry, dbPathNote)),
+		widget.NewFormItem("Never capture", ignoreEntry),
+		widget.NewFormItem("Only capture", onlyEntry),
+		widget.NewFormItem("Snap to grid", gridEntry),
+		widget.NewFormItem("Windows at once", concurrencyEntry),
+		widget.NewFormItem("", dndCheck),
+		widget.NewFormItem("Command timeout (s)", timeoutEntry),
+		widget.NewFormItem("Title matching", matchSelect),
+		widget.NewFormItem("Theme", themeSelect),
+		widget.NewFormItem("", closeToTray),
+		widget.NewFormItem("Links", container.NewVBox(linkSaves, linkHooks)),
+		widget.NewFormItem("", container.NewHBox(
+			widget.NewButton("Hotkeys…", func() {
+				showHotkeysDialog(db, hotkeys, parent)
+			}),
+			widget.NewButton("App Quirks…", func() {
+				showQuirksDialog(db, parent)
+			}),
+			widget.NewButton("Retention…", func() {
+				showRetentionDialog(db, parent)
+			}),
+		)),
+	)
+	note := widget.NewLabel("Title matching applies to windows without their own, set in Profile > Title Matching…")
+	note.Importance = widget.LowImportance
+
+	d := dialog.NewCustomConfirm("Preferences", "Save", "Cancel", container.NewBorder(nil, note, nil, nil, form), func(ok bool) {
+		if !ok {
+			return
+		}
+		err := setCaptureFilter(db, strings.TrimSpace(ignoreEntry.Text), strings.TrimSpace(onlyEntry.Text))
+		if err == nil {
+			err = setSnapGrid(db, gridEntry.Text)
+		}
+		if err == nil {
+			err = setRestoreConcurrency(db, concurrencyEntry.Text)
+		}
+		if err == nil {
+			err = setBoolSetting(db, settingRestoreDND, dndCheck.Checked)
+		}
+		if err == nil {
+			err = setCommandTimeout(db, timeoutEntry.Text)
+		}
+		if err == nil {
+			err = setDefaultMatch(db, matchValues[matchSelect.Selected])
+		}
+		if err == nil {
+			err = setSetting(db, settingTheme, themeValues[themeSelect.Selected])
+		}
+		if err == nil {
+			err = setBoolSetting(db, settingCloseToTray, closeToTray.Checked)
+		}
+		if err == nil {
+			err = setBoolSetting(db, settingLinkSaves, linkSaves.Checked)
+		}
+		if err == nil {
+			err = setBoolSetting(db, settingLinkHooks, linkHooks.Checked)
+		}
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		applyTheme(myApp, db)
+		if closeToTray.Checked {
+			setupTrayMode(tray)
+		}
+
+		if dbPath := strings.TrimSpace(dbPathEntry.Text); dbPath != currentDBPath {
+			if err := moveDBLocation(db, dbPath); err != nil {
+				dialog.ShowError(err, parent)
+				return
+			}
+			if dbPath == "" {
+				dbPath = defaultDBPath()
+			}
+			dialog.ShowInformation("Database Location", fmt.Sprintf("wisa uses %s from the next time it starts.", dbPath), parent)
+		}
+	}, parent)
+	d.Resize(fyne.NewSize(560, 560))
+	d.Show()
+}
+
+// Picks a new database location for the next start, copying this database
+// there unless a file already is. Empty goes back to the default.
+func moveDBLocation(db *sql.DB, dbPath string) error {
+	if dbPath != "" {
+		if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+			if err := os.MkdirAll(filepath.Dir(dbPath), 0o755); err != nil {
+				return fmt.Errorf("error creating database folder: %v", err)
+			}
+			if err := backupDatabase(db, dbPath); err != nil {
+				return err
+			}
+		}
+	}
+	return setConfiguredDBPath(dbPath)
+}
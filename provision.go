@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// provisionFile describes a complete setup to create in one go. Profiles use
+// the same fields as exports, and hotkeys and schedules are listed with the
+// triggers of the profile they apply.
+type provisionFile struct {
+	Settings map[string]interface{} `json:"settings"`
+	Quirks   []provisionQuirk       `json:"quirks"`
+	Profiles []exportProfile        `json:"profiles"`
+}
+
+type provisionQuirk struct {
+	App           string `json:"app"`
+	ActivateFirst bool   `json:"activate_first"`
+	// ExtraDelay is a duration such as "500ms"
+	ExtraDelay  string `json:"extra_delay"`
+	IgnoresSize bool   `json:"ignores_size"`
+}
+
+// Reads a provisioning file. The YAML is converted to JSON first so the
+// export types and their field names can be reused.
+func readProvisionFile(path string) (*provisionFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading provisioning file: %v", err)
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing provisioning file: %v", err)
+	}
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error converting provisioning file: %v", err)
+	}
+
+	var file provisionFile
+	if err := json.Unmarshal(converted, &file); err != nil {
+		return nil, fmt.Errorf("error reading provisioning file: %v", err)
+	}
+	return &file, nil
+}
+
+// Applies a provisioning file to the database. Everything is checked before
+// anything is written so a typo doesn't leave a half-provisioned machine.
+func provision(db *sql.DB, file *provisionFile) error {
+	settings := make(map[string]string)
+	for key, value := range file.Settings {
+		if !knownSettings[key] {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		settings[key] = fmt.Sprint(value)
+	}
+
+	quirks := make(map[string]AppQuirk)
+	for _, q := range file.Quirks {
+		if q.App == "" {
+			return fmt.Errorf("quirk without an app name")
+		}
+		quirk := AppQuirk{ActivateFirst: q.ActivateFirst, IgnoresSize: q.IgnoresSize}
+		if q.ExtraDelay != "" {
+			delay, err := time.ParseDuration(q.ExtraDelay)
+			if err != nil {
+				return fmt.Errorf("invalid extra_delay for %s: %v", q.App, err)
+			}
+			quirk.ExtraDelay = delay
+		}
+		quirks[q.App] = quirk
+	}
+
+	for _, profile := range file.Profiles {
+		if profile.Name == "" {
+			return fmt.Errorf("profile without a name")
+		}
+		for _, trigger := range profile.Triggers {
+			if trigger.Kind == "" || trigger.Spec == "" {
+				return fmt.Errorf("trigger without a kind or spec in profile '%s'", profile.Name)
+			}
+		}
+	}
+
+	for key, value := range settings {
+		if err := setSetting(db, key, value); err != nil {
+			return err
+		}
+	}
+	loadSettings(db)
+	for app, quirk := range quirks {
+		if err := saveAppQuirk(db, app, quirk); err != nil {
+			return err
+		}
+	}
+	return importProfiles(db, &exportBundle{Version: exportVersion, Profiles: file.Profiles})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// profileQuery filters and pages the profiles listed by queryProfiles. Zero
+// fields don't filter.
+type profileQuery struct {
+	// Search matches part of the profile name or of an app in it
+	Search string
+	// App only keeps profiles with a window of this app
+	App string
+	// Role only keeps profiles with a window of this role, e.g. "editor"
+	Role string
+	// UpdatedAfter and UpdatedBefore only keep profiles saved in between.
+	// Profiles that were last saved before changes were timed never match.
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// Limit is the most profiles to return, 0 for all of them
+	Limit  int
+	Offset int
+}
+
+// profileSummary is a profile as listed by queryProfiles
+type profileSummary struct {
+	Name     string    `json:"name"`
+	Windows  int       `json:"windows"`
+	Revision int       `json:"revision"`
+	Updated  time.Time `json:"updated,omitempty"`
+	Shared   bool      `json:"shared,omitempty"`
+}
+
+// Gets one page of the profiles the current user can see that match the
+// query, sorted by name, and how many match in total
+func queryProfiles(db *sql.DB, query profileQuery) ([]profileSummary, int, error) {
+	where := []string{"p.deleted_at IS NULL", "p.archived_at IS NULL", "(p.owner = '' OR p.owner = ? OR p.shared = 1)"}
+	args := []interface{}{currentUsername()}
+
+	if query.Search != "" {
+		pattern := "%" + escapeLike(query.Search) + "%"
+		where = append(where, `(p.name LIKE ? ESCAPE '\' OR EXISTS (
+			SELECT 1 FROM window_states w WHERE w.profile_id = p.id AND w.app_name LIKE ? ESCAPE '\'))`)
+		args = append(args, pattern, pattern)
+	}
+	if query.App != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM window_states w WHERE w.profile_id = p.id AND w.app_name = ? COLLATE NOCASE)")
+		args = append(args, query.App)
+	}
+	if query.Role != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM window_states w WHERE w.profile_id = p.id AND w.role = ? COLLATE NOCASE)")
+		args = append(args, query.Role)
+	}
+	if !query.UpdatedAfter.IsZero() {
+		where = append(where, "p.updated_at >= ?")
+		args = append(args, query.UpdatedAfter)
+	}
+	if !query.UpdatedBefore.IsZero() {
+		where = append(where, "p.updated_at < ?")
+		args = append(args, query.UpdatedBefore)
+	}
+	clause := " WHERE " + strings.Join(where, " AND ")
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM profiles p"+clause, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("error counting profiles: %v", err)
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := db.Query(`
+		SELECT p.name, (SELECT COUNT(*) FROM window_states w WHERE w.profile_id = p.id), p.revision, p.updated_at, p.shared
+		FROM profiles p`+clause+`
+		ORDER BY p.name LIMIT ? OFFSET ?`,
+		append(args, limit, query.Offset)...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying profiles: %v", err)
+	}
+	defer rows.Close()
+
+	var profiles []profileSummary
+	for rows.Next() {
+		var profile profileSummary
+		var updated sql.NullTime
+		if err := rows.Scan(&profile.Name, &profile.Windows, &profile.Revision, &updated, &profile.Shared); err != nil {
+			return nil, 0, fmt.Errorf("error scanning row: %v", err)
+		}
+		profile.Updated = updated.Time
+		profiles = append(profiles, profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return profiles, total, nil
+}
+
+// Escapes the wildcards in s for a LIKE pattern with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Parses a date for a query, either 2006-01-02 in local time or RFC 3339
+func parseQueryDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD", value)
+	}
+	// Times are stored in local time and compared as text
+	return t.Local(), nil
+}
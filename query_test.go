@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Opens a migrated database in a temporary folder, skipping the test where
+// SQLite isn't available, such as builds without cgo
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "wisa.db")+"?_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		t.Skipf("SQLite isn't available: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		t.Skipf("SQLite isn't available: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migrateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Work", "Work"},
+		{"100%", `100\%`},
+		{"my_profile", `my\_profile`},
+		{`C:\Users`, `C:\\Users`},
+		{`%_\`, `\%\_\\`},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := escapeLike(test.in); got != test.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestQueryProfiles(t *testing.T) {
+	db := openTestDB(t)
+	me := currentUsername()
+	monday := time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)
+
+	profiles := []struct {
+		name    string
+		owner   string
+		shared  bool
+		deleted bool
+		updated time.Time
+		windows [][2]string
+	}{
+		{name: "Work", owner: me, updated: monday, windows: [][2]string{{"Code", "editor"}, {"Safari", ""}}},
+		{name: "Home", owner: "", updated: monday.AddDate(0, 0, 2), windows: [][2]string{{"Music", ""}}},
+		{name: "100% Focus", owner: me, windows: [][2]string{{"Code", ""}}},
+		{name: "100 Apps", owner: me},
+		{name: "Theirs", owner: "someone-else", windows: [][2]string{{"Code", ""}}},
+		{name: "Team", owner: "someone-else", shared: true, windows: [][2]string{{"Slack", ""}}},
+		{name: "Old", owner: me, deleted: true, windows: [][2]string{{"Code", ""}}},
+	}
+	for _, p := range profiles {
+		var updated, deleted interface{}
+		if !p.updated.IsZero() {
+			updated = p.updated
+		}
+		if p.deleted {
+			deleted = monday
+		}
+		result, err := db.Exec("INSERT INTO profiles (name, owner, shared, updated_at, deleted_at) VALUES (?, ?, ?, ?, ?)",
+			p.name, p.owner, p.shared, updated, deleted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := result.LastInsertId()
+		for _, window := range p.windows {
+			_, err := db.Exec("INSERT INTO window_states (profile_id, app_name, window_title, x, y, width, height, role) VALUES (?, ?, '', 0, 0, 100, 100, ?)",
+				id, window[0], window[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		query     profileQuery
+		want      []string
+		wantTotal int
+	}{
+		{name: "everything visible", want: []string{"100 Apps", "100% Focus", "Home", "Team", "Work"}, wantTotal: 5},
+		{name: "search by app", query: profileQuery{Search: "code"}, want: []string{"100% Focus", "Work"}, wantTotal: 2},
+		{name: "search percent is literal", query: profileQuery{Search: "100%"}, want: []string{"100% Focus"}, wantTotal: 1},
+		{name: "search underscore is literal", query: profileQuery{Search: "o_"}, wantTotal: 0},
+		{name: "app ignores case", query: profileQuery{App: "SLACK"}, want: []string{"Team"}, wantTotal: 1},
+		{name: "role", query: profileQuery{Role: "editor"}, want: []string{"Work"}, wantTotal: 1},
+		{name: "updated after", query: profileQuery{UpdatedAfter: monday.AddDate(0, 0, 1)}, want: []string{"Home"}, wantTotal: 1},
+		{name: "updated before", query: profileQuery{UpdatedBefore: monday.AddDate(0, 0, 1)}, want: []string{"Work"}, wantTotal: 1},
+		{name: "page", query: profileQuery{Limit: 2, Offset: 1}, want: []string{"100% Focus", "Home"}, wantTotal: 5},
+		{name: "offset past the end", query: profileQuery{Limit: 2, Offset: 10}, wantTotal: 5},
+	}
+	for _, test := range tests {
+		got, total, err := queryProfiles(db, test.query)
+		if err != nil {
+			t.Errorf("%s: queryProfiles returned %v", test.name, err)
+			continue
+		}
+		var names []string
+		for _, profile := range got {
+			names = append(names, profile.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) || total != test.wantTotal {
+			t.Errorf("%s: queryProfiles = %q, %d, want %q, %d", test.name, names, total, test.want, test.wantTotal)
+		}
+	}
+}
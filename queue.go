@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// queuedRestore is a restore waiting for its turn. Requests for the same
+// profile that arrive while one is waiting are folded into it.
+type queuedRestore struct {
+	ProfileName string
+	// Sources are the triggers that asked for the restore, e.g. "display"
+	Sources []string
+	Options restoreOptions
+	Queued  time.Time
+
+	done []func(count int, err error)
+}
+
+// restoreQueueState is a snapshot of the queue for status displays
+type restoreQueueState struct {
+	Running *queuedRestore
+	Pending []queuedRestore
+}
+
+// Queues a restore of a profile and calls done once it has run. Restores run
+// one at a time so triggers firing together don't fight over the windows.
+func (e *restoreEngine) Enqueue(profileName, source string, opts restoreOptions, done func(count int, err error)) {
+	e.queueMu.Lock()
+	defer e.queueMu.Unlock()
+
+	for _, request := range e.pending {
+		if request.ProfileName != profileName {
+			continue
+		}
+		request.Sources = append(request.Sources, source)
+		request.Options.Preview = request.Options.Preview || opts.Preview
+		// A restore of some windows joining one of the whole profile
+		// restores the whole profile
+		if len(request.Options.Windows) == 0 || len(opts.Windows) == 0 {
+			request.Options.Windows = nil
+		} else {
+			request.Options.Windows = append(request.Options.Windows, opts.Windows...)
+		}
+		if done != nil {
+			request.done = append(request.done, done)
+		}
+		return
+	}
+
+	request := &queuedRestore{
+		ProfileName: profileName,
+		Sources:     []string{source},
+		Options:     opts,
+		Queued:      time.Now(),
+	}
+	if done != nil {
+		request.done = append(request.done, done)
+	}
+	e.pending = append(e.pending, request)
+
+	if !e.draining {
+		e.draining = true
+		go e.drainQueue()
+	}
+}
+
+// Runs queued restores until the queue is empty
+func (e *restoreEngine) drainQueue() {
+	for {
+		e.queueMu.Lock()
+		if len(e.pending) == 0 {
+			e.running = nil
+			e.draining = false
+			e.queueMu.Unlock()
+			return
+		}
+		request := e.pending[0]
+		e.pending = e.pending[1:]
+		e.running = request
+		e.queueMu.Unlock()
+
+		log.Printf("Restoring profile '%s' for %v", request.ProfileName, request.Sources)
+		request.Options.Source = strings.Join(request.Sources, ", ")
+		count, err := e.Apply(request.ProfileName, request.Options)
+		for _, done := range request.done {
+			done(count, err)
+		}
+	}
+}
+
+// Returns what's running and what's waiting in the restore queue
+func (e *restoreEngine) QueueState() restoreQueueState {
+	e.queueMu.Lock()
+	defer e.queueMu.Unlock()
+
+	var state restoreQueueState
+	if e.running != nil {
+		running := *e.running
+		state.Running = &running
+	}
+	for _, request := range e.pending {
+		state.Pending = append(state.Pending, *request)
+	}
+	return state
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// AppQuirk describes workarounds the restore engine applies for an app that
+// doesn't behave like a well-mannered window
+type AppQuirk struct {
+	// ActivateFirst brings the app to the front before moving its windows
+	ActivateFirst bool
+	// ExtraDelay is waited after activation and before moving each window
+	ExtraDelay time.Duration
+	// IgnoresSize skips resizing for apps with fixed-size windows
+	IgnoresSize bool
+}
+
+// Quirks that ship with wisa, rows in the app_quirks table override these
+var builtinQuirks = map[string]AppQuirk{
+	"Calculator":         {IgnoresSize: true},
+	"System Settings":    {IgnoresSize: true},
+	"System Preferences": {IgnoresSize: true},
+	"Microsoft Word":     {ActivateFirst: true, ExtraDelay: 300 * time.Millisecond},
+	"Microsoft Excel":    {ActivateFirst: true, ExtraDelay: 300 * time.Millisecond},
+	"Microsoft Outlook":  {ActivateFirst: true, ExtraDelay: 300 * time.Millisecond},
+	"Spotify":            {ActivateFirst: true},
+}
+
+var (
+	quirksMu  sync.RWMutex
+	appQuirks = copyQuirks(builtinQuirks)
+)
+
+func copyQuirks(quirks map[string]AppQuirk) map[string]AppQuirk {
+	copied := make(map[string]AppQuirk, len(quirks))
+	for app, quirk := range quirks {
+		copied[app] = quirk
+	}
+	return copied
+}
+
+// Gets the quirks that apply to an app
+func quirkFor(appName string) AppQuirk {
+	quirksMu.RLock()
+	defer quirksMu.RUnlock()
+	return appQuirks[appName]
+}
+
+// Reloads the quirk table from the built-in list and the user's overrides
+func loadAppQuirks(db *sql.DB) error {
+	rows, err := db.Query("SELECT app_name, activate_first, extra_delay_ms, ignores_size FROM app_quirks")
+	if err != nil {
+		return fmt.Errorf("error querying app quirks: %v", err)
+	}
+	defer rows.Close()
+
+	quirks := copyQuirks(builtinQuirks)
+	for rows.Next() {
+		var appName string
+		var quirk AppQuirk
+		var delayMs int
+		if err := rows.Scan(&appName, &quirk.ActivateFirst, &delayMs, &quirk.IgnoresSize); err != nil {
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		quirk.ExtraDelay = time.Duration(delayMs) * time.Millisecond
+		quirks[appName] = quirk
+	}
+
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	quirksMu.Lock()
+	appQuirks = quirks
+	quirksMu.Unlock()
+	return nil
+}
+
+// Saves a user quirk for an app, replacing any previous one
+func saveAppQuirk(db *sql.DB, appName string, quirk AppQuirk) error {
+	_, err := db.Exec(
+		"INSERT OR REPLACE INTO app_quirks (app_name, activate_first, extra_delay_ms, ignores_size) VALUES (?, ?, ?, ?)",
+		appName, quirk.ActivateFirst, quirk.ExtraDelay.Milliseconds(), quirk.IgnoresSize,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving app quirk: %v", err)
+	}
+	return loadAppQuirks(db)
+}
+
+// Removes a user quirk, falling back to the built-in one if there is one
+func deleteAppQuirk(db *sql.DB, appName string) error {
+	_, err := db.Exec("DELETE FROM app_quirks WHERE app_name = ?", appName)
+	if err != nil {
+		return fmt.Errorf("error deleting app quirk: %v", err)
+	}
+	return loadAppQuirks(db)
+}
+
+func describeQuirk(quirk AppQuirk) string {
+	var text string
+	if quirk.ActivateFirst {
+		text += "activate first, "
+	}
+	if quirk.ExtraDelay > 0 {
+		text += fmt.Sprintf("wait %v, ", quirk.ExtraDelay)
+	}
+	if quirk.IgnoresSize {
+		text += "position only, "
+	}
+	if text == "" {
+		return "no workarounds"
+	}
+	return text[:len(text)-2]
+}
+
+// Shows the quirk table and a form for adding or overriding entries
+func showQuirksDialog(db *sql.DB, parent fyne.Window) {
+	list := widget.NewLabel("")
+	refresh := func() {
+		quirksMu.RLock()
+		apps := make([]string, 0, len(appQuirks))
+		for app := range appQuirks {
+			apps = append(apps, app)
+		}
+		sort.Strings(apps)
+		var text string
+		for _, app := range apps {
+			text += fmt.Sprintf("%s: %s\n", app, describeQuirk(appQuirks[app]))
+		}
+		quirksMu.RUnlock()
+		list.SetText(text)
+	}
+	refresh()
+
+	appEntry := widget.NewEntry()
+	appEntry.SetPlaceHolder("App Name")
+	activateCheck := widget.NewCheck("Activate before moving", nil)
+	ignoresSizeCheck := widget.NewCheck("Don't resize", nil)
+	delayEntry := widget.NewEntry()
+	delayEntry.SetPlaceHolder("0")
+
+	saveButton := widget.NewButton("Save", func() {
+		if appEntry.Text == "" {
+			dialog.ShowInformation("App Quirks", "Please enter an app name", parent)
+			return
+		}
+		delayMs, err := strconv.Atoi("0" + delayEntry.Text)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("extra delay must be a number of milliseconds"), parent)
+			return
+		}
+
+		err = saveAppQuirk(db, appEntry.Text, AppQuirk{
+			ActivateFirst: activateCheck.Checked,
+			ExtraDelay:    time.Duration(delayMs) * time.Millisecond,
+			IgnoresSize:   ignoresSizeCheck.Checked,
+		})
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		refresh()
+	})
+
+	removeButton := widget.NewButton("Remove Override", func() {
+		if err := deleteAppQuirk(db, appEntry.Text); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		refresh()
+	})
+
+	form := container.New(
+		layout.NewFormLayout(),
+		widget.NewLabel("App:"), appEntry,
+		widget.NewLabel("Extra Delay (ms):"), delayEntry,
+	)
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(450, 200))
+
+	content := container.NewVBox(
+		scroll,
+		form,
+		activateCheck,
+		ignoresSizeCheck,
+		container.NewHBox(saveButton, removeButton),
+	)
+	dialog.ShowCustom("App Quirks", "Close", content, parent)
+}
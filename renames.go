@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Apps known to have been renamed or replaced, by the normalized old name
+var appSuccessors = map[string][]string{
+	"googlechrome":      {"Chromium", "Google Chrome Beta", "Google Chrome Canary", "chrome"},
+	"chrome":            {"Google Chrome", "Chromium", "chromium"},
+	"chromium":          {"Google Chrome", "chrome"},
+	"code":              {"Visual Studio Code", "Code - Insiders", "Cursor", "VSCodium"},
+	"visualstudiocode":  {"Code", "Code - Insiders", "Cursor", "VSCodium"},
+	"iterm":             {"iTerm2"},
+	"microsoftteams":    {"Microsoft Teams (work or school)", "Microsoft Teams classic", "ms-teams"},
+	"teams":             {"ms-teams", "Microsoft Teams"},
+	"zoom":              {"zoom.us"},
+	"firefox":           {"Firefox Developer Edition", "Firefox Nightly", "LibreWolf"},
+	"systempreferences": {"System Settings"},
+	"itunes":            {"Music"},
+}
+
+// Lower cases an app name and drops .app or .exe and anything but letters
+// and digits, so Slack.app, slack and SLACK all read the same
+func normalizeAppName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".app"), ".exe")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+}
+
+// appRename is an app in saved windows that's missing, with the apps that
+// likely replaced it, best first
+type appRename struct {
+	From        string
+	Suggestions []string
+	// Profiles is how many profiles have windows of the app
+	Profiles int
+}
+
+// Picks the available apps that likely replaced a missing one: those with
+// the same name written differently, known successors, then those whose
+// name contains the other's
+func suggestSuccessors(missing string, available []string) []string {
+	normalized := normalizeAppName(missing)
+	var same, known, similar []string
+	for _, app := range available {
+		candidate := normalizeAppName(app)
+		switch {
+		case candidate == "" || app == missing:
+		case candidate == normalized:
+			same = append(same, app)
+		case len(candidate) >= 4 && len(normalized) >= 4 &&
+			(strings.Contains(candidate, normalized) || strings.Contains(normalized, candidate)):
+			similar = append(similar, app)
+		}
+	}
+	for _, successor := range appSuccessors[normalized] {
+		for _, app := range available {
+			if normalizeAppName(app) == normalizeAppName(successor) {
+				known = append(known, app)
+			}
+		}
+	}
+
+	var suggestions []string
+	seen := make(map[string]bool)
+	for _, app := range append(append(same, known...), similar...) {
+		if !seen[app] {
+			seen[app] = true
+			suggestions = append(suggestions, app)
+		}
+	}
+	return suggestions
+}
+
+// Finds the apps in the current user's profiles that aren't installed and
+// suggests the running or installed apps that likely replaced them
+func findAppRenames(db *sql.DB, backend WindowBackend) ([]appRename, error) {
+	check, err := gatherStaleCheck(db, backend)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make(map[string]int)
+	for _, apps := range check.apps {
+		for _, appName := range apps {
+			profiles[appName]++
+		}
+	}
+
+	// Running apps, then known successors that are installed
+	var available []string
+	if launcher, ok := backend.(AppLauncher); ok {
+		running, err := launcher.RunningApps()
+		if err != nil {
+			log.Printf("Error listing running apps: %v", err)
+		}
+		for appName := range running {
+			available = append(available, appName)
+		}
+		sort.Strings(available)
+	}
+	finder, _ := backend.(AppFinder)
+
+	var renames []appRename
+	for appName, missing := range check.missing {
+		if !missing {
+			continue
+		}
+		candidates := append([]string(nil), available...)
+		if finder != nil {
+			for _, successor := range appSuccessors[normalizeAppName(appName)] {
+				if installed, err := finder.AppInstalled(successor, ""); err == nil && installed {
+					candidates = append(candidates, successor)
+				}
+			}
+		}
+		renames = append(renames, appRename{
+			From:        appName,
+			Suggestions: suggestSuccessors(appName, candidates),
+			Profiles:    profiles[appName],
+		})
+	}
+	sort.Slice(renames, func(i, j int) bool {
+		return renames[i].From < renames[j].From
+	})
+	return renames, nil
+}
+
+// Renames apps, from old to new name, in the windows and excludes of every
+// profile the current user can change, and moves their quirks over unless
+// the new name has some. Returns how many windows were changed.
+func renameApps(db *sql.DB, renames map[string]string) (int64, error) {
+	var changed int64
+	err := queueWrite(func() error {
+		autoBackup(db, "rename apps")
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %v", err)
+		}
+		owned := "SELECT id FROM profiles WHERE owner = '' OR owner = ?"
+
+		for from, to := range renames {
+			// The bundle ID was the old app's
+			result, err := tx.Exec(
+				"UPDATE window_states SET app_name = ?, bundle_id = '' WHERE app_name = ? AND profile_id IN ("+owned+")",
+				to, from, currentUsername(),
+			)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error renaming %s: %v", from, err)
+			}
+			n, _ := result.RowsAffected()
+			changed += n
+
+			_, err = tx.Exec(
+				"UPDATE window_excludes SET app_name = ? WHERE app_name = ? AND (profile_id IS NULL OR profile_id IN ("+owned+"))",
+				to, from, currentUsername(),
+			)
+			if err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error renaming %s in excludes: %v", from, err)
+			}
+
+			if _, err := tx.Exec("UPDATE OR IGNORE app_quirks SET app_name = ? WHERE app_name = ?", to, from); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("error renaming %s in app quirks: %v", from, err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing transaction: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := loadAppQuirks(db); err != nil {
+		log.Printf("Error loading app quirks: %v", err)
+	}
+	return changed, nil
+}
+
+// Lists the missing apps with their likely successors, and renames the
+// ticked ones in every profile. onRenamed is called after renaming.
+func showAppRenamesDialog(db *sql.DB, renames []appRename, parent fyne.Window, onRenamed func(windows int64)) {
+	if len(renames) == 0 {
+		dialog.ShowInformation("App Renames", "Every app in your profiles is installed", parent)
+		return
+	}
+
+	type row struct {
+		from  string
+		check *widget.Check
+		to    *widget.SelectEntry
+	}
+	var rows []row
+	list := container.NewVBox()
+	for _, rename := range renames {
+		to := widget.NewSelectEntry(rename.Suggestions)
+		to.SetPlaceHolder("No likely successor running, type one")
+		check := widget.NewCheck(fmt.Sprintf("%s (%s) →", rename.From, plural(rename.Profiles, "profile")), nil)
+		if len(rename.Suggestions) > 0 {
+			to.SetText(rename.Suggestions[0])
+			check.SetChecked(true)
+		}
+		to.OnChanged = func(text string) {
+			check.SetChecked(strings.TrimSpace(text) != "")
+		}
+		rows = append(rows, row{rename.From, check, to})
+		list.Add(container.NewBorder(nil, nil, check, nil, to))
+	}
+
+	note := widget.NewLabel("These apps aren't installed. Ticked ones are renamed in the windows of every profile, after a backup.")
+	note.Wrapping = fyne.TextWrapWord
+	content := container.NewBorder(note, nil, nil, nil, container.NewVScroll(list))
+
+	d := dialog.NewCustomConfirm("App Renames", "Rename", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		picked := make(map[string]string)
+		for _, r := range rows {
+			to := strings.TrimSpace(r.to.Text)
+			if r.check.Checked && to != "" && to != r.from {
+				picked[r.from] = to
+			}
+		}
+		if len(picked) == 0 {
+			return
+		}
+		changed, err := renameApps(db, picked)
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		onRenamed(changed)
+	}, parent)
+	d.Resize(fyne.NewSize(620, 420))
+	d.Show()
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// Rows that belong to a profile, with what to call them in the report
+var profileRows = []struct {
+	table string
+	what  string
+}{
+	{"window_states", "window states"},
+	{"profile_actions", "environment actions"},
+	{"profile_hooks", "hooks"},
+	{"triggers", "triggers"},
+	{"profile_snapshots", "history versions"},
+	{"window_excludes", "window excludes"},
+}
+
+// Where a window state is missing part of its geometry
+const nullGeometry = "x IS NULL OR y IS NULL OR width IS NULL OR height IS NULL"
+
+// Finds what repairDatabase would fix without changing anything
+func checkDatabase(db *sql.DB) ([]string, error) {
+	var problems []string
+	for _, rows := range profileRows {
+		var count int
+		err := db.QueryRow(fmt.Sprintf(
+			"SELECT COUNT(*) FROM %s WHERE profile_id IS NOT NULL AND profile_id NOT IN (SELECT id FROM profiles)", rows.table,
+		)).Scan(&count)
+		if err != nil {
+			return nil, fmt.Errorf("error checking %s: %v", rows.table, err)
+		}
+		if count > 0 {
+			problems = append(problems, fmt.Sprintf("%d %s of profiles that no longer exist", count, rows.what))
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM window_states WHERE " + nullGeometry).Scan(&count); err != nil {
+		return nil, fmt.Errorf("error checking window states: %v", err)
+	}
+	if count > 0 {
+		problems = append(problems, fmt.Sprintf("%d window states without a position or size", count))
+	}
+
+	duplicates, err := duplicateProfileNames(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, names := range duplicates {
+		problems = append(problems, fmt.Sprintf("profiles with the same name: '%s'", strings.Join(names, "', '")))
+	}
+
+	invalid, err := invalidProfileNames(db)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range invalid {
+		problems = append(problems, fmt.Sprintf("profile with an invalid name: %q", name))
+	}
+	return problems, nil
+}
+
+// queryer runs queries on the database or in a transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Groups the profile names that only differ in case or surrounding spaces,
+// oldest profile first
+func duplicateProfileNames(db queryer) ([][]string, error) {
+	rows, err := db.Query(`
+		SELECT name, LOWER(TRIM(name)) FROM profiles
+		WHERE LOWER(TRIM(name)) IN (SELECT LOWER(TRIM(name)) FROM profiles GROUP BY LOWER(TRIM(name)) HAVING COUNT(*) > 1)
+		ORDER BY LOWER(TRIM(name)), id`)
+	if err != nil {
+		return nil, fmt.Errorf("error checking profile names: %v", err)
+	}
+	defer rows.Close()
+
+	var groups [][]string
+	last := ""
+	for rows.Next() {
+		var name, key string
+		if err := rows.Scan(&name, &key); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if len(groups) == 0 || key != last {
+			groups = append(groups, nil)
+			last = key
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return groups, nil
+}
+
+// Finds the profile names saved before names were checked that
+// validateProfileName now rejects
+func invalidProfileNames(db queryer) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM profiles ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error checking profile names: %v", err)
+	}
+	defer rows.Close()
+
+	var invalid []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if validateProfileName(name) != nil {
+			invalid = append(invalid, name)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return invalid, nil
+}
+
+// Fixes rows left behind or damaged by older versions, crashes or edits
+// made outside wisa, and returns what it fixed. A backup is made first when
+// there is anything to fix.
+func repairDatabase(db *sql.DB) ([]string, error) {
+	problems, err := checkDatabase(db)
+	if err != nil || len(problems) == 0 {
+		return nil, err
+	}
+	autoBackup(db, "repair")
+
+	var fixed []string
+	err = queueWrite(func() error {
+		fixed = nil
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("error starting transaction: %v", err)
+		}
+		defer tx.Rollback()
+
+		for _, rows := range profileRows {
+			result, err := tx.Exec(fmt.Sprintf(
+				"DELETE FROM %s WHERE profile_id IS NOT NULL AND profile_id NOT IN (SELECT id FROM profiles)", rows.table,
+			))
+			if err != nil {
+				return fmt.Errorf("error removing orphaned %s: %v", rows.what, err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				fixed = append(fixed, fmt.Sprintf("Removed %d %s of profiles that no longer exist", n, rows.what))
+			}
+		}
+
+		result, err := tx.Exec("DELETE FROM window_states WHERE " + nullGeometry)
+		if err != nil {
+			return fmt.Errorf("error removing window states without geometry: %v", err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			fixed = append(fixed, fmt.Sprintf("Removed %d window states without a position or size", n))
+		}
+
+		duplicates, err := duplicateProfileNames(tx)
+		if err != nil {
+			return err
+		}
+		for _, names := range duplicates {
+			// The oldest profile keeps its name, the others get a number
+			for _, name := range names[1:] {
+				renamed, err := unusedProfileName(tx, strings.TrimSpace(name))
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec("UPDATE profiles SET name = ? WHERE name = ?", renamed, name); err != nil {
+					return fmt.Errorf("error renaming profile: %v", err)
+				}
+				fixed = append(fixed, fmt.Sprintf("Renamed profile '%s' to '%s' since '%s' has the same name", name, renamed, names[0]))
+			}
+		}
+
+		invalid, err := invalidProfileNames(tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range invalid {
+			renamed, err := validProfileName(tx, name)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE profiles SET name = ? WHERE name = ?", renamed, name); err != nil {
+				return fmt.Errorf("error renaming profile: %v", err)
+			}
+			fixed = append(fixed, fmt.Sprintf("Renamed profile %q to '%s' since its name isn't allowed", name, renamed))
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing transaction: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range fixed {
+		log.Printf("Repaired database: %s", line)
+	}
+	return fixed, nil
+}
+
+// Finds the first of "base (2)", "base (3)" and so on that isn't taken, in
+// any case
+func unusedProfileName(tx *sql.Tx, base string) (string, error) {
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s (%d)", base, i)
+		var taken bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM profiles WHERE LOWER(TRIM(name)) = LOWER(?))", name).Scan(&taken)
+		if err != nil {
+			return "", fmt.Errorf("error checking profile names: %v", err)
+		}
+		if !taken {
+			return name, nil
+		}
+	}
+}
+
+// Makes an invalid profile name valid by replacing slashes and dropping
+// control characters, numbering it if it's reserved or taken
+func validProfileName(tx *sql.Tx, name string) (string, error) {
+	base := canonicalProfileName(strings.Map(func(r rune) rune {
+		switch {
+		case r == '/' || r == '\\':
+			return '-'
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, name))
+	if base == "" || base == "." || base == ".." {
+		base = "Profile"
+	}
+
+	if validateProfileName(base) == nil {
+		var taken bool
+		err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM profiles WHERE name = ?)", base).Scan(&taken)
+		if err != nil {
+			return "", fmt.Errorf("error checking profile names: %v", err)
+		}
+		if !taken {
+			return base, nil
+		}
+	}
+	return unusedProfileName(tx, base)
+}
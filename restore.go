@@ -0,0 +1,333 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// restoreEngine applies profiles to the screen. It's shared by the buttons
+// in the main window and the automatic triggers.
+type restoreEngine struct {
+	db      *sql.DB
+	backend WindowBackend
+
+	mu sync.Mutex
+	// Windows ignored until wisa quits
+	sessionIgnores map[windowKey]bool
+
+	// applyMu keeps restores from overlapping
+	applyMu sync.Mutex
+
+	queueMu  sync.Mutex
+	pending  []*queuedRestore
+	running  *queuedRestore
+	draining bool
+
+	// Called as windows are moved, see SetProgress
+	progress func(done, total int)
+
+	resultsMu sync.Mutex
+	// What happened to each window in the last restore, by profile
+	lastResults map[string][]restoreResult
+	// Hooks that failed in the last restore without failing it, by profile
+	lastHookErrors map[string]error
+}
+
+func newRestoreEngine(db *sql.DB, backend WindowBackend) *restoreEngine {
+	return &restoreEngine{
+		db:             db,
+		backend:        backend,
+		sessionIgnores: make(map[windowKey]bool),
+		lastResults:    make(map[string][]restoreResult),
+		lastHookErrors: make(map[string]error),
+	}
+}
+
+// Gets what happened to each window the last time a profile was restored
+// since wisa started, nil if it wasn't
+func (e *restoreEngine) LastResults(profileName string) []restoreResult {
+	e.resultsMu.Lock()
+	defer e.resultsMu.Unlock()
+	return e.lastResults[profileName]
+}
+
+// Gets the hooks that failed the last time a profile was restored, when the
+// profile only logs hook failures. Nil if they all ran fine.
+func (e *restoreEngine) LastHookError(profileName string) error {
+	e.resultsMu.Lock()
+	defer e.resultsMu.Unlock()
+	return e.lastHookErrors[profileName]
+}
+
+// Sets what's told how many of its windows a restore has moved, from the
+// goroutine moving them
+func (e *restoreEngine) SetProgress(progress func(done, total int)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.progress = progress
+}
+
+// Cancels the running restore, killing the commands it's running and
+// skipping the windows it hasn't got to. Reports whether one was running.
+func (e *restoreEngine) Cancel() bool {
+	return cancelRestore()
+}
+
+// restoreOptions tweaks how a single restore runs
+type restoreOptions struct {
+	// Preview flashes the target rectangles before moving anything
+	Preview bool
+	// Source is what asked for the restore, e.g. window or hotkey, for the
+	// activity log
+	Source string
+	// Windows limits the restore to these saved window states by ID. Only
+	// those windows are moved, hooks, environment actions and other apps
+	// are left alone. Empty restores the whole profile.
+	Windows []int64
+}
+
+// Stops retrying a window until wisa quits
+func (e *restoreEngine) ignoreForSession(key windowKey) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sessionIgnores[key] = true
+}
+
+// Restores the layout variant of a profile that fits the connected displays
+// and returns how many windows it tried to restore
+func (e *restoreEngine) Apply(profileName string, opts restoreOptions) (int, error) {
+	count, err := e.apply(profileName, opts)
+	logRestoreActivity(e.db, profileName, opts, count, e.LastResults(profileName), e.LastHookError(profileName), err)
+	recordUsage(e.db, profileName, e.LastResults(profileName), err)
+	return count, err
+}
+
+func (e *restoreEngine) apply(profileName string, opts restoreOptions) (int, error) {
+	e.applyMu.Lock()
+	defer e.applyMu.Unlock()
+	ctx, endCancellable := beginCancellable()
+	defer endCancellable()
+
+	// Failing hooks that don't fail the restore are noted for the summary
+	var hookErrs []error
+	defer func() {
+		e.resultsMu.Lock()
+		e.lastHookErrors[profileName] = errors.Join(hookErrs...)
+		e.resultsMu.Unlock()
+	}()
+	policy, err := getHookPolicy(e.db, profileName)
+	if err != nil {
+		log.Printf("Error reading profile settings: %v", err)
+	}
+
+	states, err := loadWindowStates(e.db, profileName, currentArrangement(e.backend))
+	if err != nil {
+		return 0, fmt.Errorf("error loading window states: %v", err)
+	}
+
+	if len(states) == 0 {
+		return 0, fmt.Errorf("no window states found for profile '%s'", profileName)
+	}
+
+	partial := len(opts.Windows) > 0
+	if partial {
+		states = selectWindowStates(states, opts.Windows)
+		if len(states) == 0 {
+			return 0, fmt.Errorf("the selected windows are no longer in profile '%s'", profileName)
+		}
+	}
+
+	scale, err := getScaleToDisplay(e.db, profileName)
+	if err != nil {
+		log.Printf("Error reading profile settings: %v", err)
+	}
+	if scale {
+		states = scaleToDisplays(states, connectedDisplays(e.backend))
+	}
+
+	// Optionally show where the windows will land before moving them
+	if opts.Preview {
+		if highlighter, ok := e.backend.(Highlighter); ok {
+			err = highlighter.Highlight(states, time.Second)
+			if err != nil {
+				log.Printf("Error previewing window states: %v", err)
+			}
+		}
+	}
+
+	// Skip windows the user asked us to stop retrying
+	e.mu.Lock()
+	states, err = filterIgnoredStates(e.db, profileName, e.sessionIgnores, states)
+	e.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("error loading ignored windows: %v", err)
+	}
+
+	// Timed for estimating how long the next restore takes
+	started := time.Now()
+	var launched int
+	var launchTime, moveTime time.Duration
+	record := func() {
+		if statsErr := recordRestoreStats(e.db, profileName, len(states), launched, launchTime, moveTime, time.Since(started)); statsErr != nil {
+			log.Printf("Error recording restore time: %v", statsErr)
+		}
+	}
+
+	if !partial {
+		if hookErr := runProfileHooks(e.db, profileName, hookBefore, beforeHookContext(e.backend, states)); hookErr != nil {
+			log.Printf("Error running hooks for profile '%s': %v", profileName, hookErr)
+			if policy.BeforeAborts {
+				return 0, fmt.Errorf("restore stopped, %v", hookErr)
+			}
+			hookErrs = append(hookErrs, hookErr)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return 0, errRestoreCancelled
+	}
+
+	launch, err := getLaunchMissing(e.db, profileName)
+	if err != nil {
+		log.Printf("Error reading profile settings: %v", err)
+	}
+	if launch {
+		launchStarted := time.Now()
+		launched = launchMissingApps(ctx, e.backend, states, launchTimeout)
+		launchTime = time.Since(launchStarted)
+	}
+
+	if getBoolSetting(e.db, settingRestoreDND, false) {
+		defer quietNotifications(e.db, profileName)()
+	}
+
+	// Write down what's about to happen in case wisa doesn't get to finish
+	journalID, journalErr := beginJournal(e.db, profileName, states, captureStates(e.backend))
+	if journalErr != nil {
+		log.Printf("Error writing journal: %v", journalErr)
+	}
+
+	e.mu.Lock()
+	progress := e.progress
+	e.mu.Unlock()
+	endProgress := beginRestoreProgress(progress)
+	moveStarted := time.Now()
+	results, err := restoreStatesWithResults(ctx, e.backend, states)
+	endProgress()
+	moveTime = time.Since(moveStarted)
+	e.resultsMu.Lock()
+	e.lastResults[profileName] = results
+	e.resultsMu.Unlock()
+	if journalID != 0 {
+		if journalErr := finishJournal(e.db, journalID); journalErr != nil {
+			log.Printf("Error updating journal: %v", journalErr)
+		}
+	}
+
+	if partial {
+		record()
+		return len(states), err
+	}
+
+	// A cancelled restore stops here, leaving the other apps and environment
+	// as they are
+	if ctx.Err() != nil {
+		record()
+		if err == nil {
+			err = errRestoreCancelled
+		}
+		return len(states), err
+	}
+
+	mode, modeErr := getOtherAppsMode(e.db, profileName)
+	if modeErr != nil {
+		log.Printf("Error reading profile settings: %v", modeErr)
+	}
+	clearOtherApps(e.backend, states, mode)
+
+	// Environment actions run alongside the window placement
+	if actionErr := applyProfileActions(e.db, profileName); actionErr != nil {
+		log.Printf("Error applying environment for profile '%s': %v", profileName, actionErr)
+	}
+
+	if hookErr := runProfileHooks(e.db, profileName, hookAfter, afterHookContext(e.backend, results, err)); hookErr != nil {
+		log.Printf("Error running hooks for profile '%s': %v", profileName, hookErr)
+		switch {
+		case !policy.AfterFatal:
+			hookErrs = append(hookErrs, hookErr)
+		case err == nil:
+			// A failed window restore is reported ahead of the hooks
+			err = fmt.Errorf("windows restored, but %v", hookErr)
+		}
+	}
+
+	record()
+	return len(states), err
+}
+
+// Keeps the window states with the given IDs
+func selectWindowStates(states []WindowState, ids []int64) []WindowState {
+	wanted := make(map[int64]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var selected []WindowState
+	for _, state := range states {
+		if wanted[state.ID] {
+			selected = append(selected, state)
+		}
+	}
+	return selected
+}
+
+// Turns on Do Not Disturb and returns a function that turns it back off.
+// Nothing is changed if Do Not Disturb is unsupported or already on, if
+// whether it's on can't be read, since it couldn't be put back as it was,
+// or if the profile sets Do Not Disturb itself. Pass an empty profileName
+// for restores without a profile.
+func quietNotifications(db *sql.DB, profileName string) func() {
+	dnd, ok := environmentActions["do_not_disturb"]
+	if !ok {
+		return func() {}
+	}
+
+	if profileName != "" {
+		actions, err := getProfileActions(db, profileName)
+		if err != nil {
+			log.Printf("Error reading environment actions: %v", err)
+			return func() {}
+		}
+		for _, action := range actions {
+			if action.Kind == "do_not_disturb" {
+				return func() {}
+			}
+		}
+	}
+
+	if dnd.Current == nil {
+		log.Printf("Not turning on Do Not Disturb, whether it's on can't be read here")
+		return func() {}
+	}
+	current, err := dnd.Current()
+	if err != nil {
+		log.Printf("Not turning on Do Not Disturb: %v", err)
+		return func() {}
+	}
+	if current == "on" {
+		return func() {}
+	}
+
+	if err := dnd.Apply("on"); err != nil {
+		log.Printf("Error turning on Do Not Disturb: %v", err)
+		return func() {}
+	}
+	return func() {
+		if err := dnd.Apply("off"); err != nil {
+			log.Printf("Error turning off Do Not Disturb: %v", err)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How often the pruner runs while wisa is open or the daemon runs
+const pruneInterval = time.Hour
+
+// retentionPolicy is how much of a log or history is kept. Anything past
+// one of its limits is dropped, zero is no limit.
+type retentionPolicy struct {
+	MaxEntries int
+	MaxAge     time.Duration
+	// MaxBytes only applies to backups
+	MaxBytes int64
+}
+
+// Writes the policy the way parseRetention reads it, e.g. 500, 90d
+func (p retentionPolicy) String() string {
+	var parts []string
+	if p.MaxEntries > 0 {
+		parts = append(parts, strconv.Itoa(p.MaxEntries))
+	}
+	if p.MaxAge > 0 {
+		parts = append(parts, fmt.Sprintf("%dd", int(p.MaxAge/(24*time.Hour))))
+	}
+	if p.MaxBytes > 0 {
+		parts = append(parts, fmt.Sprintf("%dMB", p.MaxBytes/(1<<20)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// What each retention setting keeps when it isn't set
+var defaultRetention = map[string]retentionPolicy{
+	settingRetainActivity: {MaxEntries: maxActivityEntries},
+	settingRetainHistory:  {MaxEntries: maxSnapshots},
+	settingRetainJournal:  {MaxEntries: maxJournalEntries},
+	settingRetainBackups:  {MaxEntries: maxAutoBackups},
+}
+
+// Parses a retention setting, a comma separated list of how many entries,
+// how many days (90d) and for backups how many megabytes (500MB) to keep.
+// Empty is the default.
+func parseRetention(key, value string) (retentionPolicy, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultRetention[key], nil
+	}
+
+	var policy retentionPolicy
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToUpper(strings.TrimSpace(part))
+		unit := strings.TrimLeft(part, "0123456789")
+		n, err := strconv.Atoi(strings.TrimSuffix(part, unit))
+		if err != nil || n < 1 {
+			return retentionPolicy{}, fmt.Errorf("invalid retention %q, use a number of entries, days like 90d or a size like 500MB", part)
+		}
+		switch {
+		case unit == "":
+			policy.MaxEntries = n
+		case unit == "D":
+			policy.MaxAge = time.Duration(n) * 24 * time.Hour
+		case (unit == "MB" || unit == "GB") && key == settingRetainBackups:
+			policy.MaxBytes = int64(n) << 20
+			if unit == "GB" {
+				policy.MaxBytes <<= 10
+			}
+		default:
+			return retentionPolicy{}, fmt.Errorf("invalid retention %q, use a number of entries, days like 90d or a size like 500MB", part)
+		}
+	}
+	return policy, nil
+}
+
+// The retention policies from the settings, by setting
+var (
+	retentionMu      sync.RWMutex
+	currentRetention = make(map[string]retentionPolicy)
+)
+
+// Reloads the retention policies from the settings, using the defaults for
+// invalid ones
+func loadRetention(db *sql.DB) {
+	policies := make(map[string]retentionPolicy)
+	for key, fallback := range defaultRetention {
+		policy, err := parseRetention(key, getSetting(db, key, ""))
+		if err != nil {
+			policy = fallback
+		}
+		policies[key] = policy
+	}
+
+	retentionMu.Lock()
+	currentRetention = policies
+	retentionMu.Unlock()
+}
+
+func setRetention(db *sql.DB, key, value string) error {
+	policy, err := parseRetention(key, value)
+	if err != nil {
+		return err
+	}
+	// Empty stays empty so it follows the default
+	if strings.TrimSpace(value) != "" {
+		value = policy.String()
+	}
+	if err := setSetting(db, key, value); err != nil {
+		return err
+	}
+	loadRetention(db)
+	return nil
+}
+
+func getRetention(key string) retentionPolicy {
+	retentionMu.RLock()
+	defer retentionMu.RUnlock()
+	if policy, ok := currentRetention[key]; ok {
+		return policy
+	}
+	return defaultRetention[key]
+}
+
+// Drops the activity log entries past its retention
+func pruneActivity(db *sql.DB) error {
+	policy := getRetention(settingRetainActivity)
+	if policy.MaxEntries > 0 {
+		_, err := db.Exec(
+			"DELETE FROM activity_log WHERE id NOT IN (SELECT id FROM activity_log ORDER BY id DESC LIMIT ?)",
+			policy.MaxEntries,
+		)
+		if err != nil {
+			return fmt.Errorf("error pruning activity log: %v", err)
+		}
+	}
+	if policy.MaxAge > 0 {
+		if _, err := db.Exec("DELETE FROM activity_log WHERE at < ?", time.Now().Add(-policy.MaxAge)); err != nil {
+			return fmt.Errorf("error pruning activity log: %v", err)
+		}
+	}
+	return nil
+}
+
+// Drops the finished restores in the journal past its retention, those
+// still running are kept to finish or roll back
+func pruneJournal(db *sql.DB) error {
+	policy := getRetention(settingRetainJournal)
+	if policy.MaxEntries > 0 {
+		_, err := db.Exec(`
+			DELETE FROM restore_journal WHERE finished_at IS NOT NULL AND id NOT IN (
+				SELECT id FROM restore_journal WHERE finished_at IS NOT NULL ORDER BY id DESC LIMIT ?
+			)`,
+			policy.MaxEntries,
+		)
+		if err != nil {
+			return fmt.Errorf("error pruning journal: %v", err)
+		}
+	}
+	if policy.MaxAge > 0 {
+		_, err := db.Exec("DELETE FROM restore_journal WHERE finished_at IS NOT NULL AND finished_at < ?", time.Now().Add(-policy.MaxAge))
+		if err != nil {
+			return fmt.Errorf("error pruning journal: %v", err)
+		}
+	}
+	return nil
+}
+
+// Drops the history versions past its retention. The newest version of each
+// profile is kept however old it is.
+func pruneSnapshots(db *sql.DB) error {
+	policy := getRetention(settingRetainHistory)
+	if policy.MaxEntries > 0 {
+		_, err := db.Exec(`
+			DELETE FROM profile_snapshots WHERE id IN (
+				SELECT id FROM (
+					SELECT id, ROW_NUMBER() OVER (PARTITION BY profile_id ORDER BY version DESC) AS n FROM profile_snapshots
+				) WHERE n > ?
+			)`,
+			policy.MaxEntries,
+		)
+		if err != nil {
+			return fmt.Errorf("error pruning snapshots: %v", err)
+		}
+	}
+	if policy.MaxAge > 0 {
+		_, err := db.Exec(`
+			DELETE FROM profile_snapshots WHERE created_at < ? AND id NOT IN (
+				SELECT MAX(id) FROM profile_snapshots GROUP BY profile_id
+			)`,
+			time.Now().Add(-policy.MaxAge),
+		)
+		if err != nil {
+			return fmt.Errorf("error pruning snapshots: %v", err)
+		}
+	}
+	return nil
+}
+
+// Removes the automatic backups past their retention, oldest first. The
+// newest backup is always kept.
+func pruneBackups() error {
+	dir := backupDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading backup folder: %v", err)
+	}
+
+	type backup struct {
+		name string
+		size int64
+		at   time.Time
+	}
+	var backups []backup
+	var total int64
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "wisa-") || !strings.HasSuffix(entry.Name(), ".db") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{entry.Name(), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	// Names start with the timestamp so they sort oldest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].name < backups[j].name
+	})
+
+	policy := getRetention(settingRetainBackups)
+	cutoff := time.Now().Add(-policy.MaxAge)
+	for len(backups) > 1 {
+		oldest := backups[0]
+		tooMany := policy.MaxEntries > 0 && len(backups) > policy.MaxEntries
+		tooOld := policy.MaxAge > 0 && oldest.at.Before(cutoff)
+		tooBig := policy.MaxBytes > 0 && total > policy.MaxBytes
+		if !tooMany && !tooOld && !tooBig {
+			break
+		}
+		if err := os.Remove(filepath.Join(dir, oldest.name)); err != nil {
+			return fmt.Errorf("error removing old backup: %v", err)
+		}
+		total -= oldest.size
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Applies every retention policy, logging what fails
+func pruneAll(db *sql.DB) {
+	for _, prune := range []func(*sql.DB) error{pruneActivity, pruneJournal, pruneSnapshots} {
+		if err := prune(db); err != nil {
+			log.Printf("Error applying retention: %v", err)
+		}
+	}
+	if err := pruneBackups(); err != nil {
+		log.Printf("Error applying retention: %v", err)
+	}
+}
+
+// Applies the retention policies now and every pruneInterval, so limits by
+// age apply even when nothing new is logged
+func startPruner(db *sql.DB) {
+	go func() {
+		for {
+			pruneAll(db)
+			time.Sleep(pruneInterval)
+		}
+	}()
+}
+
+// Edits the retention policies, which are applied right away
+func showRetentionDialog(db *sql.DB, parent fyne.Window) {
+	kinds := []struct {
+		key, label string
+	}{
+		{settingRetainActivity, "Activity log"},
+		{settingRetainHistory, "History, per profile"},
+		{settingRetainJournal, "Restore journal"},
+		{settingRetainBackups, "Automatic backups"},
+	}
+
+	entries := make(map[string]*widget.Entry)
+	form := widget.NewForm()
+	for _, kind := range kinds {
+		key := kind.key
+		entry := widget.NewEntry()
+		entry.SetPlaceHolder(defaultRetention[key].String())
+		if value := getSetting(db, key, ""); value != "" {
+			entry.SetText(value)
+		}
+		entry.Validator = func(text string) error {
+			_, err := parseRetention(key, text)
+			return err
+		}
+		entries[key] = entry
+		form.Append(kind.label, entry)
+	}
+
+	note := widget.NewLabel("How many entries, how many days (90d) and for backups how large (500MB) to keep, separated by commas. Whatever is past any of them is dropped, empty keeps the default.")
+	note.Wrapping = fyne.TextWrapWord
+
+	d := dialog.NewCustomConfirm("Retention", "Save", "Cancel", container.NewBorder(note, nil, nil, nil, form), func(ok bool) {
+		if !ok {
+			return
+		}
+		for _, kind := range kinds {
+			if err := setRetention(db, kind.key, entries[kind.key].Text); err != nil {
+				dialog.ShowError(err, parent)
+				return
+			}
+		}
+		go pruneAll(db)
+	}, parent)
+	d.Resize(fyne.NewSize(560, 340))
+	d.Show()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	day := 24 * time.Hour
+	tests := []struct {
+		key     string
+		value   string
+		want    retentionPolicy
+		wantErr bool
+	}{
+		{key: settingRetainActivity, value: "", want: defaultRetention[settingRetainActivity]},
+		{key: settingRetainBackups, value: "  ", want: defaultRetention[settingRetainBackups]},
+		{key: settingRetainActivity, value: "500", want: retentionPolicy{MaxEntries: 500}},
+		{key: settingRetainHistory, value: "90d", want: retentionPolicy{MaxAge: 90 * day}},
+		{key: settingRetainHistory, value: "100, 30D", want: retentionPolicy{MaxEntries: 100, MaxAge: 30 * day}},
+		{key: settingRetainBackups, value: "20,500mb", want: retentionPolicy{MaxEntries: 20, MaxBytes: 500 << 20}},
+		{key: settingRetainBackups, value: "2GB", want: retentionPolicy{MaxBytes: 2 << 30}},
+		{key: settingRetainActivity, value: "500MB", wantErr: true},
+		{key: settingRetainActivity, value: "0", wantErr: true},
+		{key: settingRetainActivity, value: "-5", wantErr: true},
+		{key: settingRetainActivity, value: "d", wantErr: true},
+		{key: settingRetainActivity, value: "90w", wantErr: true},
+		{key: settingRetainActivity, value: "100,", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseRetention(test.key, test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseRetention(%q, %q) = %+v, want an error", test.key, test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRetention(%q, %q) returned %v", test.key, test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseRetention(%q, %q) = %+v, want %+v", test.key, test.value, got, test.want)
+		}
+	}
+}
+
+func TestRetentionStringRoundTrips(t *testing.T) {
+	for _, value := range []string{"500", "90d", "20, 30d, 500MB"} {
+		policy, err := parseRetention(settingRetainBackups, value)
+		if err != nil {
+			t.Fatalf("parseRetention(%q) returned %v", value, err)
+		}
+		if got := policy.String(); got != value {
+			t.Errorf("parseRetention(%q).String() = %q", value, got)
+		}
+	}
+}
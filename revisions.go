@@ -0,0 +1,92 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// anyRevision saves over a profile whatever its revision is
+const anyRevision = -1
+
+// staleRevisionError is returned when a profile was changed by someone else
+// after it was read, e.g. the CLI saving while the window had it open
+type staleRevisionError struct {
+	ProfileName string
+	Expected    int
+	Current     int
+}
+
+func (e *staleRevisionError) Error() string {
+	return fmt.Sprintf("profile '%s' was changed elsewhere since it was opened (revision %d, expected %d)",
+		e.ProfileName, e.Current, e.Expected)
+}
+
+// Gets the revision of a profile, 0 for profiles that don't exist yet
+func getProfileRevision(db *sql.DB, profileName string) (int, error) {
+	var revision int
+	err := db.QueryRow("SELECT revision FROM profiles WHERE name = ?", profileName).Scan(&revision)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error reading profile revision: %v", err)
+	}
+	return revision, nil
+}
+
+// Moves a profile to its next revision as part of a write and notes when it
+// changed, failing if it isn't at the expected revision
+func bumpRevision(tx *sql.Tx, profileName string, profileID int, expected int) error {
+	var current int
+	if err := tx.QueryRow("SELECT revision FROM profiles WHERE id = ?", profileID).Scan(&current); err != nil {
+		return fmt.Errorf("error reading profile revision: %v", err)
+	}
+	if expected != anyRevision && current != expected {
+		return &staleRevisionError{ProfileName: profileName, Expected: expected, Current: current}
+	}
+
+	if _, err := tx.Exec("UPDATE profiles SET revision = ?, updated_at = ? WHERE id = ?", current+1, time.Now(), profileID); err != nil {
+		return fmt.Errorf("error updating profile revision: %v", err)
+	}
+	return nil
+}
+
+// Combines a fresh capture with the saved windows it doesn't include, so
+// windows another save added aren't lost
+func mergeStates(saved, captured []WindowState) []WindowState {
+	have := make(map[windowKey]bool)
+	for _, state := range captured {
+		have[keyOf(state)] = true
+	}
+
+	merged := append([]WindowState(nil), captured...)
+	for _, state := range saved {
+		if !have[keyOf(state)] {
+			merged = append(merged, state)
+		}
+	}
+	return merged
+}
+
+// Asks what to do when saving over a profile that changed in the meantime
+func showStaleRevisionDialog(stale *staleRevisionError, parent fyne.Window, overwrite, merge func()) {
+	message := widget.NewLabel(fmt.Sprintf("'%s' was saved somewhere else since you opened it.\n"+
+		"Overwrite it with this capture, or merge in the windows only the other save has?", stale.ProfileName))
+
+	var d *dialog.CustomDialog
+	d = dialog.NewCustomWithoutButtons("Profile Changed", message, parent)
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Cancel", func() { d.Hide() }),
+		widget.NewButton("Merge", func() {
+			d.Hide()
+			merge()
+		}),
+		widget.NewButton("Overwrite", func() {
+			d.Hide()
+			overwrite()
+		}),
+	})
+	d.Show()
+}
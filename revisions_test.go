@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeStates(t *testing.T) {
+	editor := WindowState{AppName: "Code", WindowTitle: "main.go", X: 10}
+	editorMoved := WindowState{AppName: "Code", WindowTitle: "main.go", X: 500}
+	browser := WindowState{AppName: "Safari", WindowTitle: "Docs"}
+	terminal := WindowState{AppName: "Terminal", WindowTitle: "zsh"}
+
+	tests := []struct {
+		name     string
+		saved    []WindowState
+		captured []WindowState
+		want     []WindowState
+	}{
+		{
+			name:     "nothing saved",
+			captured: []WindowState{editor},
+			want:     []WindowState{editor},
+		},
+		{
+			name:  "nothing captured",
+			saved: []WindowState{editor, browser},
+			want:  []WindowState{editor, browser},
+		},
+		{
+			name:     "capture wins for the same window",
+			saved:    []WindowState{editor},
+			captured: []WindowState{editorMoved},
+			want:     []WindowState{editorMoved},
+		},
+		{
+			name:     "saved windows missing from the capture are kept after it",
+			saved:    []WindowState{terminal, editor, browser},
+			captured: []WindowState{editorMoved},
+			want:     []WindowState{editorMoved, terminal, browser},
+		},
+	}
+	for _, test := range tests {
+		got := mergeStates(test.saved, test.captured)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: mergeStates = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMergeStatesLeavesCaptureAlone(t *testing.T) {
+	captured := make([]WindowState, 1, 4)
+	captured[0] = WindowState{AppName: "Code"}
+	mergeStates([]WindowState{{AppName: "Safari"}}, captured)
+	if got := captured[:2][1]; got.AppName != "" {
+		t.Errorf("mergeStates wrote %+v into the capture's backing array", got)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+)
+
+// Gets whether a profile's windows are kept as fractions of their display,
+// so they scale to a display with another resolution
+func getScaleToDisplay(db *sql.DB, profileName string) (bool, error) {
+	var scale bool
+	err := db.QueryRow("SELECT scale_to_display FROM profiles WHERE name = ?", profileName).Scan(&scale)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading profile: %v", err)
+	}
+	return scale, nil
+}
+
+func setScaleToDisplay(db *sql.DB, profileName string, scale bool) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET scale_to_display = ? WHERE name = ?", scale, profileName)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+	return nil
+}
+
+// Gets the connected displays, nil if the backend can't list them
+func connectedDisplays(backend WindowBackend) []Display {
+	lister, ok := backend.(DisplayLister)
+	if !ok {
+		return nil
+	}
+	displays, err := lister.Displays()
+	if err != nil {
+		log.Printf("Error listing displays: %v", err)
+	}
+	return displays
+}
+
+// Turns each window's place on the display it was saved on into the same
+// fraction of that display now, or of the first display if it's gone, so a
+// layout saved on a 4K screen fills a 1440p one the same way. States saved
+// without their display's size are left as they are.
+func scaleToDisplays(states []WindowState, displays []Display) []WindowState {
+	if len(displays) == 0 {
+		return states
+	}
+
+	scaled := make([]WindowState, len(states))
+	copy(scaled, states)
+	for i, state := range scaled {
+		if state.DisplayWidth <= 0 || state.DisplayHeight <= 0 {
+			continue
+		}
+
+		display := displays[0]
+		for _, d := range displays {
+			if d.ID == state.DisplayID {
+				display = d
+				break
+			}
+		}
+
+		scaleX := display.Width / state.DisplayWidth
+		scaleY := display.Height / state.DisplayHeight
+		scaled[i].X = math.Round(display.X + (state.X-state.DisplayX)*scaleX)
+		scaled[i].Y = math.Round(display.Y + (state.Y-state.DisplayY)*scaleY)
+		scaled[i].Width = math.Round(state.Width * scaleX)
+		scaled[i].Height = math.Round(state.Height * scaleY)
+		scaled[i].DisplayID = display.ID
+		scaled[i].DisplayX = display.X
+		scaled[i].DisplayY = display.Y
+		scaled[i].DisplayWidth = display.Width
+		scaled[i].DisplayHeight = display.Height
+	}
+	return scaled
+}
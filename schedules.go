@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// triggerSchedule applies the profile at the times in Spec, e.g.
+// "weekdays 09:00"
+const triggerSchedule = "schedule"
+
+// Missed times older than this aren't caught up on, e.g. after the computer
+// wakes from sleep, so an old layout doesn't suddenly replace the windows
+const scheduleCatchUp = 5 * time.Minute
+
+// schedule is a time of day on some days of the week
+type schedule struct {
+	Days   [7]bool
+	Minute int
+}
+
+// Names for groups of days, alongside the day names themselves
+var scheduleDayGroups = map[string][]time.Weekday{
+	"daily":    {time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+var scheduleDayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Parses a schedule such as "weekdays 09:00", "mon,wed,fri 08:30" or just
+// "18:00" for every day
+func parseSchedule(spec string) (schedule, error) {
+	var s schedule
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 0 || len(fields) > 2 {
+		return schedule{}, fmt.Errorf("invalid schedule %q, use e.g. \"weekdays 09:00\"", spec)
+	}
+
+	minute, err := parseClock(fields[len(fields)-1])
+	if err != nil {
+		return schedule{}, err
+	}
+	s.Minute = minute
+
+	if len(fields) == 1 {
+		fields = []string{"daily", fields[0]}
+	}
+	for _, day := range strings.Split(fields[0], ",") {
+		day = strings.TrimSpace(day)
+		if group, ok := scheduleDayGroups[day]; ok {
+			for _, weekday := range group {
+				s.Days[weekday] = true
+			}
+			continue
+		}
+		found := false
+		for i, name := range scheduleDayNames {
+			if strings.HasPrefix(day, name) {
+				s.Days[i] = true
+				found = true
+			}
+		}
+		if !found {
+			return schedule{}, fmt.Errorf("unknown day %q in schedule %q", day, spec)
+		}
+	}
+	return s, nil
+}
+
+// Formats the schedule the way it's stored
+func (s schedule) String() string {
+	clock := fmt.Sprintf("%02d:%02d", s.Minute/60, s.Minute%60)
+	for _, name := range []string{"daily", "weekdays", "weekends"} {
+		var days [7]bool
+		for _, weekday := range scheduleDayGroups[name] {
+			days[weekday] = true
+		}
+		if days == s.Days {
+			return name + " " + clock
+		}
+	}
+
+	var days []string
+	for i, on := range s.Days {
+		if on {
+			days = append(days, scheduleDayNames[i])
+		}
+	}
+	return strings.Join(days, ",") + " " + clock
+}
+
+// Checks whether the schedule is due in the minute of t
+func (s schedule) due(t time.Time) bool {
+	return s.Days[t.Weekday()] && t.Hour()*60+t.Minute() == s.Minute
+}
+
+// Assigns a profile to a schedule, replacing whatever was scheduled at the
+// same time before
+func saveScheduleTrigger(db *sql.DB, spec, profileName string) error {
+	s, err := parseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	var profileID int
+	err = db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	_, err = db.Exec(
+		"DELETE FROM triggers WHERE kind = ? AND spec = ? AND profile_id IN ("+ownProfileIDs+")",
+		triggerSchedule, s.String(), currentUsername(),
+	)
+	if err != nil {
+		return fmt.Errorf("error replacing trigger: %v", err)
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO triggers (kind, spec, profile_id, enabled) VALUES (?, ?, ?, 1)",
+		triggerSchedule, s.String(), profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving trigger: %v", err)
+	}
+	return nil
+}
+
+// Applies the scheduled profiles when their time comes. Checks every minute
+// since the last check, so a late tick doesn't skip one.
+func watchSchedules(engine *restoreEngine, hooks triggerHooks) {
+	last := time.Now().Truncate(time.Minute)
+	for {
+		time.Sleep(time.Until(last.Add(time.Minute)))
+		now := time.Now().Truncate(time.Minute)
+		if now.Sub(last) > scheduleCatchUp {
+			last = now.Add(-time.Minute)
+		}
+
+		triggers, err := getTriggers(engine.db, triggerSchedule)
+		if err != nil {
+			log.Printf("Error finding schedule triggers: %v", err)
+			last = now
+			continue
+		}
+
+		for minute := last.Add(time.Minute); !minute.After(now); minute = minute.Add(time.Minute) {
+			for _, trigger := range triggers {
+				trigger := trigger
+				if !trigger.Enabled {
+					continue
+				}
+				s, err := parseSchedule(trigger.Spec)
+				if err != nil {
+					log.Printf("Error reading schedule: %v", err)
+					continue
+				}
+				if !s.due(minute) {
+					continue
+				}
+				fireTrigger(engine, &trigger, fmt.Sprintf("It's %s — apply '%s' profile?", minute.Format("15:04"), trigger.ProfileName), hooks)
+			}
+		}
+		last = now
+	}
+}
+
+// Shows the scheduled profiles and lets the user add, turn off and remove
+// them
+func showSchedulesDialog(db *sql.DB, parent fyne.Window) {
+	profiles, err := getProfiles(db)
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	list := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		triggers, err := getTriggers(db, triggerSchedule)
+		if err != nil {
+			list.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(triggers) == 0 {
+			list.Add(widget.NewLabel("No schedules yet"))
+		}
+		for _, trigger := range triggers {
+			trigger := trigger
+			text := fmt.Sprintf("%s → %s", trigger.Spec, trigger.ProfileName)
+			if trigger.QuietStart != "" {
+				text += fmt.Sprintf(" (quiet %s–%s)", trigger.QuietStart, trigger.QuietEnd)
+			}
+			label := widget.NewLabel(text)
+			enabled := widget.NewCheck("", func(checked bool) {
+				if err := setTriggerEnabled(db, trigger.ID, checked); err != nil {
+					dialog.ShowError(err, parent)
+				}
+			})
+			enabled.SetChecked(trigger.Enabled)
+			quiet := widget.NewButton("Quiet Hours…", func() {
+				showQuietHoursDialog(db, trigger, parent, refresh)
+			})
+			remove := widget.NewButton("Remove", func() {
+				if err := deleteTrigger(db, trigger.ID); err != nil {
+					dialog.ShowError(err, parent)
+				}
+				refresh()
+			})
+			list.Add(container.NewBorder(nil, nil, enabled, container.NewHBox(quiet, remove), label))
+		}
+	}
+	refresh()
+
+	whenEntry := widget.NewEntry()
+	whenEntry.SetPlaceHolder("weekdays 09:00")
+	profileSelect := widget.NewSelect(profiles, nil)
+	profileSelect.PlaceHolder = "Choose a profile"
+	addButton := widget.NewButton("Add", func() {
+		if profileSelect.Selected == "" {
+			return
+		}
+		if err := saveScheduleTrigger(db, whenEntry.Text, profileSelect.Selected); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		whenEntry.SetText("")
+		refresh()
+	})
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 180))
+
+	content := container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("When:"), nil, whenEntry),
+		container.NewBorder(nil, nil, nil, addButton, profileSelect),
+		widget.NewLabel("Days can be daily, weekdays, weekends or a list like mon,wed,fri"),
+		widget.NewSeparator(),
+		scroll,
+	)
+	dialog.ShowCustom("Schedules", "Close", content, parent)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	weekdays := [7]bool{false, true, true, true, true, true, false}
+	everyDay := [7]bool{true, true, true, true, true, true, true}
+	tests := []struct {
+		spec    string
+		want    schedule
+		wantErr bool
+	}{
+		{spec: "weekdays 09:00", want: schedule{Days: weekdays, Minute: 9 * 60}},
+		{spec: "18:30", want: schedule{Days: everyDay, Minute: 18*60 + 30}},
+		{spec: "daily 00:00", want: schedule{Days: everyDay}},
+		{spec: "weekends 10:15", want: schedule{Days: [7]bool{true, false, false, false, false, false, true}, Minute: 10*60 + 15}},
+		{spec: "mon,wed,fri 08:30", want: schedule{Days: [7]bool{false, true, false, true, false, true, false}, Minute: 8*60 + 30}},
+		{spec: "Monday,Sunday 23:59", want: schedule{Days: [7]bool{true, true, false, false, false, false, false}, Minute: 23*60 + 59}},
+		{spec: "", wantErr: true},
+		{spec: "weekdays", wantErr: true},
+		{spec: "weekdays 09:00 extra", wantErr: true},
+		{spec: "weekdays 24:00", wantErr: true},
+		{spec: "someday 09:00", wantErr: true},
+		{spec: "mon,,fri 09:00", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := parseSchedule(test.spec)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseSchedule(%q) = %+v, want an error", test.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSchedule(%q) returned %v", test.spec, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseSchedule(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestScheduleString(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"weekdays 09:00", "weekdays 09:00"},
+		{"mon,tue,wed,thu,fri 09:00", "weekdays 09:00"},
+		{"18:00", "daily 18:00"},
+		{"sat,sun 07:05", "weekends 07:05"},
+		{"fri,mon 12:00", "mon,fri 12:00"},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.spec)
+		if err != nil {
+			t.Fatalf("parseSchedule(%q) returned %v", test.spec, err)
+		}
+		if got := s.String(); got != test.want {
+			t.Errorf("parseSchedule(%q).String() = %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	s, err := parseSchedule("weekdays 09:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2024-01-01 was a Monday
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local), true},
+		{time.Date(2024, 1, 1, 9, 0, 59, 0, time.Local), true},
+		{time.Date(2024, 1, 1, 9, 1, 0, 0, time.Local), false},
+		{time.Date(2024, 1, 6, 9, 0, 0, 0, time.Local), false},
+	}
+	for _, test := range tests {
+		if got := s.due(test.at); got != test.want {
+			t.Errorf("due(%v) = %v, want %v", test.at, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include <Carbon/Carbon.h>
+#include <dispatch/dispatch.h>
+#include <pthread.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+
+// AppleScript commands from wisa.sdef arrive as Apple Events on the main
+// thread. Each one is suspended and written to the request pipe, and Go
+// answers it with wisa_answer_script once the command has run, so a long
+// restore doesn't hold up the main thread.
+static int wisa_script_requests[2] = {-1, -1};
+
+// A suspended command waiting for its answer
+typedef struct {
+	AppleEvent event;
+	AppleEvent reply;
+	char verb;
+	int32_t status;
+	char *text;
+	int32_t size;
+} wisa_pending_script;
+
+static OSErr wisa_script_event(const AppleEvent *event, AppleEvent *reply, SRefCon refcon) {
+	char verb = (char)(intptr_t)refcon;
+	char *profile = NULL;
+	int32_t length = 0;
+	if (verb != 'l') {
+		AEDesc desc;
+		if (AEGetParamDesc(event, keyDirectObject, typeUTF8Text, &desc) != noErr) {
+			return errAEDescNotFound;
+		}
+		length = (int32_t)AEGetDescDataSize(&desc);
+		profile = malloc(length);
+		if (profile == NULL || AEGetDescData(&desc, profile, length) != noErr) {
+			free(profile);
+			AEDisposeDesc(&desc);
+			return errAEEventFailed;
+		}
+		AEDisposeDesc(&desc);
+	}
+
+	wisa_pending_script *pending = calloc(1, sizeof(wisa_pending_script));
+	if (pending == NULL || AESuspendTheCurrentEvent(event) != noErr) {
+		free(pending);
+		free(profile);
+		return errAEEventFailed;
+	}
+	pending->event = *event;
+	pending->reply = *reply;
+	pending->verb = verb;
+
+	uint64_t id = (uint64_t)(uintptr_t)pending;
+	write(wisa_script_requests[1], &id, sizeof(id));
+	write(wisa_script_requests[1], &verb, 1);
+	write(wisa_script_requests[1], &length, sizeof(length));
+	if (length > 0) {
+		write(wisa_script_requests[1], profile, length);
+	}
+	free(profile);
+	return noErr;
+}
+
+// Fills in the reply of a suspended command and sends it, on the main thread
+static void wisa_resume_script(void *context) {
+	wisa_pending_script *pending = context;
+	AppleEvent *reply = &pending->reply;
+	const char *text = pending->text != NULL ? pending->text : "";
+
+	if (reply->descriptorType == typeNull) {
+		// The script didn't ask for a result
+	} else if (pending->status != 0) {
+		SInt32 number = errAEEventFailed;
+		AEPutParamPtr(reply, keyErrorNumber, typeSInt32, &number, sizeof(number));
+		AEPutParamPtr(reply, keyErrorString, typeUTF8Text, text, pending->size);
+	} else if (pending->verb == 'l') {
+		// Profile names come one per line
+		AEDescList list;
+		if (AECreateList(NULL, 0, false, &list) == noErr) {
+			const char *start = text;
+			while (*start != '\0') {
+				const char *end = strchr(start, '\n');
+				size_t n = end ? (size_t)(end - start) : strlen(start);
+				AEPutPtr(&list, 0, typeUTF8Text, start, n);
+				start += end ? n + 1 : n;
+			}
+			AEPutParamDesc(reply, keyDirectObject, &list);
+			AEDisposeDesc(&list);
+		}
+	} else {
+		SInt32 count = (SInt32)atoi(text);
+		AEPutParamPtr(reply, keyDirectObject, typeSInt32, &count, sizeof(count));
+	}
+
+	AEResumeTheCurrentEvent(&pending->event, reply, (AEEventHandlerUPP)kAENoDispatch, 0);
+	free(pending->text);
+	free(pending);
+}
+
+// Answers the suspended command with the given ID, from any thread
+static void wisa_answer_script(uint64_t id, int32_t status, const char *text, int32_t size) {
+	wisa_pending_script *pending = (wisa_pending_script *)(uintptr_t)id;
+	pending->status = status;
+	pending->text = malloc(size + 1);
+	if (pending->text == NULL) {
+		pending->status = 1;
+		pending->size = 0;
+	} else {
+		memcpy(pending->text, text, size);
+		pending->text[size] = '\0';
+		pending->size = size;
+	}
+	dispatch_async_f(dispatch_get_main_queue(), pending, wisa_resume_script);
+}
+
+static void wisa_install_script_handlers(void *result) {
+	AEEventHandlerUPP handler = NewAEEventHandlerUPP(wisa_script_event);
+	OSErr err = AEInstallEventHandler('Wisa', 'Rstr', handler, (SRefCon)(intptr_t)'r', false);
+	if (err == noErr) {
+		err = AEInstallEventHandler('Wisa', 'Save', handler, (SRefCon)(intptr_t)'s', false);
+	}
+	if (err == noErr) {
+		err = AEInstallEventHandler('Wisa', 'List', handler, (SRefCon)(intptr_t)'l', false);
+	}
+	*(OSErr *)result = err;
+}
+
+// Installs the handlers for the AppleScript commands on the main thread,
+// returns the pipe to read requests from, -1 on failure
+static int wisa_listen_for_scripts(void) {
+	if (pipe(wisa_script_requests) != 0) {
+		return -1;
+	}
+	OSErr result = noErr;
+	if (pthread_main_np()) {
+		wisa_install_script_handlers(&result);
+	} else {
+		dispatch_sync_f(dispatch_get_main_queue(), &result, wisa_install_script_handlers);
+	}
+	if (result != noErr) {
+		return -1;
+	}
+	return wisa_script_requests[0];
+}
+*/
+import "C"
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// Answers the AppleScript commands in wisa.sdef: restore profile, save
+// profile and list profiles. Each runs on its own goroutine so a script
+// waiting on a restore doesn't hold up the others.
+func listenForScripts(engine *restoreEngine, hooks triggerHooks) {
+	fd := int(C.wisa_listen_for_scripts())
+	if fd < 0 {
+		log.Printf("Error installing the AppleScript handlers")
+		return
+	}
+	requests := os.NewFile(uintptr(fd), "script requests")
+
+	go func() {
+		for {
+			var id uint64
+			var verb byte
+			var length int32
+			if err := binary.Read(requests, binary.NativeEndian, &id); err != nil {
+				log.Printf("Error reading AppleScript command: %v", err)
+				return
+			}
+			if err := binary.Read(requests, binary.NativeEndian, &verb); err != nil {
+				log.Printf("Error reading AppleScript command: %v", err)
+				return
+			}
+			if err := binary.Read(requests, binary.NativeEndian, &length); err != nil {
+				log.Printf("Error reading AppleScript command: %v", err)
+				return
+			}
+			profileName := make([]byte, length)
+			if _, err := io.ReadFull(requests, profileName); err != nil {
+				log.Printf("Error reading AppleScript command: %v", err)
+				return
+			}
+
+			go func() {
+				text, err := runScriptCommand(engine, hooks, verb, string(profileName))
+				status := int32(0)
+				if err != nil {
+					status, text = 1, err.Error()
+				}
+				ctext := C.CString(text)
+				defer C.free(unsafe.Pointer(ctext))
+				C.wisa_answer_script(C.uint64_t(id), C.int32_t(status), ctext, C.int32_t(len(text)))
+			}()
+		}
+	}()
+}
+
+// Runs one AppleScript command and returns its result as text
+func runScriptCommand(engine *restoreEngine, hooks triggerHooks, verb byte, profileName string) (string, error) {
+	switch verb {
+	case 'l':
+		profiles, err := getProfiles(engine.db)
+		return strings.Join(profiles, "\n"), err
+	case 's':
+		backend := engine.backend
+		states := captureForSave(backend)
+		err := saveWindowStates(engine.db, profileName, currentArrangement(backend), states)
+		hooks.Saved(profileName, len(states), err)
+		return strconv.Itoa(len(states)), err
+	case 'r':
+		type result struct {
+			count int
+			err   error
+		}
+		done := make(chan result, 1)
+		engine.Enqueue(profileName, "applescript", restoreOptions{}, func(count int, err error) {
+			hooks.Notify(profileName, count, err)
+			done <- result{count, err}
+		})
+		res := <-done
+		return strconv.Itoa(res.count), res.err
+	default:
+		return "", fmt.Errorf("unknown command %q", verb)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !(darwin && cgo)
+
+package main
+
+// AppleScript is only available on macOS
+func listenForScripts(engine *restoreEngine, hooks triggerHooks) {}
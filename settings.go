@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Setting keys
+const (
+	// settingRestoreDND turns on Do Not Disturb while a restore runs
+	settingRestoreDND = "restore_dnd"
+	// settingDisplaySettle is how long the displays must stay unchanged
+	// before a display trigger runs
+	settingDisplaySettle = "display_settle"
+	// settingConfirmTriggers asks before automatic triggers restore anything
+	settingConfirmTriggers = "confirm_triggers"
+	// settingAPIEnabled starts the local API along with the window or daemon
+	settingAPIEnabled = "api_enabled"
+	// settingAPIPort is the localhost port the local API listens on
+	settingAPIPort = "api_port"
+	// settingCaptureIgnore lists the apps that are never captured
+	settingCaptureIgnore = "capture_ignore"
+	// settingCaptureOnly lists the only apps captured, every app when empty
+	settingCaptureOnly = "capture_only"
+	// settingSnapGrid is the grid captured windows are snapped to when
+	// saved, see parseSnapGrid
+	settingSnapGrid = "snap_grid"
+	// settingImportHosts lists the hosts exports can be imported from by
+	// URL, any host when empty
+	settingImportHosts = "import_hosts"
+	// settingImportKeys lists the public keys one of which must have signed
+	// an export imported by URL, none needed when empty
+	settingImportKeys = "import_keys"
+	// settingStaleAfterDays is how many days a display must be gone before
+	// the profiles using it count as stale
+	settingStaleAfterDays = "stale_after_days"
+	// settingRestoreConcurrency is the most windows restored at once, see
+	// restoreEach
+	settingRestoreConcurrency = "restore_concurrency"
+	// settingCommandTimeout is how many seconds a command like osascript may
+	// run before it's killed
+	settingCommandTimeout = "command_timeout"
+	// The retention settings are how much of each log or history is kept,
+	// see parseRetention
+	settingRetainActivity = "retain_activity"
+	settingRetainHistory  = "retain_history"
+	settingRetainJournal  = "retain_journal"
+	settingRetainBackups  = "retain_backups"
+	// settingSetupDone is set once the setup wizard was finished or skipped
+	settingSetupDone = "setup_done"
+	// settingCloseToTray keeps wisa running in the tray when its window is
+	// closed
+	settingCloseToTray = "close_to_tray"
+	// settingDefaultTitleMatch is how windows without their own title
+	// matching are matched, see matching.go
+	settingDefaultTitleMatch = "default_title_match"
+	// settingTheme is light, dark or empty to follow the system
+	settingTheme = "theme"
+	// settingLinkSaves lets wisa:// links save profiles without asking
+	settingLinkSaves = "link_saves"
+	// settingLinkHooks lets wisa:// links restore profiles with hooks
+	// without asking
+	settingLinkHooks = "link_hooks"
+)
+
+// Setting keys that can be provisioned
+var knownSettings = map[string]bool{
+	settingRestoreDND:         true,
+	settingDisplaySettle:      true,
+	settingConfirmTriggers:    true,
+	settingAPIEnabled:         true,
+	settingAPIPort:            true,
+	settingCaptureIgnore:      true,
+	settingCaptureOnly:        true,
+	settingSnapGrid:           true,
+	settingImportHosts:        true,
+	settingImportKeys:         true,
+	settingStaleAfterDays:     true,
+	settingRestoreConcurrency: true,
+	settingCommandTimeout:     true,
+	settingRetainActivity:     true,
+	settingRetainHistory:      true,
+	settingRetainJournal:      true,
+	settingRetainBackups:      true,
+	settingSetupDone:          true,
+	settingCloseToTray:        true,
+	settingDefaultTitleMatch:  true,
+	settingTheme:              true,
+	settingLinkSaves:          true,
+	settingLinkHooks:          true,
+}
+
+// How long to wait for displays to settle when it was never set
+const defaultDisplaySettle = 2 * time.Second
+
+// Reloads the settings kept in memory, at startup and after several settings
+// changed at once
+func loadSettings(db *sql.DB) {
+	loadCaptureFilter(db)
+	loadSnapGrid(db)
+	loadRestoreConcurrency(db)
+	loadCommandTimeout(db)
+	loadRetention(db)
+	loadDefaultMatch(db)
+}
+
+// Gets a setting, or fallback if it was never set
+func getSetting(db *sql.DB, key, fallback string) string {
+	var value string
+	err := db.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error reading setting %s: %v", key, err)
+		}
+		return fallback
+	}
+	return value
+}
+
+func setSetting(db *sql.DB, key, value string) error {
+	_, err := db.Exec("INSERT OR REPLACE INTO settings (key, value) VALUES (?, ?)", key, value)
+	if err != nil {
+		return fmt.Errorf("error saving setting %s: %v", key, err)
+	}
+	return nil
+}
+
+func getBoolSetting(db *sql.DB, key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getSetting(db, key, strconv.FormatBool(fallback)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func setBoolSetting(db *sql.DB, key string, value bool) error {
+	return setSetting(db, key, strconv.FormatBool(value))
+}
+
+func getDurationSetting(db *sql.DB, key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getSetting(db, key, fallback.String()))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func setDurationSetting(db *sql.DB, key string, value time.Duration) error {
+	return setSetting(db, key, value.String())
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/widget"
+)
+
+// The profile the setup wizard offers to save the open windows to
+const defaultProfileName = "Default"
+
+// setupChoices is what was picked in the setup wizard that the window has to
+// act on
+type setupChoices struct {
+	// SaveDefault saves the open windows as the Default profile
+	SaveDefault bool
+	CloseToTray bool
+}
+
+// Whether the setup wizard should open, only the first time wisa opens on a
+// database without profiles. Databases that already have some are marked as
+// set up.
+func needsSetup(db *sql.DB, profiles []string) bool {
+	if getBoolSetting(db, settingSetupDone, false) {
+		return false
+	}
+	if len(profiles) > 0 {
+		if err := setBoolSetting(db, settingSetupDone, true); err != nil {
+			log.Printf("Error saving setting: %v", err)
+		}
+		return false
+	}
+	return true
+}
+
+// Whether the daemon's launchd job is installed
+func launchAgentInstalled() bool {
+	path, err := launchAgentPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Walks through the permissions wisa needs, what profiles are, saving the
+// open windows as a first profile and a few options. The options are saved
+// here, onFinish does the rest. Skipping also counts as set up.
+func showSetupWizard(db *sql.DB, parent fyne.Window, onFinish func(setupChoices)) {
+	// Permissions, checked again on request
+	permissionRows := container.NewVBox()
+	var checkAgain func()
+	checkAgain = func() {
+		permissionRows.RemoveAll()
+		statuses := checkPermissions()
+		if len(statuses) == 0 {
+			permissionRows.Add(widget.NewLabel("wisa doesn't need any permissions here, so there's nothing to grant."))
+			return
+		}
+		for _, status := range statuses {
+			text := status.Label() + ", granted"
+			if status.State != permissionGranted {
+				text = fmt.Sprintf("%s. %s %s", status.Label(), status.Why, status.Fix)
+			}
+			label := widget.NewLabel(text)
+			label.Wrapping = fyne.TextWrapWord
+			row := container.NewBorder(nil, nil, nil, nil, label)
+			if status.State != permissionGranted && status.SettingsURL != "" {
+				row = container.NewBorder(nil, nil, nil, widget.NewButton("Open Settings", func() {
+					openPermissionSettings(status)
+				}), label)
+			}
+			permissionRows.Add(row)
+		}
+		permissionRows.Add(widget.NewButton("Check Again", checkAgain))
+	}
+	checkAgain()
+
+	profilesText := widget.NewLabel("A profile is a saved set of windows: which apps, where they were and how big. " +
+		"Save one for each way you work, like Docked, Laptop or Presenting, and restore it to put every window back in place. " +
+		"Profiles can also restore themselves when displays change, at set times or with a hotkey.")
+	profilesText.Wrapping = fyne.TextWrapWord
+
+	saveDefault := widget.NewCheck(fmt.Sprintf("Save the windows open now as a profile named %s", defaultProfileName), nil)
+	saveDefault.SetChecked(true)
+
+	closeToTray := widget.NewCheck("Keep running in the tray when the window is closed", nil)
+	closeToTray.SetChecked(getBoolSetting(db, settingCloseToTray, false))
+	if _, ok := fyne.CurrentApp().(desktop.App); !ok {
+		closeToTray.Disable()
+	}
+	installed := launchAgentInstalled()
+	startAtLogin := widget.NewCheck("Run triggers in the background from login, with the daemon", nil)
+	startAtLogin.SetChecked(installed)
+	loginNote := widget.NewLabel("The daemon applies display, schedule and hotkey triggers while the window is closed.")
+	if runtime.GOOS != "darwin" {
+		startAtLogin.Disable()
+		loginNote.SetText("Starting at login is only set up for you on macOS, elsewhere add `wisa daemon` to your startup programs.")
+	}
+	loginNote.Wrapping = fyne.TextWrapWord
+
+	pages := []struct {
+		title   string
+		content fyne.CanvasObject
+	}{
+		{"Permissions", permissionRows},
+		{"Profiles", profilesText},
+		{"Your Windows", container.NewVBox(saveDefault, widget.NewLabel("You can pick which windows to keep when saving later profiles."))},
+		{"Options", container.NewVBox(closeToTray, startAtLogin, loginNote)},
+	}
+
+	title := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	body := container.NewStack()
+	page := 0
+
+	var d *dialog.CustomDialog
+	back := widget.NewButton("Back", nil)
+	next := widget.NewButton("Next", nil)
+	next.Importance = widget.HighImportance
+	show := func() {
+		title.SetText(fmt.Sprintf("%d of %d: %s", page+1, len(pages), pages[page].title))
+		body.Objects = []fyne.CanvasObject{container.NewVScroll(pages[page].content)}
+		body.Refresh()
+		if page == 0 {
+			back.Disable()
+		} else {
+			back.Enable()
+		}
+		next.SetText("Next")
+		if page == len(pages)-1 {
+			next.SetText("Finish")
+		}
+	}
+	done := func() {
+		if err := setBoolSetting(db, settingSetupDone, true); err != nil {
+			log.Printf("Error saving setting: %v", err)
+		}
+	}
+	back.OnTapped = func() {
+		page--
+		show()
+	}
+	next.OnTapped = func() {
+		if page < len(pages)-1 {
+			page++
+			show()
+			return
+		}
+		d.Hide()
+		done()
+
+		if err := setBoolSetting(db, settingCloseToTray, closeToTray.Checked); err != nil {
+			dialog.ShowError(err, parent)
+		}
+		if startAtLogin.Checked != installed {
+			var err error
+			if startAtLogin.Checked {
+				err = installLaunchAgent()
+			} else {
+				err = uninstallLaunchAgent()
+			}
+			if err != nil {
+				dialog.ShowError(err, parent)
+			}
+		}
+		onFinish(setupChoices{SaveDefault: saveDefault.Checked, CloseToTray: closeToTray.Checked})
+	}
+	show()
+
+	d = dialog.NewCustomWithoutButtons("Welcome to wisa", container.NewBorder(title, nil, nil, nil, body), parent)
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Skip", func() {
+			d.Hide()
+			done()
+		}),
+		back,
+		next,
+	})
+	d.Resize(fyne.NewSize(560, 380))
+	d.Show()
+}
@@ -0,0 +1,86 @@
+//go:build darwin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+)
+
+// yabaiWindow is the part of `yabai -m query --windows` output wisa uses.
+// macOS has no public API for Spaces so they are only tracked when yabai
+// is installed.
+type yabaiWindow struct {
+	ID    int    `json:"id"`
+	App   string `json:"app"`
+	Title string `json:"title"`
+	Space int    `json:"space"`
+}
+
+// Lists the windows yabai knows about along with their Space
+func listYabaiWindows() ([]yabaiWindow, error) {
+	if _, err := exec.LookPath("yabai"); err != nil {
+		return nil, fmt.Errorf("yabai is not installed: %v", err)
+	}
+
+	output, err := commandOutput("yabai", "-m", "query", "--windows")
+	if err != nil {
+		return nil, fmt.Errorf("error querying yabai: %v", err)
+	}
+
+	var windows []yabaiWindow
+	if err := json.Unmarshal(output, &windows); err != nil {
+		return nil, fmt.Errorf("error reading yabai windows: %v", err)
+	}
+	return windows, nil
+}
+
+// Fills in the Space of each state, leaving it at 0 when yabai isn't around
+func tagSpaces(states []WindowState) {
+	windows, err := listYabaiWindows()
+	if err != nil {
+		return
+	}
+
+	// Windows with the same app and title are matched in order
+	used := make(map[int]bool)
+	for i := range states {
+		for _, window := range windows {
+			if used[window.ID] || window.App != states[i].AppName || window.Title != states[i].WindowTitle {
+				continue
+			}
+			used[window.ID] = true
+			states[i].Space = window.Space
+			break
+		}
+	}
+}
+
+// Moves a window to its saved Space using yabai
+func moveToSpace(ctx context.Context, state WindowState) {
+	if state.Space == 0 {
+		return
+	}
+
+	windows, err := listYabaiWindows()
+	if err != nil {
+		return
+	}
+	for _, window := range windows {
+		if window.App != state.AppName || window.Title != state.WindowTitle {
+			continue
+		}
+		if window.Space == state.Space {
+			return
+		}
+		err := runCommandContext(ctx, "yabai", "-m", "window", strconv.Itoa(window.ID), "--space", strconv.Itoa(state.Space))
+		if err != nil {
+			log.Printf("Error moving %s - %s to Space %d: %v", state.AppName, state.WindowTitle, state.Space, err)
+		}
+		return
+	}
+}
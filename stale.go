@@ -0,0 +1,364 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// AppFinder is implemented by backends that can tell whether an app is
+// installed, for spotting profiles of apps that were removed
+type AppFinder interface {
+	AppInstalled(appName, bundleID string) (bool, error)
+}
+
+// How many days a display must be gone before profiles using it are stale,
+// when the stale_after_days setting isn't set
+const defaultStaleAfterDays = 90
+
+// Remembers that the connected displays were seen now
+func recordDisplaysSeen(db *sql.DB, displays []Display) {
+	now := time.Now()
+	for _, display := range displays {
+		if display.ID == "" {
+			continue
+		}
+		_, err := db.Exec("INSERT OR REPLACE INTO display_sightings (display_id, last_seen_at) VALUES (?, ?)", display.ID, now)
+		if err != nil {
+			log.Printf("Error recording display: %v", err)
+			return
+		}
+	}
+}
+
+// Gets when each display was last seen
+func getDisplaySightings(db *sql.DB) (map[string]time.Time, error) {
+	rows, err := db.Query("SELECT display_id, last_seen_at FROM display_sightings")
+	if err != nil {
+		return nil, fmt.Errorf("error querying displays: %v", err)
+	}
+	defer rows.Close()
+
+	sightings := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var seen time.Time
+		if err := rows.Scan(&id, &seen); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		sightings[id] = seen
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+	return sightings, nil
+}
+
+func getStaleAfterDays(db *sql.DB) int {
+	days, err := strconv.Atoi(getSetting(db, settingStaleAfterDays, strconv.Itoa(defaultStaleAfterDays)))
+	if err != nil || days < 1 {
+		return defaultStaleAfterDays
+	}
+	return days
+}
+
+// staleProfile is a profile with apps that are gone or displays that haven't
+// been seen in a while
+type staleProfile struct {
+	Name        string
+	MissingApps []string
+	// GoneDisplays are the IDs of displays not seen since the cutoff
+	GoneDisplays []string
+}
+
+func (p staleProfile) String() string {
+	var reasons []string
+	if len(p.MissingApps) > 0 {
+		reasons = append(reasons, "not installed: "+strings.Join(p.MissingApps, ", "))
+	}
+	if len(p.GoneDisplays) > 0 {
+		reasons = append(reasons, plural(len(p.GoneDisplays), "display")+" not seen lately")
+	}
+	return p.Name + " (" + strings.Join(reasons, "; ") + ")"
+}
+
+// staleCheck is what finding stale profiles needs, gathered once since
+// looking for apps is slow, so the cutoff can change without doing it again
+type staleCheck struct {
+	// Apps and displays of each profile
+	apps      map[string][]string
+	displays  map[string][]string
+	missing   map[string]bool
+	sightings map[string]time.Time
+}
+
+// Gathers the apps and displays of the current user's profiles, which of
+// the apps are missing and when the displays were last seen. Apps are only
+// missing when the backend can look for them and they aren't running.
+func gatherStaleCheck(db *sql.DB, backend WindowBackend) (*staleCheck, error) {
+	recordDisplaysSeen(db, connectedDisplays(backend))
+
+	profiles, err := getProfiles(db)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[string]bool)
+	for _, profileName := range profiles {
+		visible[profileName] = true
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT p.name, w.app_name, w.bundle_id, w.display_id FROM window_states w
+		JOIN profiles p ON p.id = w.profile_id`)
+	if err != nil {
+		return nil, fmt.Errorf("error querying window states: %v", err)
+	}
+	defer rows.Close()
+
+	check := &staleCheck{
+		apps:     make(map[string][]string),
+		displays: make(map[string][]string),
+		missing:  make(map[string]bool),
+	}
+	bundleIDs := make(map[string]string)
+	seenApp := make(map[[2]string]bool)
+	seenDisplay := make(map[[2]string]bool)
+	for rows.Next() {
+		var profileName, appName, bundleID, displayID string
+		if err := rows.Scan(&profileName, &appName, &bundleID, &displayID); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		if !visible[profileName] {
+			continue
+		}
+		if !seenApp[[2]string{profileName, appName}] {
+			seenApp[[2]string{profileName, appName}] = true
+			check.apps[profileName] = append(check.apps[profileName], appName)
+		}
+		if bundleID != "" {
+			bundleIDs[appName] = bundleID
+		}
+		if displayID != "" && !seenDisplay[[2]string{profileName, displayID}] {
+			seenDisplay[[2]string{profileName, displayID}] = true
+			check.displays[profileName] = append(check.displays[profileName], displayID)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	if check.sightings, err = getDisplaySightings(db); err != nil {
+		return nil, err
+	}
+
+	finder, ok := backend.(AppFinder)
+	if !ok {
+		return check, nil
+	}
+	var running map[string]bool
+	if launcher, ok := backend.(AppLauncher); ok {
+		if running, err = launcher.RunningApps(); err != nil {
+			log.Printf("Error listing running apps: %v", err)
+		}
+	}
+	looked := make(map[string]bool)
+	for _, apps := range check.apps {
+		for _, appName := range apps {
+			if looked[appName] || running[appName] {
+				continue
+			}
+			looked[appName] = true
+			installed, err := finder.AppInstalled(appName, bundleIDs[appName])
+			if err != nil {
+				log.Printf("Error looking for %s: %v", appName, err)
+				continue
+			}
+			check.missing[appName] = !installed
+		}
+	}
+	return check, nil
+}
+
+// Lists the profiles with a missing app or a display not seen for days,
+// sorted by name
+func (c *staleCheck) staleProfiles(days int) []staleProfile {
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	names := make(map[string]bool)
+	for profileName := range c.apps {
+		names[profileName] = true
+	}
+	for profileName := range c.displays {
+		names[profileName] = true
+	}
+
+	var stale []staleProfile
+	for profileName := range names {
+		profile := staleProfile{Name: profileName}
+		for _, appName := range c.apps[profileName] {
+			if c.missing[appName] {
+				profile.MissingApps = append(profile.MissingApps, appName)
+			}
+		}
+		for _, displayID := range c.displays[profileName] {
+			// Displays never seen here came with an imported profile
+			if seen, ok := c.sightings[displayID]; !ok || seen.Before(cutoff) {
+				profile.GoneDisplays = append(profile.GoneDisplays, displayID)
+			}
+		}
+		if len(profile.MissingApps) > 0 || len(profile.GoneDisplays) > 0 {
+			stale = append(stale, profile)
+		}
+	}
+	sort.Slice(stale, func(i, j int) bool {
+		return stale[i].Name < stale[j].Name
+	})
+	return stale
+}
+
+// Hides a profile from the list and its triggers without deleting it
+func archiveProfile(db *sql.DB, profileName string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	result, err := db.Exec("UPDATE profiles SET archived_at = ? WHERE name = ? AND archived_at IS NULL", time.Now(), profileName)
+	if err != nil {
+		return fmt.Errorf("error archiving profile: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("profile %s not found", profileName)
+	}
+	return nil
+}
+
+func unarchiveProfile(db *sql.DB, profileName string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET archived_at = NULL WHERE name = ?", profileName)
+	if err != nil {
+		return fmt.Errorf("error unarchiving profile: %v", err)
+	}
+	return nil
+}
+
+// Gets the archived profiles the current user can see, by name
+func getArchivedProfiles(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(
+		"SELECT name FROM profiles WHERE archived_at IS NOT NULL AND deleted_at IS NULL AND (owner = '' OR owner = ? OR shared = 1) ORDER BY name",
+		currentUsername(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying archived profiles: %v", err)
+	}
+	defer rows.Close()
+
+	var profiles []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		profiles = append(profiles, name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+	return profiles, nil
+}
+
+// Lists the stale profiles with a button to archive each one, and the
+// archived profiles to bring back. onChanged is called after either.
+func showStaleProfilesDialog(db *sql.DB, check *staleCheck, parent fyne.Window, onChanged func()) {
+	daysEntry := widget.NewEntry()
+	daysEntry.SetText(strconv.Itoa(getStaleAfterDays(db)))
+	daysEntry.Validator = func(text string) error {
+		if days, err := strconv.Atoi(strings.TrimSpace(text)); err != nil || days < 1 {
+			return fmt.Errorf("enter a number of days")
+		}
+		return nil
+	}
+
+	staleList := container.NewVBox()
+	archivedList := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		staleList.RemoveAll()
+		archivedList.RemoveAll()
+
+		stale := check.staleProfiles(getStaleAfterDays(db))
+		if len(stale) == 0 {
+			staleList.Add(widget.NewLabel("No profiles use missing apps or displays not seen lately"))
+		}
+		for _, profile := range stale {
+			profileName := profile.Name
+			label := widget.NewLabel(profile.String())
+			label.Wrapping = fyne.TextWrapWord
+			archive := widget.NewButton("Archive", func() {
+				if err := archiveProfile(db, profileName); err != nil {
+					dialog.ShowError(err, parent)
+					return
+				}
+				delete(check.apps, profileName)
+				delete(check.displays, profileName)
+				refresh()
+				onChanged()
+			})
+			staleList.Add(container.NewBorder(nil, nil, nil, archive, label))
+		}
+
+		archived, err := getArchivedProfiles(db)
+		if err != nil {
+			archivedList.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(archived) == 0 {
+			archivedList.Add(widget.NewLabel("No profiles are archived"))
+		}
+		for _, profileName := range archived {
+			profileName := profileName
+			unarchive := widget.NewButton("Unarchive", func() {
+				if err := unarchiveProfile(db, profileName); err != nil {
+					dialog.ShowError(err, parent)
+					return
+				}
+				refresh()
+				onChanged()
+			})
+			archivedList.Add(container.NewBorder(nil, nil, nil, unarchive, widget.NewLabel(profileName)))
+		}
+	}
+	refresh()
+
+	daysEntry.OnSubmitted = func(text string) {
+		if daysEntry.Validate() != nil {
+			return
+		}
+		if err := setSetting(db, settingStaleAfterDays, strings.TrimSpace(text)); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		refresh()
+	}
+
+	days := container.New(layout.NewFormLayout(), widget.NewLabel("Displays gone for days:"), daysEntry)
+	note := widget.NewLabel("Archived profiles are left out of the list, triggers and insights but kept, and can be unarchived here")
+	note.Wrapping = fyne.TextWrapWord
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Stale", container.NewBorder(days, nil, nil, nil, container.NewVScroll(staleList))),
+		container.NewTabItem("Archived", container.NewVScroll(archivedList)),
+	)
+	d := dialog.NewCustom("Stale Profiles", "Close", container.NewBorder(nil, note, nil, nil, tabs), parent)
+	d.Resize(fyne.NewSize(620, 460))
+	d.Show()
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Columns of the window state table and their starting widths
+var statesTableColumns = []struct {
+	title string
+	width float32
+}{
+	{"", 40},
+	{"App", 130},
+	{"Title", 200},
+	{"X", 70},
+	{"Y", 70},
+	{"Width", 70},
+	{"Height", 70},
+	{"Details", 220},
+	{"Result", 180},
+	{"", 90},
+}
+
+// statesTable shows a profile's window states one per row, with the
+// position and size editable in place and a check box to pick rows, and on
+// a map of the displays
+type statesTable struct {
+	db          *sql.DB
+	summary     *widget.Label
+	table       *widget.Table
+	layout      *layoutMap
+	profileName string
+	states      []WindowState
+	// IDs of the checked rows
+	selected map[int64]bool
+	// What happened to each row in the last restore, by ID
+	results map[int64]restoreResult
+
+	// OnEdited is called after a change made in the table was saved, or
+	// failed to save
+	OnEdited func(state WindowState, err error)
+	// OnRemove is called when a row's Remove button is pressed
+	OnRemove func(state WindowState)
+	// Displays lists the connected displays for the map, nil draws the
+	// windows on their own
+	Displays func() []Display
+}
+
+func newStatesTable(db *sql.DB) *statesTable {
+	t := &statesTable{db: db, summary: widget.NewLabel(""), layout: newLayoutMap(), selected: make(map[int64]bool)}
+	t.summary.Wrapping = fyne.TextWrapWord
+	t.layout.OnMoved = t.moved
+
+	t.table = widget.NewTable(
+		func() (int, int) {
+			return len(t.states), len(statesTableColumns)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.Truncation = fyne.TextTruncateEllipsis
+			return container.NewStack(label, widget.NewEntry(), widget.NewCheck("", nil), widget.NewButton("Remove", nil))
+		},
+		t.updateCell,
+	)
+	t.table.ShowHeaderRow = true
+	t.table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	}
+	t.table.UpdateHeader = func(id widget.TableCellID, template fyne.CanvasObject) {
+		if id.Col >= 0 {
+			template.(*widget.Label).SetText(statesTableColumns[id.Col].title)
+		}
+	}
+	for i, column := range statesTableColumns {
+		t.table.SetColumnWidth(i, column.width)
+	}
+	return t
+}
+
+// The table and the map as tabs with the summary above them
+func (t *statesTable) Content() fyne.CanvasObject {
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Windows", t.table),
+		container.NewTabItem("Map", t.layout),
+	)
+	return container.NewBorder(t.summary, nil, nil, nil, tabs)
+}
+
+// Shows the window states of a profile, rows stay checked if they're
+// still there
+func (t *statesTable) Show(profileName string, states []WindowState) {
+	selected := make(map[int64]bool)
+	if profileName == t.profileName {
+		for _, state := range states {
+			if t.selected[state.ID] {
+				selected[state.ID] = true
+			}
+		}
+	}
+	t.profileName = profileName
+	t.states = states
+	t.selected = selected
+	t.results = nil
+	var displays []Display
+	if t.Displays != nil {
+		displays = t.Displays()
+	}
+	t.layout.SetWindows(displays, states)
+	if len(states) == 0 {
+		t.summary.SetText("No window states found for this profile")
+	} else {
+		t.summary.SetText(fmt.Sprintf("Profile has %d window states, edit a position or size and press Enter or drag windows on the map to save it, or check windows to restore only those", len(states)))
+	}
+	t.table.Refresh()
+}
+
+// Empties the table and shows a message instead
+func (t *statesTable) ShowMessage(message string) {
+	t.profileName = ""
+	t.states = nil
+	t.selected = make(map[int64]bool)
+	t.results = nil
+	t.summary.SetText(message)
+	t.layout.SetWindows(nil, nil)
+	t.table.Refresh()
+}
+
+// Adds a line to the summary
+func (t *statesTable) AppendSummary(text string) {
+	t.summary.SetText(t.summary.Text + "\n" + text)
+}
+
+// Marks each row with what happened to it in a restore, rows that weren't
+// part of it are left blank
+func (t *statesTable) ShowResults(results []restoreResult) {
+	t.results = make(map[int64]restoreResult)
+	for _, result := range results {
+		t.results[result.State.ID] = result
+	}
+	t.table.Refresh()
+}
+
+// IDs of the checked rows, in the order they're shown
+func (t *statesTable) Selected() []int64 {
+	var ids []int64
+	for _, state := range t.states {
+		if t.selected[state.ID] {
+			ids = append(ids, state.ID)
+		}
+	}
+	return ids
+}
+
+func (t *statesTable) updateCell(id widget.TableCellID, template fyne.CanvasObject) {
+	stack := template.(*fyne.Container)
+	label := stack.Objects[0].(*widget.Label)
+	entry := stack.Objects[1].(*widget.Entry)
+	check := stack.Objects[2].(*widget.Check)
+	remove := stack.Objects[3].(*widget.Button)
+	if id.Row >= len(t.states) {
+		return
+	}
+	state := t.states[id.Row]
+
+	if id.Col == len(statesTableColumns)-1 {
+		label.Hide()
+		entry.Hide()
+		check.Hide()
+		remove.Show()
+		remove.OnTapped = func() {
+			if t.OnRemove != nil {
+				t.OnRemove(state)
+			}
+		}
+		if state.ID == 0 {
+			remove.Disable()
+		} else {
+			remove.Enable()
+		}
+		return
+	}
+	remove.Hide()
+
+	if id.Col == 0 {
+		label.Hide()
+		entry.Hide()
+		check.Show()
+		// Don't select while the box is updated
+		check.OnChanged = nil
+		check.SetChecked(t.selected[state.ID])
+		// Live captures aren't in the database yet
+		if state.ID == 0 {
+			check.Disable()
+			return
+		}
+		check.Enable()
+		check.OnChanged = func(checked bool) {
+			if checked {
+				t.selected[state.ID] = true
+			} else {
+				delete(t.selected, state.ID)
+			}
+		}
+		return
+	}
+	check.Hide()
+
+	value := geometryField(&state, id.Col)
+	if value == nil {
+		entry.Hide()
+		label.Show()
+		switch id.Col {
+		case 1:
+			label.SetText(state.AppName)
+		case 2:
+			label.SetText(state.WindowTitle)
+		case 7:
+			label.SetText(windowStateDetails(state))
+		case 8:
+			label.SetText(describeRestoreResult(t.results[state.ID]))
+		}
+		return
+	}
+
+	label.Hide()
+	entry.Show()
+	// Don't save while the text is replaced
+	entry.OnSubmitted = nil
+	entry.SetText(strconv.FormatFloat(*value, 'f', -1, 64))
+	// Live captures aren't in the database yet
+	if state.ID == 0 {
+		entry.Disable()
+		return
+	}
+	entry.Enable()
+	row, col := id.Row, id.Col
+	entry.OnSubmitted = func(text string) {
+		t.edit(row, col, text)
+	}
+}
+
+// Saves a value typed into the table
+func (t *statesTable) edit(row, col int, text string) {
+	if row >= len(t.states) {
+		return
+	}
+	state := t.states[row]
+	value, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err == nil && (col == 5 || col == 6) && value <= 0 {
+		err = fmt.Errorf("%s must be more than 0", strings.ToLower(statesTableColumns[col].title))
+	} else if err != nil {
+		err = fmt.Errorf("%q isn't a number", text)
+	}
+
+	if err != nil {
+		// Puts the saved value back
+		t.table.Refresh()
+		if t.OnEdited != nil {
+			t.OnEdited(state, err)
+		}
+		return
+	}
+	*geometryField(&state, col) = value
+	t.save(row, state)
+}
+
+// Saves a window dragged or resized on the map
+func (t *statesTable) moved(moved WindowState) {
+	for row, state := range t.states {
+		if state.ID != moved.ID {
+			continue
+		}
+		state.X, state.Y = moved.X, moved.Y
+		state.Width, state.Height = moved.Width, moved.Height
+		t.save(row, state)
+		return
+	}
+}
+
+// Saves a row's new position and size and shows it in the table and map,
+// or the old one if saving failed
+func (t *statesTable) save(row int, state WindowState) {
+	err := updateWindowState(t.db, t.profileName, state)
+	if err == nil {
+		t.states[row] = state
+	}
+	t.table.Refresh()
+	t.layout.SetWindows(t.layout.displays, t.states)
+	if t.OnEdited != nil {
+		t.OnEdited(state, err)
+	}
+}
+
+// Describes a row's restore outcome with a symbol in front, empty if it
+// wasn't restored
+func describeRestoreResult(result restoreResult) string {
+	switch result.Outcome {
+	case outcomeMoved:
+		if result.OnScreen {
+			return "✓ moved on screen"
+		}
+		return "✓ moved"
+	case outcomeInPlace:
+		return "∙ already in place"
+	case outcomeNotFound:
+		return "⚠ not found"
+	case outcomeAppNotRunning:
+		return "⚠ app not running"
+	case outcomePermissionDenied:
+		return "✗ permission denied"
+	case outcomeFailed:
+		if result.Err != nil {
+			return fmt.Sprintf("✗ failed: %v", result.Err)
+		}
+		return "✗ failed"
+	}
+	return ""
+}
+
+// Gets the position or size value shown in a column, nil for the other
+// columns
+func geometryField(state *WindowState, col int) *float64 {
+	switch col {
+	case 3:
+		return &state.X
+	case 4:
+		return &state.Y
+	case 5:
+		return &state.Width
+	case 6:
+		return &state.Height
+	}
+	return nil
+}
+
+// Describes the rest of what's saved about a window
+func windowStateDetails(state WindowState) string {
+	var details []string
+	if state.DisplayID != "" {
+		details = append(details, "display "+state.DisplayID)
+	}
+	if state.Role != "" {
+		details = append(details, "role "+state.Role)
+	}
+	if state.Minimized {
+		details = append(details, "minimized")
+	}
+	if state.FullScreen {
+		details = append(details, "fullscreen")
+	}
+	if state.Space != 0 {
+		details = append(details, fmt.Sprintf("space %d", state.Space))
+	}
+	if state.TitleMatch != matchExact {
+		details = append(details, strings.TrimSpace(fmt.Sprintf("match %s %s", state.TitleMatch, state.TitlePattern)))
+	}
+	return strings.Join(details, ", ")
+}
@@ -0,0 +1,33 @@
+package main
+
+import "sync"
+
+// queuedWrite is a write waiting its turn on the write queue
+type queuedWrite struct {
+	write func() error
+	done  chan error
+}
+
+var (
+	writeQueue     chan queuedWrite
+	writeQueueOnce sync.Once
+)
+
+// Runs a write that takes several statements on the goroutine that owns all
+// such writes, so saves from the window, triggers and the API can't
+// interleave their deletes and inserts. Writes on the queue must not queue
+// other writes, they call the Locked variants instead.
+func queueWrite(write func() error) error {
+	writeQueueOnce.Do(func() {
+		writeQueue = make(chan queuedWrite)
+		go func() {
+			for queued := range writeQueue {
+				queued.done <- queued.write()
+			}
+		}()
+	})
+
+	done := make(chan error, 1)
+	writeQueue <- queuedWrite{write: write, done: done}
+	return <-done
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// templateSlot is one tile of a layout template, as fractions of the display
+type templateSlot struct {
+	Name                string
+	X, Y, Width, Height float64
+	// Role is saved as the role of the window put into the slot
+	Role string
+	// Apps are put into the slot first when one of them is open
+	Apps []string
+}
+
+// layoutTemplate is a standard way of tiling a display
+type layoutTemplate struct {
+	Name string
+	// Description says what a gallery layout is for
+	Description string
+	Slots       []templateSlot
+}
+
+// Apps suggested for the gallery's slots
+var (
+	editorApps   = []string{"Code", "Visual Studio Code", "Cursor", "Zed", "Xcode", "IntelliJ IDEA", "GoLand", "Sublime Text", "Emacs"}
+	terminalApps = []string{"Terminal", "iTerm2", "Ghostty", "WezTerm", "Alacritty", "kitty", "Windows Terminal", "gnome-terminal", "Konsole"}
+	browserApps  = []string{"Safari", "Google Chrome", "Firefox", "Arc", "Microsoft Edge", "Brave Browser", "Chromium"}
+	writingApps  = []string{"Pages", "Microsoft Word", "Ulysses", "iA Writer", "Scrivener", "Typora", "LibreOffice Writer"}
+	notesApps    = []string{"Notes", "Obsidian", "Notion", "Bear", "OneNote", "Evernote"}
+	callApps     = []string{"zoom.us", "Zoom", "Microsoft Teams", "FaceTime", "Webex"}
+	chatApps     = []string{"Slack", "Messages", "Discord", "Telegram", "WhatsApp", "Signal"}
+	chartApps    = []string{"TradingView", "MetaTrader 5", "MetaTrader 4", "NinjaTrader"}
+	brokerApps   = []string{"Trader Workstation", "IBKR Desktop", "thinkorswim", "Webull"}
+	sheetApps    = []string{"Numbers", "Microsoft Excel", "LibreOffice Calc"}
+	streamApps   = []string{"OBS", "OBS Studio", "Streamlabs Desktop", "XSplit Broadcaster"}
+)
+
+// The built-in tiling presets, then the gallery of layouts for common kinds
+// of work
+var layoutTemplates = []layoutTemplate{
+	{Name: "Halves", Slots: []templateSlot{
+		{Name: "Left half", X: 0, Y: 0, Width: 0.5, Height: 1},
+		{Name: "Right half", X: 0.5, Y: 0, Width: 0.5, Height: 1},
+	}},
+	{Name: "Top and bottom", Slots: []templateSlot{
+		{Name: "Top half", X: 0, Y: 0, Width: 1, Height: 0.5},
+		{Name: "Bottom half", X: 0, Y: 0.5, Width: 1, Height: 0.5},
+	}},
+	{Name: "Thirds", Slots: []templateSlot{
+		{Name: "Left third", X: 0, Y: 0, Width: 1.0 / 3, Height: 1},
+		{Name: "Middle third", X: 1.0 / 3, Y: 0, Width: 1.0 / 3, Height: 1},
+		{Name: "Right third", X: 2.0 / 3, Y: 0, Width: 1.0 / 3, Height: 1},
+	}},
+	{Name: "Main and side", Slots: []templateSlot{
+		{Name: "Left two thirds", X: 0, Y: 0, Width: 2.0 / 3, Height: 1},
+		{Name: "Right third", X: 2.0 / 3, Y: 0, Width: 1.0 / 3, Height: 1},
+	}},
+	{Name: "Quarters", Slots: []templateSlot{
+		{Name: "Top left", X: 0, Y: 0, Width: 0.5, Height: 0.5},
+		{Name: "Top right", X: 0.5, Y: 0, Width: 0.5, Height: 0.5},
+		{Name: "Bottom left", X: 0, Y: 0.5, Width: 0.5, Height: 0.5},
+		{Name: "Bottom right", X: 0.5, Y: 0.5, Width: 0.5, Height: 0.5},
+	}},
+	{Name: "Coding", Description: "A large editor, with a browser for docs above a terminal at the side", Slots: []templateSlot{
+		{Name: "Editor", X: 0, Y: 0, Width: 0.6, Height: 1, Role: "editor", Apps: editorApps},
+		{Name: "Browser", X: 0.6, Y: 0, Width: 0.4, Height: 0.5, Role: "reference", Apps: browserApps},
+		{Name: "Terminal", X: 0.6, Y: 0.5, Width: 0.4, Height: 0.5, Role: "terminal", Apps: terminalApps},
+	}},
+	{Name: "Writing", Description: "The document in the middle of the screen, with notes or research beside it", Slots: []templateSlot{
+		{Name: "Document", X: 0.2, Y: 0, Width: 0.55, Height: 1, Role: "editor", Apps: writingApps},
+		{Name: "Notes", X: 0.75, Y: 0, Width: 0.25, Height: 1, Role: "reference", Apps: notesApps},
+	}},
+	{Name: "Video call", Description: "The call on the left, with notes and chat stacked on the right", Slots: []templateSlot{
+		{Name: "Call", X: 0, Y: 0, Width: 0.6, Height: 1, Role: "call", Apps: callApps},
+		{Name: "Notes", X: 0.6, Y: 0, Width: 0.4, Height: 0.5, Role: "notes", Apps: notesApps},
+		{Name: "Chat", X: 0.6, Y: 0.5, Width: 0.4, Height: 0.5, Role: "chat", Apps: chatApps},
+	}},
+	{Name: "Trading", Description: "Charts across the top, with the order entry and a watchlist below", Slots: []templateSlot{
+		{Name: "Charts", X: 0, Y: 0, Width: 1, Height: 0.6, Role: "charts", Apps: chartApps},
+		{Name: "Orders", X: 0, Y: 0.6, Width: 0.5, Height: 0.4, Role: "orders", Apps: brokerApps},
+		{Name: "Watchlist", X: 0.5, Y: 0.6, Width: 0.5, Height: 0.4, Role: "watchlist", Apps: sheetApps},
+	}},
+	{Name: "Streaming", Description: "The streaming app, with the stream's chat and a browser for alerts at the side", Slots: []templateSlot{
+		{Name: "Studio", X: 0, Y: 0, Width: 0.7, Height: 1, Role: "studio", Apps: streamApps},
+		{Name: "Chat", X: 0.7, Y: 0, Width: 0.3, Height: 0.6, Role: "chat", Apps: chatApps},
+		{Name: "Browser", X: 0.7, Y: 0.6, Width: 0.3, Height: 0.4, Role: "reference", Apps: browserApps},
+	}},
+}
+
+// Picks a window for each slot: the frontmost window of one of the slot's
+// apps when one is open, otherwise the frontmost window of the next app not
+// picked yet, starting with the frontmost app. The result holds indexes into
+// windows, -1 for slots left empty.
+func assignTemplateSlots(template layoutTemplate, windows []WindowState) []int {
+	order := make([]int, len(windows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return windows[order[i]].ZOrder < windows[order[j]].ZOrder
+	})
+
+	assigned := make([]int, len(template.Slots))
+	picked := make(map[string]bool)
+	for i, slot := range template.Slots {
+		assigned[i] = -1
+	apps:
+		for _, app := range slot.Apps {
+			for _, w := range order {
+				if !picked[windows[w].AppName] && strings.EqualFold(windows[w].AppName, app) {
+					assigned[i] = w
+					picked[windows[w].AppName] = true
+					break apps
+				}
+			}
+		}
+	}
+
+	var candidates []int
+	for _, w := range order {
+		if picked[windows[w].AppName] {
+			continue
+		}
+		picked[windows[w].AppName] = true
+		candidates = append(candidates, w)
+	}
+	for i := range assigned {
+		if assigned[i] < 0 && len(candidates) > 0 {
+			assigned[i] = candidates[0]
+			candidates = candidates[1:]
+		}
+	}
+	return assigned
+}
+
+// A slot bound to an app that isn't open takes the app's first window when
+// the profile is restored
+func placeholderWindow(appName string) WindowState {
+	return WindowState{AppName: appName, TitleMatch: matchIndex}
+}
+
+// Builds the states that put the window picked for each slot into the slot
+// on the display. Slots without an app are skipped, and so are windows
+// already put into an earlier slot.
+func fillTemplate(template layoutTemplate, display Display, picks []WindowState) []WindowState {
+	type pickKey struct {
+		window   windowKey
+		appIndex int
+	}
+
+	var states []WindowState
+	used := make(map[pickKey]bool)
+	for i, slot := range template.Slots {
+		if i >= len(picks) || picks[i].AppName == "" {
+			continue
+		}
+		key := pickKey{keyOf(picks[i]), picks[i].AppIndex}
+		if used[key] {
+			continue
+		}
+		used[key] = true
+
+		state := picks[i]
+		state.ID = 0
+		state.X = math.Round(display.X + slot.X*display.Width)
+		state.Y = math.Round(display.Y + slot.Y*display.Height)
+		state.Width = math.Round(slot.Width * display.Width)
+		state.Height = math.Round(slot.Height * display.Height)
+		state.DisplayID = display.ID
+		state.DisplayX = display.X
+		state.DisplayY = display.Y
+		state.DisplayWidth = display.Width
+		state.DisplayHeight = display.Height
+		state.Minimized = false
+		state.FullScreen = false
+		state.ZOrder = len(states)
+		if slot.Role != "" {
+			state.Role = slot.Role
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// Lets the user pick a template from the presets or the gallery, a display,
+// and an open window or any app's name for each slot, then calls onCreate
+// with the new profile's name and states
+func showTemplateDialog(windows []WindowState, displays []Display, parent fyne.Window, onCreate func(profileName string, states []WindowState)) {
+	if len(displays) == 0 {
+		dialog.ShowInformation("New From Template", "Templates need the connected displays, which can't be listed on this platform", parent)
+		return
+	}
+
+	var windowOptions []string
+	windowIndex := make(map[string]int)
+	for i, window := range windows {
+		label := fmt.Sprintf("%s - %s", window.AppName, window.WindowTitle)
+		if _, taken := windowIndex[label]; taken {
+			label = fmt.Sprintf("%s (%d)", label, i+1)
+		}
+		windowIndex[label] = i
+		windowOptions = append(windowOptions, label)
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("e.g. Side by Side")
+	nameEntry.Validator = func(text string) error {
+		return validateProfileName(canonicalProfileName(text))
+	}
+
+	var displayOptions []string
+	for _, display := range displays {
+		displayOptions = append(displayOptions, fmt.Sprintf("Display %d (%.0f x %.0f)", display.Index+1, display.Width, display.Height))
+	}
+	displaySelect := widget.NewSelect(displayOptions, nil)
+	selectedDisplay := func() Display {
+		if index := displaySelect.SelectedIndex(); index >= 0 {
+			return displays[index]
+		}
+		return displays[0]
+	}
+
+	// One entry per slot of the chosen template, taking an open window from
+	// its list or the name of an app to bind
+	var template layoutTemplate
+	var slotEntries []*widget.SelectEntry
+	picks := func() []WindowState {
+		picked := make([]WindowState, len(slotEntries))
+		for i, entry := range slotEntries {
+			text := strings.TrimSpace(entry.Text)
+			if index, ok := windowIndex[text]; ok {
+				picked[i] = windows[index]
+			} else if text != "" {
+				picked[i] = placeholderWindow(text)
+			}
+		}
+		return picked
+	}
+
+	// Shows where the slots land, with empty slots named after the slot
+	preview := newLayoutMap()
+	showPreview := func() {
+		picked := picks()
+		for i := range picked {
+			if picked[i].AppName == "" {
+				picked[i] = WindowState{AppName: template.Slots[i].Name}
+			}
+		}
+		display := selectedDisplay()
+		preview.SetWindows([]Display{display}, fillTemplate(template, display, picked))
+	}
+	displaySelect.OnChanged = func(string) {
+		showPreview()
+	}
+
+	description := widget.NewLabel("")
+	description.Wrapping = fyne.TextWrapWord
+	slotForm := container.New(layout.NewFormLayout())
+	showSlots := func() {
+		slotForm.RemoveAll()
+		slotEntries = nil
+		for i, window := range assignTemplateSlots(template, windows) {
+			slot := template.Slots[i]
+			entry := widget.NewSelectEntry(windowOptions)
+			entry.SetPlaceHolder("Leave empty or type an app name")
+			if len(slot.Apps) > 0 {
+				entry.SetPlaceHolder(fmt.Sprintf("Leave empty or type an app, e.g. %s", slot.Apps[0]))
+			}
+			if window >= 0 {
+				entry.SetText(windowOptions[window])
+			}
+			entry.OnChanged = func(string) {
+				showPreview()
+			}
+			slotEntries = append(slotEntries, entry)
+			slotForm.Add(widget.NewLabel(slot.Name + ":"))
+			slotForm.Add(entry)
+		}
+		slotForm.Refresh()
+		description.SetText(template.Description)
+		description.Hidden = template.Description == ""
+		showPreview()
+	}
+
+	var templateNames []string
+	for _, t := range layoutTemplates {
+		templateNames = append(templateNames, t.Name)
+	}
+	templateSelect := widget.NewSelect(templateNames, func(name string) {
+		for _, t := range layoutTemplates {
+			if t.Name == name {
+				template = t
+			}
+		}
+		showSlots()
+	})
+	displaySelect.SetSelectedIndex(0)
+	templateSelect.SetSelectedIndex(0)
+
+	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel("Name:"), nameEntry,
+		widget.NewLabel("Template:"), templateSelect,
+		widget.NewLabel("Display:"), displaySelect,
+	)
+	content := container.NewBorder(
+		container.NewVBox(form, description, widget.NewSeparator(), slotForm),
+		nil, nil, nil,
+		preview,
+	)
+
+	d := dialog.NewCustomConfirm("New From Template", "Create", "Cancel", content, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := nameEntry.Validate(); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+
+		states := fillTemplate(template, selectedDisplay(), picks())
+		if len(states) == 0 {
+			dialog.ShowInformation("New From Template", "No windows were put into the template, nothing was saved", parent)
+			return
+		}
+		onCreate(canonicalProfileName(nameEntry.Text), states)
+	}, parent)
+	d.Resize(fyne.NewSize(560, 640))
+	d.Show()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// API token scopes, each one allows everything the ones before it do
+const (
+	// scopeRead can list profiles and their windows
+	scopeRead = "read"
+	// scopeRestore can also restore profiles, e.g. from a Stream Deck
+	scopeRestore = "restore"
+	// scopeAdmin can also create, change and delete profiles
+	scopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{
+	scopeRead:    1,
+	scopeRestore: 2,
+	scopeAdmin:   3,
+}
+
+// apiToken is a token for the local API. Only a hash of the token is
+// stored, the token itself is shown once when it's created.
+type apiToken struct {
+	ID      int
+	Name    string
+	Scope   string
+	Created time.Time
+}
+
+// Checks whether the token's scope covers the required one
+func (t apiToken) allows(required string) bool {
+	return scopeLevels[t.Scope] >= scopeLevels[required]
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Creates a token with a scope and returns the token
+func createAPIToken(db *sql.DB, name, scope string) (string, error) {
+	if _, ok := scopeLevels[scope]; !ok {
+		return "", fmt.Errorf("unknown scope %q, use read, restore or admin", scope)
+	}
+
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating token: %v", err)
+	}
+	token := "wisa_" + hex.EncodeToString(raw)
+
+	_, err := db.Exec(
+		"INSERT INTO api_tokens (name, token_hash, scope, created_at) VALUES (?, ?, ?, ?)",
+		name, hashToken(token), scope, time.Now(),
+	)
+	if err != nil {
+		return "", fmt.Errorf("error saving token: %v", err)
+	}
+	return token, nil
+}
+
+// Finds the token a request presented, nil if it's unknown
+func lookupAPIToken(db *sql.DB, token string) (*apiToken, error) {
+	var t apiToken
+	err := db.QueryRow(
+		"SELECT id, name, scope, created_at FROM api_tokens WHERE token_hash = ?",
+		hashToken(token),
+	).Scan(&t.ID, &t.Name, &t.Scope, &t.Created)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding token: %v", err)
+	}
+	return &t, nil
+}
+
+func getAPITokens(db *sql.DB) ([]apiToken, error) {
+	rows, err := db.Query("SELECT id, name, scope, created_at FROM api_tokens ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []apiToken
+	for rows.Next() {
+		var t apiToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.Created); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return tokens, nil
+}
+
+func revokeAPIToken(db *sql.DB, id int) error {
+	result, err := db.Exec("DELETE FROM api_tokens WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("error revoking token: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("token %d not found", id)
+	}
+	return nil
+}
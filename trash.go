@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// How long deleted profiles stay in Recently Deleted before they are purged
+const trashRetention = 30 * 24 * time.Hour
+
+// deletedProfile is a profile in Recently Deleted
+type deletedProfile struct {
+	Name      string
+	DeletedAt time.Time
+}
+
+// Moves a profile to Recently Deleted, it can be put back until it's purged
+func deleteProfile(db *sql.DB, profileName string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	result, err := db.Exec("UPDATE profiles SET deleted_at = ? WHERE name = ? AND deleted_at IS NULL", time.Now(), profileName)
+	if err != nil {
+		return fmt.Errorf("error deleting profile: %v", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("profile %s not found", profileName)
+	}
+	return nil
+}
+
+// Puts a profile from Recently Deleted back
+func undeleteProfile(db *sql.DB, profileName string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+
+	_, err := db.Exec("UPDATE profiles SET deleted_at = NULL WHERE name = ?", profileName)
+	if err != nil {
+		return fmt.Errorf("error restoring profile: %v", err)
+	}
+	return nil
+}
+
+// Gets the current user's deleted profiles, most recently deleted first
+func getDeletedProfiles(db *sql.DB) ([]deletedProfile, error) {
+	rows, err := db.Query(
+		"SELECT name, deleted_at FROM profiles WHERE deleted_at IS NOT NULL AND (owner = '' OR owner = ?) ORDER BY deleted_at DESC",
+		currentUsername(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying deleted profiles: %v", err)
+	}
+	defer rows.Close()
+
+	var profiles []deletedProfile
+	for rows.Next() {
+		var profile deletedProfile
+		if err := rows.Scan(&profile.Name, &profile.DeletedAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		profiles = append(profiles, profile)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return profiles, nil
+}
+
+// Frees the name of a deleted profile so it can be used again by renaming
+// the deleted one to "name (2)" or the next free number, where it can still
+// be put back from. Does nothing if the profile isn't deleted. Must be called
+// from a queued write.
+func moveDeletedProfileAside(tx *sql.Tx, profileName string) error {
+	var deleted bool
+	err := tx.QueryRow("SELECT deleted_at IS NOT NULL FROM profiles WHERE name = ?", profileName).Scan(&deleted)
+	if err == sql.ErrNoRows || (err == nil && !deleted) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error checking if profile is deleted: %v", err)
+	}
+
+	aside, err := unusedProfileName(tx, profileName)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE profiles SET name = ? WHERE name = ?", aside, profileName); err != nil {
+		return fmt.Errorf("error renaming deleted profile: %v", err)
+	}
+	log.Printf("Renamed deleted profile '%s' to '%s' so the name can be used again", profileName, aside)
+	return nil
+}
+
+// Purges the profiles that were deleted longer ago than trashRetention
+func purgeExpiredProfiles(db *sql.DB) error {
+	rows, err := db.Query("SELECT name FROM profiles WHERE deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-trashRetention))
+	if err != nil {
+		return fmt.Errorf("error querying deleted profiles: %v", err)
+	}
+
+	var expired []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning row: %v", err)
+		}
+		expired = append(expired, name)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	for _, name := range expired {
+		// Other users' profiles are purged when they start wisa
+		if checkProfileOwner(db, name) != nil {
+			continue
+		}
+		if err := purgeProfile(db, name); err != nil {
+			return err
+		}
+		log.Printf("Purged profile '%s' from Recently Deleted", name)
+	}
+	return nil
+}
+
+// Lists the deleted profiles and lets the user put them back or purge them
+func showTrashDialog(db *sql.DB, parent fyne.Window, onRestored func()) {
+	list := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		profiles, err := getDeletedProfiles(db)
+		if err != nil {
+			list.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(profiles) == 0 {
+			list.Add(widget.NewLabel("No recently deleted profiles"))
+		}
+		for _, profile := range profiles {
+			profile := profile
+			left := profile.DeletedAt.Add(trashRetention).Sub(time.Now())
+			label := widget.NewLabel(fmt.Sprintf("%s (deleted %s, purged in %d days)",
+				profile.Name, profile.DeletedAt.Format("2006-01-02 15:04"), int(left.Hours()/24)))
+			restore := widget.NewButton("Restore", func() {
+				if err := undeleteProfile(db, profile.Name); err != nil {
+					dialog.ShowError(err, parent)
+					return
+				}
+				refresh()
+				onRestored()
+			})
+			purge := widget.NewButton("Delete Now", func() {
+				dialog.ShowConfirm("Delete Now",
+					fmt.Sprintf("Permanently delete '%s'? This can't be undone.", profile.Name),
+					func(ok bool) {
+						if !ok {
+							return
+						}
+						if err := purgeProfile(db, profile.Name); err != nil {
+							dialog.ShowError(err, parent)
+						}
+						refresh()
+					}, parent)
+			})
+			list.Add(container.NewBorder(nil, nil, nil, container.NewHBox(restore, purge), label))
+		}
+	}
+	refresh()
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 200))
+	dialog.ShowCustom("Recently Deleted", "Close", scroll, parent)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+)
+
+// trayMenu is the one menu of the menu bar or system tray icon. Features add
+// their items to it and it always ends with Show Wisa. The icon is only
+// created once it's needed, in tray mode or when a feature has items, since
+// Fyne can't take it away again.
+type trayMenu struct {
+	app    fyne.App
+	window fyne.Window
+	db     *sql.DB
+
+	mu          sync.Mutex
+	shown       bool
+	permissions []*fyne.MenuItem
+}
+
+func newTrayMenu(myApp fyne.App, myWindow fyne.Window, db *sql.DB) *trayMenu {
+	return &trayMenu{app: myApp, window: myWindow, db: db}
+}
+
+// Replaces the permission items, nil when none need attention
+func (t *trayMenu) SetPermissions(items []*fyne.MenuItem) {
+	t.mu.Lock()
+	t.permissions = items
+	t.mu.Unlock()
+	t.Refresh()
+}
+
+// Rebuilds the menu, creating the icon if it's needed now
+func (t *trayMenu) Refresh() {
+	desktopApp, ok := t.app.(desktop.App)
+	if !ok {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	items := append([]*fyne.MenuItem(nil), t.permissions...)
+	if !t.shown && len(items) == 0 && !getBoolSetting(t.db, settingCloseToTray, false) {
+		return
+	}
+	t.shown = true
+
+	if len(items) > 0 {
+		items = append(items, fyne.NewMenuItemSeparator())
+	}
+	items = append(items, fyne.NewMenuItem("Show Wisa", func() {
+		t.window.Show()
+		t.window.RequestFocus()
+	}))
+	desktopApp.SetSystemTrayMenu(fyne.NewMenu("Wisa", items...))
+}
+
+// In tray mode wisa keeps running in the menu bar or system tray when its
+// window is closed, and Show Wisa in the tray menu brings it back
+func setupTrayMode(tray *trayMenu) {
+	if _, ok := tray.app.(desktop.App); !ok {
+		return
+	}
+	tray.Refresh()
+	tray.window.SetCloseIntercept(func() {
+		if getBoolSetting(tray.db, settingCloseToTray, false) {
+			tray.window.Hide()
+			return
+		}
+		tray.app.Quit()
+	})
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Kinds of automatic triggers
+const (
+	// triggerDisplay fires when the display arrangement in Spec connects
+	triggerDisplay = "display"
+)
+
+// Trigger applies a profile automatically when something happens
+type Trigger struct {
+	ID          int
+	Kind        string
+	Spec        string
+	ProfileName string
+	Enabled     bool
+	// QuietStart and QuietEnd are "HH:MM" times between which the trigger
+	// doesn't fire, empty when it has no quiet hours
+	QuietStart string
+	QuietEnd   string
+}
+
+// Checks whether t falls in the trigger's quiet hours, which may span
+// midnight
+func (trigger Trigger) inQuietHours(t time.Time) bool {
+	if trigger.QuietStart == "" || trigger.QuietEnd == "" {
+		return false
+	}
+	start, err := parseClock(trigger.QuietStart)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(trigger.QuietEnd)
+	if err != nil {
+		return false
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return now >= start && now < end
+	}
+	return now >= start || now < end
+}
+
+// Parses an "HH:MM" time into minutes since midnight
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// Gets the triggers of one kind on the current user's profiles. Triggers
+// belong to the profile's owner, so another user's triggers never fire here,
+// even on a shared profile.
+func getTriggers(db *sql.DB, kind string) ([]Trigger, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.kind, t.spec, p.name, t.enabled, t.quiet_start, t.quiet_end FROM triggers t
+		JOIN profiles p ON p.id = t.profile_id
+		WHERE t.kind = ? AND p.deleted_at IS NULL AND p.archived_at IS NULL AND (p.owner = '' OR p.owner = ?)
+		ORDER BY t.id`,
+		kind, currentUsername(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying triggers: %v", err)
+	}
+	defer rows.Close()
+
+	var triggers []Trigger
+	for rows.Next() {
+		var trigger Trigger
+		err := rows.Scan(&trigger.ID, &trigger.Kind, &trigger.Spec, &trigger.ProfileName, &trigger.Enabled,
+			&trigger.QuietStart, &trigger.QuietEnd)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %v", err)
+		}
+		triggers = append(triggers, trigger)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %v", err)
+	}
+
+	return triggers, nil
+}
+
+// Finds the enabled trigger of a kind with the given spec
+func findTrigger(db *sql.DB, kind, spec string) (*Trigger, error) {
+	triggers, err := getTriggers(db, kind)
+	if err != nil {
+		return nil, err
+	}
+	for _, trigger := range triggers {
+		if trigger.Spec == spec && trigger.Enabled {
+			return &trigger, nil
+		}
+	}
+	return nil, nil
+}
+
+// Assigns a profile to a display arrangement, replacing any previous one
+func saveDisplayTrigger(db *sql.DB, arrangement, profileName string) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	var profileID int
+	err := db.QueryRow("SELECT id FROM profiles WHERE name = ?", profileName).Scan(&profileID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("profile %s not found", profileName)
+		}
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+
+	_, err = db.Exec(
+		"DELETE FROM triggers WHERE kind = ? AND spec = ? AND profile_id IN ("+ownProfileIDs+")",
+		triggerDisplay, arrangement, currentUsername(),
+	)
+	if err != nil {
+		return fmt.Errorf("error replacing trigger: %v", err)
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO triggers (kind, spec, profile_id, enabled) VALUES (?, ?, ?, 1)",
+		triggerDisplay, arrangement, profileID,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving trigger: %v", err)
+	}
+	return nil
+}
+
+func setTriggerEnabled(db *sql.DB, id int, enabled bool) error {
+	_, err := db.Exec(
+		"UPDATE triggers SET enabled = ? WHERE id = ? AND profile_id IN ("+ownProfileIDs+")",
+		enabled, id, currentUsername(),
+	)
+	if err != nil {
+		return fmt.Errorf("error updating trigger: %v", err)
+	}
+	return nil
+}
+
+// Sets the quiet hours of a trigger, empty times remove them
+func setTriggerQuietHours(db *sql.DB, id int, start, end string) error {
+	if start != "" || end != "" {
+		if _, err := parseClock(start); err != nil {
+			return err
+		}
+		if _, err := parseClock(end); err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec("UPDATE triggers SET quiet_start = ?, quiet_end = ? WHERE id = ? AND profile_id IN ("+ownProfileIDs+")",
+		strings.TrimSpace(start), strings.TrimSpace(end), id, currentUsername())
+	if err != nil {
+		return fmt.Errorf("error updating trigger: %v", err)
+	}
+	return nil
+}
+
+func deleteTrigger(db *sql.DB, id int) error {
+	_, err := db.Exec("DELETE FROM triggers WHERE id = ? AND profile_id IN ("+ownProfileIDs+")", id, currentUsername())
+	if err != nil {
+		return fmt.Errorf("error deleting trigger: %v", err)
+	}
+	return nil
+}
+
+// Waits until the display arrangement stops changing for the settle delay,
+// docking and undocking reconfigure the displays several times in a row
+func settledArrangement(engine *restoreEngine, arrangement string) string {
+	settle := getDurationSetting(engine.db, settingDisplaySettle, defaultDisplaySettle)
+	if settle == 0 {
+		return arrangement
+	}
+	for {
+		time.Sleep(settle)
+		again := currentArrangement(engine.backend)
+		if again == arrangement {
+			return arrangement
+		}
+		arrangement = again
+	}
+}
+
+// triggerHooks connects the automatic triggers to the UI
+type triggerHooks struct {
+	// Confirm asks the user whether to go ahead and calls apply if they do
+	Confirm func(message string, apply func())
+	// Notify reports the result of a restore
+	Notify func(profileName string, count int, err error)
+	// Saved reports the result of a save, e.g. from a hotkey
+	Saved func(profileName string, count int, err error)
+}
+
+// Queues the restore for a trigger that fired, asking first when triggers
+// need confirmation
+func fireTrigger(engine *restoreEngine, trigger *Trigger, message string, hooks triggerHooks) {
+	if trigger.inQuietHours(time.Now()) {
+		log.Printf("Skipping %s trigger for profile '%s' during quiet hours", trigger.Kind, trigger.ProfileName)
+		logActivity(engine.db, activityTrigger, trigger.ProfileName, trigger.Kind, "skipped during quiet hours", nil)
+		return
+	}
+	logActivity(engine.db, activityTrigger, trigger.ProfileName, trigger.Kind, message, nil)
+
+	profileName := trigger.ProfileName
+	apply := func() {
+		engine.Enqueue(profileName, trigger.Kind, restoreOptions{}, func(count int, err error) {
+			hooks.Notify(profileName, count, err)
+		})
+	}
+
+	if getBoolSetting(engine.db, settingConfirmTriggers, false) && hooks.Confirm != nil {
+		hooks.Confirm(message, apply)
+		return
+	}
+	apply()
+}
+
+// Polls the display arrangement and applies the profile assigned to the new
+// arrangement whenever it changes, e.g. when docking a laptop
+func watchDisplays(engine *restoreEngine, interval time.Duration, hooks triggerHooks) {
+	last := currentArrangement(engine.backend)
+	// The displays are noted as seen when they change and once an hour, for
+	// finding stale profiles
+	recordDisplaysSeen(engine.db, connectedDisplays(engine.backend))
+	seen, seenAt := last, time.Now()
+	for range time.Tick(interval) {
+		arrangement := currentArrangement(engine.backend)
+		if arrangement != "" && (arrangement != seen || time.Since(seenAt) > time.Hour) {
+			recordDisplaysSeen(engine.db, connectedDisplays(engine.backend))
+			seen, seenAt = arrangement, time.Now()
+		}
+		if arrangement == "" || arrangement == last {
+			continue
+		}
+		arrangement = settledArrangement(engine, arrangement)
+		if arrangement == "" || arrangement == last {
+			continue
+		}
+		last = arrangement
+
+		trigger, err := findTrigger(engine.db, triggerDisplay, arrangement)
+		if err != nil {
+			log.Printf("Error finding display trigger: %v", err)
+			continue
+		}
+		if trigger == nil {
+			continue
+		}
+
+		fireTrigger(engine, trigger, fmt.Sprintf("Displays changed — apply '%s' profile?", trigger.ProfileName), hooks)
+	}
+}
+
+// Shows the profiles assigned to display arrangements and lets the user
+// assign one to the arrangement connected right now
+func showDisplayTriggersDialog(db *sql.DB, backend WindowBackend, parent fyne.Window) {
+	arrangement := currentArrangement(backend)
+	if arrangement == "" {
+		dialog.ShowInformation("Auto-Restore", "Displays can't be detected on this platform", parent)
+		return
+	}
+
+	profiles, err := getProfiles(db)
+	if err != nil {
+		dialog.ShowError(err, parent)
+		return
+	}
+
+	list := container.NewVBox()
+	var refresh func()
+	refresh = func() {
+		list.RemoveAll()
+		triggers, err := getTriggers(db, triggerDisplay)
+		if err != nil {
+			list.Add(widget.NewLabel(fmt.Sprintf("Error: %v", err)))
+			return
+		}
+		if len(triggers) == 0 {
+			list.Add(widget.NewLabel("No display arrangements have a profile yet"))
+		}
+		for _, trigger := range triggers {
+			trigger := trigger
+			text := fmt.Sprintf("%s → %s", trigger.Spec, trigger.ProfileName)
+			if trigger.QuietStart != "" {
+				text += fmt.Sprintf(" (quiet %s–%s)", trigger.QuietStart, trigger.QuietEnd)
+			}
+			label := widget.NewLabel(text)
+			label.Wrapping = fyne.TextWrapWord
+			enabled := widget.NewCheck("", func(checked bool) {
+				if err := setTriggerEnabled(db, trigger.ID, checked); err != nil {
+					dialog.ShowError(err, parent)
+				}
+			})
+			enabled.SetChecked(trigger.Enabled)
+			quiet := widget.NewButton("Quiet Hours…", func() {
+				showQuietHoursDialog(db, trigger, parent, refresh)
+			})
+			remove := widget.NewButton("Remove", func() {
+				if err := deleteTrigger(db, trigger.ID); err != nil {
+					dialog.ShowError(err, parent)
+				}
+				refresh()
+			})
+			list.Add(container.NewBorder(nil, nil, enabled, container.NewHBox(quiet, remove), label))
+		}
+	}
+	refresh()
+
+	profileSelect := widget.NewSelect(profiles, nil)
+	profileSelect.PlaceHolder = "Choose a profile"
+	assignButton := widget.NewButton("Assign", func() {
+		if profileSelect.Selected == "" {
+			return
+		}
+		if err := saveDisplayTrigger(db, arrangement, profileSelect.Selected); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		refresh()
+	})
+
+	current := widget.NewLabel("Current displays: " + arrangement)
+	current.Wrapping = fyne.TextWrapWord
+
+	// Seconds to wait for the displays to stop changing before restoring
+	settle := getDurationSetting(db, settingDisplaySettle, defaultDisplaySettle)
+	settleEntry := widget.NewEntry()
+	settleEntry.SetText(strconv.FormatFloat(settle.Seconds(), 'f', -1, 64))
+	settleEntry.OnChanged = func(text string) {
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil || seconds < 0 {
+			return
+		}
+		err = setDurationSetting(db, settingDisplaySettle, time.Duration(seconds*float64(time.Second)))
+		if err != nil {
+			log.Printf("Error saving settle delay: %v", err)
+		}
+	}
+
+	scroll := container.NewVScroll(list)
+	scroll.SetMinSize(fyne.NewSize(500, 180))
+
+	confirmCheck := widget.NewCheck("Ask before applying automatically", func(checked bool) {
+		if err := setBoolSetting(db, settingConfirmTriggers, checked); err != nil {
+			dialog.ShowError(err, parent)
+		}
+	})
+	confirmCheck.SetChecked(getBoolSetting(db, settingConfirmTriggers, false))
+
+	content := container.NewVBox(
+		current,
+		container.NewBorder(nil, nil, widget.NewLabel("Apply when connected:"), assignButton, profileSelect),
+		container.NewBorder(nil, nil, widget.NewLabel("Wait for displays to settle (seconds):"), nil, settleEntry),
+		confirmCheck,
+		widget.NewSeparator(),
+		scroll,
+	)
+	dialog.ShowCustom("Auto-Restore on Display Change", "Close", content, parent)
+}
+
+// Lets the user set the hours during which a trigger never fires
+func showQuietHoursDialog(db *sql.DB, trigger Trigger, parent fyne.Window, onSaved func()) {
+	start := widget.NewEntry()
+	start.SetPlaceHolder("21:00")
+	start.SetText(trigger.QuietStart)
+	end := widget.NewEntry()
+	end.SetPlaceHolder("07:00")
+	end.SetText(trigger.QuietEnd)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("From", start),
+		widget.NewFormItem("Until", end),
+	}
+	dialog.ShowForm("Quiet Hours", "Save", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := setTriggerQuietHours(db, trigger.ID, start.Text, end.Text); err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+		onSaved()
+	}, parent)
+}
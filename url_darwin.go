@@ -0,0 +1,87 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo LDFLAGS: -framework Carbon
+#include <Carbon/Carbon.h>
+#include <dispatch/dispatch.h>
+#include <pthread.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+// Opened links are written to a pipe one per line, the Apple Event handler
+// runs on the main thread
+static int wisa_url_pipe[2] = {-1, -1};
+
+static OSErr wisa_get_url(const AppleEvent *event, AppleEvent *reply, SRefCon refcon) {
+	AEDesc desc;
+	if (AEGetParamDesc(event, keyDirectObject, typeUTF8Text, &desc) != noErr) {
+		return noErr;
+	}
+	Size size = AEGetDescDataSize(&desc);
+	char *buf = malloc(size + 1);
+	if (buf != NULL && AEGetDescData(&desc, buf, size) == noErr) {
+		buf[size] = '\n';
+		write(wisa_url_pipe[1], buf, size + 1);
+	}
+	free(buf);
+	AEDisposeDesc(&desc);
+	return noErr;
+}
+
+static void wisa_install_url_handler(void *result) {
+	*(OSErr *)result = AEInstallEventHandler(kInternetEventClass, kAEGetURL, NewAEEventHandlerUPP(wisa_get_url), 0, false);
+}
+
+// Installs the handler for opened links on the main thread and returns the
+// pipe to read them from, or -1 on failure
+static int wisa_listen_for_urls(void) {
+	if (pipe(wisa_url_pipe) != 0) {
+		return -1;
+	}
+	OSErr result = noErr;
+	if (pthread_main_np()) {
+		wisa_install_url_handler(&result);
+	} else {
+		dispatch_sync_f(dispatch_get_main_queue(), &result, wisa_install_url_handler);
+	}
+	if (result != noErr) {
+		return -1;
+	}
+	return wisa_url_pipe[0];
+}
+*/
+import "C"
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"os"
+)
+
+// Calls handle with each wisa:// link macOS opens, including the one that
+// launched the app when it's called before the app runs.
+func listenForURLs(handle func(string)) {
+	fd := int(C.wisa_listen_for_urls())
+	if fd < 0 {
+		log.Printf("Error installing the link handler")
+		return
+	}
+
+	go func() {
+		scanner := bufio.NewScanner(os.NewFile(uintptr(fd), "urls"))
+		for scanner.Scan() {
+			handle(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			log.Printf("Error reading links: %v", err)
+		}
+	}()
+}
+
+// The app bundle claims the scheme in its Info.plist, see build.sh
+func registerURLScheme() error {
+	return errors.New("on macOS wisa:// links are registered by the app bundle, build it with build.sh and open it once")
+}
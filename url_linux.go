@@ -0,0 +1,46 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Desktops pass opened links on the command line
+func listenForURLs(handle func(string)) {}
+
+// Installs a desktop entry that handles wisa:// links and makes it the
+// default handler
+func registerURLScheme() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error finding the wisa executable: %v", err)
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("error getting home directory: %v", err)
+	}
+
+	dir := filepath.Join(homeDir, ".local", "share", "applications")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating applications folder: %v", err)
+	}
+	entry := fmt.Sprintf(`[Desktop Entry]
+Type=Application
+Name=Wisa
+Exec="%s" %%u
+NoDisplay=true
+MimeType=x-scheme-handler/%s;
+`, executable, urlScheme)
+	if err := os.WriteFile(filepath.Join(dir, "wisa-url.desktop"), []byte(entry), 0644); err != nil {
+		return fmt.Errorf("error writing desktop entry: %v", err)
+	}
+
+	output, err := commandCombinedOutput("xdg-mime", "default", "wisa-url.desktop", "x-scheme-handler/"+urlScheme)
+	if err != nil {
+		return fmt.Errorf("error registering wisa:// links: %v: %s", err, output)
+	}
+	return nil
+}
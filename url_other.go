@@ -0,0 +1,11 @@
+//go:build !linux && !windows && !(darwin && cgo)
+
+package main
+
+import "errors"
+
+func listenForURLs(handle func(string)) {}
+
+func registerURLScheme() error {
+	return errors.New("wisa:// links can't be registered on this platform")
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Windows passes opened links on the command line
+func listenForURLs(handle func(string)) {}
+
+// Registers wisa.exe as the handler for wisa:// links for the current user
+func registerURLScheme() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("error finding the wisa executable: %v", err)
+	}
+
+	key := `HKCU\Software\Classes\` + urlScheme
+	commands := [][]string{
+		{"add", key, "/ve", "/d", "URL:" + urlScheme, "/f"},
+		{"add", key, "/v", "URL Protocol", "/d", "", "/f"},
+		{"add", key + `\shell\open\command`, "/ve", "/d", `"` + executable + `" "%1"`, "/f"},
+	}
+	for _, args := range commands {
+		if output, err := commandCombinedOutput("reg", args...); err != nil {
+			return fmt.Errorf("error registering wisa:// links: %v: %s", err, output)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Links like wisa://restore?profile=Work open wisa
+const urlScheme = "wisa"
+
+// Turns a wisa:// link into the command line it stands for, e.g.
+// wisa://restore?profile=Work into restore Work
+func urlCommand(raw string) ([]string, error) {
+	link, err := url.Parse(raw)
+	if err != nil || !strings.EqualFold(link.Scheme, urlScheme) {
+		return nil, fmt.Errorf("invalid wisa link %q", raw)
+	}
+
+	// wisa://restore?… has the action as the host, wisa:restore?… as the path
+	action := link.Host
+	if action == "" {
+		action = link.Opaque
+	}
+	if action == "" {
+		action = strings.Trim(link.Path, "/")
+	}
+
+	profileName := link.Query().Get("profile")
+	if profileName == "" {
+		return nil, fmt.Errorf("wisa link %q doesn't name a profile", raw)
+	}
+
+	switch strings.ToLower(action) {
+	case "restore", "save":
+		return []string{strings.ToLower(action), profileName}, nil
+	default:
+		return nil, fmt.Errorf("unknown action %q in wisa link, use restore or save", action)
+	}
+}
+
+// Says why a link's command needs the user's go-ahead, or returns empty when
+// it can just run. Any web page can open a link, so one that replaces a
+// profile's windows or runs its shell hooks isn't run on its own unless
+// that's turned on in Preferences.
+func linkNeedsConsent(db *sql.DB, command []string) string {
+	profileName := command[1]
+	switch command[0] {
+	case "save":
+		if !getBoolSetting(db, settingLinkSaves, false) {
+			return fmt.Sprintf("A link wants to save the open windows into profile '%s', replacing its saved layout.", profileName)
+		}
+	case "restore":
+		if getBoolSetting(db, settingLinkHooks, false) {
+			return ""
+		}
+		hooks, err := getProfileHooks(db, profileName, "")
+		if err != nil || len(hooks) > 0 {
+			return fmt.Sprintf("A link wants to restore profile '%s', which runs shell commands as hooks.", profileName)
+		}
+	}
+	return ""
+}
+
+// Runs the command of a wisa:// link passed on the command line, as Windows
+// and Linux open them
+func runLink(db *sql.DB, engine *restoreEngine, raw string, stdin io.Reader, stdout, stderr io.Writer) int {
+	command, err := urlCommand(raw)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if reason := linkNeedsConsent(db, command); reason != "" {
+		fmt.Fprintf(stderr, "%s Links can only do this when it's allowed in Preferences.\n", reason)
+		return 1
+	}
+	return runCLI(db, engine, command, stdin, stdout, stderr)
+}
+
+// Checks whether a command line argument is a wisa:// link
+func isWisaURL(arg string) bool {
+	return strings.HasPrefix(strings.ToLower(arg), urlScheme+":")
+}
+
+func runURLCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 1 || args[0] != "register" {
+		fmt.Fprint(stderr, cliUsage)
+		return 2
+	}
+	if err := registerURLScheme(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s:// links now open wisa\n", urlScheme)
+	return 0
+}
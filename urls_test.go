@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestURLCommand(t *testing.T) {
+	tests := []struct {
+		link    string
+		want    []string
+		wantErr bool
+	}{
+		{link: "wisa://restore?profile=Work", want: []string{"restore", "Work"}},
+		{link: "wisa://save?profile=Work", want: []string{"save", "Work"}},
+		{link: "WISA://Restore?profile=Work", want: []string{"restore", "Work"}},
+		{link: "wisa:restore?profile=Work", want: []string{"restore", "Work"}},
+		{link: "wisa:///restore/?profile=Work", want: []string{"restore", "Work"}},
+		{link: "wisa://restore?profile=Deep%20Work%20%26%20Mail", want: []string{"restore", "Deep Work & Mail"}},
+		{link: "wisa://restore", wantErr: true},
+		{link: "wisa://restore?profile=", wantErr: true},
+		{link: "wisa://delete?profile=Work", wantErr: true},
+		{link: "https://restore?profile=Work", wantErr: true},
+		{link: "wisa://restore?profile=%zz", wantErr: true},
+	}
+	for _, test := range tests {
+		got, err := urlCommand(test.link)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("urlCommand(%q) = %q, want an error", test.link, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("urlCommand(%q) returned %v", test.link, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("urlCommand(%q) = %q, want %q", test.link, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+)
+
+var (
+	usernameOnce sync.Once
+	username     string
+)
+
+// Gets the name of the user running wisa. Profiles are owned by the user who
+// created them so several users can share one database.
+func currentUsername() string {
+	usernameOnce.Do(func() {
+		if current, err := user.Current(); err == nil {
+			username = current.Username
+		} else {
+			username = os.Getenv("USER")
+		}
+	})
+	return username
+}
+
+// Selects the ids of the profiles the current user can change, taking their
+// username as the argument
+const ownProfileIDs = "SELECT id FROM profiles WHERE owner = '' OR owner = ?"
+
+// Returns an error if the profile belongs to another user. Profiles from
+// before ownership was tracked have no owner and anyone can change them.
+func checkProfileOwner(db *sql.DB, profileName string) error {
+	var owner string
+	var shared bool
+	err := db.QueryRow("SELECT owner, shared FROM profiles WHERE name = ?", profileName).Scan(&owner, &shared)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error finding profile: %v", err)
+	}
+	if owner != "" && owner != currentUsername() {
+		if !shared {
+			return fmt.Errorf("the name '%s' is taken, pick another one", profileName)
+		}
+		return fmt.Errorf("profile '%s' belongs to %s", profileName, owner)
+	}
+	return nil
+}
+
+// Gets whether a profile is visible to other users
+func getProfileShared(db *sql.DB, profileName string) (bool, error) {
+	var shared bool
+	err := db.QueryRow("SELECT shared FROM profiles WHERE name = ?", profileName).Scan(&shared)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error reading profile: %v", err)
+	}
+	return shared, nil
+}
+
+// Shares a profile with the other users of the database, who can restore it
+// but not change it
+func setProfileShared(db *sql.DB, profileName string, shared bool) error {
+	if err := checkProfileOwner(db, profileName); err != nil {
+		return err
+	}
+	_, err := db.Exec("UPDATE profiles SET shared = ? WHERE name = ?", shared, profileName)
+	if err != nil {
+		return fmt.Errorf("error updating profile: %v", err)
+	}
+	return nil
+}